@@ -0,0 +1,76 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Additional section processing: the address records of the names in NS,
+// MX, SRV and AFSDB records.
+
+import (
+	"strings"
+)
+
+// AdditionalNames returns the names whose address records are needed with
+// the NS, MX, SRV and AFSDB records in rrs, in the order in which they
+// first appear. Each name is returned once. The target "." of an SRV
+// record, which says the service is not available, is left out.
+func AdditionalNames(rrs []RR) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, r := range rrs {
+		n := additionalName(r)
+		if n == "" || n == "." {
+			continue
+		}
+		k := strings.ToLower(Fqdn(n))
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		names = append(names, n)
+	}
+	return names
+}
+
+func additionalName(r RR) string {
+	switch x := r.(type) {
+	case *RR_NS:
+		return x.Ns
+	case *RR_MX:
+		return x.Mx
+	case *RR_SRV:
+		return x.Target
+	case *RR_AFSDB:
+		return x.Hostname
+	}
+	return ""
+}
+
+// Additional does the additional section processing for the answer and
+// authority sections of msg, see RFC 1035 section 3.3. For the names
+// returned by AdditionalNames the A and AAAA records in the additional
+// section of msg are returned in addrs. For each name that has neither
+// there, queries holds a query for its A and one for its AAAA records.
+func Additional(msg *Msg) (addrs []RR, queries []*Msg) {
+	for _, n := range AdditionalNames(append(append([]RR{}, msg.Answer...), msg.Ns...)) {
+		k := strings.ToLower(Fqdn(n))
+		found := false
+		for _, r := range msg.Extra {
+			h := r.Header()
+			if (h.Rrtype == TypeA || h.Rrtype == TypeAAAA) && strings.ToLower(Fqdn(h.Name)) == k {
+				addrs = append(addrs, r)
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		for _, t := range []uint16{TypeA, TypeAAAA} {
+			q := new(Msg)
+			q.SetQuestion(Fqdn(n), t)
+			queries = append(queries, q)
+		}
+	}
+	return addrs, queries
+}
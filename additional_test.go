@@ -0,0 +1,65 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestAdditional(t *testing.T) {
+	hdr := func(name string, t uint16) RR_Header {
+		return RR_Header{Name: name, Rrtype: t, Class: ClassINET, Ttl: 300}
+	}
+	afsdb, err := NewRR("miek.nl. 3600 IN AFSDB 1 afs.miek.nl.")
+	if err != nil || afsdb.String() != "miek.nl.\t3600\tIN\tAFSDB\t1 afs.miek.nl." {
+		t.Logf("AFSDB should parse, got %v %v", err, afsdb)
+		t.Fail()
+		return
+	}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeANY)
+	m.Answer = []RR{
+		&RR_MX{Hdr: hdr("miek.nl.", TypeMX), Pref: 10, Mx: "mx.miek.nl."},
+		&RR_MX{Hdr: hdr("miek.nl.", TypeMX), Pref: 20, Mx: "MX.miek.nl."},
+		&RR_SRV{Hdr: hdr("_xmpp._tcp.miek.nl.", TypeSRV), Target: "."},
+		&RR_SRV{Hdr: hdr("_sip._udp.miek.nl.", TypeSRV), Port: 5060, Target: "sip.miek.nl."},
+		afsdb,
+		&RR_A{Hdr: hdr("miek.nl.", TypeA), A: net.IPv4(192, 0, 2, 1)},
+	}
+	m.Ns = []RR{&RR_NS{Hdr: hdr("miek.nl.", TypeNS), Ns: "ns.miek.nl."}}
+	m.Extra = []RR{
+		&RR_A{Hdr: hdr("mx.miek.nl.", TypeA), A: net.IPv4(192, 0, 2, 2)},
+		&RR_AAAA{Hdr: hdr("mx.miek.nl.", TypeAAAA), AAAA: net.ParseIP("2001:db8::2")},
+		&RR_AAAA{Hdr: hdr("ns.miek.nl.", TypeAAAA), AAAA: net.ParseIP("2001:db8::3")},
+		&RR_A{Hdr: hdr("www.miek.nl.", TypeA), A: net.IPv4(192, 0, 2, 4)},
+	}
+	buf, _ := m.Pack()
+	if err := m.Unpack(buf); err != nil {
+		t.Logf("Failed to round trip: %s", err)
+		t.Fail()
+		return
+	}
+
+	names := AdditionalNames(m.Answer)
+	if len(names) != 3 || names[0] != "mx.miek.nl." || names[1] != "sip.miek.nl." || names[2] != "afs.miek.nl." {
+		t.Logf("Wrong additional names: %v", names)
+		t.Fail()
+	}
+	addrs, queries := Additional(m)
+	if len(addrs) != 3 || addrs[0] != m.Extra[0] || addrs[1] != m.Extra[1] || addrs[2] != m.Extra[2] {
+		t.Logf("Wrong addresses: %v", addrs)
+		t.Fail()
+	}
+	want := []Question{{"sip.miek.nl.", TypeA, ClassINET}, {"sip.miek.nl.", TypeAAAA, ClassINET},
+		{"afs.miek.nl.", TypeA, ClassINET}, {"afs.miek.nl.", TypeAAAA, ClassINET}}
+	if len(queries) != len(want) {
+		t.Logf("Expected %d queries, got %d", len(want), len(queries))
+		t.Fail()
+		return
+	}
+	for i, q := range queries {
+		if len(q.Question) != 1 || q.Question[0] != want[i] {
+			t.Logf("Query %d: expected %v, got %v", i, want[i], q.Question)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Exponential backoff for retry loops.
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff holds the delays of a retry loop: the first retry waits
+// Initial, each next one Factor times longer, up to Max. With Jitter the
+// delays are randomized, so clients that fail at the same time do not
+// retry at the same time: a Jitter of 0.2 spreads a delay over plus and
+// minus 20%.
+//
+// A Backoff holds no state, it can be shared. A nil *Backoff does not
+// wait.
+type Backoff struct {
+	Initial time.Duration // the first delay, 100 ms if zero
+	Max     time.Duration // the largest delay, 10 s if zero
+	Factor  float64       // the growth of the delay, 2 if zero
+	Jitter  float64       // the randomization of the delay, between 0 and 1
+}
+
+// Delay returns the delay before retry n, counting from zero.
+func (b *Backoff) Delay(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+	d, max, factor := b.Initial, b.Max, b.Factor
+	if d <= 0 {
+		d = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	if factor <= 0 {
+		factor = 2
+	}
+	f := float64(d)
+	for i := 0; i < n && f < float64(max); i++ {
+		f *= factor
+	}
+	if f > float64(max) {
+		f = float64(max)
+	}
+	if b.Jitter > 0 {
+		f += f * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(f)
+}
+
+// Retry calls f until it returns nil, at most attempts times, and waits
+// between the calls. It returns the last error of f.
+func (b *Backoff) Retry(attempts int, f func() error) (err error) {
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(b.Delay(i - 1))
+		}
+		if err = f(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
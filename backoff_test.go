@@ -0,0 +1,46 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{Initial: time.Second, Max: 5 * time.Second}
+	for n, d := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if b.Delay(n) != d {
+			t.Logf("Delay %d should be %s, not %s", n, d, b.Delay(n))
+			t.Fail()
+		}
+	}
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(1); d < time.Second || d > 3*time.Second {
+			t.Logf("Delay with jitter out of range: %s", d)
+			t.Fail()
+		}
+	}
+	var nb *Backoff
+	if nb.Delay(3) != 0 {
+		t.Log("A nil Backoff should not wait")
+		t.Fail()
+	}
+
+	calls := 0
+	b = &Backoff{Initial: time.Millisecond}
+	err := b.Retry(3, func() error {
+		if calls++; calls < 3 {
+			return errors.New("fail")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Logf("Retry should succeed on the third call, got %v after %d", err, calls)
+		t.Fail()
+	}
+	if err = b.Retry(2, func() error { return ErrServ }); err != ErrServ {
+		t.Logf("Retry should return the last error, got %v", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Sending many queries to a single server. Over TCP the queries are
+// pipelined on one connection, over UDP they are spread over a number of
+// sockets.
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ExchangeBatch sends the messages in ms to the server at address a and
+// returns the results on a channel, see ExchangeStream.
+func (c *Client) ExchangeBatch(ms []*Msg, a string) <-chan *Exchange {
+	in := make(chan *Msg)
+	go func() {
+		for _, m := range ms {
+			in <- m
+		}
+		close(in)
+	}()
+	return c.ExchangeStream(in, a)
+}
+
+// ExchangeStream sends the messages read from in to the server at address
+// a, until in is closed. For each message an *Exchange with the reply or
+// the error is returned on the channel, in the order the replies come in.
+// The channel is closed after the last reply. At most c.Inflight queries
+// are outstanding at any time.
+//
+// If c.Net is "tcp" the queries are pipelined over a single connection
+// (RFC 5966), the Id of a message is changed when another outstanding
+// query has the same Id. When the connection fails the outstanding
+// queries fail and a new connection is set up for the next ones.
+// Otherwise the queries are sent from c.Inflight UDP sockets, each socket
+// having a single outstanding query. Messages with a TSIG record are not
+// signed.
+func (c *Client) ExchangeStream(in <-chan *Msg, a string) <-chan *Exchange {
+	out := make(chan *Exchange, c.inflight())
+	var wg sync.WaitGroup
+	switch c.Net {
+	case "tcp", "tcp4", "tcp6":
+		wg.Add(1)
+		go func() {
+			c.streamTCP(in, a, out)
+			wg.Done()
+		}()
+	default:
+		for i := 0; i < c.inflight(); i++ {
+			wg.Add(1)
+			go func() {
+				c.streamUDP(in, a, out)
+				wg.Done()
+			}()
+		}
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+func (c *Client) inflight() int {
+	if c.Inflight <= 0 {
+		return 64
+	}
+	return c.Inflight
+}
+
+func (c *Client) attempts() int {
+	if c.Attempts <= 0 {
+		return 1
+	}
+	return c.Attempts
+}
+
+// streamUDP sends the messages from in over a single UDP socket.
+func (c *Client) streamUDP(in <-chan *Msg, a string, out chan<- *Exchange) {
+	var conn net.Conn
+	buf := make([]byte, DefaultMsgSize)
+	for m := range in {
+		if conn == nil {
+			var err error
+			if conn, err = net.Dial(c.Net, a); err != nil {
+				out <- &Exchange{Request: m, Error: err}
+				continue
+			}
+		}
+		r, err := c.exchangeUDP(conn, m, buf)
+		out <- &Exchange{Request: m, Reply: r, Error: err}
+	}
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// exchangeUDP sends m over conn and waits for the reply. Messages with
+// another Id, late replies to earlier queries, are ignored.
+func (c *Client) exchangeUDP(conn net.Conn, m *Msg, buf []byte) (*Msg, error) {
+	q, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	for a := 0; a < c.attempts(); a++ {
+		if a > 0 {
+			time.Sleep(c.Backoff.Delay(a - 1))
+		}
+		conn.SetWriteDeadline(deadline(c.WriteTimeout))
+		if _, err = conn.Write(q); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(deadline(c.ReadTimeout))
+		for {
+			var n int
+			if n, err = conn.Read(buf); err != nil {
+				break
+			}
+			r := new(Msg)
+			if r.Unpack(buf[:n]) == nil && r.Id == m.Id {
+				return r, nil
+			}
+		}
+		if e, ok := err.(net.Error); !ok || !e.Timeout() {
+			break
+		}
+	}
+	return nil, err
+}
+
+// streamTCP pipelines the messages from in over a TCP connection, which
+// is set up again when it fails.
+func (c *Client) streamTCP(in <-chan *Msg, a string, out chan<- *Exchange) {
+	for m := range in {
+		conn, err := net.Dial(c.Net, a)
+		if err != nil {
+			out <- &Exchange{Request: m, Error: err}
+			continue
+		}
+		c.pipeline(conn, m, in, out)
+	}
+}
+
+// pipeline sends m and the messages from in over conn, while the replies
+// are read in another goroutine. It returns when all messages are
+// answered or when the connection fails, conn is closed then.
+func (c *Client) pipeline(conn net.Conn, m *Msg, in <-chan *Msg, out chan<- *Exchange) {
+	var (
+		mu      sync.Mutex
+		pending = make(map[uint16]*Msg)
+		slots   = make(chan bool, c.inflight())
+		done    = make(chan error, 1)
+		exited  = make(chan bool)
+	)
+	defer func() {
+		conn.Close()
+		<-exited
+	}()
+	// fail fails the outstanding queries and m.
+	fail := func(m *Msg, err error) {
+		mu.Lock()
+		for id, q := range pending {
+			out <- &Exchange{Request: q, Error: err}
+			delete(pending, id)
+		}
+		mu.Unlock()
+		if m != nil {
+			out <- &Exchange{Request: m, Error: err}
+		}
+	}
+	go func() {
+		defer close(exited)
+		for {
+			conn.SetReadDeadline(deadline(c.ReadTimeout))
+			r, err := ReadMsgTCP(conn)
+			if err != nil {
+				mu.Lock()
+				idle := len(pending) == 0
+				mu.Unlock()
+				if e, ok := err.(net.Error); ok && e.Timeout() && idle {
+					continue
+				}
+				done <- err
+				return
+			}
+			mu.Lock()
+			q, ok := pending[r.Id]
+			delete(pending, r.Id)
+			mu.Unlock()
+			if ok {
+				out <- &Exchange{Request: q, Reply: r}
+				<-slots
+			}
+		}
+	}()
+	for m != nil {
+		select {
+		case slots <- true:
+		case err := <-done:
+			fail(m, err)
+			return
+		}
+		mu.Lock()
+		for pending[m.Id] != nil {
+			m.Id = Id()
+		}
+		pending[m.Id] = m
+		mu.Unlock()
+		conn.SetWriteDeadline(deadline(c.WriteTimeout))
+		if err := WriteMsgTCP(conn, m); err != nil {
+			fail(nil, err)
+			return
+		}
+		m = <-in
+	}
+	// Wait for the outstanding replies
+	for i := 0; i < cap(slots); i++ {
+		select {
+		case slots <- true:
+		case err := <-done:
+			fail(nil, err)
+			return
+		}
+	}
+}
+
+// deadline returns the deadline for an I/O operation that may take d, for
+// a zero d there is no deadline.
+func deadline(d time.Duration) time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func batchMsgs(n int) []*Msg {
+	ms := make([]*Msg, n)
+	for i := range ms {
+		ms[i] = new(Msg)
+		ms[i].SetQuestion(strconv.Itoa(i)+".miek.nl.", TypeTXT)
+		ms[i].Id = 1 // Ids must be made unique over TCP
+	}
+	return ms
+}
+
+func checkBatch(t *testing.T, ms []*Msg, c <-chan *Exchange) {
+	seen := make(map[*Msg]bool)
+	for e := range c {
+		if e.Error != nil {
+			t.Logf("Exchange failed: %s", e.Error)
+			t.Fail()
+			continue
+		}
+		if e.Reply.Question[0].Name != e.Request.Question[0].Name {
+			t.Logf("Reply %s does not match request %s", e.Reply.Question[0].Name, e.Request.Question[0].Name)
+			t.Fail()
+		}
+		seen[e.Request] = true
+	}
+	if len(seen) != len(ms) {
+		t.Logf("Expected %d replies, got %d", len(ms), len(seen))
+		t.Fail()
+	}
+}
+
+func TestExchangeBatchUDP(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	srv := &Server{Handler: HandlerFunc(HelloServer)}
+	go srv.ServeUDP(l)
+
+	c := NewClient()
+	c.Inflight = 8
+	ms := batchMsgs(200)
+	for _, m := range ms {
+		m.Id = Id()
+	}
+	checkBatch(t, ms, c.ExchangeBatch(ms, l.LocalAddr().String()))
+}
+
+// pipelineServer answers the queries on a TCP connection in a random order.
+func pipelineServer(conn net.Conn) {
+	var mu sync.Mutex
+	for {
+		l := make([]byte, 2)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			break
+		}
+		n, _ := unpackUint16(l, 0)
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			break
+		}
+		go func() {
+			r := new(Msg)
+			r.Unpack(buf)
+			m := new(Msg)
+			m.SetReply(r)
+			out, _ := m.Pack()
+			time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+			mu.Lock()
+			a, b := packUint16(uint16(len(out)))
+			conn.Write(append([]byte{a, b}, out...))
+			mu.Unlock()
+		}()
+	}
+	conn.Close()
+}
+
+func TestExchangeBatchTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	defer l.Close()
+	conns := 0
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns++
+			go pipelineServer(conn)
+		}
+	}()
+
+	c := NewClient()
+	c.Net = "tcp"
+	c.Inflight = 16
+	ms := batchMsgs(500)
+	checkBatch(t, ms, c.ExchangeBatch(ms, l.Addr().String()))
+	if conns != 1 {
+		t.Logf("All queries should use one connection, used %d", conns)
+		t.Fail()
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Blocking queries for unwanted domains, such as ad and tracking domains.
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Blocklist holds the domains for which queries are blocked, and the
+// domains that are allowed even when they are in a blocked domain. An
+// entry matches the domain itself and all names below it; an entry that
+// starts with "*." only matches the names below the domain.
+//
+// The zero value is an empty list. A Blocklist is safe for concurrent use.
+type Blocklist struct {
+	// Zero makes BlocklistHandler answer A and AAAA queries for blocked
+	// names with 0.0.0.0 and ::, instead of NXDOMAIN.
+	Zero bool
+
+	mu      sync.RWMutex
+	block   map[string]bool // lowercased names
+	allow   map[string]bool
+	blocked uint64 // the number of blocked queries, updated atomically
+}
+
+// Block adds name to the blocked domains.
+func (b *Blocklist) Block(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.block == nil {
+		b.block = make(map[string]bool)
+	}
+	b.block[strings.ToLower(Fqdn(name))] = true
+}
+
+// Allow adds name to the allowed domains.
+func (b *Blocklist) Allow(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.allow == nil {
+		b.allow = make(map[string]bool)
+	}
+	b.allow[strings.ToLower(Fqdn(name))] = true
+}
+
+// ReadBlock adds the domains read from r to the blocked domains. Each line
+// holds a domain, or an address followed by domains as in a hosts(5) file;
+// a '#' starts a comment.
+func (b *Blocklist) ReadBlock(r io.Reader) error {
+	return readDomains(r, b.Block)
+}
+
+// ReadAllow adds the domains read from r to the allowed domains, see
+// ReadBlock.
+func (b *Blocklist) ReadAllow(r io.Reader) error {
+	return readDomains(r, b.Allow)
+}
+
+func readDomains(r io.Reader, add func(string)) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, f := range strings.Fields(line) {
+			// Skip the addresses of hosts files
+			if net.ParseIP(f) == nil {
+				add(f)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Blocked returns true when queries for name are blocked.
+func (b *Blocklist) Blocked(name string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	name = strings.ToLower(Fqdn(name))
+	return matchDomain(b.block, name) && !matchDomain(b.allow, name)
+}
+
+// matchDomain returns true when name or one of its parents is in list.
+func matchDomain(list map[string]bool, name string) bool {
+	if len(list) == 0 {
+		return false
+	}
+	labels := SplitLabels(name)
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".") + "."
+		if list[suffix] || i > 0 && list["*."+suffix] {
+			return true
+		}
+	}
+	return list["."]
+}
+
+// Count returns the number of queries blocked by BlocklistHandler.
+func (b *Blocklist) Count() uint64 {
+	return atomic.LoadUint64(&b.blocked)
+}
+
+// BlocklistHandler returns a handler that answers the queries for the
+// names blocked by b itself, with NXDOMAIN or with the zero address, and
+// passes the other queries on to next.
+func BlocklistHandler(b *Blocklist, next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		if len(r.Question) != 1 || !b.Blocked(r.Question[0].Name) {
+			next.ServeDNS(w, r)
+			return
+		}
+		atomic.AddUint64(&b.blocked, 1)
+		m := new(Msg)
+		m.SetReply(r)
+		m.Authoritative = false
+		m.RecursionAvailable = true
+		q := r.Question[0]
+		hdr := RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: ClassINET}
+		switch {
+		case !b.Zero:
+			m.Rcode = RcodeNameError
+		case q.Qtype == TypeA:
+			m.Answer = append(m.Answer, &RR_A{Hdr: hdr, A: net.IPv4zero})
+		case q.Qtype == TypeAAAA:
+			m.Answer = append(m.Answer, &RR_AAAA{Hdr: hdr, AAAA: net.IPv6zero})
+		}
+		if buf, err := m.Pack(); err == nil {
+			w.Write(buf)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestBlocklist(t *testing.T) {
+	b := new(Blocklist)
+	err := b.ReadBlock(strings.NewReader(`# ads
+0.0.0.0 ads.example.com tracker.example.net
+*.example.org
+doubleclick.NET # trailing comment
+`))
+	if err != nil {
+		t.Logf("Failed to read the blocklist: %s", err)
+		t.Fail()
+	}
+	b.Allow("good.ads.example.com")
+	tests := map[string]bool{
+		"ads.example.com.":        true,
+		"x.ads.example.com":       true,
+		"good.ads.example.com.":   false,
+		"a.good.ads.example.com.": false,
+		"example.com.":            false,
+		"example.org.":            false,
+		"www.example.org.":        true,
+		"ad.doubleclick.net.":     true,
+		"0.0.0.0.":                false,
+	}
+	for name, blocked := range tests {
+		if b.Blocked(name) != blocked {
+			t.Logf("%s should be blocked: %t", name, blocked)
+			t.Fail()
+		}
+	}
+
+	next := HandlerFunc(func(w ResponseWriter, r *Msg) {
+		m := new(Msg)
+		m.SetReply(r)
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})
+	h := BlocklistHandler(b, next)
+	for _, zero := range []bool{false, true} {
+		b.Zero = zero
+		w := new(bufferWriter)
+		q := new(Msg)
+		q.SetQuestion("ads.example.com.", TypeA)
+		h.ServeDNS(w, q)
+		q.SetQuestion("example.com.", TypeA)
+		h.ServeDNS(w, q)
+		r, ok := new(Msg), len(w.msgs) == 2
+		if ok {
+			ok = r.Unpack(w.msgs[0]) == nil
+		}
+		switch {
+		case !ok:
+		case zero:
+			ok = r.Rcode == RcodeSuccess && len(r.Answer) == 1 && r.Answer[0].(*RR_A).A.Equal(net.IPv4zero)
+		default:
+			ok = r.Rcode == RcodeNameError && len(r.Answer) == 0
+		}
+		if ok {
+			r2 := new(Msg)
+			ok = r2.Unpack(w.msgs[1]) == nil && r2.Rcode == RcodeSuccess
+		}
+		if !ok {
+			t.Logf("Wrong answers with Zero %t: %v", zero, r)
+			t.Fail()
+		}
+	}
+	if b.Count() != 2 {
+		t.Logf("Expected 2 blocked queries, got %d", b.Count())
+		t.Fail()
+	}
+}
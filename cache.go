@@ -0,0 +1,591 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// A caching forwarder, that serves stale answers when the upstream server
+// fails (RFC 8767).
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staleRecheck is how long stale answers are served without asking the
+// upstream server again after it failed, the failure recheck timer of RFC
+// 8767. The cache is refreshed in the background meanwhile.
+const staleRecheck = 30 * time.Second
+
+// defaultCacheEntries is the maximum number of entries of a Cache without
+// MaxEntries.
+const defaultCacheEntries = 10000
+
+// A Cache forwards queries to Server and answers them from the responses
+// it got before, for as long as their TTL allows. Only NOERROR and
+// NXDOMAIN responses are cached.
+//
+// With MaxStale set, a Cache serves expired responses when Server fails
+// or answers SERVFAIL, up to MaxStale after they expired (RFC 8767). Such
+// stale answers carry an extended DNS error "Stale Answer" (RFC 8914) when
+// the query has an OPT RR. Once Server failed, stale answers are served at
+// once for 30 seconds, and the entry is refreshed in the background.
+//
+// Queries with and without the DO bit, and with and without the CD bit,
+// are cached apart, so a client that asks for DNSSEC records gets them and
+// one that does not is not given them.
+//
+// Responses with an edns-client-subnet option (RFC 7871) that has a
+// scope prefix length are only used for clients in that scope: the
+// answers a forwarder gets for one client subnet are not given to clients
+// elsewhere.
+//
+// With Prefetch set, an entry that is hit when it has less than Prefetch
+// seconds to live is refreshed in the background, so names that are asked
+// for often stay in the cache.
+//
+// A Cache holds at most MaxEntries responses, counting the responses for
+// each client subnet. Responses that are too old to be served, even as
+// stale answers, are removed when their name is asked for again and when
+// the cache is full. When that does not make room, a tenth of the entries
+// is evicted.
+//
+// The entries of a Cache can be saved with Snapshot and loaded with
+// Restore, so a restarted forwarder does not start with an empty cache.
+//
+// A Cache is safe for concurrent use, it can be used as a Handler.
+type Cache struct {
+	Client   *Client       // the client for the queries, NewClient() if nil
+	Server   string        // the address (host:port) of the upstream server
+	MaxStale time.Duration // how long after expiry a response may be served, not at all if zero
+	StaleTtl uint32        // the TTL of stale answers, 30 if zero
+	Prefetch uint32        // the TTL below which a hit entry is refreshed, never if zero
+
+	// MaxEntries is the maximum number of cached responses, 10000 if zero.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[cacheKey][]*cacheEntry // one for each scope
+	size    int                        // the number of entries
+	stats   CacheStats
+	now     func() time.Time // time.Now if nil, for testing
+}
+
+// CacheStats holds the counters of a Cache.
+type CacheStats struct {
+	Hits       uint64 // queries answered from the cache without asking the upstream server
+	Misses     uint64 // queries sent to the upstream server
+	Stale      uint64 // stale answers, with or without asking the upstream server
+	Prefetches uint64 // refreshes started by Prefetch
+	Evictions  uint64 // entries removed to make room before they were too old
+}
+
+// Stats returns the counters of c.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+type cacheKey struct {
+	name          string // lowercased
+	qtype, qclass uint16
+	do, cd        bool // the DO bit and the CD bit of the query
+}
+
+type cacheEntry struct {
+	msg        []byte    // the packed response, without OPT RR
+	stored     time.Time // when msg was stored
+	expire     time.Time
+	failed     time.Time  // when the upstream server failed last
+	refreshing bool       // a background refresh is running
+	scope      *net.IPNet // the clients msg is for, all if nil
+	ecs        *Option    // the client subnet option of the query, for a refresh
+}
+
+// Exchange answers the query m, from the cache or from Server.
+func (c *Cache) Exchange(m *Msg) (*Msg, error) {
+	if len(m.Question) != 1 {
+		return c.client().Exchange(m, c.Server)
+	}
+	q := m.Question[0]
+	o := requestOpt(m)
+	k := cacheKey{strings.ToLower(q.Name), q.Qtype, q.Qclass, o != nil && o.Do(), m.CheckingDisabled}
+	now := c.time()
+	client, ecs := querySubnet(m)
+
+	c.mu.Lock()
+	c.expire(k, now)
+	e := c.lookup(k, client)
+	stale := e != nil && now.Before(e.expire.Add(c.MaxStale))
+	switch {
+	case e != nil && now.Before(e.expire):
+		c.stats.Hits++
+		if e.expire.Sub(now) < time.Duration(c.Prefetch)*time.Second && !e.refreshing {
+			c.stats.Prefetches++
+			c.refresh(k, e)
+		}
+		c.mu.Unlock()
+		return e.reply(m, now, 0)
+	case stale && now.Sub(e.failed) < staleRecheck:
+		c.stats.Hits++
+		c.stats.Stale++
+		c.refresh(k, e)
+		c.mu.Unlock()
+		return e.reply(m, now, c.staleTtl())
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	r, err := c.client().Exchange(m, c.Server)
+	if err == nil && r.Rcode != RcodeServerFailure {
+		c.store(k, r, now, ecs)
+		return r, nil
+	}
+	if stale {
+		c.mu.Lock()
+		e.failed = now
+		c.stats.Stale++
+		c.mu.Unlock()
+		return e.reply(m, now, c.staleTtl())
+	}
+	return r, err
+}
+
+// ServeDNS answers r with Exchange, with SERVFAIL when that fails.
+func (c *Cache) ServeDNS(w ResponseWriter, r *Msg) {
+	m, err := c.Exchange(r)
+	if err != nil {
+		m = new(Msg)
+		m.SetRcode(r, RcodeServerFailure)
+	}
+	if buf, err := m.Pack(); err == nil {
+		w.Write(buf)
+	}
+}
+
+// refresh asks Server for the entry e of k in the background, unless that
+// is under way already. c.mu must be held.
+func (c *Cache) refresh(k cacheKey, e *cacheEntry) {
+	if e.refreshing {
+		return
+	}
+	e.refreshing = true
+	go func() {
+		m := new(Msg)
+		m.SetQuestion(k.name, k.qtype)
+		m.Question[0].Qclass = k.qclass
+		m.CheckingDisabled = k.cd
+		if k.do || e.ecs != nil {
+			m.SetEdns0(DefaultMsgSize, k.do)
+		}
+		if e.ecs != nil {
+			o := m.Extra[0].(*RR_OPT)
+			o.Option = append(o.Option, *e.ecs)
+		}
+		r, err := c.client().Exchange(m, c.Server)
+		now := c.time()
+		if err == nil && r.Rcode != RcodeServerFailure {
+			c.store(k, r, now, e.ecs)
+		}
+		c.mu.Lock()
+		e.refreshing = false
+		if err != nil || r.Rcode == RcodeServerFailure {
+			e.failed = now
+		}
+		c.mu.Unlock()
+	}()
+}
+
+// lookup returns the entry of k for client, the one with the longest
+// scope that holds client. c.mu must be held.
+func (c *Cache) lookup(k cacheKey, client *net.IPNet) *cacheEntry {
+	var e *cacheEntry
+	for _, f := range c.entries[k] {
+		switch {
+		case f.scope == nil:
+			if e == nil {
+				e = f
+			}
+		case client != nil && len(client.IP) == len(f.scope.IP) && f.scope.Contains(client.IP):
+			if e == nil || e.scope == nil || scopeLen(f.scope) > scopeLen(e.scope) {
+				e = f
+			}
+		}
+	}
+	return e
+}
+
+// store caches r, the response to a query with client subnet option ecs,
+// for the lowest TTL of its RRs.
+func (c *Cache) store(k cacheKey, r *Msg, now time.Time, ecs *Option) {
+	if r.Truncated || r.Rcode != RcodeSuccess && r.Rcode != RcodeNameError {
+		return
+	}
+	s := *r
+	s.Extra = nil
+	for _, rr := range r.Extra {
+		if rr.Header().Rrtype != TypeOPT {
+			s.Extra = append(s.Extra, rr)
+		}
+	}
+	// The SOA in the authority section of a NXDOMAIN or NODATA response
+	// is cached for the negative TTL, RFC 2308
+	negative := r.Rcode == RcodeNameError || len(r.Answer) == 0
+	ttl, ok := uint32(0), false
+	for i, sec := range [][]RR{s.Answer, s.Ns, s.Extra} {
+		for _, rr := range sec {
+			t := rr.Header().Ttl
+			if soa, isSoa := rr.(*RR_SOA); isSoa && negative && i == 1 {
+				t = soa.NegativeTTL()
+			}
+			if !ok || t < ttl {
+				ttl, ok = t, true
+			}
+		}
+	}
+	if !ok || ttl == 0 {
+		return
+	}
+	buf, err := s.Pack()
+	if err != nil {
+		return
+	}
+	e := &cacheEntry{msg: buf, stored: now, expire: now.Add(time.Duration(ttl) * time.Second), ecs: ecs}
+	if ecs != nil {
+		e.scope = responseScope(r)
+	}
+	c.mu.Lock()
+	c.add(k, e, now)
+	c.mu.Unlock()
+}
+
+// add adds the entry e to k, it replaces the entry with the same scope.
+// c.mu must be held.
+func (c *Cache) add(k cacheKey, e *cacheEntry, now time.Time) {
+	if c.entries == nil {
+		c.entries = make(map[cacheKey][]*cacheEntry)
+	}
+	for i, f := range c.entries[k] {
+		if f.scope.String() == e.scope.String() {
+			c.entries[k][i] = e
+			return
+		}
+	}
+	if c.size >= c.maxEntries() {
+		c.makeRoom(now)
+	}
+	c.entries[k] = append(c.entries[k], e)
+	c.size++
+}
+
+// expire removes the entries of k that are too old to be served, even as
+// stale answers. c.mu must be held.
+func (c *Cache) expire(k cacheKey, now time.Time) {
+	es, ok := c.entries[k]
+	if !ok {
+		return
+	}
+	live := es[:0]
+	for _, e := range es {
+		if now.Before(e.expire.Add(c.MaxStale)) {
+			live = append(live, e)
+		}
+	}
+	for i := len(live); i < len(es); i++ {
+		es[i] = nil
+	}
+	c.size -= len(es) - len(live)
+	if len(live) == 0 {
+		delete(c.entries, k)
+		return
+	}
+	c.entries[k] = live
+}
+
+// makeRoom removes the entries that are too old to be served and, when
+// that leaves the cache more than nine tenths full, evicts arbitrary
+// entries until it is not. c.mu must be held.
+func (c *Cache) makeRoom(now time.Time) {
+	for k := range c.entries {
+		c.expire(k, now)
+	}
+	max := c.maxEntries()
+	for k, es := range c.entries {
+		if c.size < max-max/10 {
+			break
+		}
+		delete(c.entries, k)
+		c.size -= len(es)
+		c.stats.Evictions += uint64(len(es))
+	}
+}
+
+// querySubnet returns the network and the edns-client-subnet option of
+// the query m, nil when it has none.
+func querySubnet(m *Msg) (*net.IPNet, *Option) {
+	o := requestOpt(m)
+	if o == nil {
+		return nil, nil
+	}
+	n, ok := o.ClientSubnet()
+	if !ok {
+		return nil, nil
+	}
+	for i := range o.Option {
+		if o.Option[i].Code == OptionCodeSubnet {
+			ecs := o.Option[i]
+			return n, &ecs
+		}
+	}
+	return nil, nil
+}
+
+// responseScope returns the scope of the edns-client-subnet option in r,
+// nil when the scope is everyone.
+func responseScope(r *Msg) *net.IPNet {
+	o := requestOpt(r)
+	if o == nil {
+		return nil
+	}
+	for _, op := range o.Option {
+		if op.Code != OptionCodeSubnet {
+			continue
+		}
+		b, err := hex.DecodeString(op.Data)
+		if err != nil {
+			return nil
+		}
+		ip, _, scope, ok := clientSubnet(b)
+		if !ok || scope == 0 || scope > len(ip)*8 {
+			return nil
+		}
+		mask := net.CIDRMask(scope, len(ip)*8)
+		return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	}
+	return nil
+}
+
+// scopeLen returns the prefix length of n.
+func scopeLen(n *net.IPNet) int {
+	l, _ := n.Mask.Size()
+	return l
+}
+
+// reply returns the cached response as the answer to m. The TTLs are
+// lowered by the time the response was cached, or, when stale is not
+// zero, set to stale.
+func (e *cacheEntry) reply(m *Msg, now time.Time, stale uint32) (*Msg, error) {
+	r := new(Msg)
+	if err := r.Unpack(e.msg); err != nil {
+		return nil, err
+	}
+	r.Id = m.Id
+	r.Question = m.Question
+	age := uint32(now.Sub(e.stored) / time.Second)
+	for _, sec := range [][]RR{r.Answer, r.Ns, r.Extra} {
+		for _, rr := range sec {
+			switch h := rr.Header(); {
+			case stale != 0:
+				h.Ttl = stale
+			case h.Ttl > age:
+				h.Ttl -= age
+			default:
+				h.Ttl = 0
+			}
+		}
+	}
+	if o := requestOpt(m); o != nil {
+		r.SetEdns0(DefaultMsgSize, o.Do())
+		ro := r.Extra[len(r.Extra)-1].(*RR_OPT)
+		if _, ecs := querySubnet(m); ecs != nil {
+			// Echo the option with the scope of the answer
+			b, _ := hex.DecodeString(ecs.Data)
+			b[3] = 0
+			if e.scope != nil {
+				b[3] = byte(scopeLen(e.scope))
+			}
+			ro.Option = append(ro.Option, Option{OptionCodeSubnet, hex.EncodeToString(b)})
+		}
+		if stale != 0 {
+			ro.SetExtendedError(ExtendedErrorStaleAnswer, "")
+		}
+	}
+	return r, nil
+}
+
+// snapshotMagic starts a snapshot, the last byte is the version of the
+// format.
+var snapshotMagic = []byte{'d', 'n', 's', 'c', 2}
+
+// Snapshot writes the entries of c to w in a compact binary format, see
+// Restore. An entry is written as:
+//
+//	name length (2), name, qtype (2), qclass (2),
+//	flags (1, 1 for the DO bit, 2 for the CD bit),
+//	stored, expire (8 each, Unix time in seconds),
+//	scope prefix length (1), scope address length (1), scope address,
+//	ECS option length (2), ECS option, response length (2), response
+//
+// All integers are in network order.
+func (c *Cache) Snapshot(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	b.Write(snapshotMagic)
+	c.mu.Lock()
+	for k, es := range c.entries {
+		for _, e := range es {
+			var scope []byte
+			var ecs []byte
+			l := 0
+			if e.scope != nil {
+				scope, l = e.scope.IP, scopeLen(e.scope)
+			}
+			if e.ecs != nil {
+				ecs, _ = hex.DecodeString(e.ecs.Data)
+			}
+			binary.Write(b, binary.BigEndian, uint16(len(k.name)))
+			b.WriteString(k.name)
+			binary.Write(b, binary.BigEndian, []uint16{k.qtype, k.qclass})
+			b.WriteByte(k.flags())
+			binary.Write(b, binary.BigEndian, []int64{e.stored.Unix(), e.expire.Unix()})
+			b.Write([]byte{byte(l), byte(len(scope))})
+			b.Write(scope)
+			binary.Write(b, binary.BigEndian, uint16(len(ecs)))
+			b.Write(ecs)
+			binary.Write(b, binary.BigEndian, uint16(len(e.msg)))
+			b.Write(e.msg)
+		}
+	}
+	c.mu.Unlock()
+	return b.Flush()
+}
+
+// Restore adds the entries from a snapshot written by Snapshot to c.
+// Because the times in a snapshot are wall-clock times, the TTLs of the
+// answers are lowered by the time between the snapshot and the restore.
+// Entries that expired, or, with MaxStale, that are too stale to be
+// served, are left out. It returns ErrSnapshot when r does not hold a
+// snapshot; the entries read up to then are kept.
+func (c *Cache) Restore(r io.Reader) error {
+	b := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(b, magic); err != nil || string(magic) != string(snapshotMagic) {
+		return ErrSnapshot
+	}
+	now := c.time()
+	for {
+		k, e, err := readCacheEntry(b)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ErrSnapshot
+		}
+		if !now.Before(e.expire.Add(c.MaxStale)) {
+			continue
+		}
+		c.mu.Lock()
+		c.add(k, e, now)
+		c.mu.Unlock()
+	}
+}
+
+// readCacheEntry reads the next entry of a snapshot. It returns io.EOF
+// when there are no more entries.
+func readCacheEntry(b *bufio.Reader) (k cacheKey, e *cacheEntry, err error) {
+	var l uint16
+	if err = binary.Read(b, binary.BigEndian, &l); err != nil {
+		return
+	}
+	read := func(n int) []byte {
+		buf := make([]byte, n)
+		if err == nil {
+			_, err = io.ReadFull(b, buf)
+		}
+		return buf
+	}
+	var (
+		types [2]uint16
+		times [2]int64
+	)
+	k.name = string(read(int(l)))
+	if err == nil {
+		err = binary.Read(b, binary.BigEndian, &types)
+	}
+	f := read(1)
+	if err == nil {
+		err = binary.Read(b, binary.BigEndian, &times)
+	}
+	k.qtype, k.qclass = types[0], types[1]
+	k.do, k.cd = f[0]&1 != 0, f[0]&2 != 0
+	e = &cacheEntry{stored: time.Unix(times[0], 0), expire: time.Unix(times[1], 0)}
+	s := read(2)
+	if ip := read(int(s[1])); err == nil && len(ip) != 0 {
+		if len(ip) != net.IPv4len && len(ip) != net.IPv6len || int(s[0]) > len(ip)*8 {
+			return k, nil, ErrSnapshot
+		}
+		e.scope = &net.IPNet{IP: ip, Mask: net.CIDRMask(int(s[0]), len(ip)*8)}
+	}
+	if err == nil {
+		err = binary.Read(b, binary.BigEndian, &l)
+	}
+	if ecs := read(int(l)); err == nil && len(ecs) != 0 {
+		e.ecs = &Option{OptionCodeSubnet, hex.EncodeToString(ecs)}
+	}
+	if err == nil {
+		err = binary.Read(b, binary.BigEndian, &l)
+	}
+	e.msg = read(int(l))
+	if err == io.EOF {
+		// Only the end of the snapshot when no entry was started
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// flags returns the DO and the CD bit of k as they are written in a
+// snapshot.
+func (k cacheKey) flags() byte {
+	var f byte
+	if k.do {
+		f |= 1
+	}
+	if k.cd {
+		f |= 2
+	}
+	return f
+}
+
+func (c *Cache) client() *Client {
+	if c.Client == nil {
+		return NewClient()
+	}
+	return c.Client
+}
+
+func (c *Cache) staleTtl() uint32 {
+	if c.StaleTtl == 0 {
+		return 30
+	}
+	return c.StaleTtl
+}
+
+func (c *Cache) maxEntries() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return defaultCacheEntries
+}
+
+func (c *Cache) time() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
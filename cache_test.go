@@ -0,0 +1,428 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheUpstream starts a server that answers A queries with a TTL of 10,
+// or SERVFAIL when fail is set. It counts the queries in queries.
+func cacheUpstream(queries, fail *int32) (string, error) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		return "", err
+	}
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		atomic.AddInt32(queries, 1)
+		m := new(Msg)
+		if atomic.LoadInt32(fail) == 1 {
+			m.SetRcode(req, RcodeServerFailure)
+		} else {
+			m.SetReply(req)
+			m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeA, Class: ClassINET, Ttl: 10}, A: net.IPv4(127, 0, 0, 1)})
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})}).ServeUDP(l)
+	return l.LocalAddr().String(), nil
+}
+
+func TestCacheServeStale(t *testing.T) {
+	var queries, fail int32
+	addr, err := cacheUpstream(&queries, &fail)
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+
+	start := time.Now()
+	var now atomic.Value
+	now.Store(start)
+	c := &Cache{Server: addr, MaxStale: time.Hour}
+	c.now = func() time.Time { return now.Load().(time.Time) }
+	ask := func(at time.Duration) *Msg {
+		now.Store(start.Add(at))
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeA)
+		m.SetEdns0(4096, false)
+		r, err := c.Exchange(m)
+		if err != nil || r.Id != m.Id {
+			t.Logf("Failed to exchange at %s: %v", at, err)
+			t.Fail()
+			return new(Msg)
+		}
+		return r
+	}
+	ede := func(r *Msg) bool {
+		o := requestOpt(r)
+		return o != nil && len(o.Option) == 1 && o.Option[0].Code == OptionCodeEDE && o.Option[0].Data == "0003"
+	}
+
+	if r := ask(0); len(r.Answer) != 1 || r.Answer[0].Header().Ttl != 10 {
+		t.Logf("Wrong answer from upstream: %v", r)
+		t.Fail()
+	}
+	if r := ask(4 * time.Second); len(r.Answer) != 1 || r.Answer[0].Header().Ttl != 6 || ede(r) || atomic.LoadInt32(&queries) != 1 {
+		t.Logf("Wrong answer from the cache: %v", r)
+		t.Fail()
+	}
+	atomic.StoreInt32(&fail, 1)
+	if r := ask(20 * time.Second); len(r.Answer) != 1 || r.Answer[0].Header().Ttl != 30 || !ede(r) || atomic.LoadInt32(&queries) != 2 {
+		t.Logf("Wrong stale answer: %v", r)
+		t.Fail()
+	}
+	// Within the failure recheck time the stale answer is served at once,
+	// and refreshed in the background
+	atomic.StoreInt32(&fail, 0)
+	if r := ask(30 * time.Second); len(r.Answer) != 1 || !ede(r) {
+		t.Logf("Wrong stale answer: %v", r)
+		t.Fail()
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&queries) != 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if r := ask(31 * time.Second); len(r.Answer) != 1 || ede(r) || r.Answer[0].Header().Ttl != 9 {
+		t.Logf("The answer should have been refreshed: %v", r)
+		t.Fail()
+	}
+	atomic.StoreInt32(&fail, 1)
+	if r := ask(2 * time.Hour); r.Rcode != RcodeServerFailure {
+		t.Logf("The answer is too old to be served: %v", r)
+		t.Fail()
+	}
+}
+
+func TestCachePrefetch(t *testing.T) {
+	var queries, fail int32
+	addr, err := cacheUpstream(&queries, &fail)
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	start := time.Now()
+	var now atomic.Value
+	now.Store(start)
+	c := &Cache{Server: addr, Prefetch: 3}
+	c.now = func() time.Time { return now.Load().(time.Time) }
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	for _, at := range []time.Duration{0, 5 * time.Second, 8 * time.Second, 9 * time.Second} {
+		now.Store(start.Add(at))
+		if _, err := c.Exchange(m); err != nil {
+			t.Logf("Failed to exchange at %s: %s", at, err)
+			t.Fail()
+		}
+		// Wait for the prefetch of the hit at 8s
+		for i := 0; i < 100 && at == 8*time.Second && atomic.LoadInt32(&queries) != 2; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	// The refreshed entry expires at 18s
+	now.Store(start.Add(12 * time.Second))
+	r, err := c.Exchange(m)
+	if err != nil || r.Answer[0].Header().Ttl != 6 {
+		t.Logf("The entry should have been prefetched: %v", r)
+		t.Fail()
+	}
+	if s := c.Stats(); s != (CacheStats{Hits: 4, Misses: 1, Prefetches: 1}) || atomic.LoadInt32(&queries) != 2 {
+		t.Logf("Wrong stats: %+v, %d queries", s, atomic.LoadInt32(&queries))
+		t.Fail()
+	}
+}
+
+func TestCacheClientSubnet(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	var queries int32
+	// Answer with the address of the client subnet, for a scope of /24
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		atomic.AddInt32(&queries, 1)
+		m := new(Msg)
+		m.SetReply(req)
+		a := net.IPv4(127, 0, 0, 1)
+		if o := requestOpt(req); o != nil {
+			if n, ok := o.ClientSubnet(); ok {
+				a = n.IP
+			}
+			m.SetEdns0(4096, false)
+			for _, op := range o.Option {
+				if op.Code == OptionCodeSubnet {
+					op.Data = op.Data[:6] + "18" + op.Data[8:]
+					m.Extra[0].(*RR_OPT).Option = append(m.Extra[0].(*RR_OPT).Option, op)
+				}
+			}
+		}
+		m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeA, Class: ClassINET, Ttl: 10}, A: a})
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})}).ServeUDP(l)
+
+	c := &Cache{Server: l.LocalAddr().String()}
+	for i, x := range []struct {
+		subnet  string // source prefix length 24, or 32 for an address
+		queries int32
+		a       string
+		scope   byte
+	}{
+		{"10.0.0.0", 1, "10.0.0.0", 24},
+		{"10.0.1.0", 2, "10.0.1.0", 24},
+		{"10.0.0.5", 2, "10.0.0.0", 24},
+		{"10.0.1.0", 2, "10.0.1.0", 24},
+		{"", 3, "127.0.0.1", 0},
+		{"10.0.2.0", 3, "127.0.0.1", 0},
+	} {
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeA)
+		if x.subnet != "" {
+			ip := net.ParseIP(x.subnet).To4()
+			b := []byte{0, 1, 24, 0, ip[0], ip[1], ip[2]}
+			if ip[3] != 0 {
+				b = append(b[:4], ip...)
+				b[2] = 32
+			}
+			m.SetEdns0(4096, false)
+			m.Extra[0].(*RR_OPT).Option = []Option{{OptionCodeSubnet, hex.EncodeToString(b)}}
+		}
+		r, err := c.Exchange(m)
+		if err != nil || len(r.Answer) != 1 {
+			t.Logf("Failed to exchange for %q: %v", x.subnet, err)
+			t.Fail()
+			continue
+		}
+		if a, q := r.Answer[0].(*RR_A).A.String(), atomic.LoadInt32(&queries); a != x.a || q != x.queries {
+			t.Logf("Query %d for %q: got %s after %d upstream queries, want %s after %d", i, x.subnet, a, q, x.a, x.queries)
+			t.Fail()
+		}
+		if x.subnet == "" {
+			continue
+		}
+		o := requestOpt(r)
+		if o == nil || len(o.Option) != 1 || o.Option[0].Data[6:8] != hex.EncodeToString([]byte{x.scope}) {
+			t.Logf("Query %d for %q: expected the subnet option with scope /%d, got %v", i, x.subnet, x.scope, o)
+			t.Fail()
+		}
+	}
+}
+
+func TestCacheDnssec(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	var queries int32
+	// Answer with the RRSIG when the DO bit is set
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		atomic.AddInt32(&queries, 1)
+		m := new(Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeA, Class: ClassINET, Ttl: 10}, A: net.IPv4(127, 0, 0, 1)})
+		if o := requestOpt(req); o != nil && o.Do() {
+			m.SetEdns0(4096, true)
+			m.Answer = append(m.Answer, &RR_RRSIG{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeRRSIG, Class: ClassINET, Ttl: 10},
+				TypeCovered: TypeA, Algorithm: RSASHA256, Labels: 2, OrigTtl: 10, KeyTag: 12345, SignerName: "miek.nl.", Signature: "AAAA"})
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})}).ServeUDP(l)
+
+	start := time.Now()
+	c := &Cache{Server: l.LocalAddr().String()}
+	c.now = func() time.Time { return start }
+	ask := func(c *Cache, do, cd bool) *Msg {
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeA)
+		m.CheckingDisabled = cd
+		if do {
+			m.SetEdns0(4096, true)
+		}
+		r, err := c.Exchange(m)
+		if err != nil {
+			t.Logf("Failed to exchange: %s", err)
+			t.Fail()
+			return new(Msg)
+		}
+		return r
+	}
+	for i, x := range []struct {
+		do, cd  bool
+		answers int
+		queries int32
+	}{
+		{false, false, 1, 1},
+		{true, false, 2, 2},
+		{false, false, 1, 2},
+		{true, false, 2, 2},
+		{true, true, 2, 3},
+		{false, true, 1, 4},
+	} {
+		if r, q := ask(c, x.do, x.cd), atomic.LoadInt32(&queries); len(r.Answer) != x.answers || q != x.queries {
+			t.Logf("Query %d with DO %t and CD %t: got %d RRs after %d upstream queries, want %d after %d", i, x.do, x.cd, len(r.Answer), q, x.answers, x.queries)
+			t.Fail()
+		}
+	}
+
+	// The DO bit survives a snapshot
+	var b bytes.Buffer
+	c.Snapshot(&b)
+	d := &Cache{Server: l.LocalAddr().String()}
+	d.now = c.now
+	if err := d.Restore(&b); err != nil {
+		t.Logf("Failed to restore: %s", err)
+		t.Fail()
+		return
+	}
+	if r, q := ask(d, true, false), atomic.LoadInt32(&queries); len(r.Answer) != 2 || q != 4 {
+		t.Logf("Expected the RRSIG from the restored cache, got %d RRs after %d upstream queries", len(r.Answer), q)
+		t.Fail()
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	var queries, fail int32
+	addr, err := cacheUpstream(&queries, &fail)
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	start := time.Now()
+	c := &Cache{Server: addr}
+	c.now = func() time.Time { return start }
+	for _, name := range []string{"miek.nl.", "www.miek.nl."} {
+		m := new(Msg)
+		m.SetQuestion(name, TypeA)
+		c.Exchange(m)
+	}
+	var b bytes.Buffer
+	if err := c.Snapshot(&b); err != nil {
+		t.Logf("Failed to snapshot: %s", err)
+		t.Fail()
+		return
+	}
+
+	// Restart 4 seconds later
+	d := &Cache{Server: addr}
+	d.now = func() time.Time { return start.Add(4 * time.Second) }
+	if err := d.Restore(bytes.NewReader(b.Bytes())); err != nil {
+		t.Logf("Failed to restore: %s", err)
+		t.Fail()
+		return
+	}
+	for _, name := range []string{"miek.nl.", "www.miek.nl."} {
+		m := new(Msg)
+		m.SetQuestion(name, TypeA)
+		r, err := d.Exchange(m)
+		if err != nil || len(r.Answer) != 1 || r.Answer[0].Header().Ttl != 6 {
+			t.Logf("Expected %s with a TTL of 6 from the restored cache, got %v: %v", name, err, r)
+			t.Fail()
+		}
+	}
+	if q := atomic.LoadInt32(&queries); q != 2 {
+		t.Logf("Expected no upstream queries after the restore, got %d", q-2)
+		t.Fail()
+	}
+
+	// Too late to be of use
+	e := new(Cache)
+	e.now = func() time.Time { return start.Add(time.Minute) }
+	if err := e.Restore(bytes.NewReader(b.Bytes())); err != nil || len(e.entries) != 0 {
+		t.Logf("Expected no entries from an old snapshot, got %d: %v", len(e.entries), err)
+		t.Fail()
+	}
+	if err := e.Restore(bytes.NewReader(b.Bytes()[:b.Len()-1])); err != ErrSnapshot {
+		t.Logf("Expected ErrSnapshot for a short snapshot, got %v", err)
+		t.Fail()
+	}
+	if err := e.Restore(strings.NewReader("miek.nl. IN A 127.0.0.1")); err != ErrSnapshot {
+		t.Logf("Expected ErrSnapshot for a zone file, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestCacheLimit(t *testing.T) {
+	start := time.Now()
+	c := &Cache{MaxEntries: 10}
+	store := func(name string, at time.Duration) cacheKey {
+		m := new(Msg)
+		m.SetQuestion(name, TypeA)
+		m.SetReply(m)
+		m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: name, Rrtype: TypeA, Class: ClassINET, Ttl: 10}, A: net.IPv4(127, 0, 0, 1)})
+		k := cacheKey{name, TypeA, ClassINET, false, false}
+		c.store(k, m, start.Add(at), nil)
+		return k
+	}
+	for i := 0; i < 10; i++ {
+		store(string(rune('a'+i))+".miek.nl.", 0)
+	}
+	if c.size != 10 || len(c.entries) != 10 {
+		t.Logf("Expected 10 entries, got %d", c.size)
+		t.Fail()
+	}
+	// The old entries are dropped to make room, none is evicted
+	k := store("new.miek.nl.", 20*time.Second)
+	if c.size != 1 || len(c.entries) != 1 || c.Stats().Evictions != 0 {
+		t.Logf("Expired entries should be removed: %d entries, %d evictions", c.size, c.Stats().Evictions)
+		t.Fail()
+	}
+	c.mu.Lock()
+	c.expire(k, start.Add(40*time.Second))
+	c.mu.Unlock()
+	if c.size != 0 || len(c.entries) != 0 {
+		t.Logf("Expired entry should be removed on lookup: %d entries", c.size)
+		t.Fail()
+	}
+	for i := 0; i < 25; i++ {
+		store(string(rune('a'+i))+".miek.nl.", 30*time.Second)
+	}
+	if c.size > 10 || c.size != len(c.entries) || c.Stats().Evictions == 0 {
+		t.Logf("The cache should stay within its limit: %d entries, %d evictions", c.size, c.Stats().Evictions)
+		t.Fail()
+	}
+}
+
+func TestCacheSOA(t *testing.T) {
+	start := time.Now()
+	c := new(Cache)
+	soa := &RR_SOA{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeSOA, Class: ClassINET, Ttl: 3600},
+		Ns: "ns.miek.nl.", Mbox: "miek.miek.nl.", Serial: 1, Refresh: 14400, Retry: 3600, Expire: 604800, Minttl: 60}
+	for _, x := range []struct {
+		name  string
+		qtype uint16
+		rcode int
+		ttl   time.Duration
+	}{
+		{"miek.nl.", TypeSOA, RcodeSuccess, 3600 * time.Second},
+		{"miek.nl.", TypeMX, RcodeSuccess, 60 * time.Second},
+		{"a.miek.nl.", TypeA, RcodeNameError, 60 * time.Second},
+	} {
+		m := new(Msg)
+		m.SetQuestion(x.name, x.qtype)
+		m.SetRcode(m, x.rcode)
+		if x.qtype == TypeSOA {
+			m.Answer = append(m.Answer, soa)
+		} else {
+			m.Ns = append(m.Ns, soa)
+		}
+		k := cacheKey{x.name, x.qtype, ClassINET, false, false}
+		c.store(k, m, start, nil)
+		if e := c.entries[k]; len(e) != 1 || e[0].expire.Sub(start) != x.ttl {
+			t.Logf("Response %s %s should be cached for %s", x.name, Rr_str[x.qtype], x.ttl)
+			t.Fail()
+		}
+	}
+}
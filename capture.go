@@ -0,0 +1,75 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Unpacking the messages in captured UDP and TCP payloads.
+
+// UnpackPayload unpacks the messages in the payload of a captured packet.
+// A UDP payload is one message. A TCP payload holds messages that are each
+// preceded by their length in two bytes; it must hold complete messages, use
+// a TCPStream when messages can be split over segments. The messages that
+// can be unpacked are returned, together with the error of the first one
+// that can not.
+func UnpackPayload(payload []byte, tcp bool) ([]*Msg, error) {
+	if !tcp {
+		m := new(Msg)
+		if err := m.Unpack(payload); err != nil {
+			return nil, err
+		}
+		return []*Msg{m}, nil
+	}
+	s := new(TCPStream)
+	msgs, err := s.Feed(payload)
+	if err == nil && len(s.buf) > 0 {
+		err = ErrShortRead
+	}
+	return msgs, err
+}
+
+// A TCPStream reassembles the messages in one direction of a captured TCP
+// connection. The payloads of the segments are fed to it in order; a
+// message may be split over several segments and a segment may hold
+// several messages.
+type TCPStream struct {
+	buf []byte // the start of the next message
+}
+
+// Feed adds the payload of the next segment to the stream and returns the
+// messages it completes. A message that can not be unpacked is skipped,
+// the messages after it are still returned, together with the error of
+// the first message that was skipped.
+func (s *TCPStream) Feed(payload []byte) ([]*Msg, error) {
+	s.buf = append(s.buf, payload...)
+	var (
+		msgs []*Msg
+		err  error
+		off  int
+	)
+	for len(s.buf)-off >= 2 {
+		l, _ := unpackUint16(s.buf, off)
+		if len(s.buf)-off-2 < int(l) {
+			break
+		}
+		m := new(Msg)
+		if e := m.Unpack(s.buf[off+2 : off+2+int(l)]); e != nil {
+			if err == nil {
+				err = e
+			}
+		} else {
+			msgs = append(msgs, m)
+		}
+		off += 2 + int(l)
+	}
+	s.buf = append(s.buf[:0], s.buf[off:]...)
+	return msgs, err
+}
+
+// Buffered returns the number of bytes of an incomplete message the
+// stream holds.
+func (s *TCPStream) Buffered() int { return len(s.buf) }
+
+// Reset discards the bytes the stream holds, for instance when a segment
+// was lost.
+func (s *TCPStream) Reset() { s.buf = s.buf[:0] }
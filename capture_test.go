@@ -0,0 +1,58 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestTCPStream(t *testing.T) {
+	var stream []byte
+	for _, name := range []string{"miek.nl.", "www.miek.nl.", "a.miek.nl."} {
+		m := new(Msg)
+		m.SetQuestion(name, TypeA)
+		buf, _ := m.Pack()
+		stream = append(stream, byte(len(buf)>>8), byte(len(buf)))
+		stream = append(stream, buf...)
+	}
+	msgs, err := UnpackPayload(stream, true)
+	if err != nil || len(msgs) != 3 || msgs[2].Question[0].Name != "a.miek.nl." {
+		t.Logf("Expected 3 messages, got %v: %v", err, msgs)
+		t.Fail()
+	}
+	if _, err := UnpackPayload(stream[:len(stream)-1], true); err != ErrShortRead {
+		t.Logf("Expected a short read for a truncated payload, got %v", err)
+		t.Fail()
+	}
+	if msgs, err := UnpackPayload(stream[2:2+int(stream[1])], false); err != nil || len(msgs) != 1 || msgs[0].Question[0].Name != "miek.nl." {
+		t.Logf("Expected the UDP message, got %v: %v", err, msgs)
+		t.Fail()
+	}
+
+	// Feed the stream in segments of 5 bytes
+	s := new(TCPStream)
+	var names []string
+	for i := 0; i < len(stream); i += 5 {
+		end := i + 5
+		if end > len(stream) {
+			end = len(stream)
+		}
+		msgs, err := s.Feed(stream[i:end])
+		if err != nil {
+			t.Logf("Failed to feed the stream: %s", err)
+			t.Fail()
+		}
+		for _, m := range msgs {
+			names = append(names, m.Question[0].Name)
+		}
+	}
+	if len(names) != 3 || names[0] != "miek.nl." || names[1] != "www.miek.nl." || s.Buffered() != 0 {
+		t.Logf("Expected 3 reassembled messages, got %v", names)
+		t.Fail()
+	}
+
+	// A bad message between two good ones
+	bad := append([]byte{0, 3, 1, 2, 3}, stream...)
+	if msgs, err := s.Feed(bad); err == nil || len(msgs) != 3 {
+		t.Logf("Expected an error and 3 messages, got %v: %d", err, len(msgs))
+		t.Fail()
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Telling the kind of a response from its sections.
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The kinds of response, see ClassifyResponse.
+const (
+	ResponseNoError  = iota // the answer section answers the question
+	ResponseNXDomain        // the name does not exist
+	ResponseNoData          // the name exists, but has no RRs of the type asked for
+	ResponseReferral        // a delegation to the name servers of a zone closer to the name
+	ResponseLame            // a referral upwards, to the root, or sideways
+	ResponseError           // any other rcode, or there is no question
+)
+
+// Names of the kinds of response, see ResponseToString.
+var responseStr = map[int]string{
+	ResponseNoError:  "NOERROR",
+	ResponseNXDomain: "NXDOMAIN",
+	ResponseNoData:   "NODATA",
+	ResponseReferral: "referral",
+	ResponseLame:     "lame",
+	ResponseError:    "error",
+}
+
+// ResponseToString returns the name of the kind of response kind, as
+// returned by ClassifyResponse.
+func ResponseToString(kind int) string {
+	if s, ok := responseStr[kind]; ok {
+		return s
+	}
+	return "RESPONSE" + strconv.Itoa(kind)
+}
+
+// ClassifyResponse returns the kind of response msg is to its question,
+// following RFC 2308 section 2. A NOERROR response is ResponseNoError when
+// the answer section holds RRs of the type asked for, possibly at the end
+// of a CNAME chain; a chain that ends without them is not an answer.
+// Otherwise it is a referral when the authority section holds NS
+// records and no SOA record and the AA bit is clear; the referral is
+// ResponseLame when the NS records are for the root or for a zone that
+// is not the name asked for or one of its parents. All other NOERROR
+// responses are ResponseNoData.
+func ClassifyResponse(msg *Msg) int {
+	switch {
+	case msg.Rcode == RcodeNameError:
+		return ResponseNXDomain
+	case msg.Rcode != RcodeSuccess || len(msg.Question) == 0:
+		return ResponseError
+	}
+	q := msg.Question[0]
+	qname := strings.ToLower(Fqdn(q.Name))
+	if q.Qtype == TypeANY {
+		for _, r := range msg.Answer {
+			if strings.ToLower(Fqdn(r.Header().Name)) == qname {
+				return ResponseNoError
+			}
+		}
+	} else if rrs, _, _ := ChaseCNAME(msg, q.Name, q.Qtype); len(rrs) > 0 && rrs[len(rrs)-1].Header().Rrtype == q.Qtype {
+		return ResponseNoError
+	}
+	var zone string
+	for _, r := range msg.Ns {
+		switch r.Header().Rrtype {
+		case TypeSOA:
+			return ResponseNoData
+		case TypeNS:
+			zone = strings.ToLower(Fqdn(r.Header().Name))
+		}
+	}
+	if zone == "" || msg.Authoritative {
+		return ResponseNoData
+	}
+	if zone == "." || !isSubDomain(zone, qname) {
+		return ResponseLame
+	}
+	return ResponseReferral
+}
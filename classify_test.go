@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestClassifyResponse(t *testing.T) {
+	rr := func(s string) RR {
+		r, err := NewRR(s)
+		if err != nil {
+			t.Logf("Failed to parse %s: %s", s, err)
+			t.Fail()
+		}
+		return r
+	}
+	soa := rr("miek.nl. 3600 IN SOA linode.atoom.net. miek.miek.nl. 1282630057 14400 3600 604800 300")
+	tests := []struct {
+		qtype  uint16
+		rcode  int
+		aa     bool
+		answer []RR
+		ns     []RR
+		want   int
+	}{
+		{TypeA, RcodeSuccess, true, []RR{rr("www.miek.nl. IN A 192.0.2.1")}, nil, ResponseNoError},
+		{TypeA, RcodeSuccess, true, []RR{rr("www.miek.nl. IN CNAME a.miek.nl."), rr("a.miek.nl. IN A 192.0.2.1")}, nil, ResponseNoError},
+		{TypeANY, RcodeSuccess, true, []RR{rr("www.miek.nl. IN TXT \"hello\"")}, nil, ResponseNoError},
+		{TypeA, RcodeSuccess, true, []RR{rr("www.miek.nl. IN CNAME a.miek.nl.")}, []RR{soa}, ResponseNoData},
+		{TypeCNAME, RcodeSuccess, true, []RR{rr("www.miek.nl. IN CNAME a.miek.nl.")}, nil, ResponseNoError},
+		{TypeA, RcodeNameError, true, nil, []RR{soa}, ResponseNXDomain},
+		{TypeA, RcodeServerFailure, false, nil, nil, ResponseError},
+		{TypeA, RcodeSuccess, true, nil, []RR{soa}, ResponseNoData},
+		{TypeA, RcodeSuccess, true, nil, nil, ResponseNoData},
+		{TypeA, RcodeSuccess, true, nil, []RR{rr("miek.nl. IN NS ns.miek.nl.")}, ResponseNoData},
+		{TypeA, RcodeSuccess, true, []RR{rr("other.miek.nl. IN A 192.0.2.1")}, []RR{soa}, ResponseNoData},
+		{TypeA, RcodeSuccess, false, nil, []RR{rr("miek.nl. IN NS ns.miek.nl.")}, ResponseReferral},
+		{TypeA, RcodeSuccess, false, nil, []RR{rr("www.miek.nl. IN NS ns.miek.nl.")}, ResponseReferral},
+		{TypeA, RcodeSuccess, false, nil, []RR{&RR_NS{Hdr: RR_Header{Name: ".", Rrtype: TypeNS, Class: ClassINET}, Ns: "a.root-servers.net."}}, ResponseLame},
+		{TypeA, RcodeSuccess, false, nil, []RR{rr("example.org. IN NS ns.example.org.")}, ResponseLame},
+	}
+	for i, tc := range tests {
+		m := new(Msg)
+		m.SetQuestion("www.miek.nl.", tc.qtype)
+		m.Response = true
+		m.Rcode = tc.rcode
+		m.Authoritative = tc.aa
+		m.Answer = tc.answer
+		m.Ns = tc.ns
+		if got := ClassifyResponse(m); got != tc.want {
+			t.Logf("%d: expected %s, got %s:\n%s", i, ResponseToString(tc.want), ResponseToString(got), m)
+			t.Fail()
+		}
+	}
+	if s := ResponseToString(ResponseLame); s != "lame" {
+		t.Logf("Expected lame, got %s", s)
+		t.Fail()
+	}
+	if got := ClassifyResponse(new(Msg)); got != ResponseError {
+		t.Logf("A message without a question should be an error, got %s", ResponseToString(got))
+		t.Fail()
+	}
+}
@@ -8,8 +8,8 @@ package dns
 // when the query returns.
 
 import (
-	"io"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -26,6 +26,12 @@ type RequestWriter interface {
 	Receive() (*Msg, error)
 	Close() error
 	Dial() error
+	// SetDeadline sets the time after which Send and Receive fail, it
+	// overrides the timeouts of the Client.
+	SetDeadline(t time.Time)
+	// SetTsig makes Send sign the messages that are not yet signed with
+	// the key name from the TsigSecret of the Client, using algorithm algo.
+	SetTsig(name, algo string)
 }
 
 // hijacked connections...?
@@ -34,27 +40,45 @@ type reply struct {
 	addr           string
 	req            *Msg
 	conn           net.Conn
+	replyChan      chan *Exchange // if not nil, the replies go here instead of to client.ReplyChan
+	deadline       time.Time      // if not zero, overrides the timeouts of the client
+	tsigName       string         // if not empty, Send signs the messages with this key
+	tsigAlgorithm  string
 	tsigRequestMAC string
 	tsigTimersOnly bool
+	trace          *ClientTrace // the hooks of a synchronous exchange
 }
 
 // A Request is a incoming message from a Client
 type Request struct {
-	Request *Msg
-	Addr    string
-	Client  *Client
+	Request  *Msg
+	Addr     string
+	Client   *Client
+	Reply    chan *Exchange // the channel for the replies, Client.ReplyChan if nil
+	Deadline time.Time      // if not zero, overrides the timeouts of the client, see RequestWriter.SetDeadline
 }
 
 // QueryMux is an DNS request multiplexer. It matches the
 // zone name of each incoming request against a list of 
 // registered patterns add calls the handler for the pattern
-// that most closely matches the zone name.
+// that most closely matches the zone name. A pattern can be
+// registered for a single query type, see HandleType; such a
+// handler is preferred over one for all types of the same
+// pattern. This way different parts of a program can each handle
+// the queries, and so the replies, they are interested in.
 type QueryMux struct {
-	m map[string]QueryHandler
+	m map[queryPattern]QueryHandler
+}
+
+// queryPattern is a pattern of a QueryMux. Qtype is TypeNone for the
+// handlers of all types.
+type queryPattern struct {
+	zone  string
+	qtype uint16
 }
 
 // NewQueryMux allocates and returns a new QueryMux.
-func NewQueryMux() *QueryMux { return &QueryMux{make(map[string]QueryHandler)} }
+func NewQueryMux() *QueryMux { return &QueryMux{make(map[queryPattern]QueryHandler)} }
 
 // DefaultQueryMux is the default QueryMux used by Query.
 var DefaultQueryMux = NewQueryMux()
@@ -67,6 +91,9 @@ var (
 	// DefaultReplyChan is the channel on which the replies are
 	// coming back. Is it a channel of *Exchange, so that the original 
 	// question is included with the answer.
+	//
+	// Deprecated: all queries of all clients made with NewClient share
+	// this channel. Use DoChan to get the replies on a channel of your own.
 	DefaultReplyChan = newQueryChanSlice()
 	// DefaultQueryChan is the channel were you can send the questions to.
 	DefaultQueryChan = newQueryChan()
@@ -87,57 +114,106 @@ func HandleQueryFunc(pattern string, handler func(RequestWriter, *Msg)) {
 	DefaultQueryMux.HandleQueryFunc(pattern, handler)
 }
 
+// HandleQueryTypeFunc registers the handler for the queries of type qtype
+// matching pattern in the DefaultQueryMux.
+func HandleQueryTypeFunc(pattern string, qtype uint16, handler func(RequestWriter, *Msg)) {
+	DefaultQueryMux.HandleQueryTypeFunc(pattern, qtype, handler)
+}
+
 // reusing zoneMatch from server.go
-func (mux *QueryMux) match(zone string) QueryHandler {
+func (mux *QueryMux) match(zone string, qtype uint16) QueryHandler {
 	var h QueryHandler
 	var n = 0
+	var typed bool
 	for k, v := range mux.m {
-		if !zoneMatch(k, zone) {
+		if !zoneMatch(k.zone, zone) || (k.qtype != TypeNone && k.qtype != qtype) {
 			continue
 		}
-		if h == nil || len(k) > n {
-			n = len(k)
+		// The longest pattern wins, and for the same
+		// pattern the one for qtype
+		if h == nil || len(k.zone) > n || (len(k.zone) == n && k.qtype != TypeNone && !typed) {
+			n = len(k.zone)
 			h = v
+			typed = k.qtype != TypeNone
 		}
 	}
 	return h
 }
 
 func (mux *QueryMux) Handle(pattern string, handler QueryHandler) {
+	mux.HandleType(pattern, TypeNone, handler)
+}
+
+// HandleType registers the handler for the queries of type qtype matching
+// pattern. With TypeNone the handler is for all types, as with Handle.
+func (mux *QueryMux) HandleType(pattern string, qtype uint16, handler QueryHandler) {
 	if pattern == "" {
 		panic("dns: invalid pattern " + pattern)
 	}
-	mux.m[pattern] = handler
+	mux.m[queryPattern{pattern, qtype}] = handler
 }
 
 func (mux *QueryMux) HandleQueryFunc(pattern string, handler func(RequestWriter, *Msg)) {
 	mux.Handle(pattern, HandlerQueryFunc(handler))
 }
 
+// HandleQueryTypeFunc registers the handler function for the queries of
+// type qtype matching pattern.
+func (mux *QueryMux) HandleQueryTypeFunc(pattern string, qtype uint16, handler func(RequestWriter, *Msg)) {
+	mux.HandleType(pattern, qtype, HandlerQueryFunc(handler))
+}
+
+// QueryDNS hands r to the handler that matches its question. A query
+// without a question, or one no handler matches, is answered with an
+// Exchange with ErrQuestion or ErrNoHandler.
 func (mux *QueryMux) QueryDNS(w RequestWriter, r *Msg) {
-	h := mux.match(r.Question[0].Name)
+	if len(r.Question) == 0 {
+		replyError(w, r, ErrQuestion)
+		return
+	}
+	h := mux.match(r.Question[0].Name, r.Question[0].Qtype)
 	if h == nil {
-		panic("dns: no handler found for " + r.Question[0].Name)
+		replyError(w, r, ErrNoHandler)
+		return
 	}
 	h.QueryDNS(w, r)
 }
 
+// replyError sends an Exchange with err for the request r to the replies
+// of w. Like a HandlerQueryFunc it does not block the caller.
+func replyError(w RequestWriter, r *Msg, err error) {
+	if w, ok := w.(*reply); ok {
+		go func() { w.replies() <- &Exchange{Request: r, Error: err} }()
+	}
+}
+
 type Client struct {
-	Net          string            // if "tcp" a TCP query will be initiated, otherwise an UDP one
-	Attempts     int               // number of attempts
-	Retry        bool              // retry with TCP
-	QueryChan    chan *Request     // read DNS request from this channel
-	ReplyChan    chan *Exchange    // write the reply (together with the DNS request) to this channel
-	ReadTimeout  time.Duration     // the net.Conn.SetReadTimeout value for new connections (ns)
-	WriteTimeout time.Duration     // the net.Conn.SetWriteTimeout value for new connections (ns)
-	TsigSecret   map[string]string // secret(s) for Tsig map[<zonename>]<base64 secret>
-	Hijacked     net.Conn          // if set the calling code takes care of the connection
+	Net           string            // if "tcp" a TCP query will be initiated, otherwise an UDP one
+	Attempts      int               // number of attempts
+	Retry         bool              // retry with TCP
+	QueryChan     chan *Request     // read DNS request from this channel
+	ReplyChan     chan *Exchange    // write the reply (together with the DNS request) to this channel
+	ReadTimeout   time.Duration     // the net.Conn.SetReadTimeout value for new connections (ns)
+	WriteTimeout  time.Duration     // the net.Conn.SetWriteTimeout value for new connections (ns)
+	TsigSecret    map[string]string // secret(s) for Tsig map[<zonename>]<base64 secret>
+	Hijacked      net.Conn          // if set the calling code takes care of the connection
+	Inflight      int               // maximum number of outstanding queries in ExchangeStream, 64 if zero
+	Hosts         *Hosts            // if not nil, Exchange answers the queries it can from this hosts file
+	Edns0         *RR_OPT           // if not nil, added to the queries without an OPT RR by Exchange and Send
+	TsigName      string            // if not empty, Send signs the queries with this key from TsigSecret
+	TsigAlgorithm string            // the algorithm for TsigName, HmacMD5 if empty
+	Backoff       *Backoff          // the wait between attempts in ExchangeStream and ExchangeConfig, none if nil
+	Trace         *ClientTrace      // if not nil, the hooks called during the synchronous exchanges
+	QueryConn     *QueryConn        // if not nil, Do and DoChan hand the queries to it instead of to QueryChan
+	// If not zero, replies larger than MaxInboundSize bytes are rejected
+	// with ErrInboundSize; over TCP they are not read.
+	MaxInboundSize int
 	// LocalAddr string            // Local address to use
 }
 
 // NewClient creates a new client, with Net set to "udp" and Attempts to 1.
 // The client's ReplyChan is set to DefaultReplyChan and QueryChan
-// to DefaultQueryChan.
+// to DefaultQueryChan; use DoChan to receive the replies elsewhere.
 func NewClient() *Client {
 	c := new(Client)
 	c.Net = "udp"
@@ -163,16 +239,23 @@ func (q *Query) Query() error {
 	for {
 		select {
 		case in := <-q.QueryChan:
-			w := new(reply)
-			w.req = in.Request
-			w.addr = in.Addr
-			w.client = in.Client
-			handler.QueryDNS(w, in.Request)
+			fire(handler, in)
 		}
 	}
 	return nil
 }
 
+// fire hands the request in to handler.
+func fire(handler QueryHandler, in *Request) {
+	w := new(reply)
+	w.req = in.Request
+	w.addr = in.Addr
+	w.client = in.Client
+	w.replyChan = in.Reply
+	w.deadline = in.Deadline
+	handler.QueryDNS(w, in.Request)
+}
+
 func (q *Query) ListenAndQuery() error {
 	if q.QueryChan == nil {
 		q.QueryChan = DefaultQueryChan
@@ -183,21 +266,104 @@ func (q *Query) ListenAndQuery() error {
 // ListenAndQuery starts the listener for firing off the queries. If
 // c is nil DefaultQueryChan is used. If handler is nil
 // DefaultQueryMux is used.
+//
+// Deprecated: the listener can not be stopped, and all clients made with
+// NewClient share it. Use a QueryConn.
 func ListenAndQuery(request chan *Request, handler QueryHandler) {
 	q := &Query{QueryChan: request, Handler: handler}
 	go q.ListenAndQuery()
 }
 
+// A QueryConn fires off the asynchronous queries of the clients that
+// have it as their QueryConn. Unlike ListenAndQuery it holds no global
+// state: a program, or a test, can have several and close them when
+// done.
+type QueryConn struct {
+	handler  QueryHandler
+	requests chan *Request
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewQueryConn starts a QueryConn that hands the queries to handler, or
+// to DefaultQueryMux if handler is nil.
+func NewQueryConn(handler QueryHandler) *QueryConn {
+	if handler == nil {
+		handler = DefaultQueryMux
+	}
+	q := &QueryConn{handler: handler, requests: make(chan *Request), done: make(chan struct{})}
+	go q.serve()
+	return q
+}
+
+func (q *QueryConn) serve() {
+	for {
+		select {
+		case in := <-q.requests:
+			fire(q.handler, in)
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// query hands in to the handler of q. When q is closed the reply is an
+// Exchange with ErrQueryConn.
+func (q *QueryConn) query(in *Request) {
+	select {
+	case q.requests <- in:
+	case <-q.done:
+		w := &reply{client: in.Client, replyChan: in.Reply}
+		go func() { w.replies() <- &Exchange{Request: in.Request, Error: ErrQueryConn} }()
+	}
+}
+
+// Close stops q. Queries that were handed to the handler are finished,
+// later queries fail with ErrQueryConn.
+func (q *QueryConn) Close() error {
+	q.once.Do(func() { close(q.done) })
+	return nil
+}
+
 // Write returns the original question and the answer on the 
-// reply channel of the client.
+// reply channel of the request.
 func (w *reply) Write(m *Msg) {
-	w.Client().ReplyChan <- &Exchange{Request: w.req, Reply: m}
+	w.replies() <- &Exchange{Request: w.req, Reply: m}
+}
+
+// replies returns the channel for the replies to the request: the one
+// given to DoChan, or else the ReplyChan of the client.
+func (w *reply) replies() chan *Exchange {
+	if w.replyChan != nil {
+		return w.replyChan
+	}
+	return w.Client().ReplyChan
 }
 
 // Do performs an asynchronous query. The result is returned on the
-// QueryChan channel set in the Client c. 
+// ReplyChan channel set in the Client c, see DoChan.
 func (c *Client) Do(m *Msg, a string) {
-	c.QueryChan <- &Request{Client: c, Addr: a, Request: m}
+	c.DoChan(m, a, nil)
+}
+
+// DoChan performs an asynchronous query, like Do, but the result is
+// returned on reply. This allows independent flows of asynchronous
+// queries, each with its own channel, in one program. When reply is nil
+// the ReplyChan of c is used.
+func (c *Client) DoChan(m *Msg, a string, reply chan *Exchange) {
+	c.DoDeadline(m, a, reply, time.Time{})
+}
+
+// DoDeadline performs an asynchronous query like DoChan, but sending m
+// and receiving the reply must be done before deadline, instead of
+// within the timeouts of c.
+func (c *Client) DoDeadline(m *Msg, a string, reply chan *Exchange, deadline time.Time) {
+	in := &Request{Client: c, Addr: a, Request: m, Reply: reply, Deadline: deadline}
+	if c.QueryConn != nil {
+		c.QueryConn.query(in)
+		return
+	}
+	c.QueryChan <- in
 }
 
 // ExchangeBuffer performs a synchronous query. It sends the buffer m to the
@@ -206,32 +372,61 @@ func (c *Client) ExchangeBuffer(inbuf []byte, a string, outbuf []byte) (n int, e
 	w := new(reply)
 	w.client = c
 	w.addr = a
-	if c.Hijacked == nil {
-		if err = w.Dial(); err != nil {
-			return 0, err
-		}
-		defer w.Close()
-	}
+	w.trace = c.Trace
 	if c.Hijacked != nil {
 		w.conn = c.Hijacked
+	} else {
+		// writeClient dials
+		defer func() {
+			if w.conn != nil {
+				w.Close()
+			}
+		}()
+	}
+	n, err = w.writeClient(inbuf)
+	if w.conn != nil {
+		c.Trace.wroteQuery(n, err)
 	}
-	if n, err = w.writeClient(inbuf); err != nil {
+	if err != nil {
 		return 0, err
 	}
 	//Why cant we set the buf here?? TODO(MG)
-	if n, err = w.readClient(outbuf); err != nil {
+	n, err = w.readClient(outbuf)
+	c.Trace.gotResponse(n, err)
+	if err != nil {
 		return n, err
 	}
 	return n, nil
 }
 
 // Exchange performs an synchronous query. It sends the message m to the address
-// contained in a and waits for an reply.
+// contained in a and waits for an reply. When c.Hosts is set and can answer
+// m, the reply is made from the hosts file instead, see Hosts.Reply.
 func (c *Client) Exchange(m *Msg, a string) (r *Msg, err error) {
+	r, _, err = c.ExchangeWithInfo(m, a)
+	return r, err
+}
+
+// ExchangeInfo describes a synchronous exchange, so the amplification
+// factor of a server can be seen, and the time it took.
+type ExchangeInfo struct {
+	Rtt          time.Duration // from sending the query until the reply was read
+	RequestSize  int           // bytes in the query, without the TCP length
+	ResponseSize int           // bytes in the reply, without the TCP length
+}
+
+// ExchangeWithInfo performs a synchronous query like Exchange, and
+// also returns the sizes of the query and the reply and the round trip
+// time. The info is zero when the reply was made from c.Hosts.
+func (c *Client) ExchangeWithInfo(m *Msg, a string) (r *Msg, info ExchangeInfo, err error) {
+	if r = c.Hosts.Reply(m); r != nil {
+		return r, info, nil
+	}
+	c.Trace.dnsStart(m, a)
 	var n int
-	out, ok := m.Pack()
-	if !ok {
-		return nil, ErrPack
+	out, err := c.withEdns0(m).Pack()
+	if err != nil {
+		return nil, info, err
 	}
 	var in []byte
 	switch c.Net {
@@ -241,19 +436,151 @@ func (c *Client) Exchange(m *Msg, a string) (r *Msg, err error) {
 		in = make([]byte, DefaultMsgSize)
 	}
 	//TODO(mg): look at the buffer size here
+	start := time.Now()
 	if n, err = c.ExchangeBuffer(out, a, in); err != nil {
+		return nil, info, err
+	}
+	info = ExchangeInfo{Rtt: time.Since(start), RequestSize: len(out), ResponseSize: n}
+	r = new(Msg)
+	if err = r.Unpack(in[:n]); err != nil {
+		return nil, info, err
+	}
+	if r.Id != m.Id {
+		return r, info, ErrId
+	}
+	return r, info, nil
+}
+
+// ExchangeConn performs a synchronous query over conn, a connection set up
+// by the caller, for instance through a proxy or a TLS tunnel. The
+// message is sent as a datagram when conn is a net.PacketConn, and with a
+// length prefix, as over TCP, otherwise. The deadlines are set from the
+// timeouts of c. The connection is not closed.
+func (c *Client) ExchangeConn(m *Msg, conn net.Conn) (r *Msg, err error) {
+	c.Trace.dnsStart(m, conn.RemoteAddr().String())
+	out, err := c.withEdns0(m).Pack()
+	if err != nil {
+		return nil, err
+	}
+	_, packet := conn.(net.PacketConn)
+	w := &reply{client: c, conn: conn}
+	w.setDeadlines()
+	var in []byte
+	if !packet {
+		err = writeTCP(conn, out)
+		c.Trace.wroteQuery(len(out), err)
+		if err != nil {
+			return nil, err
+		}
+		in, err = readTCP(conn, c.MaxInboundSize, nil)
+	} else {
+		var n int
+		n, err = conn.Write(out)
+		c.Trace.wroteQuery(n, err)
+		if err != nil {
+			return nil, err
+		}
+		in = make([]byte, MaxMsgSize)
+		if n, err = conn.Read(in); err == nil && c.MaxInboundSize > 0 && n > c.MaxInboundSize {
+			err = ErrInboundSize
+		}
+		in = in[:n]
+	}
+	c.Trace.gotResponse(len(in), err)
+	if err != nil {
 		return nil, err
 	}
 	r = new(Msg)
-	if ok := r.Unpack(in[:n]); !ok {
-		return nil, ErrUnpack
+	if err = r.Unpack(in); err != nil {
+		return nil, err
+	}
+	if r.Id != m.Id {
+		return r, ErrId
 	}
 	return r, nil
 }
 
+// ExchangeConfig sends m to the servers in conf, in order, until one
+// answers. A server is tried conf.Attempts times when it does not answer,
+// waiting c.Backoff between the attempts; when it answers with an rcode
+// from conf.Failover the next server is tried. The last answer is
+// returned when all servers fail over.
+func (c *Client) ExchangeConfig(m *Msg, conf *ClientConfig) (r *Msg, err error) {
+	attempts := conf.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	err = ErrServ
+	for _, s := range conf.Servers {
+		for i := 0; i < attempts; i++ {
+			if i > 0 {
+				time.Sleep(c.Backoff.Delay(i - 1))
+			}
+			var in *Msg
+			if in, err = c.Exchange(m, s+":"+conf.Port); err != nil {
+				continue
+			}
+			if !conf.failover(in.Rcode) {
+				return in, nil
+			}
+			r = in
+			break
+		}
+	}
+	if r != nil {
+		return r, nil
+	}
+	return nil, err
+}
+
+// withEdns0 returns m with the default OPT RR of c added when m has none.
+// The OPT RR is added to a shallow copy of m, m itself is not modified. It
+// is inserted before a TSIG RR, which must stay last.
+func (c *Client) withEdns0(m *Msg) *Msg {
+	if c.Edns0 == nil || m.IsEdns0() {
+		return m
+	}
+	o := new(RR_OPT)
+	*o = *c.Edns0
+	o.Option = append([]Option(nil), c.Edns0.Option...)
+	m1 := new(Msg)
+	*m1 = *m
+	m1.Extra = make([]RR, 0, len(m.Extra)+1)
+	if m.IsTsig() {
+		n := len(m.Extra)
+		m1.Extra = append(append(m1.Extra, m.Extra[:n-1]...), o, m.Extra[n-1])
+		return m1
+	}
+	m1.Extra = append(append(m1.Extra, m.Extra...), o)
+	return m1
+}
+
+// SetDeadline implements the RequestWriter.SetDeadline method.
+func (w *reply) SetDeadline(t time.Time) {
+	w.deadline = t
+}
+
+// SetTsig implements the RequestWriter.SetTsig method.
+func (w *reply) SetTsig(name, algo string) {
+	w.tsigName, w.tsigAlgorithm = name, algo
+}
+
+// setDeadlines sets the deadlines of the connection for the next read
+// and write: the deadline of the request, or else the timeouts of the
+// client.
+func (w *reply) setDeadlines() {
+	if !w.deadline.IsZero() {
+		w.conn.SetDeadline(w.deadline)
+		return
+	}
+	w.conn.SetReadDeadline(time.Now().Add(w.Client().ReadTimeout))
+	w.conn.SetWriteDeadline(time.Now().Add(w.Client().WriteTimeout))
+}
+
 // Dial connects to the address addr for the network set in c.Net
 func (w *reply) Dial() error {
 	conn, err := net.Dial(w.Client().Net, w.addr)
+	w.trace.connectDone(w.Client().Net, w.addr, err)
 	if err != nil {
 		return err
 	}
@@ -288,8 +615,8 @@ func (w *reply) Receive() (*Msg, error) {
 		return nil, err
 	}
 	p = p[:n]
-	if ok := m.Unpack(p); !ok {
-		return nil, ErrUnpack
+	if err := m.Unpack(p); err != nil {
+		return nil, err
 	}
 	// Tsig
 	if m.IsTsig() {
@@ -316,51 +643,27 @@ func (w *reply) readClient(p []byte) (n int, err error) {
 	switch w.Client().Net {
 	case "tcp", "tcp4", "tcp6":
 		if len(p) < 1 {
-			return 0, io.ErrShortBuffer
+			return 0, ErrBuf
 		}
 		for a := 0; a < w.Client().Attempts; a++ {
-			w.conn.SetReadDeadline(time.Now().Add(w.Client().ReadTimeout))
-			w.conn.SetWriteDeadline(time.Now().Add(w.Client().WriteTimeout))
+			w.setDeadlines()
 
-			n, err = w.conn.(*net.TCPConn).Read(p[0:2])
-			if err != nil || n != 2 {
-				if e, ok := err.(net.Error); ok && e.Timeout() {
-					continue
-				}
-				return n, err
-			}
-			l, _ := unpackUint16(p[0:2], 0)
-			if l == 0 {
-				return 0, ErrShortRead
-			}
-			if int(l) > len(p) {
-				return int(l), io.ErrShortBuffer
-			}
-			n, err = w.conn.(*net.TCPConn).Read(p[:l])
+			var buf []byte
+			buf, err = readTCP(w.conn, w.Client().MaxInboundSize, nil)
 			if err != nil {
 				if e, ok := err.(net.Error); ok && e.Timeout() {
 					continue
 				}
-				return n, err
+				return 0, err
 			}
-			i := n
-			for i < int(l) {
-				j, err := w.conn.(*net.TCPConn).Read(p[i:int(l)])
-				if err != nil {
-					if e, ok := err.(net.Error); ok && e.Timeout() {
-						// We are half way in our read...
-						continue
-					}
-					return i, err
-				}
-				i += j
+			if len(buf) > len(p) {
+				return len(buf), ErrBuf
 			}
-			n = i
+			return copy(p, buf), nil
 		}
 	case "udp", "udp4", "udp6":
 		for a := 0; a < w.Client().Attempts; a++ {
-			w.conn.SetReadDeadline(time.Now().Add(w.Client().ReadTimeout))
-			w.conn.SetWriteDeadline(time.Now().Add(w.Client().ReadTimeout))
+			w.setDeadlines()
 
 			n, _, err = w.conn.(*net.UDPConn).ReadFromUDP(p)
 			if err != nil {
@@ -369,6 +672,10 @@ func (w *reply) readClient(p []byte) (n int, err error) {
 				}
 				return n, err
 			}
+			if m := w.Client().MaxInboundSize; m > 0 && n > m {
+				return 0, ErrInboundSize
+			}
+			break
 		}
 	}
 	return
@@ -376,8 +683,27 @@ func (w *reply) readClient(p []byte) (n int, err error) {
 
 // Send sends a dns msg to the address specified in w.
 // If the message m contains a TSIG record the transaction
-// signature is calculated.
+// signature is calculated. A message without TSIG record is
+// signed when a key is set with SetTsig or in the Client; the
+// default OPT RR of the Client is added to a message without one. Both
+// are added to a copy of m.
 func (w *reply) Send(m *Msg) error {
+	m = w.Client().withEdns0(m)
+	name, algo := w.tsigName, w.tsigAlgorithm
+	if name == "" {
+		name, algo = w.Client().TsigName, w.Client().TsigAlgorithm
+	}
+	if name != "" && !m.IsTsig() {
+		if algo == "" {
+			algo = HmacMD5
+		}
+		// Sign a copy, the message of the caller is not changed
+		m1 := new(Msg)
+		*m1 = *m
+		m1.Extra = append(make([]RR, 0, len(m.Extra)+1), m.Extra...)
+		m = m1
+		m.SetTsig(name, algo, 300, uint64(time.Now().Unix()))
+	}
 	if m.IsTsig() {
 		secret := m.Extra[len(m.Extra)-1].(*RR_TSIG).Hdr.Name
 		_, ok := w.Client().TsigSecret[secret]
@@ -390,11 +716,11 @@ func (w *reply) Send(m *Msg) error {
 		}
 		w.tsigRequestMAC = m.Extra[len(m.Extra)-1].(*RR_TSIG).MAC // Save the requestMAC for the next packet
 	}
-	out, ok := m.Pack()
-	if !ok {
-		return ErrPack
+	out, err := m.Pack()
+	if err != nil {
+		return err
 	}
-	_, err := w.writeClient(out)
+	_, err = w.writeClient(out)
 	if err != nil {
 		return err
 	}
@@ -416,56 +742,32 @@ func (w *reply) writeClient(p []byte) (n int, err error) {
 	switch w.Client().Net {
 	case "tcp", "tcp4", "tcp6":
 		if len(p) < 2 {
-			return 0, io.ErrShortBuffer
+			return 0, ErrBuf
 		}
 		for a := 0; a < w.Client().Attempts; a++ {
-			w.conn.SetWriteDeadline(time.Now().Add(w.Client().WriteTimeout))
-			w.conn.SetReadDeadline(time.Now().Add(w.Client().ReadTimeout))
+			w.setDeadlines()
 
-			a, b := packUint16(uint16(len(p)))
-			n, err = w.conn.Write([]byte{a, b})
-			if err != nil {
+			if err = writeTCP(w.conn, p); err != nil {
 				if e, ok := err.(net.Error); ok && e.Timeout() {
 					continue
 				}
-				return n, err
+				return 0, err
 			}
-			if n != 2 {
-				return n, io.ErrShortWrite
-			}
-			n, err = w.conn.Write(p)
-			if err != nil {
-				if e, ok := err.(net.Error); ok && e.Timeout() {
-					continue
-				}
-				return n, err
-			}
-			i := n
-			if i < len(p) {
-				j, err := w.conn.Write(p[i:len(p)])
-				if err != nil {
-					if e, ok := err.(net.Error); ok && e.Timeout() {
-						// We are half way in our write...
-						continue
-					}
-					return i, err
-				}
-				i += j
-			}
-			n = i
+			return len(p), nil
 		}
 	case "udp", "udp4", "udp6":
 		for a := 0; a < w.Client().Attempts; a++ {
-			w.conn.SetWriteDeadline(time.Now().Add(w.Client().WriteTimeout))
-			w.conn.SetReadDeadline(time.Now().Add(w.Client().ReadTimeout))
+			w.setDeadlines()
 
-			n, err = w.conn.(*net.UDPConn).WriteTo(p, w.conn.RemoteAddr())
+			// The connection is connected, so Write and not WriteTo
+			n, err = w.conn.Write(p)
 			if err != nil {
 				if e, ok := err.(net.Error); ok && e.Timeout() {
 					continue
 				}
 				return n, err
 			}
+			break
 		}
 	}
 	return
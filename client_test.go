@@ -1,6 +1,11 @@
 package dns
 
 import (
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -130,3 +135,475 @@ func TestClientAXFRMultipleMessages(t *testing.T) {
 		}
 	}
 }
+
+func TestClientDoChan(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	srv := &Server{Handler: HandlerFunc(HelloServer)}
+	go srv.ServeUDP(l)
+
+	q := &Query{QueryChan: make(chan *Request), Handler: HandlerQueryFunc(helloMiek)}
+	go q.Query()
+	c := NewClient()
+	c.QueryChan = q.QueryChan
+
+	// Two independent flows, each with its own channel
+	r1, r2 := make(chan *Exchange), make(chan *Exchange)
+	m1 := new(Msg)
+	m1.SetQuestion("one.miek.nl.", TypeTXT)
+	m2 := new(Msg)
+	m2.SetQuestion("two.miek.nl.", TypeTXT)
+	c.DoChan(m1, l.LocalAddr().String(), r1)
+	c.DoChan(m2, l.LocalAddr().String(), r2)
+	for _, x := range []struct {
+		reply chan *Exchange
+		name  string
+	}{{r2, "two.miek.nl."}, {r1, "one.miek.nl."}} {
+		select {
+		case e := <-x.reply:
+			if e.Reply == nil || e.Reply.Question[0].Name != x.name {
+				t.Logf("Wrong reply for %s: %v", x.name, e.Reply)
+				t.Fail()
+			}
+		case <-time.After(2 * time.Second):
+			t.Logf("No reply for %s", x.name)
+			t.Fail()
+		}
+	}
+}
+
+func TestClientUDPWrite(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	var queries int32
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, r *Msg) {
+		atomic.AddInt32(&queries, 1)
+		HelloServer(w, r)
+	})}).ServeUDP(l)
+
+	c := NewClient()
+	c.Attempts = 3
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	if r, err := c.Exchange(m, l.LocalAddr().String()); err != nil || r.Id != m.Id {
+		t.Logf("Expected an answer over UDP, got %v: %v", err, r)
+		t.Fail()
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Logf("The query should be sent once, it was sent %d times", n)
+		t.Fail()
+	}
+}
+
+func TestQueryMuxType(t *testing.T) {
+	mux := NewQueryMux()
+	var got string
+	handler := func(name string) QueryHandler {
+		return queryHandlerFunc(func(w RequestWriter, r *Msg) { got = name })
+	}
+	mux.Handle(".", handler("root"))
+	mux.Handle("miek.nl.", handler("miek"))
+	mux.HandleType("miek.nl.", TypeMX, handler("miek-mx"))
+	mux.HandleType(".", TypeAAAA, handler("root-aaaa"))
+	for _, x := range []struct {
+		name  string
+		qtype uint16
+		want  string
+	}{
+		{"www.miek.nl.", TypeA, "miek"},
+		{"miek.nl.", TypeMX, "miek-mx"},
+		{"miek.nl.", TypeAAAA, "miek"},
+		{"example.org.", TypeAAAA, "root-aaaa"},
+		{"example.org.", TypeA, "root"},
+	} {
+		m := new(Msg)
+		m.SetQuestion(x.name, x.qtype)
+		mux.QueryDNS(nil, m)
+		if got != x.want {
+			t.Logf("Query for %s %s went to %s, want %s", x.name, TypeToString(x.qtype), got, x.want)
+			t.Fail()
+		}
+	}
+}
+
+func TestQueryMuxError(t *testing.T) {
+	mux := NewQueryMux()
+	mux.Handle("miek.nl.", queryHandlerFunc(func(w RequestWriter, r *Msg) {}))
+	q := NewQueryConn(mux)
+	defer q.Close()
+	c := NewClient()
+	c.QueryConn = q
+	replies := make(chan *Exchange)
+	m := new(Msg)
+	m.SetQuestion("example.org.", TypeA)
+	for _, x := range []struct {
+		m   *Msg
+		err error
+	}{{new(Msg), ErrQuestion}, {m, ErrNoHandler}} {
+		c.DoChan(x.m, "127.0.0.1:53", replies)
+		select {
+		case e := <-replies:
+			if e.Error != x.err || e.Request != x.m {
+				t.Logf("Expected %s, got %v", x.err, e.Error)
+				t.Fail()
+			}
+		case <-time.After(2 * time.Second):
+			t.Logf("No reply, expected %s", x.err)
+			t.Fail()
+		}
+	}
+}
+
+// queryHandlerFunc is a QueryHandler that, unlike HandlerQueryFunc, does
+// not start a goroutine.
+type queryHandlerFunc func(RequestWriter, *Msg)
+
+func (f queryHandlerFunc) QueryDNS(w RequestWriter, r *Msg) { f(w, r) }
+
+func TestRequestWriterDefaults(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	srv := &Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		var seen []string
+		for _, rr := range req.Extra {
+			seen = append(seen, TypeToString(rr.Header().Rrtype))
+		}
+		m.Answer = []RR{&RR_TXT{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeTXT, Class: ClassINET}, Txt: seen}}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})}
+	go srv.ServeUDP(l)
+
+	q := &Query{QueryChan: make(chan *Request), Handler: queryHandlerFunc(func(w RequestWriter, m *Msg) {
+		if m.Question[0].Name == "late.miek.nl." {
+			w.SetDeadline(time.Now().Add(-time.Second))
+		} else {
+			w.SetDeadline(time.Now().Add(2 * time.Second))
+			w.SetTsig("axfr.", HmacMD5)
+		}
+		if err := w.Send(m); err != nil {
+			w.(*reply).replies() <- &Exchange{Request: m, Error: err}
+			return
+		}
+		r, err := w.Receive()
+		w.(*reply).replies() <- &Exchange{Request: m, Reply: r, Error: err}
+	})}
+	go q.Query()
+	c := NewClient()
+	c.QueryChan = q.QueryChan
+	c.TsigSecret = map[string]string{"axfr.": "so6ZGir4GPAqINNh9U5c3A=="}
+	c.Edns0 = &RR_OPT{Hdr: RR_Header{Name: ".", Rrtype: TypeOPT}}
+	c.Edns0.SetUDPSize(4096)
+
+	replies := make(chan *Exchange)
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	go c.DoChan(m, l.LocalAddr().String(), replies)
+	e := <-replies
+	if e.Error != nil {
+		t.Logf("Query failed: %s", e.Error)
+		t.Fail()
+		return
+	}
+	// The OPT RR is added first, the TSIG RR must be last
+	if txt := e.Reply.Answer[0].(*RR_TXT).Txt; len(txt) != 2 || txt[0] != "OPT" || txt[1] != "TSIG" {
+		t.Logf("Server saw %v in the additional section, want [OPT TSIG]", txt)
+		t.Fail()
+	}
+	if len(m.Extra) != 0 {
+		t.Logf("The query should not be modified: %v", m.Extra)
+		t.Fail()
+	}
+
+	m = new(Msg)
+	m.SetQuestion("late.miek.nl.", TypeTXT)
+	go c.DoChan(m, l.LocalAddr().String(), replies)
+	if e := <-replies; e.Error == nil {
+		t.Log("Query after the deadline should fail")
+		t.Fail()
+	}
+
+	// Without a default OPT RR the query is not copied to add one, the
+	// TSIG RR must still not be added to it
+	c.Edns0 = nil
+	m = new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	go c.DoChan(m, l.LocalAddr().String(), replies)
+	if e := <-replies; e.Error != nil || len(m.Extra) != 0 {
+		t.Logf("The query should be signed without being modified: %v %v", e.Error, m.Extra)
+		t.Fail()
+	}
+}
+
+func TestClientExchangeConfig(t *testing.T) {
+	conf := &ClientConfig{Attempts: 1}
+	for i, rcode := range []int{RcodeRefused, RcodeServerFailure, RcodeNameError} {
+		ip := net.IPv4(127, 0, 0, byte(i+1))
+		port := 0
+		if conf.Port != "" {
+			port, _ = strconv.Atoi(conf.Port)
+		}
+		l, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+		if err != nil {
+			t.Logf("Failed to listen: %s", err)
+			t.Fail()
+			return
+		}
+		_, conf.Port, _ = net.SplitHostPort(l.LocalAddr().String())
+		conf.Servers = append(conf.Servers, ip.String())
+		rcode := rcode
+		go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+			m := new(Msg)
+			m.SetRcode(req, rcode)
+			buf, _ := m.Pack()
+			w.Write(buf)
+		})}).ServeUDP(l)
+	}
+	c := NewClient()
+	c.ReadTimeout = time.Second
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	r, err := c.ExchangeConfig(m, conf)
+	if err != nil || r.Rcode != RcodeNameError {
+		t.Logf("Expected NXDOMAIN from the last server, got %v: %v", err, r)
+		t.Fail()
+	}
+	conf.Failover = []int{}
+	if r, err = c.ExchangeConfig(m, conf); err != nil || r.Rcode != RcodeRefused {
+		t.Logf("Expected REFUSED from the first server, got %v: %v", err, r)
+		t.Fail()
+	}
+	conf.Servers = conf.Servers[:2]
+	conf.Failover = nil
+	if r, err = c.ExchangeConfig(m, conf); err != nil || r.Rcode != RcodeServerFailure {
+		t.Logf("Expected SERVFAIL from the last server, got %v: %v", err, r)
+		t.Fail()
+	}
+}
+
+func TestClientExchangeConn(t *testing.T) {
+	c := NewClient()
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+
+	// A stream, the messages have a length prefix
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		p := make([]byte, MaxMsgSize)
+		if _, err := io.ReadFull(server, p[:2]); err != nil {
+			return
+		}
+		l, _ := unpackUint16(p, 0)
+		if _, err := io.ReadFull(server, p[:l]); err != nil {
+			return
+		}
+		req := new(Msg)
+		req.Unpack(p[:l])
+		r := new(Msg)
+		r.SetReply(req)
+		buf, _ := r.Pack()
+		a, b := packUint16(uint16(len(buf)))
+		server.Write(append([]byte{a, b}, buf...))
+	}()
+	if r, err := c.ExchangeConn(m, client); err != nil || r.Id != m.Id || !r.Response {
+		t.Logf("Failed to exchange over a stream: %v", err)
+		t.Fail()
+	}
+
+	// Datagrams
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(HelloServer)}).ServeUDP(l)
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	if err != nil {
+		t.Logf("Failed to dial: %s", err)
+		t.Fail()
+		return
+	}
+	defer conn.Close()
+	for i := 0; i < 2; i++ {
+		m.Id = Id()
+		if r, err := c.ExchangeConn(m, conn); err != nil || r.Id != m.Id {
+			t.Logf("Failed to exchange datagram %d: %v", i, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestTransferZone(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	secret := "so6ZGir4GPAqINNh9U5c3A=="
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		zone := req.Question[0].Name
+		soa, _ := NewRR(zone + " 3600 IN SOA ns.miek.nl. miek.miek.nl. 2012 14400 3600 604800 86400")
+		a, _ := NewRR("www." + zone + " 3600 IN A 127.0.0.1")
+		ns, _ := NewRR(zone + " 3600 IN NS ns.miek.nl.")
+		write := func(rrs ...RR) {
+			m := new(Msg)
+			m.SetReply(req)
+			m.Answer = rrs
+			if req.IsTsig() && zone != "nosig.miek.nl." {
+				m.SetTsig("axfr.", HmacMD5, 300, uint64(time.Now().Unix()))
+				TsigGenerate(m, secret, req.Extra[len(req.Extra)-1].(*RR_TSIG).MAC, false)
+			}
+			buf, _ := m.Pack()
+			w.Write(buf)
+		}
+		switch {
+		case req.Question[0].Qtype == TypeSOA:
+			write(soa)
+		case req.IsTsig():
+			write(soa, a, ns, soa)
+		default:
+			write(soa, a)
+			write(ns, soa)
+		}
+	})}).ServeTCP(l)
+
+	for _, key := range []*TsigKey{nil, {Name: "axfr.", Secret: secret}} {
+		rrs, serial, err := TransferZone("miek.nl", l.Addr().String(), key)
+		if err != nil || serial != 2012 || len(rrs) != 3 || rrs[0].Header().Rrtype != TypeSOA || rrs[2].Header().Rrtype != TypeNS {
+			t.Logf("Failed to transfer miek.nl. with key %v: %v %v", key, err, rrs)
+			t.Fail()
+		}
+	}
+	if _, _, err := TransferZone("nosig.miek.nl.", l.Addr().String(), &TsigKey{Name: "axfr.", Secret: secret}); err != ErrNoSig {
+		t.Logf("Expected ErrNoSig for unsigned answers, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestClientTrace(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(HelloServer)}).ServeUDP(l)
+
+	var events []string
+	c := NewClient()
+	c.Trace = &ClientTrace{
+		DNSStart: func(m *Msg, addr string) { events = append(events, "start "+m.Question[0].Name) },
+		ConnectDone: func(network, addr string, err error) {
+			events = append(events, "connect "+network)
+		},
+		WroteQuery: func(n int, err error) {
+			if err == nil && n > 0 {
+				events = append(events, "wrote")
+			}
+		},
+		GotResponse: func(n int, err error) {
+			if err == nil && n > 0 {
+				events = append(events, "got")
+			}
+		},
+	}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	if _, err := c.Exchange(m, l.LocalAddr().String()); err != nil {
+		t.Logf("Failed to exchange: %s", err)
+		t.Fail()
+		return
+	}
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	if err != nil {
+		t.Logf("Failed to dial: %s", err)
+		t.Fail()
+		return
+	}
+	defer conn.Close()
+	if _, err := c.ExchangeConn(m, conn); err != nil {
+		t.Logf("Failed to exchange over conn: %s", err)
+		t.Fail()
+		return
+	}
+	want := "start miek.nl.,connect udp,wrote,got,start miek.nl.,wrote,got"
+	if got := strings.Join(events, ","); got != want {
+		t.Logf("Expected the events %s, got %s", want, got)
+		t.Fail()
+	}
+}
+
+func TestQueryConn(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(HelloServer)}).ServeUDP(l)
+
+	handler := queryHandlerFunc(func(w RequestWriter, m *Msg) {
+		if err := w.Send(m); err != nil {
+			w.(*reply).replies() <- &Exchange{Request: m, Error: err}
+			return
+		}
+		r, err := w.Receive()
+		w.(*reply).replies() <- &Exchange{Request: m, Reply: r, Error: err}
+	})
+	q1, q2 := NewQueryConn(handler), NewQueryConn(handler)
+	defer q2.Close()
+	c1, c2 := NewClient(), NewClient()
+	c1.QueryConn, c2.QueryConn = q1, q2
+
+	replies := make(chan *Exchange)
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	get := func() *Exchange {
+		select {
+		case e := <-replies:
+			return e
+		case <-time.After(2 * time.Second):
+			return &Exchange{Error: ErrServ}
+		}
+	}
+	go c1.DoChan(m, l.LocalAddr().String(), replies)
+	if e := get(); e.Error != nil || e.Reply == nil {
+		t.Logf("Expected a reply, got %v", e.Error)
+		t.Fail()
+	}
+	go c1.DoDeadline(m, l.LocalAddr().String(), replies, time.Now().Add(-time.Second))
+	if e := get(); e.Error == nil {
+		t.Log("Expected an error for a query past its deadline")
+		t.Fail()
+	}
+	q1.Close()
+	q1.Close()
+	go c1.DoChan(m, l.LocalAddr().String(), replies)
+	if e := get(); e.Error != ErrQueryConn {
+		t.Logf("Expected ErrQueryConn after Close, got %v", e.Error)
+		t.Fail()
+	}
+	go c2.DoChan(m, l.LocalAddr().String(), replies)
+	if e := get(); e.Error != nil || e.Reply == nil {
+		t.Logf("Expected a reply from the second QueryConn, got %v", e.Error)
+		t.Fail()
+	}
+}
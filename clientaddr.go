@@ -0,0 +1,63 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// The address of the client a server answers, for answers that depend on
+// where the client is.
+
+import (
+	"net"
+)
+
+// ClientAddr returns the network of the client that sent request r to w:
+// the network of the edns-client-subnet option of r when it has one, the
+// (single address) network of w.RemoteAddr() otherwise. It returns nil
+// when neither is known.
+func ClientAddr(w ResponseWriter, r *Msg) *net.IPNet {
+	if o := requestOpt(r); o != nil {
+		if n, ok := o.ClientSubnet(); ok {
+			return n
+		}
+	}
+	var ip net.IP
+	switch a := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	default:
+		return nil
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+}
+
+// A ClientHandler answers requests depending on the client, with geo-IP
+// or topology data for instance. ServeDNSClient gets the network of the
+// client from ClientAddr.
+type ClientHandler interface {
+	ServeDNSClient(w ResponseWriter, r *Msg, client *net.IPNet)
+}
+
+// The ClientHandlerFunc type is an adapter to allow the use of ordinary
+// functions as client handlers.
+type ClientHandlerFunc func(ResponseWriter, *Msg, *net.IPNet)
+
+// ServeDNSClient calls f(w, r, client).
+func (f ClientHandlerFunc) ServeDNSClient(w ResponseWriter, r *Msg, client *net.IPNet) {
+	f(w, r, client)
+}
+
+// ClientAddrHandler returns a Handler that finds the network of the
+// client of each request with ClientAddr and calls h with it.
+func ClientAddrHandler(h ClientHandler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		h.ServeDNSClient(w, r, ClientAddr(w, r))
+	})
+}
@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+type addrWriter struct {
+	bufferWriter
+	addr net.Addr
+}
+
+func (w *addrWriter) RemoteAddr() net.Addr { return w.addr }
+
+func TestClientAddr(t *testing.T) {
+	w := &addrWriter{addr: &net.UDPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 5353}}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	var got *net.IPNet
+	h := ClientAddrHandler(ClientHandlerFunc(func(w ResponseWriter, r *Msg, client *net.IPNet) {
+		got = client
+	}))
+	h.ServeDNS(w, m)
+	if got == nil || got.String() != "198.51.100.7/32" {
+		t.Logf("Client should be the source address, not %v", got)
+		t.Fail()
+	}
+
+	// 192.0.2.128/25, scope 0, with a stray bit past the prefix
+	m.SetEdns0(4096, false)
+	opt := m.Extra[0].(*RR_OPT)
+	opt.Option = append(opt.Option, Option{OptionCodeSubnet, "00011900c00002ff"})
+	h.ServeDNS(w, m)
+	if got == nil || got.String() != "192.0.2.128/25" {
+		t.Logf("Client should be the client subnet, not %v", got)
+		t.Fail()
+	}
+}
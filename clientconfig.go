@@ -23,6 +23,29 @@ type ClientConfig struct {
 	Ndots    int      // number of dots in name to trigger absolute lookup
 	Timeout  int      // seconds before giving up on packet
 	Attempts int      // lost packets before giving up on server
+	// Failover holds the rcodes for which the next server is tried,
+	// DefaultFailover if nil.
+	Failover []int
+}
+
+// DefaultFailover are the rcodes for which Client.ExchangeConfig tries the
+// next server: the server can not or will not answer, another one may.
+// NXDOMAIN is a real answer, so it is not failed over.
+var DefaultFailover = []int{RcodeServerFailure, RcodeNotImplemented, RcodeRefused}
+
+// failover returns true if the next server should be tried after an
+// answer with rcode.
+func (c *ClientConfig) failover(rcode int) bool {
+	f := c.Failover
+	if f == nil {
+		f = DefaultFailover
+	}
+	for _, r := range f {
+		if r == rcode {
+			return true
+		}
+	}
+	return false
 }
 
 // ClientConfigFromFile parses a resolv.conf(5) like file and returns
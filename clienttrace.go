@@ -0,0 +1,55 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Hooks to trace the synchronous exchanges of a client.
+
+// A ClientTrace is a set of hooks that are called during the synchronous
+// exchanges of a Client: Exchange, ExchangeWithInfo, ExchangeBuffer and
+// ExchangeConn. Any of the hooks may be nil. They are called from the
+// goroutine doing the exchange, in this order; when a step fails, the hook
+// of that step gets the error and the later hooks are not called.
+//
+// The time between DNSStart and ConnectDone is spent dialing, between
+// WroteQuery and GotResponse waiting for the server, and after GotResponse,
+// until the exchange returns, unpacking the reply.
+type ClientTrace struct {
+	// DNSStart is called when the exchange of m with the server at
+	// addr starts, before m is packed.
+	DNSStart func(m *Msg, addr string)
+	// ConnectDone is called when dialing the server is done. It is not
+	// called when no connection is set up: for a Hijacked connection
+	// and in ExchangeConn.
+	ConnectDone func(network, addr string, err error)
+	// WroteQuery is called when the query of n bytes is written.
+	WroteQuery func(n int, err error)
+	// GotResponse is called when the reply of n bytes is read, before it
+	// is unpacked.
+	GotResponse func(n int, err error)
+}
+
+func (t *ClientTrace) dnsStart(m *Msg, addr string) {
+	if t != nil && t.DNSStart != nil {
+		t.DNSStart(m, addr)
+	}
+}
+
+func (t *ClientTrace) connectDone(network, addr string, err error) {
+	if t != nil && t.ConnectDone != nil {
+		t.ConnectDone(network, addr, err)
+	}
+}
+
+func (t *ClientTrace) wroteQuery(n int, err error) {
+	if t != nil && t.WroteQuery != nil {
+		t.WroteQuery(n, err)
+	}
+}
+
+func (t *ClientTrace) gotResponse(n int, err error) {
+	if t != nil && t.GotResponse != nil {
+		t.GotResponse(n, err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Compact storage of large numbers of RRs.
+
+// CompactRRs stores RRs in a compact form, for holding millions of
+// records. Each owner name is stored once and the rdata is
+// kept in (uncompressed) wire format in a single buffer, so an RR costs
+// little more than its rdata. An RR is only decoded, to a new RR, when it
+// is asked for with RR.
+//
+// The zero value is ready to use. A CompactRRs is not safe for
+// concurrent use when RRs are being added.
+type CompactRRs struct {
+	names []string          // the interned owner names
+	index map[string]uint32 // the index of a name in names
+	rrs   []compactRR
+	data  []byte // the rdata of all RRs
+	buf   []byte // the buffer for packing the RRs, reused by Add
+}
+
+// compactRR is the header of an RR, with its rdata in data[off:off+rdlength].
+type compactRR struct {
+	name     uint32
+	rrtype   uint16
+	class    uint16
+	ttl      uint32
+	off      uint32
+	rdlength uint16
+}
+
+// Add adds rr. It returns an error when rr cannot be packed.
+func (c *CompactRRs) Add(rr RR) error {
+	h := rr.Header()
+	var rdata []byte
+	var ok bool
+	rdata, c.buf, ok = packRdata(rr, c.buf)
+	if !ok || len(rdata) > 0xFFFF {
+		return &Error{Err: "failed to pack rr", Name: h.Name}
+	}
+	if uint64(len(c.data))+uint64(len(rdata)) > 1<<32-1 {
+		return &Error{Err: "compact storage is full", Name: h.Name}
+	}
+	if c.index == nil {
+		c.index = make(map[string]uint32)
+	}
+	n, ok := c.index[h.Name]
+	if !ok {
+		n = uint32(len(c.names))
+		c.names = append(c.names, h.Name)
+		c.index[h.Name] = n
+	}
+	c.rrs = append(c.rrs, compactRR{name: n, rrtype: h.Rrtype, class: h.Class, ttl: h.Ttl,
+		off: uint32(len(c.data)), rdlength: uint16(len(rdata))})
+	c.data = append(c.data, rdata...)
+	return nil
+}
+
+// Len returns the number of RRs.
+func (c *CompactRRs) Len() int {
+	return len(c.rrs)
+}
+
+// Header returns the header of the i-th RR, without decoding its rdata.
+// The Rdlength is the length of the uncompressed rdata.
+func (c *CompactRRs) Header(i int) RR_Header {
+	r := c.rrs[i]
+	return RR_Header{Name: c.names[r.name], Rrtype: r.rrtype, Class: r.class, Ttl: r.ttl, Rdlength: r.rdlength}
+}
+
+// Rdata returns the rdata of the i-th RR in wire format. The returned slice
+// must not be modified.
+func (c *CompactRRs) Rdata(i int) []byte {
+	r := c.rrs[i]
+	return c.data[r.off : r.off+uint32(r.rdlength)]
+}
+
+// RR decodes the i-th RR. Each call returns a new RR. It returns nil when
+// the RR cannot be decoded, which only happens for types that cannot be
+// unpacked from what they pack to.
+func (c *CompactRRs) RR(i int) RR {
+	h := c.Header(i)
+	// The owner name is the root, it is filled in after unpacking
+	wire := make([]byte, 11, 11+int(h.Rdlength))
+	wire[1], wire[2] = packUint16(h.Rrtype)
+	wire[3], wire[4] = packUint16(h.Class)
+	wire[5], wire[6] = packUint16(uint16(h.Ttl >> 16))
+	wire[7], wire[8] = packUint16(uint16(h.Ttl))
+	wire[9], wire[10] = packUint16(h.Rdlength)
+	wire = append(wire, c.Rdata(i)...)
+	rr, _, ok := unpackRR(wire, 0)
+	if !ok || rr == nil {
+		return nil
+	}
+	rr.Header().Name = h.Name
+	return rr
+}
+
+// Names returns the number of distinct owner names.
+func (c *CompactRRs) Names() int {
+	return len(c.names)
+}
@@ -0,0 +1,53 @@
+package dns
+
+import (
+	"testing"
+)
+
+func TestCompactRRs(t *testing.T) {
+	var c CompactRRs
+	var rrs []RR
+	for _, s := range []string{
+		"miek.nl. 3600 IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1 14400 3600 604800 86400",
+		"miek.nl. 3600 IN MX 10 mx.miek.nl.",
+		"miek.nl. 3600 IN TXT \"v=spf1 -all\" \"second\"",
+		"www.miek.nl. 1800 IN A 127.0.0.1",
+		"www.miek.nl. 1800 IN AAAA ::1",
+		"miek.nl. 3600 IN NS ns1.miek.nl.",
+	} {
+		rr, err := NewRR(s)
+		if err != nil {
+			t.Logf("Failed to parse %q: %s", s, err)
+			t.Fail()
+			continue
+		}
+		if err := c.Add(rr); err != nil {
+			t.Logf("Failed to add %s: %s", rr, err)
+			t.Fail()
+		}
+		rrs = append(rrs, rr)
+	}
+	if c.Len() != len(rrs) || c.Names() != 2 {
+		t.Logf("Expected %d RRs with 2 names, got %d with %d", len(rrs), c.Len(), c.Names())
+		t.Fail()
+		return
+	}
+	for i, rr := range rrs {
+		h := c.Header(i)
+		if h.Name != rr.Header().Name || h.Rrtype != rr.Header().Rrtype || h.Ttl != rr.Header().Ttl {
+			t.Logf("Header %d is %v, expected %v", i, h, rr.Header())
+			t.Fail()
+		}
+		got := c.RR(i)
+		if got == nil || got.String() != rr.String() {
+			t.Logf("RR %d is %v, expected %s", i, got, rr)
+			t.Fail()
+		}
+	}
+	// The buffer for packing is reused, not allocated for each RR
+	buf := c.buf
+	if c.Add(rrs[3]); len(buf) == 0 || &c.buf[0] != &buf[0] {
+		t.Log("The packing buffer should be reused")
+		t.Fail()
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Functions for comparing resource records and sets of them.
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RRsEqual returns true when a and b are the same resource record. The
+// owner names are compared case-insensitively, the TTL is not taken into
+// account and the rdata is compared in wire format, with the domain names
+// in it compared case-insensitively.
+func RRsEqual(a, b RR) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ka, ok := rrKey(a)
+	if !ok {
+		return false
+	}
+	kb, ok := rrKey(b)
+	if !ok {
+		return false
+	}
+	return ka == kb
+}
+
+// DiffRRsets compares the RRs in from with the RRs in to. It returns
+// the RRs that are only present in to (added) and the RRs that
+// are only present in from (removed). Equality is defined as in RRsEqual.
+func DiffRRsets(from, to []RR) (added, removed []RR) {
+	seen := make(map[string]bool)
+	for _, r := range from {
+		if k, ok := rrKey(r); ok {
+			seen[k] = true
+		}
+	}
+	now := make(map[string]bool)
+	for _, r := range to {
+		k, ok := rrKey(r)
+		if !ok {
+			continue
+		}
+		now[k] = true
+		if !seen[k] {
+			added = append(added, r)
+		}
+	}
+	for _, r := range from {
+		k, ok := rrKey(r)
+		if !ok {
+			continue
+		}
+		if !now[k] {
+			removed = append(removed, r)
+		}
+	}
+	return
+}
+
+// rrKey returns a string that uniquely identifies r: the lowercased
+// ownername, the class, the type and the rdata in wire format, with the
+// domain names in it lowercased as in the canonical form of RFC 4034,
+// section 6.2.
+func rrKey(r RR) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	rdata, ok := rawRdata(lowerNames(r))
+	if !ok {
+		return "", false
+	}
+	h := r.Header()
+	return strings.ToLower(Fqdn(h.Name)) + " " + strconv.Itoa(int(h.Class)) +
+		" " + strconv.Itoa(int(h.Rrtype)) + " " + string(rdata), true
+}
+
+// lowerNames returns r, or a copy of r when it has domain names with
+// uppercase letters in its rdata, in which these names are lowercased.
+func lowerNames(r RR) RR {
+	v := reflect.ValueOf(r).Elem()
+	var c reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		switch v.Type().Field(i).Tag {
+		case "domain-name", "cdomain-name", "gateway":
+		default:
+			continue
+		}
+		if v.Field(i).Kind() != reflect.String {
+			continue
+		}
+		name := v.Field(i).String()
+		if lower := strings.ToLower(name); lower != name {
+			if !c.IsValid() {
+				r = copyRR(r)
+				c = reflect.ValueOf(r).Elem()
+			}
+			c.Field(i).SetString(lower)
+		}
+	}
+	return r
+}
+
+// rawRdata returns the rdata of r in (uncompressed) wire format.
+func rawRdata(r RR) ([]byte, bool) {
+	rdata, _, ok := packRdata(r, nil)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), rdata...), true
+}
+
+// packRdata packs r in buf, which is replaced by a larger one when it is
+// too small, and returns the rdata in wire format and the buffer, to be
+// reused. The rdata is a slice of the buffer.
+func packRdata(r RR, buf []byte) (rdata, buf1 []byte, ok bool) {
+	n := r.Len()*2 + DefaultMsgSize
+	if len(buf) < n {
+		buf = make([]byte, n)
+	} else {
+		// Packing NSEC bitmaps ors bits into the buffer
+		for i := range buf[:n] {
+			buf[i] = 0
+		}
+	}
+	off, ok := packRR(r, buf, 0, nil, false)
+	if !ok {
+		return nil, buf, false
+	}
+	_, start, ok := UnpackDomainName(buf, 0)
+	if !ok {
+		return nil, buf, false
+	}
+	start += 10 // rrtype(2) + class(2) + ttl(4) + rdlength(2)
+	if start > off {
+		return nil, buf, false
+	}
+	return buf[start:off], buf, true
+}
+
+// Dedup removes the duplicate RRs from rrs, equality is defined as in
+// RRsEqual. The order of the RRs is preserved. When duplicates differ in
+// TTL, the lowest TTL is set in a copy of the RR that is kept; the RRs in
+// rrs are not modified.
+func Dedup(rrs []RR) []RR {
+	index := make(map[string]int)
+	copied := make(map[int]bool)
+	out := make([]RR, 0, len(rrs))
+	for _, r := range rrs {
+		k, ok := rrKey(r)
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+		if i, ok := index[k]; ok {
+			if r.Header().Ttl < out[i].Header().Ttl {
+				if !copied[i] {
+					out[i] = copyRR(out[i])
+					copied[i] = true
+				}
+				out[i].Header().Ttl = r.Header().Ttl
+			}
+			continue
+		}
+		index[k] = len(out)
+		out = append(out, r)
+	}
+	return out
+}
+
+// MsgsEqual returns true when a and b are the same message, see DiffMsgs.
+func MsgsEqual(a, b *Msg) bool {
+	return len(DiffMsgs(a, b)) == 0
+}
+
+// DiffMsgs compares the messages a and b and returns their differences,
+// one per line, in a form suited for the log of a test. The message ID and
+// the compression of the messages are not compared, nor is the order of
+// the RRs in a section. Names in the question section are compared
+// case-insensitively. The RRs are compared as in RRsEqual, but with the
+// TTL; an RR that is only in a is reported as "- RR" and an RR that is
+// only in b as "+ RR", prefixed with the name of the section.
+func DiffMsgs(a, b *Msg) []string {
+	if a == nil || b == nil {
+		if a == b {
+			return nil
+		}
+		return []string{"message: " + a.String() + " != " + b.String()}
+	}
+	var diff []string
+	flag := func(name string, x, y bool) {
+		if x != y {
+			diff = append(diff, name+": "+strconv.FormatBool(x)+" != "+strconv.FormatBool(y))
+		}
+	}
+	flag("qr", a.Response, b.Response)
+	if a.Opcode != b.Opcode {
+		diff = append(diff, "opcode: "+OpcodeToString(a.Opcode)+" != "+OpcodeToString(b.Opcode))
+	}
+	flag("aa", a.Authoritative, b.Authoritative)
+	flag("tc", a.Truncated, b.Truncated)
+	flag("rd", a.RecursionDesired, b.RecursionDesired)
+	flag("ra", a.RecursionAvailable, b.RecursionAvailable)
+	flag("z", a.Zero, b.Zero)
+	flag("ad", a.AuthenticatedData, b.AuthenticatedData)
+	flag("cd", a.CheckingDisabled, b.CheckingDisabled)
+	if a.Rcode != b.Rcode {
+		diff = append(diff, "rcode: "+RcodeToString(a.Rcode)+" != "+RcodeToString(b.Rcode))
+	}
+	qa := make([]string, len(a.Question))
+	for i, q := range a.Question {
+		q.Name = strings.ToLower(q.Name)
+		qa[i] = q.String()
+	}
+	qb := make([]string, len(b.Question))
+	for i, q := range b.Question {
+		q.Name = strings.ToLower(q.Name)
+		qb[i] = q.String()
+	}
+	onlyA, onlyB := diffKeys(qa, qb)
+	for _, i := range onlyA {
+		diff = append(diff, "question: - "+a.Question[i].String())
+	}
+	for _, i := range onlyB {
+		diff = append(diff, "question: + "+b.Question[i].String())
+	}
+	diff = append(diff, diffSection("answer", a.Answer, b.Answer)...)
+	diff = append(diff, diffSection("authority", a.Ns, b.Ns)...)
+	diff = append(diff, diffSection("additional", a.Extra, b.Extra)...)
+	return diff
+}
+
+// diffSection returns the differences between the RRs of a section of
+// two messages.
+func diffSection(section string, a, b []RR) []string {
+	onlyA, onlyB := diffKeys(sectionKeys(a), sectionKeys(b))
+	var diff []string
+	for _, i := range onlyA {
+		diff = append(diff, section+": - "+a[i].String())
+	}
+	for _, i := range onlyB {
+		diff = append(diff, section+": + "+b[i].String())
+	}
+	return diff
+}
+
+// sectionKeys returns the keys (see rrKey) of rrs, prefixed with the TTL.
+func sectionKeys(rrs []RR) []string {
+	keys := make([]string, len(rrs))
+	for i, r := range rrs {
+		k, ok := rrKey(r)
+		if !ok {
+			// Not packable, compare the text
+			keys[i] = r.String()
+			continue
+		}
+		keys[i] = strconv.Itoa(int(r.Header().Ttl)) + " " + k
+	}
+	return keys
+}
+
+// diffKeys returns the indices of the keys that are only in a and of those
+// that are only in b, counting duplicates.
+func diffKeys(a, b []string) (onlyA, onlyB []int) {
+	count := make(map[string]int)
+	for _, k := range b {
+		count[k]++
+	}
+	for i, k := range a {
+		if count[k] > 0 {
+			count[k]--
+			continue
+		}
+		onlyA = append(onlyA, i)
+	}
+	for i, k := range b {
+		if count[k] > 0 {
+			count[k]--
+			onlyB = append(onlyB, i)
+		}
+	}
+	return
+}
+
+// A ZoneDiff holds the differences between two zones, see CompareZones.
+// All lists are in the canonical order of the zone.
+type ZoneDiff struct {
+	Missing []RR         // the RRs only in the first zone
+	Extra   []RR         // the RRs only in the second zone
+	TTL     []ZoneChange // the RRs in both zones, but with a different TTL
+	Rdata   []ZoneChange // the RRs of an RRset in both zones, but with different rdata
+}
+
+// A ZoneChange is an RR as it is in the first (A) and in the second (B)
+// zone.
+type ZoneChange struct {
+	A, B RR
+}
+
+// Equal returns true when there are no differences.
+func (d *ZoneDiff) Equal() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.TTL) == 0 && len(d.Rdata) == 0
+}
+
+// CompareZones compares the zones a and b, for instance the RRs of a zone
+// file and those received with an AXFR from a secondary. RRs are compared
+// as in RRsEqual; an RR that is in both zones with another TTL is reported
+// in TTL. When an RRset is in both zones but some of its rdata is not,
+// those RRs are paired in Rdata and the remainder of the one side with
+// more RRs is reported in Missing or Extra.
+//
+// Both zones are sorted in canonical order and then merged, so large zones
+// can be compared without building an index. The order of a and b is not
+// changed.
+func CompareZones(a, b []RR) *ZoneDiff {
+	ea, eb := zoneEntries(a), zoneEntries(b)
+	sort.Sort(ea)
+	sort.Sort(eb)
+	d := new(ZoneDiff)
+	i, j := 0, 0
+	for i < len(ea) || j < len(eb) {
+		var c int
+		switch {
+		case i == len(ea):
+			c = 1
+		case j == len(eb):
+			c = -1
+		default:
+			c = ea[i].compareSet(&eb[j])
+		}
+		switch {
+		case c < 0:
+			d.Missing = append(d.Missing, ea[i].rr)
+			i++
+		case c > 0:
+			d.Extra = append(d.Extra, eb[j].rr)
+			j++
+		default:
+			i, j = d.compareRRset(ea, eb, i, j)
+		}
+	}
+	return d
+}
+
+// compareRRset compares the RRset that starts at ea[i] with the same RRset
+// starting at eb[j]. It returns the indices after those RRsets.
+func (d *ZoneDiff) compareRRset(ea, eb zoneEntryList, i, j int) (int, int) {
+	var onlyA, onlyB []RR
+	ei, ej := i+1, j+1
+	for ei < len(ea) && ea[ei].compareSet(&ea[i]) == 0 {
+		ei++
+	}
+	for ej < len(eb) && eb[ej].compareSet(&eb[j]) == 0 {
+		ej++
+	}
+	for i < ei || j < ej {
+		var c int
+		switch {
+		case i == ei:
+			c = 1
+		case j == ej:
+			c = -1
+		default:
+			c = bytes.Compare(ea[i].rdata, eb[j].rdata)
+		}
+		switch {
+		case c < 0:
+			onlyA = append(onlyA, ea[i].rr)
+			i++
+		case c > 0:
+			onlyB = append(onlyB, eb[j].rr)
+			j++
+		default:
+			if ea[i].rr.Header().Ttl != eb[j].rr.Header().Ttl {
+				d.TTL = append(d.TTL, ZoneChange{ea[i].rr, eb[j].rr})
+			}
+			i++
+			j++
+		}
+	}
+	for len(onlyA) > 0 && len(onlyB) > 0 {
+		d.Rdata = append(d.Rdata, ZoneChange{onlyA[0], onlyB[0]})
+		onlyA, onlyB = onlyA[1:], onlyB[1:]
+	}
+	d.Missing = append(d.Missing, onlyA...)
+	d.Extra = append(d.Extra, onlyB...)
+	return i, j
+}
+
+// zoneEntry is an RR with the parts needed for sorting it in canonical
+// order.
+type zoneEntry struct {
+	rr    RR
+	name  string // lowercased owner name
+	class uint16
+	typ   uint16
+	rdata []byte
+}
+
+// compareSet compares the owner name, class and type of e and f.
+func (e *zoneEntry) compareSet(f *zoneEntry) int {
+	if e.name != f.name {
+		if c := CompareDomainName(e.name, f.name); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case e.class < f.class:
+		return -1
+	case e.class > f.class:
+		return 1
+	case e.typ < f.typ:
+		return -1
+	case e.typ > f.typ:
+		return 1
+	}
+	return 0
+}
+
+type zoneEntryList []zoneEntry
+
+func zoneEntries(rrs []RR) zoneEntryList {
+	l := make(zoneEntryList, 0, len(rrs))
+	var buf []byte
+	for _, r := range rrs {
+		if r == nil {
+			continue
+		}
+		h := r.Header()
+		var (
+			rdata []byte
+			ok    bool
+		)
+		if rdata, buf, ok = packRdata(lowerNames(r), buf); ok {
+			// Keep only the rdata, not the whole buffer
+			rdata = append([]byte(nil), rdata...)
+		} else {
+			// Not packable, compare the text
+			rdata = []byte(r.String())
+		}
+		l = append(l, zoneEntry{rr: r, name: strings.ToLower(Fqdn(h.Name)), class: h.Class, typ: h.Rrtype, rdata: rdata})
+	}
+	return l
+}
+
+func (p zoneEntryList) Len() int { return len(p) }
+func (p zoneEntryList) Less(i, j int) bool {
+	if c := p[i].compareSet(&p[j]); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(p[i].rdata, p[j].rdata) < 0
+}
+func (p zoneEntryList) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
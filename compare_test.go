@@ -0,0 +1,160 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRRsEqual(t *testing.T) {
+	a1, _ := NewRR("miek.nl. 3600 IN A 127.0.0.1")
+	a2, _ := NewRR("MIEK.nl. 1800 IN A 127.0.0.1")
+	a3, _ := NewRR("miek.nl. 3600 IN A 127.0.0.2")
+	mx, _ := NewRR("miek.nl. 3600 IN MX 10 mx.miek.nl.")
+
+	if !RRsEqual(a1, a2) {
+		t.Logf("%s and %s should be equal", a1, a2)
+		t.Fail()
+	}
+	if RRsEqual(a1, a3) {
+		t.Logf("%s and %s should not be equal", a1, a3)
+		t.Fail()
+	}
+	if RRsEqual(a1, mx) {
+		t.Logf("%s and %s should not be equal", a1, mx)
+		t.Fail()
+	}
+	mx1, _ := NewRR("miek.nl. 3600 IN MX 10 MX.Miek.nl.")
+	if !RRsEqual(mx, mx1) || mx1.(*RR_MX).Mx != "MX.Miek.nl." {
+		t.Logf("%s and %s should be equal", mx, mx1)
+		t.Fail()
+	}
+}
+
+func TestDiffRRsets(t *testing.T) {
+	a1, _ := NewRR("miek.nl. IN A 127.0.0.1")
+	a2, _ := NewRR("miek.nl. IN A 127.0.0.2")
+	a3, _ := NewRR("miek.nl. IN A 127.0.0.3")
+
+	added, removed := DiffRRsets([]RR{a1, a2}, []RR{a2, a3})
+	if len(added) != 1 || !RRsEqual(added[0], a3) {
+		t.Logf("Added should hold %s: %v", a3, added)
+		t.Fail()
+	}
+	if len(removed) != 1 || !RRsEqual(removed[0], a1) {
+		t.Logf("Removed should hold %s: %v", a1, removed)
+		t.Fail()
+	}
+}
+
+func TestDedup(t *testing.T) {
+	a1, _ := NewRR("miek.nl. 3600 IN A 127.0.0.1")
+	a2, _ := NewRR("miek.nl. 1800 IN A 127.0.0.1")
+	a3, _ := NewRR("miek.nl. 3600 IN A 127.0.0.2")
+
+	rrs := Dedup([]RR{a1, a2, a3})
+	if len(rrs) != 2 {
+		t.Logf("Dedup should return 2 RRs: %v", rrs)
+		t.Fail()
+		return
+	}
+	if rrs[0].Header().Ttl != 1800 {
+		t.Logf("Lowest TTL should be kept: %s", rrs[0])
+		t.Fail()
+	}
+	if a1.Header().Ttl != 3600 || rrs[1] != a3 {
+		t.Logf("The RRs given to Dedup should not be modified: %s", a1)
+		t.Fail()
+	}
+}
+
+func TestDiffMsgs(t *testing.T) {
+	a := new(Msg)
+	a.SetQuestion("miek.nl.", TypeA)
+	a.Answer = newRRs("miek.nl. 3600 IN A 127.0.0.1", "miek.nl. 3600 IN A 127.0.0.2")
+	b := new(Msg)
+	b.SetQuestion("MIEK.nl.", TypeA)
+	b.Answer = newRRs("miek.nl. 3600 IN A 127.0.0.2", "miek.nl. 3600 IN A 127.0.0.1")
+	b.Compress = true
+	if !MsgsEqual(a, b) {
+		t.Logf("Messages should be equal: %v", DiffMsgs(a, b))
+		t.Fail()
+	}
+
+	b.Rcode = RcodeNameError
+	b.Answer = newRRs("miek.nl. 3600 IN A 127.0.0.2", "miek.nl. 300 IN A 127.0.0.1", "miek.nl. 300 IN A 127.0.0.1")
+	diff := DiffMsgs(a, b)
+	if len(diff) != 4 || diff[0] != "rcode: NOERROR != NXDOMAIN" ||
+		!strings.HasPrefix(diff[1], "answer: - miek.nl.\t3600") ||
+		!strings.HasPrefix(diff[2], "answer: + miek.nl.\t300") || diff[2] != diff[3] {
+		t.Logf("Wrong differences: %q", diff)
+		t.Fail()
+	}
+	if MsgsEqual(a, nil) || !MsgsEqual(nil, nil) {
+		t.Log("Nil messages should only equal each other")
+		t.Fail()
+	}
+}
+
+func TestCompareZones(t *testing.T) {
+	zone := func(s ...string) []RR {
+		var rrs []RR
+		for _, r := range s {
+			rr, err := NewRR(r)
+			if err != nil {
+				t.Logf("Failed to parse %q: %s", r, err)
+				t.Fail()
+				continue
+			}
+			rrs = append(rrs, rr)
+		}
+		return rrs
+	}
+	primary := zone(
+		"miek.nl. 3600 IN SOA open.nlnetlabs.nl. miekg.atoom.net. 2 14400 3600 604800 86400",
+		"miek.nl. 3600 IN NS ns1.miek.nl.",
+		"miek.nl. 3600 IN NS ns2.miek.nl.",
+		"a.miek.nl. 3600 IN A 127.0.0.1",
+		"b.miek.nl. 3600 IN A 127.0.0.2",
+		"www.miek.nl. 3600 IN CNAME a.miek.nl.",
+	)
+	// Names, also those in the rdata, compare case-insensitively
+	secondary := zone(
+		"WWW.miek.nl. 3600 IN CNAME A.miek.nl.",
+		"a.miek.nl. 1800 IN A 127.0.0.1",
+		"c.miek.nl. 3600 IN A 127.0.0.3",
+		"miek.nl. 3600 IN NS NS1.miek.nl.",
+		"miek.nl. 3600 IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1 14400 3600 604800 86400",
+	)
+	d := CompareZones(primary, secondary)
+	if d.Equal() {
+		t.Log("Zones should differ")
+		t.Fail()
+	}
+	if len(d.Missing) != 2 || !strings.HasPrefix(d.Missing[0].String(), "miek.nl.\t3600\tIN\tNS\tns2") ||
+		!strings.HasPrefix(d.Missing[1].String(), "b.miek.nl.") {
+		t.Logf("Missing should hold the NS of ns2 and b: %v", d.Missing)
+		t.Fail()
+	}
+	if len(d.Extra) != 1 || !strings.HasPrefix(d.Extra[0].String(), "c.miek.nl.") {
+		t.Logf("Extra should hold c: %v", d.Extra)
+		t.Fail()
+	}
+	if len(d.TTL) != 1 || d.TTL[0].A.Header().Ttl != 3600 || d.TTL[0].B.Header().Ttl != 1800 {
+		t.Logf("TTL should hold a: %v", d.TTL)
+		t.Fail()
+	}
+	if len(d.Rdata) != 1 || d.Rdata[0].A.(*RR_SOA).Serial != 2 || d.Rdata[0].B.(*RR_SOA).Serial != 1 {
+		t.Logf("Rdata should hold the SOA: %v", d.Rdata)
+		t.Fail()
+	}
+	for _, e := range zoneEntries(primary) {
+		if cap(e.rdata) > 64 {
+			t.Logf("The rdata of %s should not keep the packing buffer, its capacity is %d", e.rr, cap(e.rdata))
+			t.Fail()
+		}
+	}
+	if d := CompareZones(primary, primary); !d.Equal() {
+		t.Logf("Zone should equal itself: %+v", d)
+		t.Fail()
+	}
+}
@@ -1,17 +1,22 @@
 package dns
 
+import (
+	"strings"
+)
+
 // Everything is assumed in the ClassINET class. If
 // you need other classes you are on your own.
 
-// SetReply creates a reply packet from a request message.
+// SetReply creates a reply packet from a request message. The question
+// section is copied from the request, which may hold zero or more questions.
 func (dns *Msg) SetReply(request *Msg) {
 	dns.MsgHdr.Id = request.MsgHdr.Id
 	dns.MsgHdr.Authoritative = true
 	dns.MsgHdr.Response = true
 	dns.MsgHdr.Opcode = OpcodeQuery
 	dns.MsgHdr.Rcode = RcodeSuccess
-	dns.Question = make([]Question, 1)
-	dns.Question[0] = request.Question[0]
+	dns.Question = make([]Question, len(request.Question))
+	copy(dns.Question, request.Question)
 }
 
 // SetQuestion creates a question packet.
@@ -22,6 +27,99 @@ func (dns *Msg) SetQuestion(z string, t uint16) {
 	dns.Question[0] = Question{z, t, ClassINET}
 }
 
+// ChaseCNAME follows the CNAME chain for qname in the answer section of msg.
+// It returns the CNAMEs that make up the chain together with the RRs of
+// type qtype found for the final target, and that final target. When the
+// chain ends without any RRs of type qtype, target is the name that
+// should be queried for next. A loop in the chain returns ErrCnameLoop.
+func ChaseCNAME(msg *Msg, qname string, qtype uint16) (rrs []RR, target string, err error) {
+	target = qname
+	seen := map[string]bool{strings.ToLower(Fqdn(qname)): true}
+	for {
+		var (
+			cname *RR_CNAME
+			found bool
+		)
+		for _, r := range msg.Answer {
+			h := r.Header()
+			if strings.ToLower(Fqdn(h.Name)) != strings.ToLower(Fqdn(target)) {
+				continue
+			}
+			if h.Rrtype == qtype {
+				rrs = append(rrs, r)
+				found = true
+				continue
+			}
+			if c, ok := r.(*RR_CNAME); ok && cname == nil {
+				cname = c
+			}
+		}
+		if found || cname == nil {
+			break
+		}
+		rrs = append(rrs, cname)
+		k := strings.ToLower(Fqdn(cname.Cname))
+		if seen[k] {
+			return rrs, cname.Cname, ErrCnameLoop
+		}
+		seen[k] = true
+		target = cname.Cname
+	}
+	return rrs, target, nil
+}
+
+// Minimize removes the records from the authority and additional section
+// that are not strictly needed, this is akin to BIND's minimal-responses.
+// For an answer only the records proving a wildcard expansion are kept in
+// the authority section. For a referral the NS and DS records and the glue
+// are kept. For a negative response the SOA record and the records proving
+// the denial are kept. The OPT RR is always kept.
+func (dns *Msg) Minimize() {
+	var ns, extra []RR
+	referral := false
+	if len(dns.Answer) == 0 && !dns.Authoritative && dns.Rcode == RcodeSuccess {
+		for _, r := range dns.Ns {
+			if r.Header().Rrtype == TypeNS {
+				referral = true
+				break
+			}
+		}
+	}
+	glue := make(map[string]bool)
+	for _, r := range dns.Ns {
+		t := r.Header().Rrtype
+		if s, ok := r.(*RR_RRSIG); ok {
+			t = s.TypeCovered
+		}
+		switch {
+		case t == TypeNSEC || t == TypeNSEC3:
+			ns = append(ns, r)
+		case len(dns.Answer) > 0 && dns.Rcode == RcodeSuccess:
+		case referral:
+			if n, ok := r.(*RR_NS); ok {
+				glue[strings.ToLower(Fqdn(n.Ns))] = true
+			}
+			if t == TypeNS || t == TypeDS {
+				ns = append(ns, r)
+			}
+		case t == TypeSOA:
+			ns = append(ns, r)
+		}
+	}
+	for _, r := range dns.Extra {
+		switch r.Header().Rrtype {
+		case TypeOPT:
+			extra = append(extra, r)
+		case TypeA, TypeAAAA:
+			if glue[strings.ToLower(Fqdn(r.Header().Name))] {
+				extra = append(extra, r)
+			}
+		}
+	}
+	dns.Ns = ns
+	dns.Extra = extra
+}
+
 // SetNotify creates a notify packet.
 func (dns *Msg) SetNotify(z string) {
 	dns.MsgHdr.Opcode = OpcodeNotify
@@ -31,15 +129,69 @@ func (dns *Msg) SetNotify(z string) {
 	dns.Question[0] = Question{z, TypeSOA, ClassINET}
 }
 
-// SetRcode creates an error packet.
-func (dns *Msg) SetRcode(request *Msg, rcode int) {
-	dns.MsgHdr.Rcode = rcode
-	dns.MsgHdr.Opcode = OpcodeQuery
+// SetRcode creates an error packet. The question section and the opcode
+// are copied from the request, which may hold zero or more questions, so
+// the reply to an update is an update too. An extended rcode, above 15,
+// is split between the header and the OPT RR, which dns must hold then.
+// For any other rcode, or one that does not fit in 12 bits, ErrRcode is
+// returned and dns is not changed.
+func (dns *Msg) SetRcode(request *Msg, rcode int) error {
+	opt := requestOpt(dns)
+	if rcode < 0 || rcode >= 1<<12 || rcode > 0xF && opt == nil {
+		return ErrRcode
+	}
+	if opt != nil {
+		opt.SetExtendedRcode(rcode)
+	}
+	dns.MsgHdr.Rcode = rcode & 0xF
+	dns.MsgHdr.Opcode = request.MsgHdr.Opcode
 	dns.MsgHdr.Response = true
 	dns.MsgHdr.Authoritative = false
 	dns.MsgHdr.Id = request.MsgHdr.Id
-	dns.Question = make([]Question, 1)
-	dns.Question[0] = request.Question[0]
+	dns.Question = make([]Question, len(request.Question))
+	copy(dns.Question, request.Question)
+	return nil
+}
+
+// SetNXDOMAIN creates a reply to request that says the name does not
+// exist (RFC 2308): the rcode is set to NXDOMAIN and the authority section
+// holds soa, the SOA record of the zone. The answer section is not
+// changed, it may hold the CNAME records leading to the name.
+func (dns *Msg) SetNXDOMAIN(request *Msg, soa *RR_SOA) {
+	dns.SetReply(request)
+	dns.MsgHdr.Rcode = RcodeNameError
+	dns.Ns = []RR{NegativeSoa(soa)}
+}
+
+// SetNoData creates a reply to request that says the name exists, but
+// has no data of the requested type (RFC 2308): the rcode is NOERROR and
+// the authority section holds soa, the SOA record of the zone. The answer
+// section is not changed, it may hold the CNAME records leading to the
+// name.
+func (dns *Msg) SetNoData(request *Msg, soa *RR_SOA) {
+	dns.SetReply(request)
+	dns.Ns = []RR{NegativeSoa(soa)}
+}
+
+// NegativeSoa returns a copy of soa for use in a negative answer, its TTL
+// is the minimum of the TTL and the MINIMUM field of soa (RFC 2308,
+// section 3), so the negative answer is not cached for longer.
+func NegativeSoa(soa *RR_SOA) *RR_SOA {
+	s := *soa
+	s.Hdr.Ttl = soa.NegativeTTL()
+	return &s
+}
+
+// QuestionFor returns the question from the question section that
+// matches name and qtype. The name is compared case-insensitively. If
+// there is no such question ok is false.
+func (dns *Msg) QuestionFor(name string, qtype uint16) (q Question, ok bool) {
+	for _, q := range dns.Question {
+		if q.Qtype == qtype && strings.ToLower(Fqdn(q.Name)) == strings.ToLower(Fqdn(name)) {
+			return q, true
+		}
+	}
+	return Question{}, false
 }
 
 // SetRcodeFormatError creates a packet with FormError set.
@@ -133,9 +285,59 @@ func (dns *Msg) IsRcodeFormatError() (ok bool) {
 	return
 }
 
+// IsRcodeYXDomain checks if the message has YXDOMAIN set: a name that
+// should not exist for an update does exist.
+func (dns *Msg) IsRcodeYXDomain() (ok bool) {
+	if len(dns.Question) == 0 {
+		return false
+	}
+	ok = dns.MsgHdr.Rcode == RcodeYXDomain
+	return
+}
+
+// IsRcodeYXRrset checks if the message has YXRRSET set: an RRset that
+// should not exist for an update does exist.
+func (dns *Msg) IsRcodeYXRrset() (ok bool) {
+	if len(dns.Question) == 0 {
+		return false
+	}
+	ok = dns.MsgHdr.Rcode == RcodeYXRrset
+	return
+}
+
+// IsRcodeNXRrset checks if the message has NXRRSET set: an RRset that
+// should exist for an update does not exist.
+func (dns *Msg) IsRcodeNXRrset() (ok bool) {
+	if len(dns.Question) == 0 {
+		return false
+	}
+	ok = dns.MsgHdr.Rcode == RcodeNXRrset
+	return
+}
+
+// IsRcodeNotAuth checks if the message has NOTAUTH set: the server is not
+// authoritative for the zone, or the request is not authorized.
+func (dns *Msg) IsRcodeNotAuth() (ok bool) {
+	if len(dns.Question) == 0 {
+		return false
+	}
+	ok = dns.MsgHdr.Rcode == RcodeNotAuth
+	return
+}
+
+// IsRcodeNotZone checks if the message has NOTZONE set: a name in the
+// update is not in the zone.
+func (dns *Msg) IsRcodeNotZone() (ok bool) {
+	if len(dns.Question) == 0 {
+		return false
+	}
+	ok = dns.MsgHdr.Rcode == RcodeNotZone
+	return
+}
+
 // IsUpdate checks if the message is a dynamic update packet.
 func (dns *Msg) IsUpdate() (ok bool) {
-	if len(dns.Question) == 0 {
+	if len(dns.Question) != 1 {
 		return false
 	}
 	ok = dns.MsgHdr.Opcode == OpcodeUpdate
@@ -145,7 +347,7 @@ func (dns *Msg) IsUpdate() (ok bool) {
 
 // IsNotify checks if the message is a valid notify packet.
 func (dns *Msg) IsNotify() (ok bool) {
-	if len(dns.Question) == 0 {
+	if len(dns.Question) != 1 {
 		return false
 	}
 	ok = dns.MsgHdr.Opcode == OpcodeNotify
@@ -156,7 +358,7 @@ func (dns *Msg) IsNotify() (ok bool) {
 
 // IsAxfr checks if the message is a valid axfr request packet.
 func (dns *Msg) IsAxfr() (ok bool) {
-	if len(dns.Question) == 0 {
+	if len(dns.Question) != 1 {
 		return false
 	}
 	ok = dns.MsgHdr.Opcode == OpcodeQuery
@@ -167,7 +369,7 @@ func (dns *Msg) IsAxfr() (ok bool) {
 
 // IsIXfr checks if the message is a valid ixfr request packet.
 func (dns *Msg) IsIxfr() (ok bool) {
-	if len(dns.Question) == 0 {
+	if len(dns.Question) != 1 {
 		return false
 	}
 	ok = dns.MsgHdr.Opcode == OpcodeQuery
@@ -185,6 +387,17 @@ func (dns *Msg) IsTsig() (ok bool) {
 	return
 }
 
+// StripTsig removes the TSIG RR from the message and returns it, nil is
+// returned when the message has none.
+func (dns *Msg) StripTsig() *RR_TSIG {
+	if !dns.IsTsig() {
+		return nil
+	}
+	t, _ := dns.Extra[len(dns.Extra)-1].(*RR_TSIG)
+	dns.Extra = dns.Extra[:len(dns.Extra)-1]
+	return t
+}
+
 // IsEdns0 checks if the message has a Edns0 record, any EDNS0
 // record in the additional section will do
 func (dns *Msg) IsEdns0() (ok bool) {
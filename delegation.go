@@ -0,0 +1,258 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Checking the consistency of a delegation between parent and child.
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// A DelegationCheck checks the delegation of a zone. It compares the NS
+// records and the glue at the parent with the NS RRset and the addresses
+// in the zone itself, checks that the DS records at the parent refer to
+// keys in the DNSKEY RRset of the zone and finds the lame name servers:
+// the servers that do not answer authoritatively for the zone.
+type DelegationCheck struct {
+	Client *Client  // the client for the queries, NewClient() if nil
+	Parent []string // the addresses (host:port) of the name servers of the parent zone
+	Port   string   // the port of the name servers of the zone, "53" if empty
+	// LookupIP returns the addresses of a name server without glue,
+	// net.LookupIP if nil.
+	LookupIP func(name string) ([]net.IP, error)
+}
+
+// A DelegationReport holds the findings of a DelegationCheck.
+type DelegationReport struct {
+	Zone     string
+	ParentNS []string            // the NS names at the parent
+	ChildNS  []string            // the NS names in the zone, from the first authoritative server
+	Glue     map[string][]net.IP // the glue at the parent, by lowercased name
+	DS       []*RR_DS            // the DS records at the parent
+	DNSKEY   []*RR_DNSKEY        // the DNSKEY records of the zone
+	Lame     []string            // the lame servers, as "name (address): reason"
+	Problems []string            // the inconsistencies between parent and child
+}
+
+// OK returns true when there are no lame servers and no problems.
+func (r *DelegationReport) OK() bool {
+	return len(r.Lame) == 0 && len(r.Problems) == 0
+}
+
+// Check checks the delegation of zone. An error is returned when none of
+// the parent's servers answers or when the parent does not delegate zone;
+// the other findings are in the report.
+func (d *DelegationCheck) Check(zone string) (*DelegationReport, error) {
+	zone = strings.ToLower(Fqdn(zone))
+	r := &DelegationReport{Zone: zone, Glue: make(map[string][]net.IP)}
+
+	// The delegation at the parent
+	var ref *Msg
+	var err error
+	for _, a := range d.Parent {
+		if ref, err = d.query(a, zone, TypeNS); err == nil {
+			break
+		}
+	}
+	if ref == nil {
+		if err == nil {
+			err = ErrServ
+		}
+		return nil, err
+	}
+	r.ParentNS = nsNames(append(ref.Answer, ref.Ns...), zone)
+	if len(r.ParentNS) == 0 {
+		return nil, &Error{Err: "no delegation at the parent", Name: zone}
+	}
+	for _, rr := range ref.Extra {
+		k := strings.ToLower(rr.Header().Name)
+		switch x := rr.(type) {
+		case *RR_A:
+			r.Glue[k] = append(r.Glue[k], x.A)
+		case *RR_AAAA:
+			r.Glue[k] = append(r.Glue[k], x.AAAA)
+		}
+	}
+	for _, a := range d.Parent {
+		if m, err := d.query(a, zone, TypeDS); err == nil {
+			for _, rr := range m.Answer {
+				if ds, ok := rr.(*RR_DS); ok {
+					r.DS = append(r.DS, ds)
+				}
+			}
+			break
+		}
+	}
+
+	// The name servers of the zone
+	var auth string // the first authoritative server
+	for _, ns := range r.ParentNS {
+		ips := r.Glue[ns]
+		if len(ips) == 0 {
+			if ips, err = d.lookupIP(ns); err != nil || len(ips) == 0 {
+				r.Lame = append(r.Lame, ns+": no address")
+				continue
+			}
+		}
+		for _, ip := range ips {
+			a := net.JoinHostPort(ip.String(), d.port())
+			if reason := d.lame(a, zone); reason != "" {
+				r.Lame = append(r.Lame, ns+" ("+a+"): "+reason)
+				continue
+			}
+			m, err := d.query(a, zone, TypeNS)
+			if err != nil {
+				r.Lame = append(r.Lame, ns+" ("+a+"): "+err.Error())
+				continue
+			}
+			names := nsNames(m.Answer, zone)
+			if auth == "" {
+				auth, r.ChildNS = a, names
+				continue
+			}
+			if strings.Join(names, " ") != strings.Join(r.ChildNS, " ") {
+				r.Problems = append(r.Problems, ns+" ("+a+") has a different NS RRset: "+strings.Join(names, " "))
+			}
+		}
+	}
+	if auth == "" {
+		sort.Strings(r.Lame)
+		r.Problems = append(r.Problems, "no authoritative server for the zone")
+		return r, nil
+	}
+
+	// NS RRset and glue
+	child := make(map[string]bool)
+	for _, ns := range r.ChildNS {
+		child[ns] = true
+	}
+	for _, ns := range r.ParentNS {
+		if !child[ns] {
+			r.Problems = append(r.Problems, "NS "+ns+" only at the parent")
+		}
+		delete(child, ns)
+	}
+	for _, ns := range r.ChildNS {
+		if child[ns] {
+			r.Problems = append(r.Problems, "NS "+ns+" only in the zone")
+		}
+	}
+	for _, ns := range r.ParentNS {
+		glue := r.Glue[ns]
+		if len(glue) == 0 || !isSubDomain(zone, ns) {
+			continue
+		}
+		var addrs []net.IP
+		for _, t := range []uint16{TypeA, TypeAAAA} {
+			m, err := d.query(auth, ns, t)
+			if err != nil {
+				continue
+			}
+			for _, rr := range m.Answer {
+				switch x := rr.(type) {
+				case *RR_A:
+					addrs = append(addrs, x.A)
+				case *RR_AAAA:
+					addrs = append(addrs, x.AAAA)
+				}
+			}
+		}
+		if ipString(glue) != ipString(addrs) {
+			r.Problems = append(r.Problems, "glue of "+ns+" ("+ipString(glue)+") differs from the zone ("+ipString(addrs)+")")
+		}
+	}
+
+	// DS and DNSKEY
+	if m, err := d.query(auth, zone, TypeDNSKEY); err == nil {
+		for _, rr := range m.Answer {
+			if k, ok := rr.(*RR_DNSKEY); ok {
+				r.DNSKEY = append(r.DNSKEY, k)
+			}
+		}
+	}
+DS:
+	for _, ds := range r.DS {
+		for _, k := range r.DNSKEY {
+			if ds.Verify(k) == nil {
+				continue DS
+			}
+		}
+		r.Problems = append(r.Problems, "DS "+ds.String()+" matches no DNSKEY")
+	}
+	sort.Strings(r.Lame)
+	sort.Strings(r.Problems)
+	return r, nil
+}
+
+// lame returns why the server at a is lame for zone, or the empty string
+// when it is not.
+func (d *DelegationCheck) lame(a, zone string) string {
+	m, err := d.query(a, zone, TypeSOA)
+	switch {
+	case err != nil:
+		return err.Error()
+	case m.Rcode != RcodeSuccess:
+		return "rcode " + RcodeToString(m.Rcode)
+	case !m.Authoritative:
+		return "not authoritative"
+	}
+	for _, rr := range m.Answer {
+		if rr.Header().Rrtype == TypeSOA && strings.ToLower(rr.Header().Name) == zone {
+			return ""
+		}
+	}
+	return "no SOA record"
+}
+
+// query sends a non-recursive query for name and t to the server at a.
+func (d *DelegationCheck) query(a, name string, t uint16) (*Msg, error) {
+	c := d.Client
+	if c == nil {
+		c = NewClient()
+	}
+	m := new(Msg)
+	m.SetQuestion(name, t)
+	m.RecursionDesired = false
+	return c.Exchange(m, a)
+}
+
+func (d *DelegationCheck) lookupIP(name string) ([]net.IP, error) {
+	if d.LookupIP != nil {
+		return d.LookupIP(name)
+	}
+	return net.LookupIP(name)
+}
+
+func (d *DelegationCheck) port() string {
+	if d.Port == "" {
+		return "53"
+	}
+	return d.Port
+}
+
+// nsNames returns the sorted, lowercased names of the NS records for zone
+// in rrs.
+func nsNames(rrs []RR, zone string) []string {
+	var names []string
+	for _, rr := range rrs {
+		if ns, ok := rr.(*RR_NS); ok && strings.ToLower(ns.Hdr.Name) == zone {
+			names = append(names, strings.ToLower(ns.Ns))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ipString returns the sorted addresses in ips, separated by spaces.
+func ipString(ips []net.IP) string {
+	s := make([]string, len(ips))
+	for i, ip := range ips {
+		s[i] = ip.String()
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,124 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func delegationKey() *RR_DNSKEY {
+	k := getKey()
+	k.Hdr.Rrtype = TypeDNSKEY
+	return k
+}
+
+func delegationParent(w ResponseWriter, req *Msg) {
+	m := new(Msg)
+	m.SetReply(req)
+	m.Authoritative = false
+	switch req.Question[0].Qtype {
+	case TypeNS:
+		for _, ns := range []string{"ns1.miek.nl.", "lame.example.net."} {
+			m.Ns = append(m.Ns, &RR_NS{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeNS, Class: ClassINET, Ttl: 3600}, Ns: ns})
+		}
+		m.Extra = append(m.Extra, &RR_A{Hdr: RR_Header{Name: "ns1.miek.nl.", Rrtype: TypeA, Class: ClassINET, Ttl: 3600}, A: net.IPv4(127, 0, 0, 1)})
+	case TypeDS:
+		m.Authoritative = true
+		ds := delegationKey().ToDS(SHA256)
+		bogus := delegationKey().ToDS(SHA256)
+		bogus.KeyTag++
+		m.Answer = append(m.Answer, ds, bogus)
+	}
+	buf, _ := m.Pack()
+	w.Write(buf)
+}
+
+func delegationChild(w ResponseWriter, req *Msg) {
+	m := new(Msg)
+	m.SetReply(req)
+	hdr := RR_Header{Name: req.Question[0].Name, Rrtype: req.Question[0].Qtype, Class: ClassINET, Ttl: 3600}
+	switch req.Question[0].Qtype {
+	case TypeSOA:
+		m.Answer = append(m.Answer, getSoa())
+	case TypeNS:
+		for _, ns := range []string{"ns1.miek.nl.", "ns3.miek.nl."} {
+			m.Answer = append(m.Answer, &RR_NS{Hdr: hdr, Ns: ns})
+		}
+	case TypeA:
+		m.Answer = append(m.Answer, &RR_A{Hdr: hdr, A: net.IPv4(127, 0, 0, 1)}, &RR_A{Hdr: hdr, A: net.IPv4(192, 0, 2, 1)})
+	case TypeDNSKEY:
+		m.Answer = append(m.Answer, delegationKey())
+	}
+	buf, _ := m.Pack()
+	w.Write(buf)
+}
+
+func TestDelegationCheck(t *testing.T) {
+	parent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	child, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	_, port, _ := net.SplitHostPort(child.LocalAddr().String())
+	// The lame server only refers to the parent
+	lame, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.2"), Port: child.LocalAddr().(*net.UDPAddr).Port})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(delegationParent)}).ServeUDP(parent)
+	go (&Server{Handler: HandlerFunc(delegationChild)}).ServeUDP(child)
+	go (&Server{Handler: HandlerFunc(delegationParent)}).ServeUDP(lame)
+
+	d := &DelegationCheck{Parent: []string{parent.LocalAddr().String()}, Port: port,
+		LookupIP: func(name string) ([]net.IP, error) {
+			return []net.IP{net.IPv4(127, 0, 0, 2)}, nil
+		}}
+	r, err := d.Check("MIEK.nl")
+	if err != nil {
+		t.Logf("Check failed: %s", err)
+		t.Fail()
+		return
+	}
+	if r.OK() {
+		t.Log("Delegation should not be OK")
+		t.Fail()
+	}
+	if len(r.Lame) != 1 || r.Lame[0] != "lame.example.net. (127.0.0.2:"+port+"): not authoritative" {
+		t.Logf("Lame servers: %v", r.Lame)
+		t.Fail()
+	}
+	if len(r.DS) != 2 || len(r.DNSKEY) != 1 {
+		t.Logf("Expected 2 DS and 1 DNSKEY, got %d and %d", len(r.DS), len(r.DNSKEY))
+		t.Fail()
+	}
+	want := []string{
+		"DS miek.nl.",
+		"NS lame.example.net. only at the parent",
+		"NS ns3.miek.nl. only in the zone",
+		"glue of ns1.miek.nl. (127.0.0.1) differs from the zone (127.0.0.1 192.0.2.1)",
+	}
+	if len(r.Problems) != len(want) {
+		t.Logf("Problems: %v", r.Problems)
+		t.Fail()
+		return
+	}
+	for i, p := range r.Problems {
+		if !strings.HasPrefix(p, want[i]) {
+			t.Logf("Problem %d is %q, expected %q", i, p, want[i])
+			t.Fail()
+		}
+	}
+	if r.Problems[0] != "DS "+r.DS[1].String()+" matches no DNSKEY" {
+		t.Logf("Bogus DS not reported: %s", r.Problems[0])
+		t.Fail()
+	}
+}
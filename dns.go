@@ -13,7 +13,7 @@
 //
 //      r := new(RR_TXT)
 //      r.Hdr = RR_Header{Name: "a.miek.nl.", Rrtype: TypeTXT, Class: ClassINET, Ttl: 3600}
-//      r.TXT = "This is the content of the TXT record"
+//      r.Txt = []string{"This is the content of the TXT record"}
 //
 // Or directly from a string:
 //
@@ -22,7 +22,8 @@
 // The package dns supports (async) querying/replying, incoming/outgoing Axfr/Ixfr, 
 // TSIG, EDNS0, dynamic updates, notifies and DNSSEC validation/signing.
 // Note that domain names MUST be full qualified, before sending them. The packages
-// enforces this, by throwing a panic().
+// enforces this, by returning ErrFqdn from Pack(). Set AutoFqdn in the message
+// to have those names made fully qualified instead.
 //
 // In the DNS messages are exchanged. Use pattern for creating one:
 //
@@ -53,10 +54,13 @@
 // a synchronous query. The Basic use pattern is:
 // 
 //      HandleQueryFunc(".", handler)
-//      ListenAndQuery(nil, nil)
-//      c.Do(m1, "127.0.0.1:53")
+//      q := NewQueryConn(nil) // fires off the queries with DefaultQueryMux
+//      defer q.Close()
+//      c.QueryConn = q
+//      replies := make(chan *Exchange)
+//      c.DoChan(m1, "127.0.0.1:53", replies)
 //      // Do something else
-//      r := <- DefaultReplyChan
+//      r := <- replies
 //      // r.Reply is the answer
 //      // r.Request is the original request
 package dns
@@ -99,7 +103,8 @@ type RR interface {
 	Len() int
 }
 
-// An RRset is a slice of RRs.
+// An RRset is a slice of RRs. It is not safe for concurrent use, a
+// SafeRRset is.
 type RRset []RR
 
 func NewRRset() RRset {
@@ -127,44 +132,77 @@ func (s *RRset) Pop() RR {
 	return r
 }
 
-// Push pushes the RR r to the RRset.
+// Push pushes the RR r to the RRset. It returns false, and does not add
+// r, when r has a different owner name, class or type than the RRs in
+// the set. An RRSIG counts as the type it covers. See PushStrict for
+// a version that also checks the TTL.
 func (s *RRset) Push(r RR) bool {
-	if len(*s) == 0 {
-		*s = append(*s, r)
-		return true
-	}
-	// For RRSIGs this is not true (RFC???)
+	// For RRSIGs the TTL is not always the same (RFC???)
 	// Don't make it a failure if this happens
-	//	if (*s)[0].Header().Ttl != r.Header().Ttl {
-	//                return false
-	//        }
-	if (*s)[0].Header().Name != r.Header().Name {
-		return false
-	}
-	if (*s)[0].Header().Class != r.Header().Class {
+	if len(*s) > 0 && checkRRset((*s)[0], r, false) != nil {
 		return false
 	}
 	*s = append(*s, r)
 	return true
 }
 
+// PushStrict pushes the RR r to the RRset if it has the same owner name,
+// class, type and TTL as the RRs in the set. Otherwise it returns the
+// first invariant that does not hold: ErrRRsetName, ErrRRsetClass,
+// ErrRRsetType or ErrRRsetTtl.
+func (s *RRset) PushStrict(r RR) error {
+	if len(*s) > 0 {
+		if err := checkRRset((*s)[0], r, true); err != nil {
+			return err
+		}
+	}
+	*s = append(*s, r)
+	return nil
+}
+
 // Ok checks if the RRSet is RFC 2181 compliant.
 func (s RRset) Ok() bool {
-	ttl := s[0].Header().Ttl
-	name := s[0].Header().Name
-	class := s[0].Header().Class
+	return s.Check() == nil
+}
+
+// Check checks if the RRset is RFC 2181 compliant, like Ok, and returns
+// the invariant that does not hold: ErrRRsetEmpty, ErrRRsetName,
+// ErrRRsetClass, ErrRRsetType or ErrRRsetTtl.
+func (s RRset) Check() error {
+	if len(s) == 0 {
+		return ErrRRsetEmpty
+	}
 	for _, rr := range s[1:] {
-		if rr.Header().Ttl != ttl {
-			return false
-		}
-		if rr.Header().Name != name {
-			return false
-		}
-		if rr.Header().Class != class {
-			return false
+		if err := checkRRset(s[0], rr, true); err != nil {
+			return err
 		}
 	}
-	return true
+	return nil
+}
+
+// checkRRset checks if r may be in the same RRset as first.
+func checkRRset(first, r RR, ttl bool) error {
+	h, rh := first.Header(), r.Header()
+	switch {
+	case h.Name != rh.Name:
+		return ErrRRsetName
+	case h.Class != rh.Class:
+		return ErrRRsetClass
+	case rrsetType(first) != rrsetType(r):
+		return ErrRRsetType
+	case ttl && h.Ttl != rh.Ttl:
+		return ErrRRsetTtl
+	}
+	return nil
+}
+
+// rrsetType returns the type of the RRset r belongs to, for an RRSIG that
+// is the type it covers.
+func rrsetType(r RR) uint16 {
+	if s, ok := r.(*RR_RRSIG); ok {
+		return s.TypeCovered
+	}
+	return r.Header().Rrtype
 }
 
 // Exchange is used in communicating with the resolver.
@@ -204,17 +242,8 @@ func (h *RR_Header) String() string {
 	}
 	s = s + strconv.Itoa(int(h.Ttl)) + "\t"
 
-	if _, ok := Class_str[h.Class]; ok {
-		s += Class_str[h.Class] + "\t"
-	} else {
-		s += "CLASS" + strconv.Itoa(int(h.Class)) + "\t"
-	}
-
-	if _, ok := Rr_str[h.Rrtype]; ok {
-		s += Rr_str[h.Rrtype] + "\t"
-	} else {
-		s += "TYPE" + strconv.Itoa(int(h.Rrtype)) + "\t"
-	}
+	s += ClassToString(h.Class) + "\t"
+	s += TypeToString(h.Rrtype) + "\t"
 	return s
 }
 
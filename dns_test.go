@@ -1,8 +1,11 @@
 package dns
 
 import (
+	"encoding/hex"
 	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestPackUnpack(t *testing.T) {
@@ -14,13 +17,13 @@ func TestPackUnpack(t *testing.T) {
 	key.PublicKey = "AwEAAaHIwpx3w4VHKi6i1LHnTaWeHCL154Jug0Rtc9ji5qwPXpBo6A5sRv7cSsPQKPIwxLpyCrbJ4mr2L0EPOdvP6z6YfljK2ZmTbogU9aSU2fiq/4wjxbdkLyoDVgtO+JsxNN4bjr4WcWhsmk1Hg93FV9ZpkWb0Tbad8DFqNDzr//kZ"
 
 	out.Answer[0] = key
-	msg, ok := out.Pack()
-	if !ok {
+	msg, err := out.Pack()
+	if err != nil {
 		t.Log("Failed to pack msg with DNSKEY")
 		t.Fail()
 	}
 	in := new(Msg)
-	if !in.Unpack(msg) {
+	if in.Unpack(msg) != nil {
 		t.Log("Failed to unpack msg with DNSKEY")
 		t.Fail()
 	}
@@ -32,13 +35,13 @@ func TestPackUnpack(t *testing.T) {
 	sig.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeRRSIG, Class: ClassINET, Ttl: 3600}
 
 	out.Answer[0] = sig
-	msg, ok = out.Pack()
-	if !ok {
+	msg, err = out.Pack()
+	if err != nil {
 		t.Log("Failed to pack msg with RRSIG")
 		t.Fail()
 	}
 
-	if !in.Unpack(msg) {
+	if in.Unpack(msg) != nil {
 		t.Log("Failed to unpack msg with RRSIG")
 		t.Fail()
 	}
@@ -55,12 +58,12 @@ func TestPackUnpack2(t *testing.T) {
 
 	x := new(RR_TXT)
 	x.Hdr = RR_Header{Name: dom, Rrtype: TypeTXT, Class: ClassINET, Ttl: 0}
-	x.Txt = "heelalaollo"
+	x.Txt = []string{"heelalaollo"}
 
 	m.Extra[0] = x
 	m.Answer[0] = rr
-	_, ok := m.Pack()
-	if !ok {
+	_, err := m.Pack()
+	if err != nil {
 		t.Log("Packing failed")
 		t.Fail()
 		return
@@ -78,3 +81,673 @@ func TestEDNS_RR(t *testing.T) {
 	edns.Option[0].Data = "lalalala"
 	//t..Logf("%v\n", edns)
 }
+
+func TestEDNSFlags(t *testing.T) {
+	edns := new(RR_OPT)
+	edns.Hdr.Name = "."
+	edns.Hdr.Rrtype = TypeOPT
+	edns.SetUDPSize(4096)
+	edns.SetVersion(1)
+	edns.SetDo()
+	edns.SetZ(0x10)
+	edns.SetExtendedRcode(RcodeBadVers)
+	if edns.Version() != 1 || !edns.Do() || edns.Z() != 0x10 || edns.UDPSize() != 4096 {
+		t.Logf("Wrong EDNS0 values: %s", edns)
+		t.Fail()
+	}
+	if edns.Flags() != 0x8010 || edns.ExtendedRcode() != RcodeBadVers {
+		t.Logf("Wrong EDNS0 flags or extended rcode: %x %d", edns.Flags(), edns.ExtendedRcode())
+		t.Fail()
+	}
+	edns.ClearDo()
+	if edns.Do() || edns.Version() != 1 {
+		t.Logf("DO bit should be cleared: %s", edns)
+		t.Fail()
+	}
+}
+
+func TestMsgValidate(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeSOA)
+	if err := m.Validate(); err != nil {
+		t.Logf("Message should be valid: %s", err)
+		t.Fail()
+	}
+
+	m.SetQuestion("miek.nl", TypeSOA)
+	if err := m.Validate(); err == nil {
+		t.Log("Non fully qualified name should not validate")
+		t.Fail()
+	}
+
+	m.SetQuestion(strings.Repeat("\\065", 63)+".miek.nl.", TypeSOA)
+	if err := m.Validate(); err != nil {
+		t.Logf("Label of 63 escaped octets should validate: %s", err)
+		t.Fail()
+	}
+	m.SetQuestion(strings.Repeat("\\065", 64)+".miek.nl.", TypeSOA)
+	if err := m.Validate(); err == nil {
+		t.Log("Label of 64 escaped octets should not validate")
+		t.Fail()
+	}
+
+	m.SetQuestion("miek.nl.", TypeSOA)
+	m.SetEdns0(4096, true)
+	m.Answer = append(m.Answer, m.Extra[0])
+	if err := m.Validate(); err == nil {
+		t.Log("OPT RR in the answer section should not validate")
+		t.Fail()
+	}
+
+	m = new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	txt := new(RR_TXT)
+	txt.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeTXT, Class: ClassINET}
+	txt.Txt = []string{strings.Repeat("a", 256)}
+	m.Answer = []RR{txt}
+	if err := m.Validate(); err != nil {
+		t.Logf("Long TXT string should validate: %s", err)
+		t.Fail()
+	}
+	txt.Txt = []string{strings.Repeat("a", 65536)}
+	if err := m.Validate(); err == nil {
+		t.Log("Too long TXT rdata should not validate")
+		t.Fail()
+	}
+}
+
+func TestPackTXT(t *testing.T) {
+	long := strings.Repeat("v=DKIM1; p=", 30)
+	txt := &RR_TXT{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeTXT, Class: ClassINET},
+		Txt: []string{"short", "", long}}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	m.Answer = []RR{txt}
+	buf, err := m.Pack()
+	if err != nil {
+		t.Logf("Failed to pack: %s", err)
+		t.Fail()
+		return
+	}
+	m = new(Msg)
+	if err := m.Unpack(buf); err != nil {
+		t.Logf("Failed to unpack: %s", err)
+		t.Fail()
+		return
+	}
+	// The long string comes back in two pieces
+	got := m.Answer[0].(*RR_TXT).Txt
+	if len(got) != 4 || got[0] != "short" || got[1] != "" || got[2] != long[:255] || got[3] != long[255:] {
+		t.Logf("Wrong character-strings: %q", got)
+		t.Fail()
+	}
+	if ok, diag := UnpackThenPack(buf); !ok {
+		t.Logf("TXT record should round trip: %s", diag)
+		t.Fail()
+	}
+	if m.Answer[0].Len() != txt.Len() {
+		t.Logf("Length %d, want %d", txt.Len(), m.Answer[0].Len())
+		t.Fail()
+	}
+
+	rr, err := NewRR(`miek.nl. IN TXT "v=spf1 mx" "-all" three`)
+	if err != nil || len(rr.(*RR_TXT).Txt) != 3 || rr.(*RR_TXT).Txt[0] != "v=spf1 mx" {
+		t.Logf("Failed to parse TXT record: %v %s", err, rr)
+		t.Fail()
+	}
+}
+
+func TestPackFqdn(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl", TypeMX)
+	mx := new(RR_MX)
+	mx.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeMX, Class: ClassINET, Ttl: 3600}
+	mx.Pref = 10
+	mx.Mx = "mx.miek.nl"
+	m.Answer = []RR{mx}
+	if _, err := m.Pack(); err != ErrFqdn {
+		t.Logf("Packing should fail with ErrFqdn: %v", err)
+		t.Fail()
+	}
+	m.AutoFqdn = true
+	buf, err := m.Pack()
+	if err != nil {
+		t.Logf("Packing should succeed with AutoFqdn: %v", err)
+		t.Fail()
+		return
+	}
+	// Packing does not change the message
+	if m.Question[0].Name != "miek.nl" || mx.Mx != "mx.miek.nl" {
+		t.Log("Names should not be changed by Pack")
+		t.Fail()
+	}
+	m1 := new(Msg)
+	if err := m1.Unpack(buf); err != nil || m1.Question[0].Name != "miek.nl." || m1.Answer[0].(*RR_MX).Mx != "mx.miek.nl." {
+		t.Logf("Names should be packed fully qualified: %v %v", err, m1)
+		t.Fail()
+	}
+}
+
+func TestUnpackErrors(t *testing.T) {
+	m := new(Msg)
+	if err := m.Unpack([]byte{0, 1, 2}); err != ErrShortRead {
+		t.Logf("Unpacking a short message should return ErrShortRead: %v", err)
+		t.Fail()
+	}
+
+	m.SetQuestion("miek.nl.", TypeMX)
+	mx := &RR_MX{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeMX, Class: ClassINET}, Pref: 10, Mx: "mx.miek.nl."}
+	m.Answer = []RR{mx}
+	buf, _ := m.Pack()
+	if err := m.Unpack(buf[:len(buf)-4]); err != ErrRdata {
+		t.Logf("Unpacking a cut off message should return ErrRdata: %v", err)
+		t.Fail()
+	}
+	m.Truncated = true
+	buf, _ = m.Pack()
+	if err := m.Unpack(buf[:len(buf)-4]); err != ErrTruncated {
+		t.Logf("Unpacking a truncated message should return ErrTruncated: %v", err)
+		t.Fail()
+	}
+}
+
+func TestUnpackShortRdlength(t *testing.T) {
+	// The rdlength of 8 is shorter than the fixed fields and the signer
+	// name of the signature
+	for _, typ := range []uint16{TypeSIG, TypeRRSIG} {
+		buf := []byte{0, 1, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0,
+			0, byte(typ >> 8), byte(typ), 0, 1, 0, 0, 0, 0, 0, 8,
+			0, 1, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+		m := new(Msg)
+		if err := m.Unpack(buf); err != ErrRdata {
+			t.Logf("Unpacking a %s with a short rdlength should return ErrRdata: %v", Rr_str[typ], err)
+			t.Fail()
+		}
+	}
+}
+
+func TestSetReplyQuestions(t *testing.T) {
+	req := new(Msg)
+	m := new(Msg)
+	m.SetReply(req)
+	m.SetRcode(req, RcodeFormatError)
+	if len(m.Question) != 0 {
+		t.Log("Reply to a question-less request should have no question")
+		t.Fail()
+	}
+
+	req.Question = []Question{{"miek.nl.", TypeA, ClassINET}, {"Miek.nl.", TypeMX, ClassINET}}
+	m.SetReply(req)
+	if len(m.Question) != 2 {
+		t.Logf("Reply should have 2 questions: %v", m.Question)
+		t.Fail()
+	}
+	if q, ok := m.QuestionFor("miek.nl.", TypeMX); !ok || q.Name != "Miek.nl." {
+		t.Logf("Should have found the MX question: %s", q)
+		t.Fail()
+	}
+	if _, ok := m.QuestionFor("miek.nl.", TypeAAAA); ok {
+		t.Log("Should not have found an AAAA question")
+		t.Fail()
+	}
+	q := Question{"miek.nl.", TypeA, 1000}
+	if q.String() != ";miek.nl.\tCLASS1000\t A" {
+		t.Logf("Wrong string for question: %s", q.String())
+		t.Fail()
+	}
+}
+
+func TestChaseCNAME(t *testing.T) {
+	m := new(Msg)
+	for _, s := range []string{"www.miek.nl. IN CNAME a.miek.nl.",
+		"a.miek.nl. IN CNAME b.miek.nl.",
+		"b.miek.nl. IN A 127.0.0.1",
+		"b.miek.nl. IN A 127.0.0.2"} {
+		rr, _ := NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+	rrs, target, err := ChaseCNAME(m, "WWW.miek.nl.", TypeA)
+	if err != nil || target != "b.miek.nl." || len(rrs) != 4 {
+		t.Logf("Failed to chase CNAME: %v %s %v", rrs, target, err)
+		t.Fail()
+	}
+	rrs, target, err = ChaseCNAME(m, "www.miek.nl.", TypeAAAA)
+	if err != nil || target != "b.miek.nl." || len(rrs) != 2 {
+		t.Logf("Chain without AAAA should end at b.miek.nl.: %v %s %v", rrs, target, err)
+		t.Fail()
+	}
+
+	loop, _ := NewRR("b.miek.nl. IN CNAME www.miek.nl.")
+	m.Answer = append(m.Answer[:2], loop)
+	if _, _, err := ChaseCNAME(m, "www.miek.nl.", TypeA); err != ErrCnameLoop {
+		t.Logf("Should have detected a CNAME loop: %v", err)
+		t.Fail()
+	}
+}
+
+func TestEDNSChain(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("www.miek.nl.", TypeA)
+	m.SetEdns0(4096, true)
+	m.Extra[0].(*RR_OPT).SetNsid("")
+	m.Extra[0].(*RR_OPT).SetChain("nl.")
+	buf, err := m.Pack()
+	if err != nil {
+		t.Logf("Failed to pack: %s", err)
+		t.Fail()
+		return
+	}
+	m1 := new(Msg)
+	if err := m1.Unpack(buf); err != nil || len(m1.Extra) != 1 {
+		t.Logf("Failed to unpack: %s", err)
+		t.Fail()
+		return
+	}
+	opt := m1.Extra[0].(*RR_OPT)
+	if tp, ok := opt.Chain(); !ok || tp != "nl." || len(opt.Option) != 2 {
+		t.Logf("Wrong CHAIN option: %s", opt)
+		t.Fail()
+	}
+
+	var asked []string
+	lookup := func(name string, qtype uint16) []RR {
+		asked = append(asked, name+" "+TypeToString(qtype))
+		return nil
+	}
+	ChainRRs("www.miek.nl.", "nl.", lookup)
+	if strings.Join(asked, ",") != "nl. DNSKEY,miek.nl. DS,miek.nl. DNSKEY,www.miek.nl. DS,www.miek.nl. DNSKEY" {
+		t.Logf("Wrong chain lookups: %v", asked)
+		t.Fail()
+	}
+	if ChainRRs("www.miek.nl.", "org.", lookup) != nil {
+		t.Log("Name not below the trust point should not have a chain")
+		t.Fail()
+	}
+}
+
+func TestEDNSKeyTag(t *testing.T) {
+	ds1, _ := NewRR("miek.nl. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D")
+	ds2, _ := NewRR("miek.nl. IN DS 19036 8 2 49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5")
+	tags := AnchorKeyTags([]RR{ds1, ds2, ds1})
+	if len(tags) != 2 || tags[0] != 19036 || tags[1] != 20326 {
+		t.Logf("Wrong anchor key tags: %v", tags)
+		t.Fail()
+	}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeNULL)
+	m.SetEdns0(4096, true)
+	m.Extra[0].(*RR_OPT).SetKeyTags(tags)
+	buf, _ := m.Pack()
+	m1 := new(Msg)
+	if err := m1.Unpack(buf); err != nil {
+		t.Logf("Failed to unpack: %s", err)
+		t.Fail()
+		return
+	}
+	tags = m1.Extra[0].(*RR_OPT).KeyTags()
+	if len(tags) != 2 || tags[0] != 19036 || tags[1] != 20326 {
+		t.Logf("Wrong key tags in option: %v", tags)
+		t.Fail()
+	}
+}
+
+func TestTsig(t *testing.T) {
+	secret := "so6ZGir4GPAqINNh9U5c3A=="
+	for _, alg := range []string{HmacMD5, HmacSHA1, HmacSHA256} {
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeSOA)
+		m.SetTsig("axfr.", alg, 300, uint64(time.Now().Unix()))
+		if err := TsigGenerate(m, secret, "", false); err != nil {
+			t.Logf("Failed to generate TSIG with %s: %s", alg, err)
+			t.Fail()
+			continue
+		}
+		buf, _ := m.Pack()
+		if err := TsigVerify(buf, secret, "", false); err != nil {
+			t.Logf("Failed to verify TSIG with %s: %s", alg, err)
+			t.Fail()
+		}
+		buf, _ = m.Pack()
+		buf[13] ^= 1 // change the question
+		if err := TsigVerify(buf, secret, "", false); err != ErrSig {
+			t.Logf("Changed message should not verify with %s: %v", alg, err)
+			t.Fail()
+		}
+	}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeSOA)
+	m.SetTsig("axfr.", "hmac-none.", 300, uint64(time.Now().Unix()))
+	if err := TsigGenerate(m, secret, "", false); err != ErrKeyAlg {
+		t.Logf("Unknown TSIG algorithm should fail: %v", err)
+		t.Fail()
+	}
+}
+
+func TestTsigForward(t *testing.T) {
+	client, upstream := "so6ZGir4GPAqINNh9U5c3A==", "pRZgBrBvI4NAHZYhxmhs/Q=="
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeSOA)
+	m.SetTsig("client.", HmacMD5, 300, uint64(time.Now().Unix()))
+	TsigGenerate(m, client, "", false)
+	clientMAC := m.Extra[len(m.Extra)-1].(*RR_TSIG).MAC
+	buf, _ := m.Pack()
+
+	// The forwarder uses its own ID
+	RawSetId(buf, 0, m.Id+1)
+	orig := append([]byte(nil), buf...)
+	if err := TsigVerify(buf, client, "", false); err != nil {
+		t.Logf("Failed to verify the TSIG after the ID changed: %s", err)
+		t.Fail()
+	}
+	if string(buf) != string(orig) {
+		t.Log("TsigVerify should not change the message")
+		t.Fail()
+	}
+	stripped, tsig, err := TsigStrip(buf)
+	if id, _ := unpackUint16(stripped, 0); err != nil || tsig.OrigId != m.Id || id != m.Id {
+		t.Logf("Failed to strip the TSIG, or to restore the original ID: %v", err)
+		t.Fail()
+	}
+	f := new(Msg)
+	f.Unpack(buf)
+	if err := TsigResign(f, "upstream.", HmacSHA256, upstream, ""); err != nil {
+		t.Logf("Failed to resign: %s", err)
+		t.Fail()
+		return
+	}
+	if len(f.Extra) != 1 || f.Extra[0].Header().Name != "upstream." {
+		t.Logf("Expected one TSIG RR for upstream., got %v", f.Extra)
+		t.Fail()
+	}
+	upstreamMAC := f.Extra[0].(*RR_TSIG).MAC
+	buf, _ = f.Pack()
+	if TsigVerify(buf, upstream, "", false) != nil || TsigVerify(buf, client, "", false) == nil {
+		t.Log("The forwarded request should only verify with the upstream key")
+		t.Fail()
+	}
+
+	// And the response back
+	r := new(Msg)
+	r.SetReply(f)
+	r.SetTsig("upstream.", HmacSHA256, 300, uint64(time.Now().Unix()))
+	TsigGenerate(r, upstream, upstreamMAC, false)
+	r.Id = m.Id
+	if err := TsigResign(r, "client.", HmacMD5, client, clientMAC); err != nil {
+		t.Logf("Failed to resign the response: %s", err)
+		t.Fail()
+	}
+	buf, _ = r.Pack()
+	if err := TsigVerify(buf, client, clientMAC, false); err != nil {
+		t.Logf("Failed to verify the forwarded response: %s", err)
+		t.Fail()
+	}
+	if r.StripTsig() == nil || r.IsTsig() || r.StripTsig() != nil {
+		t.Log("Failed to remove the TSIG RR")
+		t.Fail()
+	}
+}
+
+func TestPackCompressed(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeSOA)
+	for _, s := range []string{"miek.nl. IN SOA linode.atoom.net. miek.miek.nl. 1 2 3 4 5",
+		"miek.nl. IN NS linode.atoom.net.", "a.miek.nl. IN A 127.0.0.1", "miek.nl. IN MX 10 mail.miek.nl."} {
+		rr, _ := NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+	m.Compress = true
+	buf, err := m.Pack()
+	if err != nil {
+		t.Logf("Failed to pack: %s", err)
+		t.Fail()
+		return
+	}
+	m1 := new(Msg)
+	if err := m1.Unpack(buf); err != nil || len(m1.Answer) != len(m.Answer) {
+		t.Logf("Failed to unpack compressed message: %v", err)
+		t.Fail()
+		return
+	}
+	for i := range m.Answer {
+		if m.Answer[i].String() != m1.Answer[i].String() {
+			t.Logf("Compressed RR differs: %s != %s", m.Answer[i], m1.Answer[i])
+			t.Fail()
+		}
+	}
+}
+
+func TestNegativeAnswer(t *testing.T) {
+	req := new(Msg)
+	req.SetQuestion("nx.miek.nl.", TypeA)
+	rr, _ := NewRR("miek.nl. 3600 IN SOA linode.atoom.net. miek.miek.nl. 1282630057 14400 3600 604800 300")
+	soa := rr.(*RR_SOA)
+
+	m := new(Msg)
+	m.SetNXDOMAIN(req, soa)
+	if m.Rcode != RcodeNameError || m.Id != req.Id || !m.Response || len(m.Question) != 1 {
+		t.Logf("Wrong NXDOMAIN reply:\n%s", m)
+		t.Fail()
+	}
+	if len(m.Ns) != 1 || m.Ns[0].Header().Ttl != 300 || soa.Hdr.Ttl != 3600 {
+		t.Logf("SOA TTL should be the minimum, without changing soa:\n%s", m)
+		t.Fail()
+	}
+
+	m = new(Msg)
+	soa.Hdr.Ttl = 60
+	m.SetNoData(req, soa)
+	if m.Rcode != RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 || m.Ns[0].Header().Ttl != 60 {
+		t.Logf("Wrong NODATA reply:\n%s", m)
+		t.Fail()
+	}
+}
+
+func TestSOATimers(t *testing.T) {
+	rr, _ := NewRR("miek.nl. 3600 IN SOA linode.atoom.net. miek.miek.nl. 1282630057 14400 3600 604800 300")
+	soa := rr.(*RR_SOA)
+	if soa.NegativeTTL() != 300 {
+		t.Logf("NegativeTTL should be MINIMUM 300, got %d", soa.NegativeTTL())
+		t.Fail()
+	}
+	soa.Hdr.Ttl = 60
+	if soa.NegativeTTL() != 60 {
+		t.Logf("NegativeTTL should be the TTL 60, got %d", soa.NegativeTTL())
+		t.Fail()
+	}
+	if soa.RefreshIn() != 4*time.Hour || soa.RetryIn() != time.Hour {
+		t.Logf("Wrong refresh %s or retry %s", soa.RefreshIn(), soa.RetryIn())
+		t.Fail()
+	}
+	now := time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+	if e := soa.ExpireAt(now); !e.Equal(now.Add(7 * 24 * time.Hour)) {
+		t.Logf("Wrong expiry %s", e)
+		t.Fail()
+	}
+}
+
+func TestPackRRFast(t *testing.T) {
+	var rrs []RR
+	for _, s := range []string{
+		"miek.nl. 3600 IN A 127.0.0.1",
+		"www.miek.nl. 3600 IN AAAA 2001:db8::1",
+		"miek.nl. 3600 IN NS ns1.miek.nl.",
+		"www.miek.nl. 3600 IN CNAME miek.nl.",
+		"miek.nl. 3600 IN MX 10 mx.miek.nl.",
+		"miek.nl. 3600 IN TXT \"v=spf1 -all\" \"\"",
+	} {
+		rr, err := NewRR(s)
+		if err != nil {
+			t.Logf("Failed to parse %q: %s", s, err)
+			t.Fail()
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	rrs = append(rrs, &RR_TXT{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeTXT, Class: ClassINET},
+		Txt: []string{strings.Repeat("x", 300)}})
+	for _, compress := range []bool{false, true} {
+		for _, rr := range rrs {
+			// Both start after the same name, to compress against
+			fast, slow := make([]byte, 512), make([]byte, 512)
+			cf, cs := make(map[string]int), make(map[string]int)
+			off, _ := PackDomainName("miek.nl.", fast, 12, cf, compress)
+			PackDomainName("miek.nl.", slow, 12, cs, compress)
+
+			end, ok, _ := packRRFast(rr, fast, off, cf, compress)
+			if !ok {
+				t.Logf("Failed to pack %s", rr)
+				t.Fail()
+				continue
+			}
+			send, _ := packStructCompress(rr, slow, off, cs, compress)
+			RawSetRdlength(slow, off, send)
+			if string(fast[:end]) != string(slow[:send]) {
+				t.Logf("Fast path packs %s (compress %t) as %v, want %v", rr, compress, fast[off:end], slow[off:send])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func BenchmarkPackAnswer(b *testing.B) {
+	m := new(Msg)
+	m.SetQuestion("www.miek.nl.", TypeA)
+	m.Compress = true
+	for _, s := range []string{
+		"www.miek.nl. 3600 IN CNAME miek.nl.",
+		"miek.nl. 3600 IN A 127.0.0.1",
+		"miek.nl. 3600 IN A 127.0.0.2",
+		"miek.nl. 3600 IN NS ns1.miek.nl.",
+		"miek.nl. 3600 IN NS ns2.miek.nl.",
+		"ns1.miek.nl. 3600 IN A 127.0.0.3",
+		"ns2.miek.nl. 3600 IN AAAA 2001:db8::1",
+	} {
+		rr, _ := NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+	buf := make([]byte, m.Len()*2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.PackBuffer(buf)
+	}
+}
+
+func TestMsgHdrFlags(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	if err := m.SetFlagsFromString("QR, aa rd\tra"); err != nil {
+		t.Logf("Failed to set the flags: %s", err)
+		t.Fail()
+	}
+	if !m.Response || !m.Authoritative || !m.RecursionDesired || !m.RecursionAvailable || m.Truncated {
+		t.Logf("Wrong flags set: %s", m.Flags())
+		t.Fail()
+	}
+	if f := m.Flags(); f != "qr aa rd ra" {
+		t.Logf("Flags are %q, want %q", f, "qr aa rd ra")
+		t.Fail()
+	}
+	// Round trip all flags
+	for _, f := range []string{"", "qr tc z ad cd", "qr aa tc rd ra z ad cd"} {
+		h := new(MsgHdr)
+		if err := h.SetFlagsFromString(f); err != nil || h.Flags() != f {
+			t.Logf("Flags %q come back as %q: %v", f, h.Flags(), err)
+			t.Fail()
+		}
+	}
+	if err := m.SetFlagsFromString("qr xx"); err == nil || !m.Response {
+		t.Log("Unknown flag should give an error and leave the flags alone")
+		t.Fail()
+	}
+	if !strings.Contains(m.MsgHdr.String(), ";; flags: qr aa rd ra;") {
+		t.Logf("Header string: %s", m.MsgHdr.String())
+		t.Fail()
+	}
+}
+
+func TestUnpackHeaderBits(t *testing.T) {
+	for _, x := range []struct{ z, ad, cd bool }{{true, false, false}, {false, true, false}, {false, false, true}} {
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeA)
+		m.Zero, m.AuthenticatedData, m.CheckingDisabled = x.z, x.ad, x.cd
+		buf, _ := m.Pack()
+		m1 := new(Msg)
+		if err := m1.Unpack(buf); err != nil || m1.MsgHdr != m.MsgHdr {
+			t.Logf("Header bits z %t, ad %t, cd %t do not round trip: %v", x.z, x.ad, x.cd, m1.MsgHdr)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseMsgHdr(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	m.Opcode = OpcodeUpdate
+	m.Rcode = RcodeNotZone
+	m.Response, m.AuthenticatedData = true, true
+	for _, s := range []string{m.MsgHdr.String(), m.String()} {
+		h, err := ParseMsgHdr(s)
+		if err != nil || *h != m.MsgHdr {
+			t.Logf("%q parses to %v: %v", s, h, err)
+			t.Fail()
+		}
+	}
+	for _, s := range []string{"", ";; opcode: QUERY, status: NOERROR, id: 1", ";; opcode: QUERY, status: XX, id: 1\n;; flags: qr;"} {
+		if _, err := ParseMsgHdr(s); err == nil {
+			t.Logf("%q should not parse", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestRawFlags(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	buf, _ := m.Pack()
+	if bits, ok := RawFlags(buf, 0); !ok || !FlagSet(bits, FlagRD) || FlagSet(bits, FlagQR) {
+		t.Logf("Wrong flags %x", bits)
+		t.Fail()
+	}
+	RawSetFlag(buf, 0, FlagQR, true)
+	RawSetFlag(buf, 0, FlagRD, false)
+	m.Unpack(buf)
+	if !m.Response || m.RecursionDesired {
+		t.Logf("Wrong flags after setting them: %s", m.Flags())
+		t.Fail()
+	}
+	if SetFlag(OpcodeNotify<<11|FlagAA, FlagAA, false) != OpcodeNotify<<11 {
+		t.Log("SetFlag should leave the opcode alone")
+		t.Fail()
+	}
+	if RawSetFlag(buf[:3], 0, FlagQR, true) {
+		t.Log("Setting a flag in a short message should fail")
+		t.Fail()
+	}
+}
+
+func TestOPTString(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	m.SetEdns0(4096, true)
+	opt := m.Extra[0].(*RR_OPT)
+	opt.SetNsid(hex.EncodeToString([]byte("gpdns\x01")))
+	// 192.0.2.0/24, scope 0
+	opt.Option = append(opt.Option, Option{OptionCodeSubnet, "00011800c00002"}, Option{65001, "0102"})
+	opt.SetKeyTags([]uint16{20326})
+
+	want := ";; OPT PSEUDOSECTION:\n; EDNS: version: 0, flags: do; udp: 4096\n" +
+		"; NSID: 67 70 64 6e 73 01 (\"gpdns.\")\n" +
+		"; CLIENT-SUBNET: 192.0.2.0/24/0\n" +
+		"; OPT=65001: 01 02 (\"..\")\n" +
+		"; KEY-TAG: 20326"
+	if s := opt.String(); s != want {
+		t.Logf("OPT is\n%s\nwant\n%s", s, want)
+		t.Fail()
+	}
+	// The message shows the OPT RR before the question, and not as an RR
+	s := m.String()
+	if !strings.Contains(s, "ADDITIONAL: 1\n\n"+want+"\n\n;; QUESTION SECTION:") || strings.Contains(s, "ADDITIONAL SECTION") {
+		t.Logf("Message is\n%s", s)
+		t.Fail()
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/md5"
 	"crypto/rand"
@@ -18,6 +19,8 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/asn1"
 	"encoding/hex"
 	"hash"
 	"io"
@@ -41,6 +44,8 @@ const (
 	ECCGOST          = 12
 	ECDSAP256SHA256  = 13
 	ECDSAP384SHA384  = 14
+	ED25519          = 15
+	ED448            = 16
 	PRIVATEDNS       = 253 // Private (experimental keys)
 	PRIVATEOID       = 254
 )
@@ -51,14 +56,14 @@ const (
 	SHA1   // RFC 4034
 	SHA256 // RFC 4509 
 	GOST94 // RFC 5933
-	SHA384 // Experimental
+	SHA384 // RFC 6605
 )
 
 // DNSKEY flag values.
 const (
 	SEP    = 1
-	ZONE   = 1 << 7
-	REVOKE = 1 << 8
+	REVOKE = 1 << 7 // RFC 5011
+	ZONE   = 1 << 8
 )
 
 // The RRSIG needs to be converted to wireformat with some of
@@ -159,31 +164,92 @@ func (k *RR_DNSKEY) ToDS(h int) *RR_DS {
 	// digest buffer
 	digest := append(owner, wire...) // another copy
 
-	switch h {
-	case SHA1:
-		s := sha1.New()
-		io.WriteString(s, string(digest))
-		ds.Digest = hex.EncodeToString(s.Sum(nil))
-	case SHA256:
-		s := sha256.New()
-		io.WriteString(s, string(digest))
-		ds.Digest = hex.EncodeToString(s.Sum(nil))
-	case SHA384:
-		s := sha512.New384()
-		io.WriteString(s, string(digest))
-		ds.Digest = hex.EncodeToString(s.Sum(nil))
-	case GOST94:
-		/* I have no clue */
-	default:
+	f, ok := dsDigest[h]
+	if !ok {
 		return nil
 	}
+	s := f()
+	io.WriteString(s, string(digest))
+	ds.Digest = hex.EncodeToString(s.Sum(nil))
 	return ds
 }
 
+// Hash functions for the DS digest types.
+var dsDigest = map[int]func() hash.Hash{
+	SHA1:   sha1.New,
+	SHA256: sha256.New,
+	SHA384: sha512.New384,
+}
+
+// RegisterDigest makes the hash function f available for the DS digest
+// type t. This can be used to add digest types that are not implemented by
+// this package, like GOST94. It should be called before any DS records are
+// created or checked, i.e. from an init function.
+func RegisterDigest(t int, f func() hash.Hash) {
+	dsDigest[t] = f
+}
+
+// Verify checks that the DS record refers to the key k. It returns
+// ErrAlg if the digest type is not known, see RegisterDigest.
+func (d *RR_DS) Verify(k *RR_DNSKEY) error {
+	if _, ok := dsDigest[int(d.DigestType)]; !ok {
+		return ErrAlg
+	}
+	ds := k.ToDS(int(d.DigestType))
+	if ds == nil {
+		return ErrKey
+	}
+	if ds.KeyTag != d.KeyTag || ds.Algorithm != d.Algorithm ||
+		strings.ToLower(ds.Hdr.Name) != strings.ToLower(d.Hdr.Name) ||
+		!equalDigest(ds.Digest, d.Digest) {
+		return ErrKey
+	}
+	return nil
+}
+
+// equalDigest compares the hex encoded digests a and b in constant time.
+func equalDigest(a, b string) bool {
+	da, err := hex.DecodeString(a)
+	if err != nil {
+		return false
+	}
+	db, err := hex.DecodeString(b)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(da, db) == 1
+}
+
+// keyAlgorithm returns true if the public key pub can be used with
+// the DNSSEC algorithm alg. This prevents signatures that are made with one
+// algorithm from being labeled as another.
+func keyAlgorithm(pub crypto.PublicKey, alg uint8) bool {
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		switch alg {
+		case RSAMD5, RSASHA1, RSASHA1NSEC3SHA1, RSASHA256, RSASHA512:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		switch alg {
+		case ECDSAP256SHA256:
+			return p.Curve == elliptic.P256()
+		case ECDSAP384SHA384:
+			return p.Curve == elliptic.P384()
+		}
+	case ed25519.PublicKey:
+		return alg == ED25519
+	case ED448PublicKey:
+		return alg == ED448
+	}
+	return false
+}
+
 // Sign signs an RRSet. The signature needs to be filled in with
 // the values: Inception, Expiration, KeyTag, SignerName and Algorithm.
-// The rest is copied from the RRset. Sign returns true when the signing went OK,
-// otherwise false.
+// The rest is copied from the RRset. Sign returns nil when the signing went OK,
+// otherwise an error. The key k can also be a crypto.Signer, see PrivateKey.
+// A key that can not be used with the algorithm results in ErrKeyAlg.
 // The signature data in the RRSIG is filled by this method.
 // There is no check if RRSet is a proper (RFC 2181) RRSet.
 func (s *RR_RRSIG) Sign(k PrivateKey, rrset RRset) error {
@@ -245,14 +311,26 @@ func (s *RR_RRSIG) Sign(k PrivateKey, rrset RRset) error {
 		ch = crypto.SHA256
 	case ECDSAP384SHA384:
 		h = sha512.New384()
+		ch = crypto.SHA384
 	case RSASHA512:
 		h = sha512.New()
 		ch = crypto.SHA512
+	case ED25519, ED448:
+		// EdDSA signs the data itself, RFC 8080
 	default:
 		return ErrAlg
 	}
-	io.WriteString(h, string(signdata))
-	sighash = h.Sum(nil)
+	if h != nil {
+		io.WriteString(h, string(signdata))
+		sighash = h.Sum(nil)
+	} else {
+		sighash = signdata
+	}
+
+	// The key must be of the type the algorithm calls for
+	if p, ok := k.(crypto.Signer); !ok || !keyAlgorithm(p.Public(), s.Algorithm) {
+		return ErrKeyAlg
+	}
 
 	switch p := k.(type) {
 	case *rsa.PrivateKey:
@@ -266,8 +344,29 @@ func (s *RR_RRSIG) Sign(k PrivateKey, rrset RRset) error {
 		if err != nil {
 			return err
 		}
-		signature := r1.Bytes()
-		signature = append(signature, s1.Bytes()...)
+		s.Signature = unpackBase64(ecdsaSignature(r1, s1, p.Curve))
+	case ed25519.PrivateKey:
+		s.Signature = unpackBase64(ed25519.Sign(p, signdata))
+	case ED448PrivateKey:
+		s.Signature = unpackBase64(ed448Sign(p, signdata))
+	case crypto.Signer:
+		// Key is held elsewhere, i.e. in an HSM
+		signature, err := p.Sign(rand.Reader, sighash, ch)
+		if err != nil {
+			return err
+		}
+		switch pub := p.Public().(type) {
+		case *rsa.PublicKey, ed25519.PublicKey, ED448PublicKey:
+		case *ecdsa.PublicKey:
+			// crypto.Signer returns an ASN.1 encoded ECDSA signature
+			var rs struct{ R, S *big.Int }
+			if _, err := asn1.Unmarshal(signature, &rs); err != nil {
+				return ErrSigGen
+			}
+			signature = ecdsaSignature(rs.R, rs.S, pub.Curve)
+		default:
+			return ErrKeyAlg
+		}
 		s.Signature = unpackBase64(signature)
 	default:
 		// Not given the correct key
@@ -276,30 +375,119 @@ func (s *RR_RRSIG) Sign(k PrivateKey, rrset RRset) error {
 	return nil
 }
 
+// ecdsaSignature returns the signature r, s in the DNSSEC wire format: r and
+// s are both padded to the size of the curve and concatenated, RFC 6605.
+func ecdsaSignature(r, s *big.Int, c elliptic.Curve) []byte {
+	size := (c.Params().BitSize + 7) / 8
+	buf := make([]byte, 2*size)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(buf[size-len(rb):size], rb)
+	copy(buf[2*size-len(sb):], sb)
+	return buf
+}
+
+// Reasons for a failed verification, see VerifyError.
+const (
+	VerifyKeyTag    = iota + 1 // key tag of the signature does not match the key
+	VerifyKey                  // class, algorithm or signer name do not match the key, or the key is invalid
+	VerifyRRset                // the RRset is empty or not covered by the signature
+	VerifyOwner                // the owner name is not in the signer's zone
+	VerifyLabels               // the labels field is larger than the number of labels in the owner name
+	VerifyTime                 // the signature is not valid at the time of verification
+	VerifyCrypto               // the cryptographic check failed
+	VerifyAlgorithm            // the algorithm is not supported
+)
+
+// Map of verification reasons to strings.
+var Verify_str = map[int]string{
+	VerifyKeyTag:    "key tag mismatch",
+	VerifyKey:       "key mismatch",
+	VerifyRRset:     "rrset not covered",
+	VerifyOwner:     "owner not in signer's zone",
+	VerifyLabels:    "label count mismatch",
+	VerifyTime:      "time invalid",
+	VerifyCrypto:    "crypto failure",
+	VerifyAlgorithm: "unsupported algorithm",
+}
+
+// A VerifyError is returned by Verify and VerifyAt and tells why a
+// signature does not validate.
+type VerifyError struct {
+	Reason int   // VerifyKeyTag, VerifyKey, ...
+	Err    error // the underlying error, ErrKey, ErrSig, ...
+}
+
+func (e *VerifyError) Error() string {
+	return Verify_str[e.Reason] + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *VerifyError) Unwrap() error { return e.Err }
+
+func verifyError(reason int, err error) error {
+	return &VerifyError{Reason: reason, Err: err}
+}
+
+// VerifyAt is like Verify, but also checks that the signature is valid at
+// time t. A signature that is not valid at t results in a VerifyError with
+// reason VerifyTime.
+func (s *RR_RRSIG) VerifyAt(k *RR_DNSKEY, rrset RRset, t time.Time) error {
+	if err := s.CheckValidity(t, 0); err != nil {
+		return verifyError(VerifyTime, err)
+	}
+	return s.Verify(k, rrset)
+}
+
 // Verify validates an RRSet with the signature and key. This is only the
-// cryptographic test, the signature validity period most be checked separately.
+// cryptographic test, the signature validity period most be checked separately,
+// or use VerifyAt. When the signature does not validate the error returned
+// is a *VerifyError.
 func (s *RR_RRSIG) Verify(k *RR_DNSKEY, rrset RRset) error {
 	// Frist the easy checks
 	if s.KeyTag != k.KeyTag() {
-		return ErrKey
+		return verifyError(VerifyKeyTag, ErrKey)
 	}
 	if s.Hdr.Class != k.Hdr.Class {
-		return ErrKey
+		return verifyError(VerifyKey, ErrKey)
 	}
 	if s.Algorithm != k.Algorithm {
-		return ErrKey
+		return verifyError(VerifyKey, ErrKey)
 	}
 	if s.SignerName != k.Hdr.Name {
-		return ErrKey
+		return verifyError(VerifyKey, ErrKey)
+	}
+	// RFC 4034 2.1.1 and 2.1.2, only zone keys may be used
+	if k.Flags&ZONE != ZONE || k.Protocol != 3 {
+		return verifyError(VerifyKey, ErrKey)
+	}
+	if len(rrset) == 0 {
+		return verifyError(VerifyRRset, ErrRRset)
 	}
 	for _, r := range rrset {
 		if r.Header().Class != s.Hdr.Class {
-			return ErrRRset
+			return verifyError(VerifyRRset, ErrRRset)
 		}
 		if r.Header().Rrtype != s.TypeCovered {
-			return ErrRRset
+			return verifyError(VerifyRRset, ErrRRset)
 		}
 	}
+	// RFC 4035 5.3.1, the owner must be in the signer's zone and the
+	// labels field may not be larger than the number of labels in the owner,
+	// not counting a wildcard label.
+	owner := strings.ToLower(rrset[0].Header().Name)
+	if !isSubDomain(strings.ToLower(s.SignerName), owner) {
+		return verifyError(VerifyOwner, ErrRRset)
+	}
+	labels := SplitLabels(owner)
+	if owner == "." {
+		labels = nil
+	}
+	if len(labels) > 0 && labels[0] == "*" {
+		labels = labels[1:]
+	}
+	if int(s.Labels) > len(labels) {
+		return verifyError(VerifyLabels, ErrRRset)
+	}
 
 	// RFC 4035 5.3.2.  Reconstructing the Signed Data
 	// Copy the sig, except the rrsig data
@@ -316,12 +504,12 @@ func (s *RR_RRSIG) Verify(k *RR_DNSKEY, rrset RRset) error {
 	signeddata := make([]byte, DefaultMsgSize)
 	n, ok := packStruct(sigwire, signeddata, 0)
 	if !ok {
-		return ErrPack
+		return verifyError(VerifyCrypto, ErrPack)
 	}
 	signeddata = signeddata[:n]
 	wire := rawSignatureData(rrset, s)
 	if wire == nil {
-		return ErrSigGen
+		return verifyError(VerifyCrypto, ErrSigGen)
 	}
 	signeddata = append(signeddata, wire...)
 
@@ -333,6 +521,9 @@ func (s *RR_RRSIG) Verify(k *RR_DNSKEY, rrset RRset) error {
 	switch s.Algorithm {
 	case RSASHA1, RSASHA1NSEC3SHA1, RSASHA256, RSASHA512, RSAMD5:
 		pubkey := k.pubKeyRSA() // Get the key
+		if pubkey == nil {
+			return verifyError(VerifyKey, ErrKey)
+		}
 		// Setup the hash as defined for this alg.
 		var h hash.Hash
 		var ch crypto.Hash
@@ -352,21 +543,308 @@ func (s *RR_RRSIG) Verify(k *RR_DNSKEY, rrset RRset) error {
 		}
 		io.WriteString(h, string(signeddata))
 		sighash := h.Sum(nil)
-		return rsa.VerifyPKCS1v15(pubkey, ch, sighash, sigbuf)
+		if rsa.VerifyPKCS1v15(pubkey, ch, sighash, sigbuf) != nil {
+			return verifyError(VerifyCrypto, ErrSig)
+		}
+		return nil
+	case ECDSAP256SHA256, ECDSAP384SHA384:
+		pubkey := k.pubKeyCurve()
+		if pubkey == nil {
+			return verifyError(VerifyKey, ErrKey)
+		}
+		var h hash.Hash
+		switch s.Algorithm {
+		case ECDSAP256SHA256:
+			h = sha256.New()
+		case ECDSAP384SHA384:
+			h = sha512.New384()
+		}
+		// The signature is r | s, RFC 6605
+		intlen := pubkey.Curve.Params().BitSize / 8
+		if len(sigbuf) != 2*intlen {
+			return verifyError(VerifyCrypto, ErrSig)
+		}
+		r := big.NewInt(0).SetBytes(sigbuf[:intlen])
+		s1 := big.NewInt(0).SetBytes(sigbuf[intlen:])
+		io.WriteString(h, string(signeddata))
+		if !ecdsa.Verify(pubkey, h.Sum(nil), r, s1) {
+			return verifyError(VerifyCrypto, ErrSig)
+		}
+		return nil
+	case ED25519:
+		pubkey := k.pubKeyEd25519()
+		if pubkey == nil {
+			return verifyError(VerifyKey, ErrKey)
+		}
+		if !ed25519.Verify(pubkey, signeddata, sigbuf) {
+			return verifyError(VerifyCrypto, ErrSig)
+		}
+		return nil
+	case ED448:
+		pubkey := k.pubKeyEd448()
+		if pubkey == nil {
+			return verifyError(VerifyKey, ErrKey)
+		}
+		if !ed448Verify(pubkey, signeddata, sigbuf) {
+			return verifyError(VerifyCrypto, ErrSig)
+		}
+		return nil
 	}
 	// Unknown alg
-	return ErrAlg
+	return verifyError(VerifyAlgorithm, ErrAlg)
+}
+
+// CheckCDS checks the CDS and CDNSKEY records of a child zone against the
+// DNSKEY RRset of that zone, as a parent must do before it updates the DS
+// records, see RFC 7344 and RFC 8078. The RRs in rrs should be the DNSKEY,
+// CDS, CDNSKEY and RRSIG records from the apex of the child zone. It is
+// checked that each CDS and CDNSKEY refers to a key in the DNSKEY RRset,
+// that the CDS and CDNSKEY RRsets refer to the same keys, that a delete
+// request (algorithm zero) is the only record in its RRset and that the
+// DNSKEY, CDS and CDNSKEY RRsets are signed by a key from the DNSKEY RRset.
+// If there are no CDS or CDNSKEY records nil is returned.
+func CheckCDS(rrs []RR) error {
+	var (
+		keys    []*RR_DNSKEY
+		cds     []*RR_CDS
+		cdnskey []*RR_CDNSKEY
+		sigs    []*RR_RRSIG
+		sets    = make(map[uint16]RRset)
+	)
+	for _, r := range rrs {
+		switch x := r.(type) {
+		case *RR_DNSKEY:
+			keys = append(keys, x)
+		case *RR_CDS:
+			cds = append(cds, x)
+		case *RR_CDNSKEY:
+			cdnskey = append(cdnskey, x)
+		case *RR_RRSIG:
+			sigs = append(sigs, x)
+			continue
+		default:
+			continue
+		}
+		sets[r.Header().Rrtype] = append(sets[r.Header().Rrtype], r)
+	}
+	if len(cds) == 0 && len(cdnskey) == 0 {
+		return nil
+	}
+	if len(keys) == 0 {
+		return ErrCds
+	}
+	// A delete request must be the only record
+	for _, c := range cds {
+		if c.Algorithm == 0 && len(cds) != 1 {
+			return ErrCds
+		}
+	}
+	for _, c := range cdnskey {
+		if c.Algorithm == 0 && len(cdnskey) != 1 {
+			return ErrCds
+		}
+	}
+	fromCds := make(map[uint16]bool)
+	for _, c := range cds {
+		if c.Algorithm == 0 {
+			continue
+		}
+		found := false
+		for _, k := range keys {
+			if ds := k.ToDS(int(c.DigestType)); ds != nil && ds.KeyTag == c.KeyTag &&
+				ds.Algorithm == c.Algorithm && equalDigest(ds.Digest, c.Digest) {
+				fromCds[ds.KeyTag] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrCds
+		}
+	}
+	fromCdnskey := make(map[uint16]bool)
+	for _, c := range cdnskey {
+		if c.Algorithm == 0 {
+			continue
+		}
+		found := false
+		for _, k := range keys {
+			if k.Flags == c.Flags && k.Protocol == c.Protocol && k.Algorithm == c.Algorithm &&
+				k.PublicKey == c.PublicKey {
+				fromCdnskey[k.KeyTag()] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrCds
+		}
+	}
+	if len(cds) > 0 && len(cdnskey) > 0 {
+		if len(fromCds) != len(fromCdnskey) {
+			return ErrCds
+		}
+		for t := range fromCds {
+			if !fromCdnskey[t] {
+				return ErrCds
+			}
+		}
+	}
+	// Each RRset must carry a valid signature from one of the keys
+	for t, set := range sets {
+		signed := false
+	Sigs:
+		for _, s := range sigs {
+			if s.TypeCovered != t || !s.ValidityPeriod(time.Now()) {
+				continue
+			}
+			for _, k := range keys {
+				if s.Verify(k, set) == nil {
+					signed = true
+					break Sigs
+				}
+			}
+		}
+		if !signed {
+			return ErrNoSig
+		}
+	}
+	return nil
+}
+
+// The coverage of an RRset by signatures, see VerifyRRsetCoverage.
+const (
+	CoverageSigned     = iota // a valid signature from a known key covers the RRset
+	CoverageUnsigned          // there is no signature for the RRset
+	CoverageExpired           // the signatures are expired or not yet valid
+	CoverageBogus             // a signature from a known key does not validate
+	CoverageUnknownKey        // the signatures are made with unknown keys
+)
+
+// Map of coverage states to strings.
+var Coverage_str = map[int]string{
+	CoverageSigned:     "signed",
+	CoverageUnsigned:   "unsigned",
+	CoverageExpired:    "expired",
+	CoverageBogus:      "bogus",
+	CoverageUnknownKey: "unknown key",
+}
+
+// RRsetCoverage tells how an RRset of a message is covered by signatures.
+type RRsetCoverage struct {
+	RRset    RRset
+	Sigs     []*RR_RRSIG // the signatures for the RRset
+	Coverage int         // CoverageSigned, CoverageUnsigned, ...
+}
+
+// VerifyRRsetCoverage checks the signatures of the RRsets in the answer,
+// authority and additional sections of m against keys and the DNSKEY
+// records in m, at the current time. It returns the coverage of each
+// RRset, in the order of the message. When a signature covers the RRset
+// the coverage is CoverageSigned; otherwise it is CoverageExpired when
+// there is a signature that is not valid now, CoverageBogus when a
+// signature from a known key does not validate and CoverageUnknownKey when
+// there are signatures from unknown keys only. The NS RRset of a referral
+// is not signed and is left out, the unsigned glue in the additional
+// section is not.
+func VerifyRRsetCoverage(m *Msg, keys ...*RR_DNSKEY) []RRsetCoverage {
+	var sigs []*RR_RRSIG
+	for _, section := range [][]RR{m.Answer, m.Ns, m.Extra} {
+		for _, r := range section {
+			switch x := r.(type) {
+			case *RR_RRSIG:
+				sigs = append(sigs, x)
+			case *RR_DNSKEY:
+				keys = append(keys, x)
+			}
+		}
+	}
+	referral := len(m.Answer) == 0 && findSoa(m.Ns) == nil
+	now := time.Now()
+	var cov []RRsetCoverage
+	for i, section := range [][]RR{m.Answer, m.Ns, m.Extra} {
+		for _, idx := range rrsetIndices(section) {
+			set := make(RRset, len(idx))
+			for j, k := range idx {
+				set[j] = section[k]
+			}
+			h := set[0].Header()
+			switch {
+			case h.Rrtype == TypeRRSIG, h.Rrtype == TypeOPT, h.Rrtype == TypeTSIG:
+				continue
+			case i == 1 && referral && h.Rrtype == TypeNS:
+				continue
+			}
+			c := RRsetCoverage{RRset: set, Coverage: CoverageUnsigned}
+			for _, s := range sigs {
+				if s.TypeCovered == h.Rrtype && s.Hdr.Class == h.Class && strings.EqualFold(s.Hdr.Name, h.Name) {
+					c.Sigs = append(c.Sigs, s)
+				}
+			}
+			c.Coverage = sigCoverage(c.Sigs, keys, set, now)
+			cov = append(cov, c)
+		}
+	}
+	return cov
 }
 
-// ValidityPeriod uses RFC1982 serial arithmetic to calculate 
-// if a signature period is valid.
-func (s *RR_RRSIG) ValidityPeriod() bool {
-	utc := time.Now().UTC().Unix()
+// sigCoverage returns the coverage of rrset by sigs.
+func sigCoverage(sigs []*RR_RRSIG, keys []*RR_DNSKEY, rrset RRset, now time.Time) int {
+	if len(sigs) == 0 {
+		return CoverageUnsigned
+	}
+	expired, bogus := false, false
+	for _, s := range sigs {
+		valid := s.ValidityPeriod(now)
+		if !valid {
+			expired = true
+		}
+		for _, k := range keys {
+			if k.KeyTag() != s.KeyTag || k.Algorithm != s.Algorithm || !strings.EqualFold(k.Hdr.Name, s.SignerName) {
+				continue
+			}
+			if s.Verify(k, rrset) != nil {
+				bogus = true
+				continue
+			}
+			if valid {
+				return CoverageSigned
+			}
+		}
+	}
+	switch {
+	case expired:
+		return CoverageExpired
+	case bogus:
+		return CoverageBogus
+	}
+	return CoverageUnknownKey
+}
+
+// ValidityPeriod uses RFC1982 serial arithmetic to calculate
+// if a signature period is valid at time t.
+func (s *RR_RRSIG) ValidityPeriod(t time.Time) bool {
+	return s.CheckValidity(t, 0) == nil
+}
+
+// CheckValidity checks if the signature period is valid at time t,
+// allowing for a clock skew of skew: the inception may lie up to skew
+// after t and the expiration up to skew before t. It returns ErrSigExpired
+// or ErrSigNotYet when the signature is not valid.
+func (s *RR_RRSIG) CheckValidity(t time.Time, skew time.Duration) error {
+	utc := t.UTC().Unix()
 	modi := (int64(s.Inception) - utc) / Year68
 	mode := (int64(s.Expiration) - utc) / Year68
 	ti := int64(s.Inception) + (modi * Year68)
 	te := int64(s.Expiration) + (mode * Year68)
-	return ti <= utc && utc <= te
+	sk := int64(skew / time.Second)
+	if utc+sk < ti {
+		return ErrSigNotYet
+	}
+	if utc-sk > te {
+		return ErrSigExpired
+	}
+	return nil
 }
 
 // Return the signatures base64 encodedig sigdata as a byte slice.
@@ -417,15 +895,37 @@ func (k *RR_DNSKEY) pubKeyCurve() *ecdsa.PublicKey {
 		c = elliptic.P256()
 	case ECDSAP384SHA384:
 		c = elliptic.P384()
+	default:
+		return nil
+	}
+	// The key is X | Y, without the uncompressed point marker
+	intlen := c.Params().BitSize / 8
+	if len(keybuf) != 2*intlen {
+		return nil
 	}
-	x, y := elliptic.Unmarshal(c, keybuf)
 	pubkey := new(ecdsa.PublicKey)
-	pubkey.X = x
-	pubkey.Y = y
+	pubkey.X = big.NewInt(0).SetBytes(keybuf[:intlen])
+	pubkey.Y = big.NewInt(0).SetBytes(keybuf[intlen:])
 	pubkey.Curve = c
 	return pubkey
 }
 
+func (k *RR_DNSKEY) pubKeyEd25519() ed25519.PublicKey {
+	keybuf, err := packBase64([]byte(k.PublicKey))
+	if err != nil || len(keybuf) != ed25519.PublicKeySize {
+		return nil
+	}
+	return ed25519.PublicKey(keybuf)
+}
+
+func (k *RR_DNSKEY) pubKeyEd448() ED448PublicKey {
+	keybuf, err := packBase64([]byte(k.PublicKey))
+	if err != nil || len(keybuf) != ed448PublicKeySize {
+		return nil
+	}
+	return ED448PublicKey(keybuf)
+}
+
 // Set the public key (the value E and N)
 func (k *RR_DNSKEY) setPublicKeyRSA(_E int, _N *big.Int) bool {
 	if _E == 0 || _N == nil {
@@ -442,7 +942,16 @@ func (k *RR_DNSKEY) setPublicKeyCurve(_X, _Y *big.Int) bool {
 	if _X == nil || _Y == nil {
 		return false
 	}
-	buf := curveToBuf(_X, _Y)
+	var intlen int
+	switch k.Algorithm {
+	case ECDSAP256SHA256:
+		intlen = 32
+	case ECDSAP384SHA384:
+		intlen = 48
+	default:
+		return false
+	}
+	buf := curveToBuf(_X, _Y, intlen)
 	k.PublicKey = unpackBase64(buf)
 	return true
 }
@@ -465,10 +974,13 @@ func exponentToBuf(_E int) []byte {
 	return buf
 }
 
-// Set the public key for X and Y for Curve. Experiment.
-func curveToBuf(_X, _Y *big.Int) []byte {
-	buf := _X.Bytes()
-	buf = append(buf, _Y.Bytes()...)
+// Set the public key for Elliptic Curves, RFC 6605: X and Y are
+// both padded to intlen bytes and concatenated.
+func curveToBuf(_X, _Y *big.Int, intlen int) []byte {
+	buf := make([]byte, 2*intlen)
+	x, y := _X.Bytes(), _Y.Bytes()
+	copy(buf[intlen-len(x):intlen], x)
+	copy(buf[2*intlen-len(y):], y)
 	return buf
 }
 
@@ -530,6 +1042,8 @@ var Alg_str = map[uint8]string{
 	ECCGOST:          "ECC-GOST",
 	ECDSAP256SHA256:  "ECDSAP256SHA256",
 	ECDSAP384SHA384:  "ECDSAP384SHA384",
+	ED25519:          "ED25519",
+	ED448:            "ED448",
 	PRIVATEDNS:       "PRIVATEDNS",
 	PRIVATEOID:       "PRIVATEOID",
 }
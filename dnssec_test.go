@@ -1,9 +1,14 @@
 package dns
 
 import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rsa"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func getKey() *RR_DNSKEY {
@@ -78,14 +83,34 @@ func TestSignature(t *testing.T) {
 	sig.Signature = "AwEAAaHIwpx3w4VHKi6i1LHnTaWeHCL154Jug0Rtc9ji5qwPXpBo6A5sRv7cSsPQKPIwxLpyCrbJ4mr2L0EPOdvP6z6YfljK2ZmTbogU9aSU2fiq/4wjxbdkLyoDVgtO+JsxNN4bjr4WcWhsmk1Hg93FV9ZpkWb0Tbad8DFqNDzr//kZ"
 
 	// Should not be valid
-	if sig.ValidityPeriod() {
+	if sig.ValidityPeriod(time.Now()) {
 		t.Log("Should not be valid")
 		t.Fail()
 	}
+	if sig.CheckValidity(time.Now(), 0) != ErrSigExpired {
+		t.Log("Should be expired")
+		t.Fail()
+	}
+	if sig.CheckValidity(time.Unix(700, 0), 0) != ErrSigNotYet {
+		t.Log("Should not be valid yet")
+		t.Fail()
+	}
+	if sig.CheckValidity(time.Unix(700, 0), 100*time.Second) != nil {
+		t.Log("Should be valid with clock skew")
+		t.Fail()
+	}
+	if d := TimeToDate(sig.Expiration); d != "19700101001640" {
+		t.Logf("Wrong date for expiration: %s", d)
+		t.Fail()
+	}
+	if e, _ := DateToTime("19700101001640"); e != sig.Expiration {
+		t.Logf("Wrong time for date: %d", e)
+		t.Fail()
+	}
 
 	sig.Inception = 315565800   //Tue Jan  1 10:10:00 CET 1980
 	sig.Expiration = 4102477800 //Fri Jan  1 10:10:00 CET 2100
-	if !sig.ValidityPeriod() {
+	if !sig.ValidityPeriod(time.Now()) {
 		t.Log("Should be valid")
 		t.Fail()
 	}
@@ -291,3 +316,461 @@ func TestKeyToDS(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCheckCDS(t *testing.T) {
+	key := new(RR_DNSKEY)
+	key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+	key.Flags = 257
+	key.Protocol = 3
+	key.Algorithm = RSASHA256
+	priv, err := key.Generate(1024)
+	if err != nil {
+		t.Logf("Failed to generate key: %s", err)
+		t.Fail()
+		return
+	}
+	ds := key.ToDS(SHA256)
+	cds := &RR_CDS{RR_Header{"miek.nl.", TypeCDS, ClassINET, 3600, 0}, ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest}
+	cdnskey := &RR_CDNSKEY{RR_Header{"miek.nl.", TypeCDNSKEY, ClassINET, 3600, 0}, key.Flags, key.Protocol, key.Algorithm, key.PublicKey}
+
+	now := uint32(time.Now().Unix())
+	rrs := []RR{key, cds, cdnskey}
+	for _, r := range []RR{key, cds, cdnskey} {
+		sig := new(RR_RRSIG)
+		sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 3600, 0}
+		sig.Inception = now - 3600
+		sig.Expiration = now + 3600
+		sig.KeyTag = key.KeyTag()
+		sig.SignerName = key.Hdr.Name
+		sig.Algorithm = key.Algorithm
+		if err := sig.Sign(priv, []RR{r}); err != nil {
+			t.Logf("Failed to sign: %s", err)
+			t.Fail()
+			return
+		}
+		rrs = append(rrs, sig)
+	}
+	if err := CheckCDS(rrs); err != nil {
+		t.Logf("CDS should be consistent: %s", err)
+		t.Fail()
+	}
+	if err := CheckCDS(rrs[:3]); err != ErrNoSig {
+		t.Logf("Unsigned CDS should fail: %v", err)
+		t.Fail()
+	}
+	cds.Digest = "AABB"
+	if err := CheckCDS(rrs); err != ErrCds {
+		t.Logf("CDS with a bad digest should fail: %v", err)
+		t.Fail()
+	}
+
+	r, err := NewRR("miek.nl. IN CDS 0 0 0 00")
+	if err != nil || r.Header().Rrtype != TypeCDS {
+		t.Logf("Failed to parse delete CDS: %v", err)
+		t.Fail()
+	}
+}
+
+// remoteSigner only exposes the crypto.Signer methods of a key.
+type remoteSigner struct {
+	s crypto.Signer
+}
+
+func (r remoteSigner) Public() crypto.PublicKey { return r.s.Public() }
+func (r remoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return r.s.Sign(rand, digest, opts)
+}
+
+func TestSignWithSigner(t *testing.T) {
+	key := new(RR_DNSKEY)
+	key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+	key.Flags = 256
+	key.Protocol = 3
+	key.Algorithm = RSASHA256
+	priv, _ := key.Generate(1024)
+	soa, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+
+	sig := new(RR_RRSIG)
+	sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 14400, 0}
+	sig.Inception = uint32(time.Now().Unix())
+	sig.Expiration = sig.Inception + 3600
+	sig.KeyTag = key.KeyTag()
+	sig.SignerName = key.Hdr.Name
+	sig.Algorithm = key.Algorithm
+	if err := sig.Sign(remoteSigner{priv.(*rsa.PrivateKey)}, []RR{soa}); err != nil {
+		t.Logf("Failed to sign with a crypto.Signer: %s", err)
+		t.Fail()
+		return
+	}
+	if err := sig.Verify(key, []RR{soa}); err != nil {
+		t.Logf("Failed to verify signature from a crypto.Signer: %s", err)
+		t.Fail()
+	}
+}
+
+func TestSignED25519(t *testing.T) {
+	key := new(RR_DNSKEY)
+	key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+	key.Flags = 257
+	key.Protocol = 3
+	key.Algorithm = ED25519
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Logf("Failed to generate key: %s", err)
+		t.Fail()
+		return
+	}
+	// Round trip the private key
+	priv, err = ReadPrivateKey(strings.NewReader(key.PrivateKeyString(priv)), "")
+	if err != nil {
+		t.Logf("Failed to read private key: %s", err)
+		t.Fail()
+		return
+	}
+	soa, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+	sig := new(RR_RRSIG)
+	sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 14400, 0}
+	sig.Inception = uint32(time.Now().Unix())
+	sig.Expiration = sig.Inception + 3600
+	sig.KeyTag = key.KeyTag()
+	sig.SignerName = key.Hdr.Name
+	sig.Algorithm = key.Algorithm
+	if err := sig.Sign(priv, []RR{soa}); err != nil {
+		t.Logf("Failed to sign: %s", err)
+		t.Fail()
+		return
+	}
+	if err := sig.Verify(key, []RR{soa}); err != nil {
+		t.Logf("Failed to verify: %s", err)
+		t.Fail()
+	}
+	soa.(*RR_SOA).Serial++
+	if err := sig.Verify(key, []RR{soa}); err == nil {
+		t.Log("Verify should fail on changed data")
+		t.Fail()
+	}
+}
+
+func TestSignED448(t *testing.T) {
+	key := new(RR_DNSKEY)
+	key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+	key.Flags = 257
+	key.Protocol = 3
+	key.Algorithm = ED448
+	if _, err := key.Generate(256); err != ErrKeySize {
+		t.Logf("Generate should fail with ErrKeySize, got %v", err)
+		t.Fail()
+	}
+	priv, err := key.Generate(456)
+	if err != nil {
+		t.Logf("Failed to generate key: %s", err)
+		t.Fail()
+		return
+	}
+	// Round trip the private key
+	priv, err = ReadPrivateKey(strings.NewReader(key.PrivateKeyString(priv)), "")
+	if err != nil {
+		t.Logf("Failed to read private key: %s", err)
+		t.Fail()
+		return
+	}
+	soa, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+	sig := new(RR_RRSIG)
+	sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 14400, 0}
+	sig.Inception = uint32(time.Now().Unix())
+	sig.Expiration = sig.Inception + 3600
+	sig.KeyTag = key.KeyTag()
+	sig.SignerName = key.Hdr.Name
+	sig.Algorithm = key.Algorithm
+	if err := sig.Sign(priv, []RR{soa}); err != nil {
+		t.Logf("Failed to sign: %s", err)
+		t.Fail()
+		return
+	}
+	if err := sig.Verify(key, []RR{soa}); err != nil {
+		t.Logf("Failed to verify: %s", err)
+		t.Fail()
+	}
+	soa.(*RR_SOA).Serial++
+	if err := sig.Verify(key, []RR{soa}); err == nil {
+		t.Log("Verify should fail on changed data")
+		t.Fail()
+	}
+	// An Ed25519 key can not make an ED448 signature
+	ed := &RR_DNSKEY{Hdr: key.Hdr, Flags: 257, Protocol: 3, Algorithm: ED25519}
+	other, _ := ed.Generate(256)
+	if err := sig.Sign(other, []RR{soa}); err != ErrKeyAlg {
+		t.Logf("Sign with an Ed25519 key should fail with ErrKeyAlg, got %v", err)
+		t.Fail()
+	}
+	if ds := key.ToDS(SHA256); ds == nil || ds.Algorithm != ED448 || ds.KeyTag != key.KeyTag() {
+		t.Logf("Failed to make a DS of the key: %v", ds)
+		t.Fail()
+	}
+	if Alg_str[ED448] != "ED448" {
+		t.Logf("ED448 should have a name, got %q", Alg_str[ED448])
+		t.Fail()
+	}
+}
+
+func TestSignECDSA(t *testing.T) {
+	for _, alg := range []uint8{ECDSAP256SHA256, ECDSAP384SHA384} {
+		key := new(RR_DNSKEY)
+		key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+		key.Flags = 257
+		key.Protocol = 3
+		key.Algorithm = alg
+		bits := 256
+		if alg == ECDSAP384SHA384 {
+			bits = 384
+		}
+		priv, err := key.Generate(bits)
+		if err != nil {
+			t.Logf("Failed to generate key: %s", err)
+			t.Fail()
+			continue
+		}
+		priv, err = ReadPrivateKey(strings.NewReader(key.PrivateKeyString(priv)), "")
+		if err != nil {
+			t.Logf("Failed to read private key: %s", err)
+			t.Fail()
+			continue
+		}
+		if len(key.pubKeyCurve().X.Bytes()) == 0 || key.ToDS(SHA384) == nil {
+			t.Logf("Failed to use the public key: %s", key)
+			t.Fail()
+		}
+		soa, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+		sig := new(RR_RRSIG)
+		sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 14400, 0}
+		sig.Inception = uint32(time.Now().Unix())
+		sig.Expiration = sig.Inception + 3600
+		sig.KeyTag = key.KeyTag()
+		sig.SignerName = key.Hdr.Name
+		sig.Algorithm = key.Algorithm
+		if err := sig.Sign(priv, []RR{soa}); err != nil {
+			t.Logf("Failed to sign: %s", err)
+			t.Fail()
+			continue
+		}
+		if err := sig.Verify(key, []RR{soa}); err != nil {
+			t.Logf("Failed to verify %s: %s", Alg_str[alg], err)
+			t.Fail()
+		}
+	}
+}
+
+func TestKeyToDSECDSA(t *testing.T) {
+	// Example from RFC 6605, section 6.1
+	k, _ := NewRR("example.net. 3600 IN DNSKEY 257 3 13 GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==")
+	ds := k.(*RR_DNSKEY).ToDS(SHA256)
+	if ds.KeyTag != 55648 || strings.ToUpper(ds.Digest) != "B4C8C1FE2E7477127B27115656AD6256F424625BF5C1E2770CE6D6E37DF61D17" {
+		t.Logf("Wrong DS for ECDSA key: %s", ds)
+		t.Fail()
+	}
+}
+
+func TestDSDigests(t *testing.T) {
+	k, _ := NewRR("example.net. 3600 IN DNSKEY 257 3 13 GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==")
+	key := k.(*RR_DNSKEY)
+	for _, h := range []int{SHA1, SHA256, SHA384} {
+		ds := key.ToDS(h)
+		if ds == nil || ds.Verify(key) != nil {
+			t.Logf("Failed to create and verify DS with digest type %d", h)
+			t.Fail()
+		}
+	}
+	if key.ToDS(GOST94) != nil {
+		t.Log("GOST94 should not be available")
+		t.Fail()
+	}
+	RegisterDigest(GOST94, md5.New) // Not GOST at all, but it will do
+	defer delete(dsDigest, GOST94)
+	ds := key.ToDS(GOST94)
+	if ds == nil || ds.Verify(key) != nil || len(ds.Digest) != 32 {
+		t.Log("Failed to use a registered digest")
+		t.Fail()
+	}
+	ds.Digest = strings.Repeat("0", 32)
+	if ds.Verify(key) != ErrKey {
+		t.Log("DS with a wrong digest should not verify")
+		t.Fail()
+	}
+}
+
+func TestVerifyReasons(t *testing.T) {
+	key := new(RR_DNSKEY)
+	key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+	key.Flags = 256
+	key.Protocol = 3
+	key.Algorithm = ECDSAP256SHA256
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Logf("Failed to generate key: %s", err)
+		t.Fail()
+		return
+	}
+	soa, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+	sig := new(RR_RRSIG)
+	sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 14400, 0}
+	sig.TypeCovered = TypeSOA
+	sig.Labels = 2
+	sig.Inception = uint32(time.Now().Unix())
+	sig.Expiration = sig.Inception + 3600
+	sig.KeyTag = key.KeyTag()
+	sig.SignerName = key.Hdr.Name
+	sig.Algorithm = key.Algorithm
+	if err := sig.Sign(priv, []RR{soa}); err != nil {
+		t.Logf("Failed to sign: %s", err)
+		t.Fail()
+		return
+	}
+	if err := sig.VerifyAt(key, []RR{soa}, time.Now()); err != nil {
+		t.Logf("Failed to verify: %s", err)
+		t.Fail()
+	}
+
+	reason := func(err error) int {
+		if e, ok := err.(*VerifyError); ok {
+			return e.Reason
+		}
+		return 0
+	}
+	other, _ := NewRR("example.org. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+	changed, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945906 14400 3600 604800 86400")
+	a, _ := NewRR("miek.nl. IN A 127.0.0.1")
+
+	sig1 := *sig
+	sig1.KeyTag++
+	if r := reason(sig1.Verify(key, []RR{soa})); r != VerifyKeyTag {
+		t.Logf("Expected VerifyKeyTag, got %d", r)
+		t.Fail()
+	}
+	if r := reason(sig.Verify(key, []RR{a})); r != VerifyRRset {
+		t.Logf("Expected VerifyRRset, got %d", r)
+		t.Fail()
+	}
+	if r := reason(sig.Verify(key, []RR{other})); r != VerifyOwner {
+		t.Logf("Expected VerifyOwner, got %d", r)
+		t.Fail()
+	}
+	sig1 = *sig
+	sig1.Labels = 3
+	if r := reason(sig1.Verify(key, []RR{soa})); r != VerifyLabels {
+		t.Logf("Expected VerifyLabels, got %d", r)
+		t.Fail()
+	}
+	if r := reason(sig.Verify(key, []RR{changed})); r != VerifyCrypto {
+		t.Logf("Expected VerifyCrypto, got %d", r)
+		t.Fail()
+	}
+	err = sig.VerifyAt(key, []RR{soa}, time.Now().Add(2*time.Hour))
+	if r := reason(err); r != VerifyTime {
+		t.Logf("Expected VerifyTime, got %d", r)
+		t.Fail()
+	}
+	if err.(*VerifyError).Unwrap() != ErrSigExpired {
+		t.Logf("Expected ErrSigExpired, got %s", err)
+		t.Fail()
+	}
+}
+
+func TestKeyAlgorithmMismatch(t *testing.T) {
+	key := new(RR_DNSKEY)
+	key.Hdr = RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600}
+	key.Flags = 256
+	key.Protocol = 3
+	key.Algorithm = ECDSAP256SHA256
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Logf("Failed to generate key: %s", err)
+		t.Fail()
+		return
+	}
+	soa, _ := NewRR("miek.nl. IN SOA open.nlnetlabs.nl. miekg.atoom.net. 1293945905 14400 3600 604800 86400")
+	sig := new(RR_RRSIG)
+	sig.Hdr = RR_Header{"miek.nl.", TypeRRSIG, ClassINET, 14400, 0}
+	sig.Inception = uint32(time.Now().Unix())
+	sig.Expiration = sig.Inception + 3600
+	sig.KeyTag = key.KeyTag()
+	sig.SignerName = key.Hdr.Name
+	// An ECDSA P-256 key can not make P-384 or RSA signatures
+	for _, alg := range []uint8{ECDSAP384SHA384, RSASHA256} {
+		sig.Algorithm = alg
+		if err := sig.Sign(priv, []RR{soa}); err != ErrKeyAlg {
+			t.Logf("Signing with algorithm %d should fail: %v", alg, err)
+			t.Fail()
+		}
+	}
+	sig.Algorithm = key.Algorithm
+	if err := sig.Sign(priv, []RR{soa}); err != nil {
+		t.Logf("Failed to sign: %s", err)
+		t.Fail()
+		return
+	}
+	// Not a zone key
+	key.Flags = 0
+	sig.KeyTag = key.KeyTag()
+	if err := sig.Verify(key, []RR{soa}); err == nil || err.(*VerifyError).Reason != VerifyKey {
+		t.Logf("Verify with a non zone key should fail: %v", err)
+		t.Fail()
+	}
+}
+
+func TestVerifyRRsetCoverage(t *testing.T) {
+	newKey := func() (*RR_DNSKEY, PrivateKey) {
+		k := &RR_DNSKEY{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600},
+			Flags: ZONE, Protocol: 3, Algorithm: ED25519}
+		p, _ := k.Generate(256)
+		return k, p
+	}
+	key, priv := newKey()
+	other, otherPriv := newKey()
+	now := time.Now()
+	sign := func(k *RR_DNSKEY, p PrivateKey, rrset RRset, inception, expiration time.Time) *RR_RRSIG {
+		sig := &RR_RRSIG{KeyTag: k.KeyTag(), Algorithm: k.Algorithm, SignerName: k.Hdr.Name,
+			Inception: uint32(inception.Unix()), Expiration: uint32(expiration.Unix())}
+		sig.Sign(p, rrset)
+		return sig
+	}
+	a := newRRs("miek.nl. 3600 IN A 127.0.0.1", "miek.nl. 3600 IN A 127.0.0.2")
+	mx := newRRs("miek.nl. 3600 IN MX 10 mx.miek.nl.")
+	txt := newRRs("miek.nl. 3600 IN TXT \"unsigned\"")
+	aaaa := newRRs("miek.nl. 3600 IN AAAA ::1")
+	ns := newRRs("miek.nl. 3600 IN NS ns.miek.nl.")
+	bogus := sign(key, priv, aaaa, now.Add(-time.Hour), now.Add(time.Hour))
+	bogus.TypeCovered = TypeAAAA
+	bogus.OrigTtl = 1
+
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeANY)
+	m.Answer = append(m.Answer, a...)
+	m.Answer = append(m.Answer, sign(key, priv, a, now.Add(-time.Hour), now.Add(time.Hour)))
+	m.Answer = append(m.Answer, mx...)
+	m.Answer = append(m.Answer, sign(key, priv, mx, now.Add(-2*time.Hour), now.Add(-time.Hour)))
+	m.Answer = append(m.Answer, txt...)
+	m.Answer = append(m.Answer, aaaa...)
+	m.Answer = append(m.Answer, bogus)
+	m.Ns = append(ns, sign(other, otherPriv, ns, now.Add(-time.Hour), now.Add(time.Hour)))
+	m.SetEdns0(4096, true)
+
+	cov := VerifyRRsetCoverage(m, key)
+	want := []int{CoverageSigned, CoverageExpired, CoverageUnsigned, CoverageBogus, CoverageUnknownKey}
+	if len(cov) != len(want) {
+		t.Logf("Expected %d RRsets, got %d", len(want), len(cov))
+		t.Fail()
+		return
+	}
+	for i, c := range cov {
+		if c.Coverage != want[i] {
+			t.Logf("%s: coverage %s, want %s", c.RRset[0], Coverage_str[c.Coverage], Coverage_str[want[i]])
+			t.Fail()
+		}
+	}
+	// With the other key in the message the NS RRset is signed
+	m.Extra = append(m.Extra, other)
+	if cov = VerifyRRsetCoverage(m, key); cov[4].Coverage != CoverageSigned {
+		t.Logf("NS RRset should be signed: %s", Coverage_str[cov[4].Coverage])
+		t.Fail()
+	}
+}
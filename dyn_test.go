@@ -56,3 +56,27 @@ func TestUpdateDelete(t *testing.T) {
 	}
 	t.Log(r.String())
 }
+
+func TestUpdateRcode(t *testing.T) {
+	u := NewUpdate("dyn.atoom.net.", ClassINET)
+	m := new(Msg)
+	if err := m.SetRcode(u, RcodeYXRrset); err != nil || m.Opcode != OpcodeUpdate {
+		t.Logf("Expected an update reply, got %v: %s", err, m.MsgHdr.String())
+		t.Fail()
+	}
+	if !m.IsRcodeYXRrset() || m.IsRcodeNXRrset() || m.IsRcodeYXDomain() || m.IsRcodeNotAuth() || m.IsRcodeNotZone() {
+		t.Logf("Wrong rcode for %s", RcodeToString(m.Rcode))
+		t.Fail()
+	}
+	for _, rcode := range []int{-1, RcodeBadVers, 1 << 12} {
+		if err := m.SetRcode(u, rcode); err != ErrRcode || m.Rcode != RcodeYXRrset {
+			t.Logf("Expected ErrRcode for %d, got %v", rcode, err)
+			t.Fail()
+		}
+	}
+	m.SetEdns0(4096, false)
+	if err := m.SetRcode(u, RcodeBadVers); err != nil || m.Rcode != 0 || m.Extra[0].(*RR_OPT).ExtendedRcode() != RcodeBadVers {
+		t.Logf("Expected BADVERS in the OPT RR, got %v: %s", err, m.String())
+		t.Fail()
+	}
+}
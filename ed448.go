@@ -0,0 +1,242 @@
+package dns
+
+// Ed448 signatures (RFC 8032) for the DNSSEC algorithm ED448 (RFC 8080).
+// The Go crypto packages have no Ed448, this is a straightforward
+// implementation on math/big. It is not constant time.
+
+import (
+	"crypto"
+	"crypto/sha3"
+	"errors"
+	"io"
+	"math/big"
+)
+
+const (
+	ed448SeedSize      = 57
+	ed448PublicKeySize = 57
+	ed448SignatureSize = 114
+)
+
+// An ED448PrivateKey is an Ed448 private key: the seed followed by the
+// public key, as with crypto/ed25519.
+type ED448PrivateKey []byte
+
+// An ED448PublicKey is an Ed448 public key in the encoding of RFC 8032.
+type ED448PublicKey []byte
+
+// Public returns the public key of k.
+func (k ED448PrivateKey) Public() crypto.PublicKey {
+	return ED448PublicKey(append([]byte(nil), k[ed448SeedSize:]...))
+}
+
+// Seed returns the seed of k, this is the private key of RFC 8032.
+func (k ED448PrivateKey) Seed() []byte {
+	return append([]byte(nil), k[:ed448SeedSize]...)
+}
+
+// Sign signs msg itself, it must not be hashed. This implements
+// crypto.Signer.
+func (k ED448PrivateKey) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != 0 {
+		return nil, errors.New("dns: Ed448 can not sign a hashed message")
+	}
+	return ed448Sign(k, msg), nil
+}
+
+var (
+	ed448P = new(big.Int).Sub(new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 448), new(big.Int).Lsh(big.NewInt(1), 224)), big.NewInt(1))
+	ed448D = new(big.Int).Sub(ed448P, big.NewInt(39081))
+	ed448L = ed448Int("181709681073901722637330951972001133588410340171829515070372549795146003961539585716195755291692375963310293709091662304773755859649779")
+	ed448B = &ed448Point{
+		ed448Int("224580040295924300187604334099896036246789641632564134246125461686950415467406032909029192869357953282578032075146446173674602635247710"),
+		ed448Int("298819210078481492676017930443930673437544040154080242095928241372331506189835876003536878655418784733982303233503462500531545062832660"),
+		big.NewInt(1),
+	}
+	ed448Dom = []byte("SigEd448\x00\x00") // dom4(0, ""), no context
+)
+
+func ed448Int(s string) *big.Int {
+	i, _ := new(big.Int).SetString(s, 10)
+	return i
+}
+
+// An ed448Point is a point on the curve in projective coordinates.
+type ed448Point struct {
+	x, y, z *big.Int
+}
+
+// add returns p + q, RFC 8032 section 5.2.4. The formulas are complete,
+// they also double a point.
+func (p *ed448Point) add(q *ed448Point) *ed448Point {
+	mod := func(i *big.Int) *big.Int { return i.Mod(i, ed448P) }
+	mul := func(a, b *big.Int) *big.Int { return mod(new(big.Int).Mul(a, b)) }
+	a := mul(p.z, q.z)
+	b := mul(a, a)
+	c := mul(p.x, q.x)
+	d := mul(p.y, q.y)
+	e := mul(mul(ed448D, c), d)
+	f := mod(new(big.Int).Sub(b, e))
+	g := mod(new(big.Int).Add(b, e))
+	h := mul(new(big.Int).Add(p.x, p.y), new(big.Int).Add(q.x, q.y))
+	x := mul(mul(a, f), mod(new(big.Int).Sub(new(big.Int).Sub(h, c), d)))
+	y := mul(mul(a, g), mod(new(big.Int).Sub(d, c)))
+	return &ed448Point{x, y, mul(f, g)}
+}
+
+// mul returns [k]p.
+func (p *ed448Point) mul(k *big.Int) *ed448Point {
+	r := &ed448Point{big.NewInt(0), big.NewInt(1), big.NewInt(1)}
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = r.add(r)
+		if k.Bit(i) == 1 {
+			r = r.add(p)
+		}
+	}
+	return r
+}
+
+// equal returns true when p and q are the same point.
+func (p *ed448Point) equal(q *ed448Point) bool {
+	cross := func(a, b, c, d *big.Int) bool {
+		l := new(big.Int).Mul(a, b)
+		r := new(big.Int).Mul(c, d)
+		return l.Sub(l, r).Mod(l, ed448P).Sign() == 0
+	}
+	return cross(p.x, q.z, q.x, p.z) && cross(p.y, q.z, q.y, p.z)
+}
+
+// encode encodes p, RFC 8032 section 5.2.2.
+func (p *ed448Point) encode() []byte {
+	zi := new(big.Int).ModInverse(p.z, ed448P)
+	x := new(big.Int).Mul(p.x, zi)
+	x.Mod(x, ed448P)
+	y := new(big.Int).Mul(p.y, zi)
+	y.Mod(y, ed448P)
+	b := ed448Bytes(y)
+	b[ed448PublicKeySize-1] |= byte(x.Bit(0)) << 7
+	return b
+}
+
+// ed448Decode decodes a point, RFC 8032 section 5.2.3. It returns nil
+// when b is not the encoding of a point.
+func ed448Decode(b []byte) *ed448Point {
+	if len(b) != ed448PublicKeySize || b[ed448PublicKeySize-1]&0x7F != 0 {
+		return nil
+	}
+	x0 := uint(b[ed448PublicKeySize-1] >> 7)
+	y := ed448Scalar(b[:ed448PublicKeySize-1])
+	if y.Cmp(ed448P) >= 0 {
+		return nil
+	}
+	// x^2 = (y^2 - 1) / (d y^2 - 1), p is 3 mod 4
+	y2 := new(big.Int).Mul(y, y)
+	u := new(big.Int).Sub(y2, big.NewInt(1))
+	v := new(big.Int).Mul(ed448D, y2)
+	v.Sub(v, big.NewInt(1)).Mod(v, ed448P)
+	if v.ModInverse(v, ed448P) == nil {
+		return nil
+	}
+	x2 := u.Mul(u, v).Mod(u, ed448P)
+	e := new(big.Int).Add(ed448P, big.NewInt(1))
+	x := new(big.Int).Exp(x2, e.Rsh(e, 2), ed448P)
+	if new(big.Int).Exp(x, big.NewInt(2), ed448P).Cmp(x2) != 0 {
+		return nil
+	}
+	if x.Sign() == 0 && x0 == 1 {
+		return nil
+	}
+	if x.Bit(0) != x0 {
+		x.Sub(ed448P, x)
+	}
+	return &ed448Point{x, y, big.NewInt(1)}
+}
+
+// ed448Scalar returns the little-endian integer in b.
+func ed448Scalar(b []byte) *big.Int {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return new(big.Int).SetBytes(r)
+}
+
+// ed448Bytes returns i as a 57 byte little-endian integer.
+func ed448Bytes(i *big.Int) []byte {
+	b := i.Bytes()
+	r := make([]byte, ed448PublicKeySize)
+	for j := range b {
+		r[j] = b[len(b)-1-j]
+	}
+	return r
+}
+
+// ed448Hash returns SHAKE256(dom4 || parts) as an integer mod L.
+func ed448Hash(parts ...[]byte) *big.Int {
+	h := sha3.NewSHAKE256()
+	h.Write(ed448Dom)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	d := make([]byte, 2*ed448PublicKeySize)
+	h.Read(d)
+	k := ed448Scalar(d)
+	return k.Mod(k, ed448L)
+}
+
+// ed448Expand returns the secret scalar and the prefix of seed, RFC 8032
+// section 5.2.5.
+func ed448Expand(seed []byte) (*big.Int, []byte) {
+	h := sha3.SumSHAKE256(seed, 2*ed448SeedSize)
+	h[0] &= 0xFC
+	h[ed448SeedSize-1] = 0
+	h[ed448SeedSize-2] |= 0x80
+	return ed448Scalar(h[:ed448SeedSize]), h[ed448SeedSize:]
+}
+
+// ed448NewKeyFromSeed returns the private key of seed.
+func ed448NewKeyFromSeed(seed []byte) ED448PrivateKey {
+	s, _ := ed448Expand(seed)
+	return ED448PrivateKey(append(append([]byte(nil), seed...), ed448B.mul(s).encode()...))
+}
+
+// ed448GenerateKey generates a private key with randomness from rand.
+func ed448GenerateKey(rand io.Reader) (ED448PrivateKey, error) {
+	seed := make([]byte, ed448SeedSize)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, err
+	}
+	return ed448NewKeyFromSeed(seed), nil
+}
+
+// ed448Sign signs msg with k, RFC 8032 section 5.2.6.
+func ed448Sign(k ED448PrivateKey, msg []byte) []byte {
+	s, prefix := ed448Expand(k[:ed448SeedSize])
+	pub := k[ed448SeedSize:]
+	r := ed448Hash(prefix, msg)
+	rb := ed448B.mul(r).encode()
+	h := ed448Hash(rb, pub, msg)
+	h.Mul(h, s).Add(h, r).Mod(h, ed448L)
+	return append(rb, ed448Bytes(h)...)
+}
+
+// ed448Verify returns true when sig is a valid signature of msg by pub,
+// RFC 8032 section 5.2.7.
+func ed448Verify(pub ED448PublicKey, msg, sig []byte) bool {
+	if len(sig) != ed448SignatureSize {
+		return false
+	}
+	a := ed448Decode(pub)
+	r := ed448Decode(sig[:ed448PublicKeySize])
+	if a == nil || r == nil {
+		return false
+	}
+	s := ed448Scalar(sig[ed448PublicKeySize:])
+	if s.Cmp(ed448L) >= 0 {
+		return false
+	}
+	h := ed448Hash(sig[:ed448PublicKeySize], pub, msg)
+	// [4][S]B = [4]R + [4][k]A
+	four := big.NewInt(4)
+	return ed448B.mul(s).mul(four).equal(r.add(a.mul(h)).mul(four))
+}
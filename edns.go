@@ -2,18 +2,29 @@ package dns
 
 import (
 	"encoding/hex"
+	"net"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // EDNS0 Option codes.
 const (
-	_              = iota
-	OptionCodeLLQ           // not used
-	OptionCodeUL            // not used
-	OptionCodeNSID          // NSID, RFC5001
-	_DO            = 1 << 7 // dnssec ok
+	_                = iota
+	OptionCodeLLQ             // not used
+	OptionCodeUL              // not used
+	OptionCodeNSID            // NSID, RFC5001
+	OptionCodeSubnet = 8      // edns-client-subnet, RFC7871
+	OptionCodeChain  = 13     // CHAIN, RFC7901
+	OptionCodeKeyTag = 14     // edns-key-tag, RFC8145
+	OptionCodeEDE    = 15     // extended DNS error, RFC8914
+	_DO              = 1 << 7 // dnssec ok
 )
 
+// ExtendedErrorStaleAnswer is the extended DNS error (RFC 8914) info code
+// of an answer from expired data.
+const ExtendedErrorStaleAnswer = 3
+
 // An ENDS0 option rdata element.
 type Option struct {
 	Code uint16
@@ -49,30 +60,100 @@ func (rr *RR_OPT) Header() *RR_Header {
 	return &rr.Hdr
 }
 
+// String returns the OPT pseudo-section as dig shows it, one line for the
+// EDNS header and one for each option:
+//
+//	;; OPT PSEUDOSECTION:
+//	; EDNS: version: 0, flags: do; udp: 4096
+//	; NSID: 67 70 64 6e 73 ("gpdns")
+//	; CLIENT-SUBNET: 192.0.2.0/24/0
 func (rr *RR_OPT) String() string {
-	s := "\n;; OPT PSEUDOSECTION:\n; EDNS: version " + strconv.Itoa(int(rr.Version())) + "; "
+	s := ";; OPT PSEUDOSECTION:\n; EDNS: version: " + strconv.Itoa(int(rr.Version())) + ", flags:"
 	if rr.Do() {
-		s += "flags: do; "
-	} else {
-		s += "flags: ; "
+		s += " do"
 	}
-	s += "udp: " + strconv.Itoa(int(rr.UDPSize()))
-
+	s += "; udp: " + strconv.Itoa(int(rr.UDPSize()))
 	for _, o := range rr.Option {
-		switch o.Code {
-		case OptionCodeNSID:
-			s += "\n; NSID: " + o.Data
-			h, e := hex.DecodeString(o.Data)
-			var r string
-			if e == nil {
-				for _, c := range h {
-					r += "(" + string(c) + ")"
-				}
-				s += "  " + r
+		s += "\n; " + o.String()
+	}
+	return s
+}
+
+// String returns the option as dig shows it in the OPT pseudo-section.
+func (o Option) String() string {
+	h, err := hex.DecodeString(o.Data)
+	if err != nil {
+		return "OPT=" + strconv.Itoa(int(o.Code)) + ": " + o.Data
+	}
+	switch o.Code {
+	case OptionCodeNSID:
+		return "NSID: " + hexAscii(h)
+	case OptionCodeSubnet:
+		if ip, source, scope, ok := clientSubnet(h); ok {
+			return "CLIENT-SUBNET: " + ip.String() + "/" + strconv.Itoa(source) + "/" + strconv.Itoa(scope)
+		}
+	case OptionCodeChain:
+		if tp, _, ok := UnpackDomainName(h, 0); ok {
+			return "CHAIN: " + Fqdn(tp)
+		}
+	case OptionCodeKeyTag:
+		if len(h)%2 == 0 {
+			s := "KEY-TAG:"
+			for i := 0; i < len(h); i += 2 {
+				s += " " + strconv.Itoa(int(h[i])<<8|int(h[i+1]))
+			}
+			return s
+		}
+	case OptionCodeEDE:
+		if len(h) >= 2 {
+			s := "EDE: " + strconv.Itoa(int(h[0])<<8|int(h[1]))
+			if len(h) > 2 {
+				s += " (" + string(h[2:]) + ")"
 			}
+			return s
 		}
 	}
-	return s
+	return "OPT=" + strconv.Itoa(int(o.Code)) + ": " + hexAscii(h)
+}
+
+// hexAscii returns b as space separated hex octets, followed by the
+// printable characters in b between quotes; as dig shows NSID.
+func hexAscii(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	x := make([]string, len(b))
+	a := make([]byte, len(b))
+	for i, c := range b {
+		x[i] = hex.EncodeToString([]byte{c})
+		a[i] = c
+		if c < ' ' || c > '~' {
+			a[i] = '.'
+		}
+	}
+	return strings.Join(x, " ") + " (\"" + string(a) + "\")"
+}
+
+// clientSubnet returns the address, source and scope prefix length of the
+// edns-client-subnet option data in b.
+func clientSubnet(b []byte) (ip net.IP, source, scope int, ok bool) {
+	if len(b) < 4 {
+		return nil, 0, 0, false
+	}
+	family, source, scope := int(b[0])<<8|int(b[1]), int(b[2]), int(b[3])
+	switch family {
+	case 1:
+		ip = make(net.IP, net.IPv4len)
+	case 2:
+		ip = make(net.IP, net.IPv6len)
+	default:
+		return nil, 0, 0, false
+	}
+	if len(b)-4 > len(ip) || source > len(ip)*8 {
+		return nil, 0, 0, false
+	}
+	copy(ip, b[4:])
+	return ip, source, scope, true
 }
 
 func (rr *RR_OPT) Len() int {
@@ -85,12 +166,46 @@ func (rr *RR_OPT) Len() int {
 
 // Version returns the EDNS version.
 func (rr *RR_OPT) Version() uint8 {
-	return uint8(rr.Hdr.Ttl & 0x00FF00FFFF)
+	return uint8(rr.Hdr.Ttl >> 16)
 }
 
 // SetVersion sets the version of EDNS. This is usually zero.
 func (rr *RR_OPT) SetVersion(v uint8) {
-	rr.Hdr.Ttl = rr.Hdr.Ttl&0xFF00FFFF | uint32(v)
+	rr.Hdr.Ttl = rr.Hdr.Ttl&0xFF00FFFF | uint32(v)<<16
+}
+
+// ExtendedRcode returns the upper 8 bits of the extended rcode, already
+// shifted into place. Or it with the rcode from the message header to
+// get the full 12 bit rcode.
+func (rr *RR_OPT) ExtendedRcode() int {
+	return int(byte(rr.Hdr.Ttl>>24)) << 4
+}
+
+// SetExtendedRcode sets the upper 8 bits of the (12 bit) rcode in the
+// OPT RR. The lower 4 bits must be set in the message header.
+func (rr *RR_OPT) SetExtendedRcode(rcode int) {
+	rr.Hdr.Ttl = rr.Hdr.Ttl&0x00FFFFFF | uint32(byte(rcode>>4))<<24
+}
+
+// Flags returns all 16 flag bits, this includes the DO bit.
+func (rr *RR_OPT) Flags() uint16 {
+	return uint16(rr.Hdr.Ttl)
+}
+
+// SetFlags sets all 16 flag bits, this includes the DO bit.
+func (rr *RR_OPT) SetFlags(flags uint16) {
+	rr.Hdr.Ttl = rr.Hdr.Ttl&0xFFFF0000 | uint32(flags)
+}
+
+// Z returns the flag bits that are not defined (yet), i.e. all flags
+// except the DO bit.
+func (rr *RR_OPT) Z() uint16 {
+	return uint16(rr.Hdr.Ttl) & 0x7FFF
+}
+
+// SetZ sets the undefined flag bits, the DO bit is left alone.
+func (rr *RR_OPT) SetZ(z uint16) {
+	rr.Hdr.Ttl = rr.Hdr.Ttl&0xFFFF8000 | uint32(z&0x7FFF)
 }
 
 // UDPSize gets the UDP buffer size.
@@ -127,6 +242,32 @@ func (rr *RR_OPT) SetDo() {
 	rr.Hdr.Ttl = uint32(b1)<<24 | uint32(b2)<<16 | uint32(b3)<<8 | uint32(b4)
 }
 
+// ClearDo clears the DO (DNSSEC OK) bit.
+func (rr *RR_OPT) ClearDo() {
+	rr.Hdr.Ttl &^= _DO << 8
+}
+
+// ClientSubnet returns the network of the edns-client-subnet option
+// (RFC 7871), with the source prefix length as its mask.
+func (rr *RR_OPT) ClientSubnet() (*net.IPNet, bool) {
+	for _, o := range rr.Option {
+		if o.Code != OptionCodeSubnet {
+			continue
+		}
+		h, err := hex.DecodeString(o.Data)
+		if err != nil {
+			return nil, false
+		}
+		ip, source, _, ok := clientSubnet(h)
+		if !ok {
+			return nil, false
+		}
+		mask := net.CIDRMask(source, len(ip)*8)
+		return &net.IPNet{IP: ip.Mask(mask), Mask: mask}, true
+	}
+	return nil, false
+}
+
 // Nsid returns the NSID as hex character string.
 func (rr *RR_OPT) Nsid() string {
 	for i := 0; i < len(rr.Option); i++ {
@@ -142,3 +283,130 @@ func (rr *RR_OPT) Nsid() string {
 func (rr *RR_OPT) SetNsid(hexnsid string) {
 	rr.Option = append(rr.Option, Option{OptionCodeNSID, hexnsid})
 }
+
+// SetChain adds the CHAIN option (RFC 7901) to ask for the chain of trust
+// from the closest trust point down to the query name. Use the root when
+// no other trust point is configured.
+func (rr *RR_OPT) SetChain(trustpoint string) bool {
+	buf := make([]byte, 256)
+	off, ok := PackDomainName(Fqdn(trustpoint), buf, 0, nil, false)
+	if !ok {
+		return false
+	}
+	rr.Option = append(rr.Option, Option{OptionCodeChain, hex.EncodeToString(buf[:off])})
+	return true
+}
+
+// Chain returns the closest trust point from the CHAIN option. If the
+// option is not present, ok is false.
+func (rr *RR_OPT) Chain() (trustpoint string, ok bool) {
+	for _, o := range rr.Option {
+		if o.Code != OptionCodeChain {
+			continue
+		}
+		buf, e := hex.DecodeString(o.Data)
+		if e != nil {
+			return "", false
+		}
+		if trustpoint, _, ok = UnpackDomainName(buf, 0); !ok {
+			return "", false
+		}
+		return Fqdn(trustpoint), true
+	}
+	return "", false
+}
+
+// ChainRRs returns the RRs that make up the chain of trust from trustpoint
+// down to qname, as requested with the CHAIN option. For the trust point the
+// DNSKEY RRset is looked up, for each name below it, up to and including
+// qname, the DS and DNSKEY RRsets. The lookup function should return the
+// RRset together with its signatures, or nil when there is none. The
+// returned RRs belong in the authority section. If qname is not
+// below trustpoint, nil is returned.
+func ChainRRs(qname, trustpoint string, lookup func(name string, qtype uint16) []RR) []RR {
+	var ql, tl []string
+	if qname = Fqdn(qname); qname != "." {
+		ql = SplitLabels(qname)
+	}
+	if trustpoint = Fqdn(trustpoint); trustpoint != "." {
+		tl = SplitLabels(trustpoint)
+	}
+	if len(tl) > len(ql) || !strings.EqualFold(strings.Join(ql[len(ql)-len(tl):], "."), strings.Join(tl, ".")) {
+		return nil
+	}
+	rrs := lookup(trustpoint, TypeDNSKEY)
+	for i := len(ql) - len(tl) - 1; i >= 0; i-- {
+		name := strings.Join(ql[i:], ".") + "."
+		rrs = append(rrs, lookup(name, TypeDS)...)
+		rrs = append(rrs, lookup(name, TypeDNSKEY)...)
+	}
+	return rrs
+}
+
+// SetKeyTags adds the edns-key-tag option (RFC 8145) with the key tags of
+// the trust anchors a validator has configured. See AnchorKeyTags.
+func (rr *RR_OPT) SetKeyTags(tags []uint16) {
+	buf := make([]byte, 2*len(tags))
+	for i, k := range tags {
+		buf[2*i], buf[2*i+1] = packUint16(k)
+	}
+	rr.Option = append(rr.Option, Option{OptionCodeKeyTag, hex.EncodeToString(buf)})
+}
+
+// SetExtendedError adds an extended DNS error option (RFC 8914) with the
+// info code and the (optional) extra text.
+func (rr *RR_OPT) SetExtendedError(code uint16, text string) {
+	a, b := packUint16(code)
+	rr.Option = append(rr.Option, Option{OptionCodeEDE, hex.EncodeToString(append([]byte{a, b}, text...))})
+}
+
+// KeyTags returns the key tags from the edns-key-tag option, or nil
+// when the option is not present or malformed.
+func (rr *RR_OPT) KeyTags() []uint16 {
+	for _, o := range rr.Option {
+		if o.Code != OptionCodeKeyTag {
+			continue
+		}
+		buf, e := hex.DecodeString(o.Data)
+		if e != nil || len(buf)%2 != 0 {
+			return nil
+		}
+		tags := make([]uint16, len(buf)/2)
+		for i := range tags {
+			tags[i], _ = unpackUint16(buf, 2*i)
+		}
+		return tags
+	}
+	return nil
+}
+
+// AnchorKeyTags returns the key tags of the trust anchors in anchors, these
+// can be DNSKEY or DS records. Other RRs are ignored. The key tags are
+// returned in ascending order without duplicates, as RFC 8145 requires.
+func AnchorKeyTags(anchors []RR) []uint16 {
+	seen := make(map[uint16]bool)
+	var tags []uint16
+	for _, r := range anchors {
+		var k uint16
+		switch x := r.(type) {
+		case *RR_DNSKEY:
+			k = x.KeyTag()
+		case *RR_DS:
+			k = x.KeyTag
+		default:
+			continue
+		}
+		if !seen[k] {
+			seen[k] = true
+			tags = append(tags, k)
+		}
+	}
+	sort.Sort(uint16s(tags))
+	return tags
+}
+
+type uint16s []uint16
+
+func (p uint16s) Len() int           { return len(p) }
+func (p uint16s) Less(i, j int) bool { return p[i] < p[j] }
+func (p uint16s) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
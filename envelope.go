@@ -0,0 +1,85 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// An Envelope packs a stream of RRs in as few messages as possible. When the
+// next RR would make the current message larger than the size limit, the
+// message is written to the ResponseWriter and a new one is started. This is
+// useful for sending an AXFR or for chunking large answers over TCP.
+//
+// Basic use pattern:
+//
+//	e := dns.NewEnvelope(w, request, dns.MaxMsgSize-1)
+//	for _, rr := range zone {
+//		if err := e.Add(rr); err != nil {
+//			// handle error
+//		}
+//	}
+//	err := e.Flush()
+//
+// Each message written is a reply to request and carries the
+// question section of the request. All RRs are put in the answer section.
+type Envelope struct {
+	w    ResponseWriter
+	req  *Msg
+	size int
+	m    *Msg
+	l    int    // uncompressed length of m
+	buf  []byte // reused when packing
+}
+
+// NewEnvelope returns an Envelope that writes replies to request to w. Each
+// message is at most size bytes, if size is zero DefaultMsgSize is used.
+func NewEnvelope(w ResponseWriter, request *Msg, size int) *Envelope {
+	if size <= 0 {
+		size = DefaultMsgSize
+	}
+	e := &Envelope{w: w, req: request, size: size}
+	e.reset()
+	return e
+}
+
+func (e *Envelope) reset() {
+	e.m = new(Msg)
+	e.m.SetReply(e.req)
+	e.m.Compress = true
+	e.l = e.m.Len()
+}
+
+// Add adds the RRs to the envelope. A message is written when adding
+// an RR would overflow the current message.
+func (e *Envelope) Add(rr ...RR) error {
+	for _, r := range rr {
+		l := r.Len()
+		if e.l+l > e.size && len(e.m.Answer) > 0 {
+			if err := e.Flush(); err != nil {
+				return err
+			}
+		}
+		e.m.Answer = append(e.m.Answer, r)
+		e.l += l
+	}
+	return nil
+}
+
+// Flush writes the RRs added since the last write. An envelope without
+// any new RRs writes nothing.
+func (e *Envelope) Flush() error {
+	if len(e.m.Answer) == 0 {
+		return nil
+	}
+	if len(e.buf) < e.l*2 {
+		e.buf = make([]byte, e.l*2)
+	}
+	out, err := e.m.PackBuffer(e.buf)
+	if err != nil {
+		return err
+	}
+	if _, err = e.w.Write(out); err != nil {
+		return err
+	}
+	e.reset()
+	return nil
+}
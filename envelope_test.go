@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type bufferWriter struct {
+	msgs [][]byte
+}
+
+func (b *bufferWriter) RemoteAddr() net.Addr { return nil }
+
+func (b *bufferWriter) Write(p []byte) (int, error) {
+	b.msgs = append(b.msgs, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func TestEnvelope(t *testing.T) {
+	req := new(Msg)
+	req.SetAxfr("miek.nl.")
+	w := new(bufferWriter)
+	e := NewEnvelope(w, req, 512)
+	for i := 0; i < 100; i++ {
+		rr, _ := NewRR("a" + strconv.Itoa(i) + ".miek.nl. IN TXT \"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\"")
+		if err := e.Add(rr); err != nil {
+			t.Logf("Failed to add RR: %s", err)
+			t.Fail()
+			return
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Logf("Failed to flush: %s", err)
+		t.Fail()
+		return
+	}
+	if len(w.msgs) < 2 {
+		t.Logf("Should have written more than one message: %d", len(w.msgs))
+		t.Fail()
+	}
+	n := 0
+	for _, buf := range w.msgs {
+		if len(buf) > 512 {
+			t.Logf("Message is too large: %d", len(buf))
+			t.Fail()
+		}
+		m := new(Msg)
+		if err := m.Unpack(buf); err != nil {
+			t.Logf("Failed to unpack message: %s", err)
+			t.Fail()
+			return
+		}
+		n += len(m.Answer)
+	}
+	if n != 100 {
+		t.Logf("Should have received 100 RRs: %d", n)
+		t.Fail()
+	}
+}
+
+func TestEnvelopeNSEC(t *testing.T) {
+	req := new(Msg)
+	req.SetAxfr("miek.nl.")
+	w := new(bufferWriter)
+	e := NewEnvelope(w, req, 512)
+	bitmaps := []string{"A MX RRSIG NSEC TYPE17", "TXT"}
+	for i := 0; i < 40; i++ {
+		rr, _ := NewRR("a" + strconv.Itoa(i) + ".miek.nl. IN NSEC b.miek.nl. " + bitmaps[i%2])
+		if err := e.Add(rr); err != nil {
+			t.Logf("Failed to add RR: %s", err)
+			t.Fail()
+			return
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Logf("Failed to flush: %s", err)
+		t.Fail()
+		return
+	}
+	if len(w.msgs) < 2 {
+		t.Logf("Should have written more than one message: %d", len(w.msgs))
+		t.Fail()
+	}
+	for _, buf := range w.msgs {
+		m := new(Msg)
+		if err := m.Unpack(buf); err != nil {
+			t.Logf("Failed to unpack message: %s", err)
+			t.Fail()
+			return
+		}
+		for _, rr := range m.Answer {
+			i, _ := strconv.Atoi(rr.Header().Name[1:strings.Index(rr.Header().Name, ".")])
+			want, _ := NewRR("a" + strconv.Itoa(i) + ".miek.nl. IN NSEC b.miek.nl. " + bitmaps[i%2])
+			if !RRsEqual(rr, want) {
+				t.Logf("Bitmap should be %s: %s", bitmaps[i%2], rr)
+				t.Fail()
+			}
+		}
+	}
+}
@@ -58,15 +58,16 @@ func addresses(conf *dns.ClientConfig, c *dns.Client, name string) []string {
 	m4.SetQuestion(dns.Fqdn(os.Args[1]), dns.TypeA)
 	m6 := new(dns.Msg)
 	m6.SetQuestion(dns.Fqdn(os.Args[1]), dns.TypeAAAA)
-        c.Do(m4, conf.Servers[0] + ":" + conf.Port)
-        c.Do(m6, conf.Servers[0] + ":" + conf.Port)
+	replies := make(chan *dns.Exchange)
+	c.DoChan(m4, conf.Servers[0]+":"+conf.Port, replies)
+	c.DoChan(m6, conf.Servers[0]+":"+conf.Port, replies)
 
 	var ips []string
 	i := 2 // two outstanding queries
 forever:
 	for {
 		select {
-		case r := <-dns.DefaultReplyChan:
+		case r := <-replies:
 			if r.Reply != nil && r.Reply.Rcode == dns.RcodeSuccess {
 				for _, aa := range r.Reply.Answer {
 					switch aa.(type) {
@@ -103,17 +103,8 @@ func (f *fingerprint) String() string {
 	} else {
 		s = f.Query.Name
 	}
-	if _, ok := dns.Class_str[f.Query.Qclass]; ok {
-		s += "," + dns.Class_str[f.Query.Qclass]
-	} else {
-		s += "," + "CLASS" + strconv.Itoa(int(f.Query.Qclass))
-	}
-
-	if _, ok := dns.Rr_str[f.Query.Qtype]; ok {
-		s += "," + dns.Rr_str[f.Query.Qtype]
-	} else {
-		s += "," + "TYPE" + strconv.Itoa(int(f.Query.Qtype))
-	}
+	s += "," + dns.ClassToString(f.Query.Qclass)
+	s += "," + dns.TypeToString(f.Query.Qtype)
 
 	if op, ok := dns.Opcode_str[f.Opcode]; ok {
 		s += "," + op
@@ -163,12 +154,12 @@ func (f *fingerprint) setString(str string) {
 			f.Query.Name = s
 		case 1: // Qclass
 			f.Query.Qclass = 0
-			if c, ok := dns.Str_class[s]; ok {
+			if c, ok := dns.StringToClass(s); ok {
 				f.Query.Qclass = c
 			}
 		case 2: // Qtype
 			f.Query.Qtype = 0
-			if c, ok := dns.Str_rr[s]; ok {
+			if c, ok := dns.StringToType(s); ok {
 				f.Query.Qtype = c
 			}
 		case 3:
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 	"strconv"
-	"strings"
 )
 
 func q(w dns.RequestWriter, m *dns.Msg) {
@@ -53,23 +52,15 @@ Flags:
 		}
 		// First class, then type, to make ANY queries possible
 		// And if it looks like type, it is a type
-		if k, ok := dns.Str_rr[strings.ToUpper(flag.Arg(i))]; ok {
+		if k, ok := dns.StringToType(flag.Arg(i)); ok {
 			qtype = k
 			continue Flags
 		}
 		// If it looks like a class, it is a class
-		if k, ok := dns.Str_class[strings.ToUpper(flag.Arg(i))]; ok {
+		if k, ok := dns.StringToClass(flag.Arg(i)); ok {
 			qclass = k
 			continue Flags
 		}
-		// If it starts with TYPExxx it is unknown rr
-		if strings.HasPrefix(flag.Arg(i), "TYPE") {
-			i, e := strconv.Atoi(string([]byte(flag.Arg(i))[4:]))
-			if e == nil {
-				qtype = uint16(i)
-				continue Flags
-			}
-		}
 
 		// Anything else is a qname
 		qname = append(qname, flag.Arg(i))
@@ -92,6 +83,7 @@ Flags:
 	dns.HandleQueryFunc(".", q)
 	dns.ListenAndQuery(nil, nil)
 	c := dns.NewClient()
+	replies := make(chan *dns.Exchange)
 	if *tcp {
 		c.Net = "tcp"
 	}
@@ -127,14 +119,14 @@ Flags:
 			fmt.Printf("%s\n", msgToFingerprint(m))
 			fmt.Printf("%s\n", m.String())
 		}
-		c.Do(m, nameserver)
+		c.DoChan(m, nameserver, replies)
 	}
 
 	i := 0
 forever:
 	for {
 		select {
-		case r := <-dns.DefaultReplyChan:
+		case r := <-replies:
 			if r.Reply != nil {
 				if r.Reply.Rcode == dns.RcodeSuccess {
 					if r.Request.Id != r.Reply.Id {
@@ -254,7 +246,7 @@ func getKey(name string, keytag uint16, server string, tcp bool) *dns.RR_DNSKEY
 
 // shorten RRSIG to "miek.nl RRSIG(NS)"
 func shortSig(sig *dns.RR_RRSIG) string {
-	return sig.Header().Name + " RRSIG(" + dns.Rr_str[sig.TypeCovered] + ")"
+	return sig.Header().Name + " RRSIG(" + dns.TypeToString(sig.TypeCovered) + ")"
 }
 
 // Walk trough message and short Key data and Sig data
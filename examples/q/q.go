@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
-	"strings"
+	"time"
 )
 
 var dnskey *dns.RR_DNSKEY
@@ -70,23 +70,15 @@ Flags:
 		}
 		// First class, then type, to make ANY queries possible
 		// And if it looks like type, it is a type
-		if k, ok := dns.Str_rr[strings.ToUpper(flag.Arg(i))]; ok {
+		if k, ok := dns.StringToType(flag.Arg(i)); ok {
 			qtype = k
 			continue Flags
 		}
 		// If it looks like a class, it is a class
-		if k, ok := dns.Str_class[strings.ToUpper(flag.Arg(i))]; ok {
+		if k, ok := dns.StringToClass(flag.Arg(i)); ok {
 			qclass = k
 			continue Flags
 		}
-		// If it starts with TYPExxx it is unknown rr
-		if strings.HasPrefix(flag.Arg(i), "TYPE") {
-			i, e := strconv.Atoi(string([]byte(flag.Arg(i))[4:]))
-			if e == nil {
-				qtype = uint16(i)
-				continue Flags
-			}
-		}
 
 		// Anything else is a qname
 		qname = append(qname, flag.Arg(i))
@@ -109,6 +101,7 @@ Flags:
 	dns.HandleQueryFunc(".", q)
 	dns.ListenAndQuery(nil, nil)
 	c := dns.NewClient()
+	replies := make(chan *dns.Exchange)
 	if *tcp {
 		c.Net = "tcp"
 	}
@@ -139,14 +132,14 @@ Flags:
 		if *query {
 			fmt.Printf("%s\n", m.String())
 		}
-		c.Do(m, nameserver)
+		c.DoChan(m, nameserver, replies)
 	}
 
 	i := 0
 forever:
 	for {
 		select {
-		case r := <-dns.DefaultReplyChan:
+		case r := <-replies:
 			if r.Reply != nil {
 				if r.Reply.Rcode == dns.RcodeSuccess {
 					if r.Request.Id != r.Reply.Id {
@@ -191,6 +184,8 @@ func sectionCheck(set []dns.RR, server string, tcp bool) {
                         }
 			if err := rr.(*dns.RR_RRSIG).Verify(key, rrset); err != nil {
 			        fmt.Printf(";- Bog us signature,  %s does not validate (DNSKEY %s/%d/%s)\n", shortSig(rr.(*dns.RR_RRSIG)), key.Header().Name, key.KeyTag(), where)
+			} else if err := rr.(*dns.RR_RRSIG).CheckValidity(time.Now(), 0); err != nil {
+				fmt.Printf(";- Bogus signature, %s validates, but %s (DNSKEY %s/%d/%s)\n", shortSig(rr.(*dns.RR_RRSIG)), err, key.Header().Name, key.KeyTag(), where)
 			} else {
 				fmt.Printf(";+ Secure signature, %s validates (DNSKEY %s/%d/%s)\n", shortSig(rr.(*dns.RR_RRSIG)), key.Header().Name, key.KeyTag(), where)
 			}
@@ -217,16 +212,18 @@ func nsecCheck(in *dns.Msg) {
         }
         return
 Check:
-        w, err := in.Nsec3Verify(in.Question[0])
-        switch w {
+        r, err := in.Nsec3Check(in.Question[0])
+        switch r.Denial {
         case dns.NSEC3_NXDOMAIN:
-                fmt.Printf(";+ [beta] Correct denial of existence (NSEC3/NXDOMAIN)\n")
+                fmt.Printf(";+ [beta] Correct denial of existence (NSEC3/NXDOMAIN), closest encloser %s\n", r.ClosestEncloser)
         case dns.NSEC3_NODATA:
-                fmt.Printf(";+ [beta] Correct denial of existence (NSEC3/NODATA)\n")
+                fmt.Printf(";+ [beta] Correct denial of existence (NSEC3/NODATA), closest encloser %s\n", r.ClosestEncloser)
+        case dns.NSEC3_INSECURE:
+                fmt.Printf(";- [beta] Insecure denial of existence (NSEC3): too many iterations or salt too long\n")
         default:
                 // w == 0
                 if err != nil {
-	                fmt.Printf(";- [beta] Incorrect denial of existence (NSEC3): %s\n",err.Error())
+	                fmt.Printf(";- [beta] Incorrect denial of existence (NSEC3): %s (closest encloser %q)\n",err.Error(), r.ClosestEncloser)
                 }
         }
 }
@@ -275,7 +272,7 @@ func getKey(name string, keytag uint16, server string, tcp bool) *dns.RR_DNSKEY
 
 // shorten RRSIG to "miek.nl RRSIG(NS)"
 func shortSig(sig *dns.RR_RRSIG) string {
-	return sig.Header().Name + " RRSIG(" + dns.Rr_str[sig.TypeCovered] + ")"
+	return sig.Header().Name + " RRSIG(" + dns.TypeToString(sig.TypeCovered) + ")"
 }
 
 // Walk trough message and short Key data and Sig data
@@ -64,7 +64,7 @@ func handleReflect(w dns.ResponseWriter, r *dns.Msg) {
 
 	t := new(dns.RR_TXT)
 	t.Hdr = dns.RR_Header{Name: dom, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 0}
-	t.Txt = str
+	t.Txt = []string{str}
 
         switch r.Question[0].Qtype {
         case dns.TypeTXT:
@@ -90,12 +90,12 @@ func handleReflect(w dns.ResponseWriter, r *dns.Msg) {
         m.Extra = append(m.Extra, nsec3)
         */
 
-	b, ok := m.Pack()
+	b, err := m.Pack()
         if *printf {
                 fmt.Printf("%v\n", m.String())
         }
-	if !ok {
-		log.Print("Packing failed")
+	if err != nil {
+		log.Print("Packing failed: ", err)
                 m.SetRcode(r, dns.RcodeServerFailure)
                 m.Extra = nil
                 m.Answer = nil
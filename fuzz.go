@@ -0,0 +1,47 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Round trip checking of the wire format, for fuzzers and conformance tests.
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// UnpackThenPack unpacks the message in b and packs it again. It returns
+// true when the result is identical to b, either packed without or with
+// compression. Otherwise diag describes what went wrong: the error from
+// unpacking or packing, trailing bytes after the message, or the first
+// offset at which the packed message differs from b.
+//
+// Any b can be given, UnpackThenPack does not panic. This makes it usable
+// as an oracle for fuzzers and for comparing with other implementations.
+func UnpackThenPack(b []byte) (equal bool, diag string) {
+	m := new(Msg)
+	off, err := m.unpack(b)
+	if err != nil {
+		return false, "unpack: " + err.Error()
+	}
+	if off != len(b) {
+		return false, fmt.Sprintf("unpack: %d trailing bytes at offset %d", len(b)-off, off)
+	}
+	var packed []byte
+	for _, m.Compress = range []bool{false, true} {
+		if packed, err = m.Pack(); err != nil {
+			return false, "pack: " + err.Error()
+		}
+		if bytes.Equal(packed, b) {
+			return true, ""
+		}
+	}
+	// Report the difference with the compressed message
+	for i := 0; i < len(packed) && i < len(b); i++ {
+		if packed[i] != b[i] {
+			return false, fmt.Sprintf("pack: differs at offset %d: %#02x, want %#02x", i, packed[i], b[i])
+		}
+	}
+	return false, fmt.Sprintf("pack: length %d, want %d", len(packed), len(b))
+}
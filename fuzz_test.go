@@ -0,0 +1,86 @@
+package dns
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func roundTripCorpus() [][]byte {
+	var corpus [][]byte
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeMX)
+	m.SetEdns0(4096, true)
+	for _, compress := range []bool{false, true} {
+		m.Compress = compress
+		buf, _ := m.Pack()
+		corpus = append(corpus, buf)
+	}
+	m = new(Msg)
+	m.SetQuestion("miek.nl.", TypeMX)
+	m.Response, m.Authoritative = true, true
+	m.Answer = newRRs("miek.nl. 300 IN MX 10 mx.miek.nl.", "miek.nl. 300 IN MX 20 mx2.miek.nl.")
+	m.Ns = newRRs("miek.nl. 300 IN NS ns.miek.nl.")
+	m.Extra = newRRs("mx.miek.nl. 300 IN A 127.0.0.1", "mx.miek.nl. 300 IN AAAA ::1", "mx.miek.nl. 300 IN TXT \"text\"")
+	for _, compress := range []bool{false, true} {
+		m.Compress = compress
+		buf, _ := m.Pack()
+		corpus = append(corpus, buf)
+	}
+	return corpus
+}
+
+func TestUnpackThenPack(t *testing.T) {
+	for i, b := range roundTripCorpus() {
+		if ok, diag := UnpackThenPack(b); !ok {
+			t.Logf("Corpus message %d does not round trip: %s", i, diag)
+			t.Fail()
+		}
+		if ok, diag := UnpackThenPack(append(b, 0)); ok || !strings.Contains(diag, "trailing") {
+			t.Logf("Trailing byte not detected in corpus message %d: %s", i, diag)
+			t.Fail()
+		}
+		if ok, diag := UnpackThenPack(b[:len(b)-1]); ok || diag == "" {
+			t.Logf("Short message %d should not round trip", i)
+			t.Fail()
+		}
+	}
+	// Valid, but the second owner name points to the first instead of to
+	// the question
+	b := []byte{0, 1, 0x80, 0, 0, 1, 0, 2, 0, 0, 0, 0,
+		4, 'm', 'i', 'e', 'k', 2, 'n', 'l', 0, 0, 1, 0, 1,
+		4, 'm', 'i', 'e', 'k', 2, 'n', 'l', 0, 0, 1, 0, 1, 0, 0, 1, 44, 0, 4, 127, 0, 0, 1,
+		0xC0, 25, 0, 1, 0, 1, 0, 0, 1, 44, 0, 4, 127, 0, 0, 2}
+	if ok, diag := UnpackThenPack(b); ok || !strings.Contains(diag, "offset 25") {
+		t.Logf("Other compression should not round trip: %s", diag)
+		t.Fail()
+	}
+	if ok, diag := UnpackThenPack(nil); ok || diag == "" {
+		t.Log("Empty message should not round trip")
+		t.Fail()
+	}
+}
+
+func TestUnpackThenPackRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	corpus := roundTripCorpus()
+	for i := 0; i < 100000; i++ {
+		b := append([]byte(nil), corpus[r.Intn(len(corpus))]...)
+		for j := r.Intn(4); j >= 0; j-- {
+			b[r.Intn(len(b))] = byte(r.Intn(256))
+		}
+		if r.Intn(4) == 0 {
+			b = b[:r.Intn(len(b))]
+		}
+		unpackThenPackNoPanic(t, b)
+	}
+}
+
+func unpackThenPackNoPanic(t *testing.T, b []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("UnpackThenPack panics on %x: %v", b, r)
+		}
+	}()
+	UnpackThenPack(b)
+}
@@ -0,0 +1,157 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Read the static host table from /etc/hosts.
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Hosts holds the contents of a hosts(5) file. When set in a Client, the
+// queries that can be answered from it are not sent to the network, see
+// Reply.
+type Hosts struct {
+	addrs map[string][]net.IP // addresses by lowercased name
+	names map[string][]string // names by reverse name (in-addr.arpa. or ip6.arpa.)
+}
+
+// HostsFromFile parses a hosts(5) file, such as /etc/hosts, and returns
+// a *Hosts.
+func HostsFromFile(name string) (*Hosts, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseHosts(f)
+}
+
+// ParseHosts parses the hosts(5) file in r. Each line holds an address
+// followed by the canonical name and the aliases for that address, a '#'
+// starts a comment. Lines that do not start with an address are skipped,
+// as the C library does.
+func ParseHosts(r io.Reader) (*Hosts, error) {
+	h := &Hosts{addrs: make(map[string][]net.IP), names: make(map[string][]string)}
+	b := bufio.NewReader(r)
+	for {
+		line, err := b.ReadString('\n')
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if f := strings.Fields(line); len(f) > 1 {
+			h.add(f[0], f[1:])
+		}
+		if err == io.EOF {
+			return h, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (h *Hosts) add(addr string, names []string) {
+	// Scoped addresses, fe80::1%lo0, are used without the zone
+	if i := strings.Index(addr, "%"); i >= 0 {
+		addr = addr[:i]
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	rev := reverseAddr(ip)
+	for _, n := range names {
+		n = Fqdn(n)
+		k := strings.ToLower(n)
+		h.addrs[k] = append(h.addrs[k], ip)
+		h.names[rev] = append(h.names[rev], n)
+	}
+}
+
+// Lookup returns the RRs for name and qtype from the hosts file: A and
+// AAAA records for the addresses of a name and PTR records for the names
+// of an address. The TTL of the RRs is zero. When the hosts file has no
+// data for name and qtype, nil is returned.
+func (h *Hosts) Lookup(name string, qtype uint16) []RR {
+	name = Fqdn(name)
+	k := strings.ToLower(name)
+	var rrs []RR
+	switch qtype {
+	case TypeA, TypeAAAA:
+		for _, ip := range h.addrs[k] {
+			ip4 := len(ip) == net.IPv4len
+			switch {
+			case qtype == TypeA && ip4:
+				rrs = append(rrs, &RR_A{Hdr: RR_Header{Name: name, Rrtype: TypeA, Class: ClassINET}, A: ip})
+			case qtype == TypeAAAA && !ip4:
+				rrs = append(rrs, &RR_AAAA{Hdr: RR_Header{Name: name, Rrtype: TypeAAAA, Class: ClassINET}, AAAA: ip})
+			}
+		}
+	case TypePTR:
+		for _, n := range h.names[k] {
+			rrs = append(rrs, &RR_PTR{Hdr: RR_Header{Name: name, Rrtype: TypePTR, Class: ClassINET}, Ptr: n})
+		}
+	}
+	return rrs
+}
+
+// Reply returns the reply to the query q from the hosts file, or nil if
+// the hosts file has no data for the question. Like the C library, only
+// the names and types that are in the hosts file are answered there, for
+// instance an AAAA query for a name with only an IPv4 address in the hosts
+// file is sent to the network.
+func (h *Hosts) Reply(q *Msg) *Msg {
+	if h == nil || len(q.Question) != 1 || q.Question[0].Qclass != ClassINET {
+		return nil
+	}
+	rrs := h.Lookup(q.Question[0].Name, q.Question[0].Qtype)
+	if len(rrs) == 0 {
+		return nil
+	}
+	m := new(Msg)
+	m.SetReply(q)
+	m.RecursionAvailable = true
+	m.Answer = rrs
+	return m
+}
+
+// HostsHandler returns a handler that answers the queries it can from h
+// and passes the others on to next.
+func HostsHandler(h *Hosts, next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		m := h.Reply(r)
+		if m == nil {
+			next.ServeDNS(w, r)
+			return
+		}
+		if buf, err := m.Pack(); err == nil {
+			w.Write(buf)
+		}
+	})
+}
+
+// reverseAddr returns the name for the reverse lookup of ip, in lower
+// case.
+func reverseAddr(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return strconv.Itoa(int(ip4[3])) + "." + strconv.Itoa(int(ip4[2])) + "." +
+			strconv.Itoa(int(ip4[1])) + "." + strconv.Itoa(int(ip4[0])) + ".in-addr.arpa."
+	}
+	const hex = "0123456789abcdef"
+	b := make([]byte, 0, 4*net.IPv6len+len("ip6.arpa."))
+	for i := len(ip) - 1; i >= 0; i-- {
+		b = append(b, hex[ip[i]&0xF], '.', hex[ip[i]>>4], '.')
+	}
+	return string(append(b, "ip6.arpa."...))
+}
@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHosts = `# The hosts file
+127.0.0.1	localhost
+::1		localhost ip6-localhost # IPv6
+192.168.1.10	Host.Miek.NL. host	alias
+fe80::1%lo0	linklocal
+not-an-address	bogus
+`
+
+func TestHosts(t *testing.T) {
+	h, err := ParseHosts(strings.NewReader(testHosts))
+	if err != nil {
+		t.Logf("Failed to parse hosts: %s", err)
+		t.Fail()
+		return
+	}
+	tests := []struct {
+		name  string
+		qtype uint16
+		rdata []string
+	}{
+		{"localhost", TypeA, []string{"127.0.0.1"}},
+		{"localhost.", TypeAAAA, []string{"::1"}},
+		{"host.miek.nl.", TypeA, []string{"192.168.1.10"}},
+		{"ALIAS.", TypeA, []string{"192.168.1.10"}},
+		{"host.miek.nl.", TypeAAAA, nil},
+		{"linklocal.", TypeAAAA, []string{"fe80::1"}},
+		{"bogus.", TypeA, nil},
+		{"10.1.168.192.in-addr.arpa.", TypePTR, []string{"Host.Miek.NL.", "host.", "alias."}},
+		{"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.IP6.ARPA.", TypePTR, []string{"localhost.", "ip6-localhost."}},
+		{"localhost.", TypeMX, nil},
+	}
+	for _, x := range tests {
+		rrs := h.Lookup(x.name, x.qtype)
+		if len(rrs) != len(x.rdata) {
+			t.Logf("Lookup %s %s: expected %d RRs, got %v", x.name, TypeToString(x.qtype), len(x.rdata), rrs)
+			t.Fail()
+			continue
+		}
+		for i, r := range rrs {
+			var s string
+			switch r := r.(type) {
+			case *RR_A:
+				s = r.A.String()
+			case *RR_AAAA:
+				s = r.AAAA.String()
+			case *RR_PTR:
+				s = r.Ptr
+			}
+			if s != x.rdata[i] {
+				t.Logf("Lookup %s %s: expected %s, got %s", x.name, TypeToString(x.qtype), x.rdata[i], s)
+				t.Fail()
+			}
+		}
+	}
+
+	// The client answers from the hosts file, without a server
+	c := NewClient()
+	c.Hosts = h
+	m := new(Msg)
+	m.SetQuestion("host.miek.nl.", TypeA)
+	r, err := c.Exchange(m, "127.0.0.1:0")
+	if err != nil || r.Id != m.Id || !r.Response || len(r.Answer) != 1 {
+		t.Logf("Exchange should be answered from the hosts file: %v %s", err, r)
+		t.Fail()
+	}
+}
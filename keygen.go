@@ -2,6 +2,7 @@ package dns
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -10,7 +11,11 @@ import (
 )
 
 // Empty interface that is used as a wrapper around all possible
-// private key implementations from the crypto package.
+// private key implementations from the crypto package. Besides
+// *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey and
+// ED448PrivateKey, any crypto.Signer with an RSA, ECDSA or EdDSA
+// public key can be used for signing. This allows the private key
+// to be held in an HSM or by a remote signing service.
 type PrivateKey interface{}
 
 // Generate generates a DNSKEY of the given bit size.
@@ -37,6 +42,14 @@ func (r *RR_DNSKEY) Generate(bits int) (PrivateKey, error) {
 		if bits != 384 {
 			return nil, ErrKeySize
 		}
+	case ED25519:
+		if bits != 256 {
+			return nil, ErrKeySize
+		}
+	case ED448:
+		if bits != 456 {
+			return nil, ErrKeySize
+		}
 	}
 
 	switch r.Algorithm {
@@ -61,6 +74,20 @@ func (r *RR_DNSKEY) Generate(bits int) (PrivateKey, error) {
 		}
 		r.setPublicKeyCurve(priv.PublicKey.X, priv.PublicKey.Y)
 		return priv, nil
+	case ED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		r.PublicKey = unpackBase64(pub)
+		return priv, nil
+	case ED448:
+		priv, err := ed448GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		r.PublicKey = unpackBase64(priv.Public().(ED448PublicKey))
+		return priv, nil
 	default:
 		return nil, ErrAlg
 	}
@@ -71,9 +98,9 @@ func (r *RR_DNSKEY) Generate(bits int) (PrivateKey, error) {
 // string has the same format as the private-key-file of BIND9 (Private-key-format: v1.3). 
 // It needs some info from the key (hashing, keytag), so its a method of the RR_DNSKEY.
 func (r *RR_DNSKEY) PrivateKeyString(p PrivateKey) (s string) {
+	algorithm := strconv.Itoa(int(r.Algorithm)) + " (" + Alg_str[r.Algorithm] + ")"
 	switch t := p.(type) {
 	case *rsa.PrivateKey:
-		algorithm := strconv.Itoa(int(r.Algorithm)) + " (" + Alg_str[r.Algorithm] + ")"
 		modulus := unpackBase64(t.PublicKey.N.Bytes())
 		e := big.NewInt(int64(t.PublicKey.E))
 		publicExponent := unpackBase64(e.Bytes())
@@ -105,7 +132,21 @@ func (r *RR_DNSKEY) PrivateKeyString(p PrivateKey) (s string) {
 			"Exponent2: " + exponent2 + "\n" +
 			"Coefficient: " + coefficient + "\n"
 	case *ecdsa.PrivateKey:
-		s = "TODO"
+		intlen := t.Curve.Params().BitSize / 8
+		d := t.D.Bytes()
+		private := make([]byte, intlen)
+		copy(private[intlen-len(d):], d)
+		s = "Private-key-format: v1.3\n" +
+			"Algorithm: " + algorithm + "\n" +
+			"PrivateKey: " + unpackBase64(private) + "\n"
+	case ed25519.PrivateKey:
+		s = "Private-key-format: v1.3\n" +
+			"Algorithm: " + algorithm + "\n" +
+			"PrivateKey: " + unpackBase64(t.Seed()) + "\n"
+	case ED448PrivateKey:
+		s = "Private-key-format: v1.3\n" +
+			"Algorithm: " + algorithm + "\n" +
+			"PrivateKey: " + unpackBase64(t.Seed()) + "\n"
 	}
 	return
 }
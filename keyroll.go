@@ -0,0 +1,225 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Automatic key rollovers, see RFC 6781 section 4.1.
+
+import (
+	"time"
+)
+
+// The states a key goes through during its lifetime.
+const (
+	KeyPublished = iota // DNSKEY is in the zone, but the key does not sign
+	KeyActive           // DNSKEY is in the zone and the key signs
+	KeyRetired          // DNSKEY is in the zone, but the key no longer signs
+)
+
+// A RollKey is a key managed by a KeyRoller.
+type RollKey struct {
+	Key     *RR_DNSKEY
+	Private PrivateKey
+	State   int       // KeyPublished, KeyActive or KeyRetired
+	Changed time.Time // when the key entered State
+}
+
+// IsKSK returns true if the key is a key signing key (has the SEP bit set).
+func (k *RollKey) IsKSK() bool {
+	return k.Key.Flags&SEP == SEP
+}
+
+// A KeyStore persists the keys of a KeyRoller.
+type KeyStore interface {
+	// Load returns the keys saved by the last call to Save.
+	Load() ([]*RollKey, error)
+	// Save saves the keys.
+	Save(keys []*RollKey) error
+}
+
+// A KeyRoller performs the key rollovers for a zone. Zone signing keys (ZSKs)
+// are rolled with the pre-publish method: the new key is published
+// PublishSafety before it starts signing, the old key stays published for
+// RetireSafety after it stopped signing. Key signing keys (KSKs) are rolled
+// with the double signature method: the new key signs the DNSKEY RRset
+// together with the old key for RetireSafety, which must be long enough for
+// the DS at the parent to be replaced, after that the old key is removed.
+//
+// The KeyRoller does not sign the zone itself, each time the set of keys
+// changes the Sign function is called with all the keys that should be
+// published in the zone. The active ZSKs should sign the zone, the active
+// KSKs the DNSKEY RRset.
+type KeyRoller struct {
+	Zone          string        // zone name
+	Algorithm     uint8         // algorithm for new keys
+	KSKBits       int           // size of new KSKs
+	ZSKBits       int           // size of new ZSKs
+	KSKLifetime   time.Duration // how long a KSK signs
+	ZSKLifetime   time.Duration // how long a ZSK signs
+	PublishSafety time.Duration // how long a ZSK is published before it signs, at least the DNSKEY TTL
+	RetireSafety  time.Duration // how long a key is kept after it stopped signing, at least the largest TTL in the zone
+	Store         KeyStore      // persistent storage for the keys
+	// Sign is called with the keys to publish, whenever they change.
+	Sign func(keys []*RollKey) error
+
+	keys []*RollKey
+}
+
+// Keys returns the keys that are currently published.
+func (r *KeyRoller) Keys() []*RollKey {
+	return r.keys
+}
+
+// Step moves the keys of the zone forward to the time now: new keys are
+// introduced, signing switches to new keys and old keys are removed, as
+// the timelines dictate. Step should be called regularly. When the keys
+// changed they are saved to the Store and Sign is called.
+func (r *KeyRoller) Step(now time.Time) (changed bool, err error) {
+	if r.keys == nil && r.Store != nil {
+		if r.keys, err = r.Store.Load(); err != nil {
+			return false, err
+		}
+	}
+	for _, ksk := range []bool{true, false} {
+		c, err := r.step(now, ksk)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	if !changed {
+		return false, nil
+	}
+	if r.Store != nil {
+		if err := r.Store.Save(r.keys); err != nil {
+			return true, err
+		}
+	}
+	if r.Sign != nil {
+		if err := r.Sign(r.keys); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// step performs the rollover for the KSKs or for the ZSKs.
+func (r *KeyRoller) step(now time.Time, ksk bool) (changed bool, err error) {
+	lifetime := r.ZSKLifetime
+	if ksk {
+		lifetime = r.KSKLifetime
+	}
+	var active, published, retired []*RollKey
+	for _, k := range r.keys {
+		if k.IsKSK() != ksk {
+			continue
+		}
+		switch k.State {
+		case KeyActive:
+			active = append(active, k)
+		case KeyPublished:
+			published = append(published, k)
+		case KeyRetired:
+			retired = append(retired, k)
+		}
+	}
+
+	// Remove the retired keys that have been retired long enough
+	for _, k := range retired {
+		if now.Sub(k.Changed) >= r.RetireSafety {
+			r.remove(k)
+			changed = true
+		}
+	}
+
+	if len(active) == 0 && len(published) == 0 {
+		// Initial key
+		if _, err := r.newKey(now, ksk, KeyActive); err != nil {
+			return changed, err
+		}
+		return true, nil
+	}
+
+	if ksk {
+		// Double signature: the newest active key is the current one
+		var cur *RollKey
+		for _, k := range active {
+			if cur == nil || k.Changed.After(cur.Changed) {
+				cur = k
+			}
+		}
+		for _, k := range active {
+			if k != cur && now.Sub(cur.Changed) >= r.RetireSafety {
+				r.remove(k)
+				changed = true
+			}
+		}
+		if cur != nil && now.Sub(cur.Changed) >= lifetime {
+			if _, err := r.newKey(now, ksk, KeyActive); err != nil {
+				return changed, err
+			}
+			changed = true
+		}
+		return changed, nil
+	}
+
+	// Pre-publish
+	if len(active) == 0 {
+		// Only published keys, activate the oldest
+		published[0].State = KeyActive
+		published[0].Changed = now
+		return true, nil
+	}
+	cur := active[0]
+	if len(published) == 0 && now.Sub(cur.Changed) >= lifetime-r.PublishSafety {
+		if _, err := r.newKey(now, ksk, KeyPublished); err != nil {
+			return changed, err
+		}
+		return true, nil
+	}
+	if len(published) > 0 && now.Sub(cur.Changed) >= lifetime && now.Sub(published[0].Changed) >= r.PublishSafety {
+		next := published[0]
+		next.State = KeyActive
+		next.Changed = now
+		for _, k := range active {
+			k.State = KeyRetired
+			k.Changed = now
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// newKey generates a new key and adds it to the keys of r.
+func (r *KeyRoller) newKey(now time.Time, ksk bool, state int) (*RollKey, error) {
+	k := new(RollKey)
+	k.Key = new(RR_DNSKEY)
+	k.Key.Hdr = RR_Header{Name: Fqdn(r.Zone), Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: DefaultTtl}
+	k.Key.Flags = ZONE
+	k.Key.Protocol = 3
+	k.Key.Algorithm = r.Algorithm
+	bits := r.ZSKBits
+	if ksk {
+		k.Key.Flags |= SEP
+		bits = r.KSKBits
+	}
+	var err error
+	if k.Private, err = k.Key.Generate(bits); err != nil {
+		return nil, err
+	}
+	k.State = state
+	k.Changed = now
+	r.keys = append(r.keys, k)
+	return k, nil
+}
+
+// remove removes k from the keys of r.
+func (r *KeyRoller) remove(k *RollKey) {
+	for i, k1 := range r.keys {
+		if k1 == k {
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			return
+		}
+	}
+}
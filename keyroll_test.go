@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+type memStore struct {
+	keys []*RollKey
+}
+
+func (m *memStore) Load() ([]*RollKey, error) { return m.keys, nil }
+func (m *memStore) Save(k []*RollKey) error   { m.keys = k; return nil }
+
+func count(keys []*RollKey, ksk bool, state int) (n int) {
+	for _, k := range keys {
+		if k.IsKSK() == ksk && k.State == state {
+			n++
+		}
+	}
+	return
+}
+
+func TestKeyRoller(t *testing.T) {
+	day := 24 * time.Hour
+	signs := 0
+	r := &KeyRoller{Zone: "miek.nl.", Algorithm: ECDSAP256SHA256, KSKBits: 256, ZSKBits: 256,
+		KSKLifetime: 60 * day, ZSKLifetime: 10 * day, PublishSafety: day, RetireSafety: 2 * day,
+		Store: new(memStore), Sign: func(keys []*RollKey) error { signs++; return nil }}
+
+	now := time.Date(2012, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := r.Step(now); err != nil {
+		t.Logf("Step failed: %s", err)
+		t.Fail()
+		return
+	}
+	if count(r.Keys(), true, KeyActive) != 1 || count(r.Keys(), false, KeyActive) != 1 {
+		t.Log("Should have an active KSK and ZSK")
+		t.Fail()
+	}
+	// Day 9: a new ZSK is published
+	r.Step(now.Add(9 * day))
+	if count(r.Keys(), false, KeyPublished) != 1 {
+		t.Log("Should have pre-published a ZSK")
+		t.Fail()
+	}
+	// Day 10: the new ZSK signs, the old one is retired
+	r.Step(now.Add(10 * day))
+	if count(r.Keys(), false, KeyActive) != 1 || count(r.Keys(), false, KeyRetired) != 1 {
+		t.Log("Should have rolled the ZSK")
+		t.Fail()
+	}
+	// Day 12: the old ZSK is removed
+	r.Step(now.Add(12 * day))
+	if count(r.Keys(), false, KeyRetired) != 0 || len(r.Keys()) != 2 {
+		t.Log("Should have removed the old ZSK")
+		t.Fail()
+	}
+	// Day 60: a second KSK signs as well, at day 62 the old one is removed
+	r.Step(now.Add(60 * day))
+	if count(r.Keys(), true, KeyActive) != 2 {
+		t.Log("Should have two active KSKs")
+		t.Fail()
+	}
+	r.Step(now.Add(62 * day))
+	if count(r.Keys(), true, KeyActive) != 1 {
+		t.Log("Should have removed the old KSK")
+		t.Fail()
+	}
+	if signs != 6 {
+		t.Logf("Sign should have been called 6 times: %d", signs)
+		t.Fail()
+	}
+}
@@ -2,6 +2,8 @@ package dns
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
 	"io"
 	"math/big"
@@ -28,6 +30,10 @@ func ReadPrivateKey(q io.Reader, file string) (PrivateKey, error) {
 		return readPrivateKeyRSA(m)
 	case "13 (ECDSAP256SHA256)", "14 (ECDSAP384SHA384)":
 		return readPrivateKeyECDSA(m)
+	case "15 (ED25519)":
+		return readPrivateKeyED25519(m)
+	case "16 (ED448)":
+		return readPrivateKeyED448(m)
 	}
 	return nil, ErrPrivKey
 }
@@ -72,23 +78,46 @@ func readPrivateKeyRSA(m map[string]string) (PrivateKey, error) {
 
 func readPrivateKeyECDSA(m map[string]string) (PrivateKey, error) {
 	p := new(ecdsa.PrivateKey)
-	p.D = big.NewInt(0)
-	// Need to check if we have everything
-	for k, v := range m {
-		switch k {
-		case "privatekey:":
-			v1, err := packBase64([]byte(v))
-			if err != nil {
-				return nil, err
-			}
-			p.D.SetBytes(v1)
-		case "created:", "publish:", "activate:":
-			/* not used in Go (yet) */
-		}
+	switch m["algorithm"] {
+	case "13 (ECDSAP256SHA256)":
+		p.Curve = elliptic.P256()
+	case "14 (ECDSAP384SHA384)":
+		p.Curve = elliptic.P384()
+	}
+	v1, err := packBase64([]byte(m["privatekey"]))
+	if err != nil {
+		return nil, err
+	}
+	if len(v1) == 0 {
+		return nil, ErrPrivKey
 	}
+	p.D = big.NewInt(0).SetBytes(v1)
+	p.PublicKey.X, p.PublicKey.Y = p.Curve.ScalarBaseMult(v1)
 	return p, nil
 }
 
+func readPrivateKeyED25519(m map[string]string) (PrivateKey, error) {
+	seed, err := packBase64([]byte(m["privatekey"]))
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, ErrPrivKey
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func readPrivateKeyED448(m map[string]string) (PrivateKey, error) {
+	seed, err := packBase64([]byte(m["privatekey"]))
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed448SeedSize {
+		return nil, ErrPrivKey
+	}
+	return ed448NewKeyFromSeed(seed), nil
+}
+
 // parseKey reads a private key from r. It returns a map[string]string,
 // with the key-value pairs, or an error when the file is not correct.
 func parseKey(r io.Reader, file string) (map[string]string, error) {
@@ -108,7 +137,7 @@ func parseKey(r io.Reader, file string) (map[string]string, error) {
 			k = l.token
 		case _VALUE:
 			if k == "" {
-				return nil, &ParseError{file, "No key seen", l}
+				return nil, &ParseError{file, "No key seen", l, nil}
 			}
 			//println("Setting", strings.ToLower(k), "to", l.token, "b")
 			m[strings.ToLower(k)] = l.token
@@ -2,6 +2,10 @@ package dns
 
 // Holds a bunch of helper functions for dealing with labels.
 
+import (
+	"strings"
+)
+
 // SplitLabels splits a domainname string into its labels.
 func SplitLabels(s string) []string {
 	last := byte('.')
@@ -48,3 +52,65 @@ func CompareLabels(s1, s2 string) (n int) {
 	}
 	return
 }
+
+// isSubDomain returns true if child is equal to parent or is below it. Both
+// names must be fully qualified and in the same case.
+func isSubDomain(parent, child string) bool {
+	if parent == "." {
+		return true
+	}
+	return CompareLabels(parent, child) == len(SplitLabels(parent))
+}
+
+// CompareDomainName compares the domain names a and b in the canonical
+// DNS name order of RFC 4034 section 6.1: the labels are compared from
+// the right, case-insensitively. It returns -1 when a sorts before b, 0
+// when they are equal and 1 when a sorts after b.
+func CompareDomainName(a, b string) int {
+	la := SplitLabels(strings.ToLower(a))
+	lb := SplitLabels(strings.ToLower(b))
+	if Fqdn(a) == "." {
+		la = nil
+	}
+	if Fqdn(b) == "." {
+		lb = nil
+	}
+	i, j := len(la)-1, len(lb)-1
+	for ; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(unescapeLabel(la[i]), unescapeLabel(lb[j])); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i < 0 && j < 0:
+		return 0
+	case i < 0:
+		return -1
+	}
+	return 1
+}
+
+// unescapeLabel returns the label l with the \X and \DDD escapes replaced by
+// the characters they stand for.
+func unescapeLabel(l string) string {
+	if strings.IndexByte(l, '\\') == -1 {
+		return l
+	}
+	b := make([]byte, 0, len(l))
+	for i := 0; i < len(l); i++ {
+		if l[i] != '\\' || i+1 == len(l) {
+			b = append(b, l[i])
+			continue
+		}
+		if i+3 < len(l) && isDigit(l[i+1]) && isDigit(l[i+2]) && isDigit(l[i+3]) {
+			b = append(b, (l[i+1]-'0')*100+(l[i+2]-'0')*10+(l[i+3]-'0'))
+			i += 3
+			continue
+		}
+		b = append(b, l[i+1])
+		i++
+	}
+	return string(b)
+}
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
@@ -0,0 +1,365 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Lookup functions that use the system configuration, like net.Lookup*.
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// system holds the configuration of the Lookup functions, read from
+// /etc/resolv.conf once.
+var system struct {
+	once sync.Once
+	conf *ClientConfig
+}
+
+// systemConfig returns the system configuration, or one that uses a name
+// server on localhost when /etc/resolv.conf can not be read or lists no
+// servers.
+func systemConfig() *ClientConfig {
+	system.once.Do(func() {
+		conf, err := ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil || len(conf.Servers) == 0 {
+			conf = &ClientConfig{Servers: []string{"127.0.0.1"}, Port: "53", Ndots: 1, Timeout: 5, Attempts: 2}
+		}
+		system.conf = conf
+	})
+	return system.conf
+}
+
+// lookup asks the servers of the system configuration for the RRs of
+// type qtype of name, which is made fully qualified; the search list is
+// not used. A truncated answer is asked again over TCP. An answer
+// without an NOERROR rcode is an error.
+func lookup(name string, qtype uint16) ([]RR, error) {
+	r, err := new(Resolver).exchange(context.Background(), name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != RcodeSuccess {
+		return nil, &Error{Err: "lookup failed: " + RcodeToString(r.Rcode), Name: name}
+	}
+	return answerType(r, qtype), nil
+}
+
+// answerType returns the RRs of type qtype in the answer section of r.
+func answerType(r *Msg, qtype uint16) []RR {
+	var rrs []RR
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype == qtype {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
+
+// LookupA returns the A records of name, using the name servers from
+// /etc/resolv.conf. The records of the name a CNAME points to are
+// included; there are none when name has no A records.
+func LookupA(name string) ([]*RR_A, error) {
+	rrs, err := lookup(name, TypeA)
+	var a []*RR_A
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_A); ok {
+			a = append(a, x)
+		}
+	}
+	return a, err
+}
+
+// LookupAAAA returns the AAAA records of name, see LookupA.
+func LookupAAAA(name string) ([]*RR_AAAA, error) {
+	rrs, err := lookup(name, TypeAAAA)
+	var a []*RR_AAAA
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_AAAA); ok {
+			a = append(a, x)
+		}
+	}
+	return a, err
+}
+
+// LookupMX returns the MX records of name, see LookupA. They are in the
+// order of the answer, not sorted by preference.
+func LookupMX(name string) ([]*RR_MX, error) {
+	rrs, err := lookup(name, TypeMX)
+	var mx []*RR_MX
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_MX); ok {
+			mx = append(mx, x)
+		}
+	}
+	return mx, err
+}
+
+// LookupTXT returns the TXT records of name, see LookupA.
+func LookupTXT(name string) ([]*RR_TXT, error) {
+	rrs, err := lookup(name, TypeTXT)
+	var txt []*RR_TXT
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_TXT); ok {
+			txt = append(txt, x)
+		}
+	}
+	return txt, err
+}
+
+// LookupNS returns the NS records of name, see LookupA.
+func LookupNS(name string) ([]*RR_NS, error) {
+	rrs, err := lookup(name, TypeNS)
+	var ns []*RR_NS
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_NS); ok {
+			ns = append(ns, x)
+		}
+	}
+	return ns, err
+}
+
+// A Resolver looks up names with the same methods, and the same
+// results, as a net.Resolver, so it can be used where an interface
+// with those methods is expected. The names are made fully qualified,
+// the search list is not used. When the server answers NXDOMAIN, or an
+// answer has no records of the asked type, the error is a *net.DNSError
+// with IsNotFound set; other rcodes give a *net.DNSError too.
+type Resolver struct {
+	Config *ClientConfig // the servers to ask, from /etc/resolv.conf if nil
+	Client *Client       // the client to ask them with, NewClient() if nil
+}
+
+// exchange asks the servers of r for the RRs of type qtype of name. A
+// truncated answer is asked again over TCP. The deadline of ctx caps the
+// timeouts of the client.
+func (r *Resolver) exchange(ctx context.Context, name string, qtype uint16) (*Msg, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conf := r.Config
+	if conf == nil {
+		conf = systemConfig()
+	}
+	c := new(Client)
+	if r.Client != nil {
+		*c = *r.Client
+	} else {
+		c = NewClient()
+		if conf.Timeout > 0 {
+			c.ReadTimeout = time.Duration(conf.Timeout) * time.Second
+		}
+	}
+	if d, ok := ctx.Deadline(); ok {
+		t := time.Until(d)
+		if t <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+		if c.ReadTimeout == 0 || t < c.ReadTimeout {
+			c.ReadTimeout = t
+		}
+		if c.WriteTimeout == 0 || t < c.WriteTimeout {
+			c.WriteTimeout = t
+		}
+	}
+	m := new(Msg)
+	m.SetQuestion(Fqdn(name), qtype)
+	type result struct {
+		r   *Msg
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		in, err := c.ExchangeConfig(m, conf)
+		if err == nil && in.Truncated && c.Net != "tcp" {
+			c.Net = "tcp"
+			in, err = c.ExchangeConfig(m, conf)
+		}
+		done <- result{in, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case x := <-done:
+		return x.r, x.err
+	}
+}
+
+// lookup is like exchange, but returns the RRs of type qtype of the
+// answer, and an error when there are none.
+func (r *Resolver) lookup(ctx context.Context, name string, qtype uint16) ([]RR, error) {
+	in, err := r.exchange(ctx, name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	var rrs []RR
+	if in.Rcode == RcodeSuccess {
+		if rrs = answerType(in, qtype); len(rrs) > 0 {
+			return rrs, nil
+		}
+	}
+	e := &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	if in.Rcode != RcodeSuccess && in.Rcode != RcodeNameError {
+		e.Err, e.IsNotFound = "server answered "+RcodeToString(in.Rcode), false
+	}
+	return nil, e
+}
+
+// LookupIP looks up host and returns its IPv4 and IPv6 addresses for the
+// network "ip", only its IPv4 addresses for "ip4" and only its IPv6
+// addresses for "ip6".
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	var qtypes []uint16
+	switch network {
+	case "ip":
+		qtypes = []uint16{TypeA, TypeAAAA}
+	case "ip4":
+		qtypes = []uint16{TypeA}
+	case "ip6":
+		qtypes = []uint16{TypeAAAA}
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	var (
+		ips []net.IP
+		err error
+	)
+	for _, t := range qtypes {
+		rrs, e := r.lookup(ctx, host, t)
+		if e != nil {
+			err = e
+			continue
+		}
+		ips = append(ips, NetIP(rrs)...)
+	}
+	if len(ips) == 0 {
+		return nil, err
+	}
+	return ips, nil
+}
+
+// LookupIPAddr looks up host and returns its IPv4 and IPv6 addresses.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, err := r.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]net.IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = net.IPAddr{IP: ip}
+	}
+	return addrs, nil
+}
+
+// LookupHost looks up host and returns its addresses as strings.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	ips, err := r.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	return addrs, nil
+}
+
+// LookupCNAME returns the canonical name of host: the end of the CNAME
+// chain in the answer for its A records, or host itself, fully qualified,
+// when it is not an alias.
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	in, err := r.exchange(ctx, host, TypeA)
+	if err != nil {
+		return "", err
+	}
+	if in.Rcode != RcodeSuccess {
+		e := &net.DNSError{Err: "no such host", Name: host, IsNotFound: in.Rcode == RcodeNameError}
+		if !e.IsNotFound {
+			e.Err = "server answered " + RcodeToString(in.Rcode)
+		}
+		return "", e
+	}
+	name := Fqdn(host)
+	for i := 0; i < len(in.Answer); i++ {
+		for _, rr := range in.Answer {
+			if x, ok := rr.(*RR_CNAME); ok && strings.EqualFold(x.Hdr.Name, name) {
+				name = x.Cname
+				break
+			}
+		}
+	}
+	return name, nil
+}
+
+// LookupAddr returns the names that the PTR records of addr point to.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, &net.DNSError{Err: "unrecognized address", Name: addr}
+	}
+	rrs, err := r.lookup(ctx, reverseAddr(ip), TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, rr := range rrs {
+		names = append(names, rr.(*RR_PTR).Ptr)
+	}
+	return names, nil
+}
+
+// LookupMX returns the MX records of name, sorted by preference.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	rrs, err := r.lookup(ctx, name, TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	mx := NetMX(rrs)
+	sort.SliceStable(mx, func(i, j int) bool { return mx[i].Pref < mx[j].Pref })
+	return mx, nil
+}
+
+// LookupNS returns the NS records of name.
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	rrs, err := r.lookup(ctx, name, TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	return NetNS(rrs), nil
+}
+
+// LookupSRV returns the SRV records of _service._proto.name, or of name
+// when service and proto are empty, sorted by priority and, within a
+// priority, ordered randomly by weight as described in RFC 2782, see
+// SortByPreference. The name that was asked for is returned as cname.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+	rrs, err := r.lookup(ctx, target, TypeSRV)
+	if err != nil {
+		return "", nil, err
+	}
+	return Fqdn(target), NetSRV(SortByPreference(rrs)), nil
+}
+
+// LookupTXT returns the TXT records of name, the strings of each record
+// are joined.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	rrs, err := r.lookup(ctx, name, TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	txt := make([]string, len(rrs))
+	for i, rr := range rrs {
+		txt[i] = strings.Join(rr.(*RR_TXT).Txt, "")
+	}
+	return txt, nil
+}
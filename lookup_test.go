@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		switch q := req.Question[0]; {
+		case q.Name == "www.miek.nl." && q.Qtype == TypeA:
+			m.Answer = append(m.Answer, &RR_CNAME{Hdr: RR_Header{Name: q.Name, Rrtype: TypeCNAME, Class: ClassINET, Ttl: 3600}, Cname: "miek.nl."})
+			m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeA, Class: ClassINET, Ttl: 300}, A: net.IPv4(127, 0, 0, 1)})
+		case q.Name == "miek.nl." && q.Qtype == TypeMX:
+			m.Answer = append(m.Answer, &RR_MX{Hdr: RR_Header{Name: q.Name, Rrtype: TypeMX, Class: ClassINET, Ttl: 3600}, Pref: 10, Mx: "mx.miek.nl."})
+		case q.Name == "miek.nl.":
+		default:
+			m.Rcode = RcodeNameError
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})}).ServeUDP(l)
+
+	systemConfig()
+	defer func(conf *ClientConfig) { system.conf = conf }(system.conf)
+	_, port, _ := net.SplitHostPort(l.LocalAddr().String())
+	system.conf = &ClientConfig{Servers: []string{"127.0.0.1"}, Port: port, Timeout: 1, Attempts: 1}
+
+	a, err := LookupA("www.miek.nl")
+	if err != nil || len(a) != 1 || a[0].Hdr.Ttl != 300 || !a[0].A.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Logf("Expected the A record of miek.nl., got %v: %v", err, a)
+		t.Fail()
+	}
+	mx, err := LookupMX("miek.nl.")
+	if err != nil || len(mx) != 1 || mx[0].Mx != "mx.miek.nl." {
+		t.Logf("Expected the MX record of miek.nl., got %v: %v", err, mx)
+		t.Fail()
+	}
+	if txt, err := LookupTXT("miek.nl."); err != nil || len(txt) != 0 {
+		t.Logf("Expected no TXT records, got %v: %v", err, txt)
+		t.Fail()
+	}
+	if ns, err := LookupNS("nx.miek.nl."); err == nil {
+		t.Logf("Expected an error for NXDOMAIN, got %v", ns)
+		t.Fail()
+	}
+}
+
+// resolver has the methods that net.Resolver and Resolver share.
+type resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+var (
+	_ resolver = new(net.Resolver)
+	_ resolver = new(Resolver)
+)
+
+func TestResolver(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	hdr := func(name string, t uint16) RR_Header {
+		return RR_Header{Name: name, Rrtype: t, Class: ClassINET, Ttl: 300}
+	}
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		switch q := req.Question[0]; {
+		case q.Name == "www.miek.nl." && q.Qtype == TypeA:
+			m.Answer = append(m.Answer, &RR_CNAME{Hdr: hdr(q.Name, TypeCNAME), Cname: "miek.nl."})
+			m.Answer = append(m.Answer, &RR_A{Hdr: hdr("miek.nl.", TypeA), A: net.IPv4(127, 0, 0, 1)})
+		case q.Name == "www.miek.nl." && q.Qtype == TypeAAAA:
+			m.Answer = append(m.Answer, &RR_CNAME{Hdr: hdr(q.Name, TypeCNAME), Cname: "miek.nl."})
+			m.Answer = append(m.Answer, &RR_AAAA{Hdr: hdr("miek.nl.", TypeAAAA), AAAA: net.ParseIP("::1")})
+		case q.Name == "miek.nl." && q.Qtype == TypeMX:
+			m.Answer = append(m.Answer, &RR_MX{Hdr: hdr(q.Name, TypeMX), Pref: 20, Mx: "mx2.miek.nl."})
+			m.Answer = append(m.Answer, &RR_MX{Hdr: hdr(q.Name, TypeMX), Pref: 10, Mx: "mx1.miek.nl."})
+		case q.Name == "_sip._udp.miek.nl." && q.Qtype == TypeSRV:
+			m.Answer = append(m.Answer, &RR_SRV{Hdr: hdr(q.Name, TypeSRV), Priority: 1, Weight: 10, Port: 5060, Target: "sip.miek.nl."},
+				&RR_SRV{Hdr: hdr(q.Name, TypeSRV), Priority: 0, Weight: 10, Port: 5061, Target: "sip.miek.nl."})
+		case q.Name == "1.0.0.127.in-addr.arpa." && q.Qtype == TypePTR:
+			m.Answer = append(m.Answer, &RR_PTR{Hdr: hdr(q.Name, TypePTR), Ptr: "localhost."})
+		case q.Name == "miek.nl." && q.Qtype == TypeTXT:
+			m.Answer = append(m.Answer, &RR_TXT{Hdr: hdr(q.Name, TypeTXT), Txt: []string{"v=spf1 ", "-all"}})
+		case q.Name == "slow.miek.nl.":
+			time.Sleep(500 * time.Millisecond)
+		case q.Name == "miek.nl.":
+		default:
+			m.Rcode = RcodeNameError
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})}).ServeUDP(l)
+
+	_, port, _ := net.SplitHostPort(l.LocalAddr().String())
+	r := &Resolver{Config: &ClientConfig{Servers: []string{"127.0.0.1"}, Port: port, Timeout: 1, Attempts: 1}}
+	ctx := context.Background()
+
+	if addrs, err := r.LookupHost(ctx, "www.miek.nl"); err != nil || len(addrs) != 2 || addrs[0] != "127.0.0.1" || addrs[1] != "::1" {
+		t.Logf("Expected the addresses of www.miek.nl, got %v: %v", err, addrs)
+		t.Fail()
+	}
+	if ips, err := r.LookupIP(ctx, "ip6", "www.miek.nl"); err != nil || len(ips) != 1 || !ips[0].Equal(net.IPv6loopback) {
+		t.Logf("Expected the IPv6 address of www.miek.nl, got %v: %v", err, ips)
+		t.Fail()
+	}
+	if cname, err := r.LookupCNAME(ctx, "www.miek.nl"); err != nil || cname != "miek.nl." {
+		t.Logf("Expected miek.nl. as canonical name, got %v: %s", err, cname)
+		t.Fail()
+	}
+	if mx, err := r.LookupMX(ctx, "miek.nl"); err != nil || len(mx) != 2 || mx[0].Host != "mx1.miek.nl." {
+		t.Logf("Expected the sorted MX records of miek.nl, got %v: %v", err, mx)
+		t.Fail()
+	}
+	if cname, srv, err := r.LookupSRV(ctx, "sip", "udp", "miek.nl"); err != nil || cname != "_sip._udp.miek.nl." || len(srv) != 2 || srv[0].Port != 5061 || srv[1].Port != 5060 {
+		t.Logf("Expected the sorted SRV records of _sip._udp.miek.nl, got %v: %s %v", err, cname, srv)
+		t.Fail()
+	}
+	if names, err := r.LookupAddr(ctx, "127.0.0.1"); err != nil || len(names) != 1 || names[0] != "localhost." {
+		t.Logf("Expected localhost. for 127.0.0.1, got %v: %v", err, names)
+		t.Fail()
+	}
+	if txt, err := r.LookupTXT(ctx, "miek.nl"); err != nil || len(txt) != 1 || txt[0] != "v=spf1 -all" {
+		t.Logf("Expected the TXT record of miek.nl, got %v: %v", err, txt)
+		t.Fail()
+	}
+	for _, name := range []string{"nx.miek.nl", "miek.nl"} {
+		_, err := r.LookupNS(ctx, name)
+		if e, ok := err.(*net.DNSError); !ok || !e.IsNotFound {
+			t.Logf("Expected a not found error for %s, got %v", name, err)
+			t.Fail()
+		}
+	}
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := r.LookupHost(tctx, "slow.miek.nl"); err == nil {
+		t.Log("Expected an error when the context expires")
+		t.Fail()
+	}
+}
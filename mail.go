@@ -0,0 +1,337 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// The TXT record conventions of mail authentication: DKIM (RFC 6376),
+// SPF (RFC 7208) and DMARC (RFC 7489).
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NewDKIMRecord returns the TXT record that publishes pubkey, an
+// *rsa.PublicKey or an ed25519.PublicKey, as the DKIM key of selector in
+// domain, at selector._domainkey.domain.
+func NewDKIMRecord(selector, domain string, pubkey interface{}) (*RR_TXT, error) {
+	var k, p string
+	switch pub := pubkey.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		k, p = "rsa", base64.StdEncoding.EncodeToString(der)
+	case ed25519.PublicKey:
+		k, p = "ed25519", base64.StdEncoding.EncodeToString(pub)
+	default:
+		return nil, ErrKeyAlg
+	}
+	return &RR_TXT{Hdr: RR_Header{Name: selector + "._domainkey." + Fqdn(domain), Rrtype: TypeTXT, Class: ClassINET},
+		Txt: []string{"v=DKIM1; k=" + k + "; p=" + p}}, nil
+}
+
+// DKIM is a parsed DKIM key record.
+type DKIM struct {
+	KeyType   string // the k= tag, "rsa" when not given
+	PublicKey []byte // the decoded p= tag, empty when the key is revoked
+	Hashes    []string
+	Services  []string
+	Flags     []string
+	Notes     string
+}
+
+// ParseDKIM parses the DKIM key record txt, the character-strings of the
+// TXT record joined together.
+func ParseDKIM(txt string) (*DKIM, error) {
+	tags, err := parseTagList(txt)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		return nil, &Error{Err: "bad DKIM version", Name: v}
+	}
+	p, ok := tags["p"]
+	if !ok {
+		return nil, &Error{Err: "missing DKIM tag", Name: "p"}
+	}
+	d := &DKIM{KeyType: "rsa", Notes: tags["n"]}
+	if k, ok := tags["k"]; ok {
+		d.KeyType = k
+	}
+	if d.PublicKey, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p), "")); err != nil {
+		return nil, &Error{Err: "bad DKIM public key", Name: p}
+	}
+	d.Hashes = splitList(tags["h"], ":")
+	d.Services = splitList(tags["s"], ":")
+	d.Flags = splitList(tags["t"], ":")
+	return d, nil
+}
+
+// Key returns the public key of d, an *rsa.PublicKey or an
+// ed25519.PublicKey.
+func (d *DKIM) Key() (interface{}, error) {
+	switch d.KeyType {
+	case "rsa":
+		pub, err := x509.ParsePKIXPublicKey(d.PublicKey)
+		if err != nil {
+			// Some publish the bare RSAPublicKey
+			return x509.ParsePKCS1PublicKey(d.PublicKey)
+		}
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return nil, ErrKeyAlg
+		}
+		return pub, nil
+	case "ed25519":
+		if len(d.PublicKey) != ed25519.PublicKeySize {
+			return nil, ErrKeySize
+		}
+		return ed25519.PublicKey(d.PublicKey), nil
+	}
+	return nil, ErrKeyAlg
+}
+
+// The qualifiers of an SPF mechanism.
+const (
+	SPFPass     = '+'
+	SPFFail     = '-'
+	SPFSoftFail = '~'
+	SPFNeutral  = '?'
+)
+
+// SPFMechanism is one of the mechanisms of an SPF record, such as
+// "-all" or "ip4:192.0.2.0/24".
+type SPFMechanism struct {
+	Qualifier byte   // SPFPass, SPFFail, SPFSoftFail or SPFNeutral
+	Name      string // all, include, a, mx, ptr, ip4, ip6 or exists
+	Value     string // what follows the ':' or '/' after the name
+}
+
+func (m SPFMechanism) String() string {
+	s := m.Name
+	if m.Qualifier != SPFPass {
+		s = string(m.Qualifier) + s
+	}
+	if m.Value == "" {
+		return s
+	}
+	if m.Value[0] == '/' {
+		return s + m.Value
+	}
+	return s + ":" + m.Value
+}
+
+// SPF is a parsed SPF policy.
+type SPF struct {
+	Mechanisms  []SPFMechanism
+	Redirect    string            // the redirect= modifier
+	Explanation string            // the exp= modifier
+	Modifiers   map[string]string // the other modifiers
+}
+
+// ParseSPF parses the SPF record txt, the character-strings of the TXT
+// record joined together.
+func ParseSPF(txt string) (*SPF, error) {
+	terms := strings.Fields(txt)
+	if len(terms) == 0 || !strings.EqualFold(terms[0], "v=spf1") {
+		return nil, &Error{Err: "not an SPF record", Name: txt}
+	}
+	s := new(SPF)
+	for _, t := range terms[1:] {
+		if i := strings.IndexAny(t, "=:/"); i > 0 && t[i] == '=' {
+			name, value := strings.ToLower(t[:i]), t[i+1:]
+			switch name {
+			case "redirect":
+				s.Redirect = value
+			case "exp":
+				s.Explanation = value
+			default:
+				if s.Modifiers == nil {
+					s.Modifiers = make(map[string]string)
+				}
+				s.Modifiers[name] = value
+			}
+			continue
+		}
+		m := SPFMechanism{Qualifier: SPFPass}
+		switch t[0] {
+		case SPFPass, SPFFail, SPFSoftFail, SPFNeutral:
+			m.Qualifier = t[0]
+			t = t[1:]
+		}
+		m.Name = t
+		if i := strings.IndexAny(t, ":/"); i >= 0 {
+			m.Name, m.Value = t[:i], t[i:]
+			if t[i] == ':' {
+				m.Value = t[i+1:]
+			}
+		}
+		m.Name = strings.ToLower(m.Name)
+		switch m.Name {
+		case "all":
+			if m.Value != "" {
+				return nil, &Error{Err: "bad SPF mechanism", Name: t}
+			}
+		case "include", "exists":
+			if m.Value == "" || m.Value[0] == '/' {
+				return nil, &Error{Err: "bad SPF mechanism", Name: t}
+			}
+		case "a", "mx", "ptr":
+		case "ip4", "ip6":
+			if m.Value == "" {
+				return nil, &Error{Err: "bad SPF mechanism", Name: t}
+			}
+		default:
+			return nil, &Error{Err: "unknown SPF mechanism", Name: t}
+		}
+		s.Mechanisms = append(s.Mechanisms, m)
+	}
+	return s, nil
+}
+
+// String returns the SPF record for s.
+func (s *SPF) String() string {
+	terms := []string{"v=spf1"}
+	for _, m := range s.Mechanisms {
+		terms = append(terms, m.String())
+	}
+	var names []string
+	for name := range s.Modifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		terms = append(terms, name+"="+s.Modifiers[name])
+	}
+	if s.Redirect != "" {
+		terms = append(terms, "redirect="+s.Redirect)
+	}
+	if s.Explanation != "" {
+		terms = append(terms, "exp="+s.Explanation)
+	}
+	return strings.Join(terms, " ")
+}
+
+// DMARC is a parsed DMARC policy record.
+type DMARC struct {
+	Policy          string   // the p= tag: none, quarantine or reject
+	SubdomainPolicy string   // the sp= tag, empty when not given
+	Percent         int      // the pct= tag, 100 when not given
+	ReportAggregate []string // the URIs of the rua= tag
+	ReportFailure   []string // the URIs of the ruf= tag
+	AlignDKIM       string   // the adkim= tag, "r" or "s"; "r" when not given
+	AlignSPF        string   // the aspf= tag, "r" or "s"; "r" when not given
+}
+
+// NewDMARCRecord returns the TXT record that publishes d for domain, at
+// _dmarc.domain.
+func NewDMARCRecord(domain string, d *DMARC) *RR_TXT {
+	return &RR_TXT{Hdr: RR_Header{Name: "_dmarc." + Fqdn(domain), Rrtype: TypeTXT, Class: ClassINET},
+		Txt: []string{d.String()}}
+}
+
+// ParseDMARC parses the DMARC record txt, the character-strings of the TXT
+// record joined together.
+func ParseDMARC(txt string) (*DMARC, error) {
+	tags, err := parseTagList(txt)
+	if err != nil {
+		return nil, err
+	}
+	// The v tag must come first
+	if first := strings.SplitN(txt, "=", 2)[0]; tags["v"] != "DMARC1" || strings.TrimSpace(first) != "v" {
+		return nil, &Error{Err: "not a DMARC record", Name: txt}
+	}
+	d := &DMARC{Policy: tags["p"], SubdomainPolicy: tags["sp"], Percent: 100, AlignDKIM: "r", AlignSPF: "r"}
+	if !dmarcPolicy(d.Policy) || (d.SubdomainPolicy != "" && !dmarcPolicy(d.SubdomainPolicy)) {
+		return nil, &Error{Err: "bad DMARC policy", Name: txt}
+	}
+	if pct, ok := tags["pct"]; ok {
+		if d.Percent, err = strconv.Atoi(pct); err != nil || d.Percent < 0 || d.Percent > 100 {
+			return nil, &Error{Err: "bad DMARC percentage", Name: pct}
+		}
+	}
+	for _, a := range []struct {
+		tag string
+		v   *string
+	}{{"adkim", &d.AlignDKIM}, {"aspf", &d.AlignSPF}} {
+		switch v := tags[a.tag]; v {
+		case "":
+		case "r", "s":
+			*a.v = v
+		default:
+			return nil, &Error{Err: "bad DMARC alignment", Name: v}
+		}
+	}
+	d.ReportAggregate = splitList(tags["rua"], ",")
+	d.ReportFailure = splitList(tags["ruf"], ",")
+	return d, nil
+}
+
+// String returns the DMARC record for d. Tags with their default value
+// are left out.
+func (d *DMARC) String() string {
+	s := "v=DMARC1; p=" + d.Policy
+	if d.SubdomainPolicy != "" {
+		s += "; sp=" + d.SubdomainPolicy
+	}
+	if d.Percent != 100 {
+		s += "; pct=" + strconv.Itoa(d.Percent)
+	}
+	if len(d.ReportAggregate) > 0 {
+		s += "; rua=" + strings.Join(d.ReportAggregate, ",")
+	}
+	if len(d.ReportFailure) > 0 {
+		s += "; ruf=" + strings.Join(d.ReportFailure, ",")
+	}
+	if d.AlignDKIM == "s" {
+		s += "; adkim=s"
+	}
+	if d.AlignSPF == "s" {
+		s += "; aspf=s"
+	}
+	return s
+}
+
+func dmarcPolicy(p string) bool {
+	return p == "none" || p == "quarantine" || p == "reject"
+}
+
+// parseTagList parses a tag=value list as used by DKIM and DMARC
+// (RFC 6376, section 3.2). The tag names are case-sensitive.
+func parseTagList(txt string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, spec := range strings.Split(txt, ";") {
+		if strings.TrimSpace(spec) == "" {
+			// Trailing ;
+			continue
+		}
+		i := strings.Index(spec, "=")
+		if i < 0 {
+			return nil, &Error{Err: "bad tag", Name: spec}
+		}
+		tag := strings.TrimSpace(spec[:i])
+		if _, ok := tags[tag]; ok || tag == "" {
+			return nil, &Error{Err: "bad tag", Name: spec}
+		}
+		tags[tag] = strings.TrimSpace(spec[i+1:])
+	}
+	return tags, nil
+}
+
+// splitList splits the list v at sep, leaving out the empty elements.
+func splitList(v, sep string) []string {
+	var s []string
+	for _, f := range strings.Split(v, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			s = append(s, f)
+		}
+	}
+	return s
+}
@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+func TestDKIM(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	rr, err := NewDKIMRecord("sel", "miek.nl", pub)
+	if err != nil || rr.Hdr.Name != "sel._domainkey.miek.nl." {
+		t.Logf("Failed to create DKIM record: %v %s", err, rr)
+		t.Fail()
+		return
+	}
+	d, err := ParseDKIM(strings.Join(rr.Txt, ""))
+	if err != nil || d.KeyType != "ed25519" {
+		t.Logf("Failed to parse DKIM record: %v %s", err, rr)
+		t.Fail()
+		return
+	}
+	if k, err := d.Key(); err != nil || !pub.Equal(k) {
+		t.Logf("Wrong DKIM key: %v", err)
+		t.Fail()
+	}
+	if _, err := ParseDKIM("v=DKIM1; k=rsa"); err == nil {
+		t.Log("DKIM record without a key should not parse")
+		t.Fail()
+	}
+	d, err = ParseDKIM("v=DKIM1; h=sha256 : sha1; t=y:s; p=")
+	if err != nil || len(d.PublicKey) != 0 || len(d.Hashes) != 2 || len(d.Flags) != 2 {
+		t.Logf("Failed to parse revoked DKIM record: %v %v", err, d)
+		t.Fail()
+	}
+}
+
+func TestSPF(t *testing.T) {
+	const txt = "v=spf1 ip4:192.0.2.0/24 a/24 mx:mail.miek.nl ~include:_spf.example.com -all redirect=_spf.miek.nl"
+	s, err := ParseSPF(txt)
+	if err != nil || len(s.Mechanisms) != 5 || s.Redirect != "_spf.miek.nl" {
+		t.Logf("Failed to parse SPF record: %v %v", err, s)
+		t.Fail()
+		return
+	}
+	m := s.Mechanisms[3]
+	if m.Qualifier != SPFSoftFail || m.Name != "include" || m.Value != "_spf.example.com" {
+		t.Logf("Wrong mechanism: %v", m)
+		t.Fail()
+	}
+	if s.Mechanisms[1].Value != "/24" || s.Mechanisms[4].Qualifier != SPFFail {
+		t.Logf("Wrong mechanisms: %v", s.Mechanisms)
+		t.Fail()
+	}
+	if s.String() != txt {
+		t.Logf("SPF record should round trip: %s", s)
+		t.Fail()
+	}
+	for _, bad := range []string{"v=spf2 -all", "v=spf1 foo", "v=spf1 include", "v=spf1 all:x"} {
+		if _, err := ParseSPF(bad); err == nil {
+			t.Logf("%q should not parse", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestDMARC(t *testing.T) {
+	d, err := ParseDMARC("v=DMARC1; p=quarantine; pct=50; rua=mailto:a@miek.nl, mailto:b@miek.nl; aspf=s")
+	if err != nil || d.Policy != "quarantine" || d.Percent != 50 || len(d.ReportAggregate) != 2 ||
+		d.AlignSPF != "s" || d.AlignDKIM != "r" {
+		t.Logf("Failed to parse DMARC record: %v %v", err, d)
+		t.Fail()
+		return
+	}
+	rr := NewDMARCRecord("miek.nl", d)
+	if rr.Hdr.Name != "_dmarc.miek.nl." ||
+		rr.Txt[0] != "v=DMARC1; p=quarantine; pct=50; rua=mailto:a@miek.nl,mailto:b@miek.nl; aspf=s" {
+		t.Logf("Wrong DMARC record: %s", rr)
+		t.Fail()
+	}
+	for _, bad := range []string{"p=none; v=DMARC1", "v=DMARC1; p=maybe", "v=DMARC1; p=none; pct=101", "v=DMARC1; p=none; p=none"} {
+		if _, err := ParseDMARC(bad); err == nil {
+			t.Logf("%q should not parse", bad)
+			t.Fail()
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"net"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -51,11 +52,31 @@ var (
 	ErrChan        error = &Error{Err: "channel is nil"}
 	ErrName        error = &Error{Err: "type not found for name"}
 	ErrRRset       error = &Error{Err: "invalid rrset"}
+	ErrRRsetEmpty  error = &Error{Err: "empty rrset"}
+	ErrRRsetName   error = &Error{Err: "owner name differs in rrset"}
+	ErrRRsetClass  error = &Error{Err: "class differs in rrset"}
+	ErrRRsetType   error = &Error{Err: "type differs in rrset"}
+	ErrRRsetTtl    error = &Error{Err: "ttl differs in rrset"}
 	ErrDenialNsec3 error = &Error{Err: "no NSEC3 records"}
 	ErrDenialCe    error = &Error{Err: "no matching closest encloser found"}
 	ErrDenialNc    error = &Error{Err: "no covering NSEC3 found for next closer"}
 	ErrDenialSo    error = &Error{Err: "no covering NSEC3 found for source of synthesis"}
         ErrDenialBit   error = &Error{Err: "type not denied in NSEC3 bitmap"}
+	ErrFqdn        error = &Error{Err: "domain name is not fully qualified"}
+	ErrRdata       error = &Error{Err: "bad rdata"}
+	ErrBuf         error = &Error{Err: "buffer size too small"}
+	ErrTruncated   error = &Error{Err: "failed to unpack truncated message"}
+	ErrCnameLoop   error = &Error{Err: "CNAME loop detected"}
+	ErrCds         error = &Error{Err: "CDS or CDNSKEY does not match the DNSKEY RRset"}
+	ErrSigExpired  error = &Error{Err: "signature expired"}
+	ErrSigNotYet   error = &Error{Err: "signature not yet valid"}
+	ErrWalk        error = &Error{Err: "NSEC chain is broken"}
+	ErrSnapshot    error = &Error{Err: "bad cache snapshot"}
+	ErrRcode       error = &Error{Err: "bad rcode"}
+	ErrInboundSize error = &Error{Err: "message larger than MaxInboundSize"}
+	ErrQueryConn   error = &Error{Err: "query conn closed"}
+	ErrQuestion    error = &Error{Err: "no question in query"}
+	ErrNoHandler   error = &Error{Err: "no handler found for query"}
 )
 
 // A manually-unpacked version of (id, bits).
@@ -78,15 +99,22 @@ type MsgHdr struct {
 type Msg struct {
 	MsgHdr
 	Compress bool // If true, the message will be compressed when converted to wire format.
+	AutoFqdn bool // If true, names that are not fully qualified are made so when converted to wire format.
 	Question []Question
 	Answer   []RR
 	Ns       []RR
 	Extra    []RR
+
+	arena *RRArena // if not nil, the RRs are unpacked into RRs from arena, see Pools
 }
 
-// Map of strings for each RR wire type.
-var Rr_str = map[uint16]string{
+// The mnemonics of the RR types; use TypeToString and StringToType.
+var typeStr = map[uint16]string{
 	TypeCNAME:      "CNAME",
+	TypeMD:         "MD",
+	TypeMF:         "MF",
+	TypeNULL:       "NULL",
+	TypeWKS:        "WKS",
 	TypeHINFO:      "HINFO",
 	TypeMB:         "MB",
 	TypeMG:         "MG",
@@ -97,6 +125,13 @@ var Rr_str = map[uint16]string{
 	TypePTR:        "PTR",
 	TypeSOA:        "SOA",
 	TypeTXT:        "TXT",
+	TypeAFSDB:      "AFSDB",
+	TypeX25:        "X25",
+	TypeISDN:       "ISDN",
+	TypeRT:         "RT",
+	TypeNSAP:       "NSAP",
+	TypePX:         "PX",
+	TypeGPOS:       "GPOS",
 	TypeSRV:        "SRV",
 	TypeNAPTR:      "NAPTR",
 	TypeKX:         "KX",
@@ -116,20 +151,105 @@ var Rr_str = map[uint16]string{
 	TypeNSEC3:      "NSEC3",
 	TypeNSEC3PARAM: "NSEC3PARAM",
 	TypeTALINK:     "TALINK",
+	TypeCDS:        "CDS",
+	TypeCDNSKEY:    "CDNSKEY",
 	TypeSPF:        "SPF",
-	TypeTKEY:       "TKEY", // Meta RR
-	TypeTSIG:       "TSIG", // Meta RR
-	TypeAXFR:       "AXFR", // Meta RR
-	TypeIXFR:       "IXFR", // Meta RR
-	TypeANY:        "ANY",  // Meta RR
+	TypeSIG:        "SIG",
+	TypeKEY:        "KEY",
+	TypeNXT:        "NXT",
+	TypeNID:        "NID",
+	TypeL32:        "L32",
+	TypeL64:        "L64",
+	TypeLP:         "LP",
+	TypeTKEY:       "TKEY",  // Meta RR
+	TypeTSIG:       "TSIG",  // Meta RR
+	TypeAXFR:       "AXFR",  // Meta RR
+	TypeIXFR:       "IXFR",  // Meta RR
+	TypeANY:        "ANY",   // Meta RR
+	TypeMAILB:      "MAILB", // Meta RR
+	TypeMAILA:      "MAILA", // Meta RR
 	TypeURI:        "URI",
+	TypeAMTRELAY:   "AMTRELAY",
 	TypeTA:         "TA",
 	TypeDLV:        "DLV",
+	TypeTLSA:       "TLSA",
 }
 
-// Reverse, needed for string parsing.
-var Str_rr = reverseInt16(Rr_str)
-var Str_class = reverseInt16(Class_str)
+// The reverse maps, derived from the maps above so that they can not
+// drift apart.
+var strType = reverseInt16(typeStr)
+var strClass = reverseInt16(classStr)
+
+// Map of strings for each RR wire type.
+//
+// Deprecated: use TypeToString. This is a copy, changes are not seen by
+// the package.
+var Rr_str = copyInt16(typeStr)
+
+// Map of RR wire types for each string.
+//
+// Deprecated: use StringToType. This is a copy, changes are not seen by
+// the package.
+var Str_rr = reverseInt16(typeStr)
+
+// Map of strings for each CLASS wire type.
+//
+// Deprecated: use ClassToString. This is a copy, changes are not seen by
+// the package.
+var Class_str = copyInt16(classStr)
+
+// Map of CLASS wire types for each string.
+//
+// Deprecated: use StringToClass. This is a copy, changes are not seen by
+// the package.
+var Str_class = reverseInt16(classStr)
+
+// TypeToString returns the mnemonic of the RR type t, or the generic
+// TYPEnnn form of RFC 3597 when t has none.
+func TypeToString(t uint16) string {
+	if s, ok := typeStr[t]; ok {
+		return s
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// ClassToString returns the mnemonic of the class c, or the generic
+// CLASSnnn form of RFC 3597 when c has none.
+func ClassToString(c uint16) string {
+	if s, ok := classStr[c]; ok {
+		return s
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+// StringToType returns the RR type for the mnemonic s, which may be in the
+// generic TYPEnnn form. The mnemonic is case-insensitive.
+func StringToType(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	if t, ok := strType[s]; ok {
+		return t, true
+	}
+	return genericNumber(s, "TYPE")
+}
+
+// StringToClass returns the class for the mnemonic s, which may be in the
+// generic CLASSnnn form. The mnemonic is case-insensitive.
+func StringToClass(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	if c, ok := strClass[s]; ok {
+		return c, true
+	}
+	return genericNumber(s, "CLASS")
+}
+
+// genericNumber parses the number in the generic form prefix+number.
+func genericNumber(s, prefix string) (uint16, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
+	}
+	i, err := strconv.ParseUint(s[len(prefix):], 10, 16)
+	return uint16(i), err == nil
+}
 
 // Map of opcodes strings.
 var Str_opcode = reverseInt(Opcode_str)
@@ -137,8 +257,59 @@ var Str_opcode = reverseInt(Opcode_str)
 // Map of rcodes strings.
 var Str_rcode = reverseInt(Rcode_str)
 
-// Map of strings for each CLASS wire type.
-var Class_str = map[uint16]string{
+// Other names of rcodes, accepted by StringToRcode. BADSIG is the TSIG
+// name of BADVERS.
+var rcodeAlias = map[string]int{
+	"NOTIMP": RcodeNotImplemented,
+	"BADSIG": RcodeBadSig,
+}
+
+// RcodeToString returns the mnemonic of rcode, or RCODEnnn when it has
+// none.
+func RcodeToString(rcode int) string {
+	if s, ok := Rcode_str[rcode]; ok {
+		return s
+	}
+	return "RCODE" + strconv.Itoa(rcode)
+}
+
+// StringToRcode returns the rcode for the mnemonic s, which may be in the
+// RCODEnnn form. The mnemonic is case-insensitive.
+func StringToRcode(s string) (int, bool) {
+	s = strings.ToUpper(s)
+	if r, ok := Str_rcode[s]; ok {
+		return r, true
+	}
+	if r, ok := rcodeAlias[s]; ok {
+		return r, true
+	}
+	// Extended rcodes have 12 bits
+	r, ok := genericNumber(s, "RCODE")
+	return int(r), ok && r < 1<<12
+}
+
+// OpcodeToString returns the mnemonic of opcode, or OPCODEnnn when it has
+// none.
+func OpcodeToString(opcode int) string {
+	if s, ok := Opcode_str[opcode]; ok {
+		return s
+	}
+	return "OPCODE" + strconv.Itoa(opcode)
+}
+
+// StringToOpcode returns the opcode for the mnemonic s, which may be in
+// the OPCODEnnn form. The mnemonic is case-insensitive.
+func StringToOpcode(s string) (int, bool) {
+	s = strings.ToUpper(s)
+	if o, ok := Str_opcode[s]; ok {
+		return o, true
+	}
+	o, ok := genericNumber(s, "OPCODE")
+	return int(o), ok && o < 1<<4
+}
+
+// The mnemonics of the classes; use ClassToString and StringToClass.
+var classStr = map[uint16]string{
 	ClassINET:   "IN",
 	ClassCSNET:  "CS",
 	ClassCHAOS:  "CH",
@@ -169,6 +340,14 @@ var Rcode_str = map[int]string{
 	RcodeNXRrset:        "NXRRSET",
 	RcodeNotAuth:        "NOTAUTH",
 	RcodeNotZone:        "NOTZONE",
+	RcodeBadVers:        "BADVERS", // Also BADSIG
+	RcodeBadKey:         "BADKEY",
+	RcodeBadTime:        "BADTIME",
+	RcodeBadMode:        "BADMODE",
+	RcodeBadName:        "BADNAME",
+	RcodeBadAlg:         "BADALG",
+	RcodeBadTrunc:       "BADTRUNC",
+	RcodeBadCookie:      "BADCOOKIE",
 }
 
 // Rather than write the usual handful of routines to pack and
@@ -379,6 +558,29 @@ func packStructValue(val reflect.Value, msg []byte, off int, compression map[str
 					copy(msg[off:off+len(string(h))], h)
 					off += len(string(h))
 				}
+			case "txt":
+				// Strings longer than 255 octets are split in several
+				// character-strings
+				for j := 0; j < fv.Len(); j++ {
+					s := fv.Index(j).String()
+					for {
+						n := len(s)
+						if n > 255 {
+							n = 255
+						}
+						if off+1+n > lenmsg {
+							println("dns: overflow packing txt string")
+							return lenmsg, false
+						}
+						msg[off] = byte(n)
+						off++
+						copy(msg[off:off+n], s[:n])
+						off += n
+						if s = s[n:]; s == "" {
+							break
+						}
+					}
+				}
 			case "A":
 				// It must be a slice of 4, even if it is 16, we encode
 				// only the first 4
@@ -418,6 +620,26 @@ func packStructValue(val reflect.Value, msg []byte, off int, compression map[str
 					msg[off] = byte(fv.Index(j).Uint())
 					off++
 				}
+			case "WKS":
+				// The port bitmap, up to the octet of the highest port
+				n := 0
+				for j := 0; j < fv.Len(); j++ {
+					if p := int(fv.Index(j).Uint()); p/8+1 > n {
+						n = p/8 + 1
+					}
+				}
+				if off+n > lenmsg {
+					println("dns: overflow packing WKS")
+					return lenmsg, false
+				}
+				for j := 0; j < n; j++ {
+					msg[off+j] = 0
+				}
+				for j := 0; j < fv.Len(); j++ {
+					p := int(fv.Index(j).Uint())
+					msg[off+p/8] |= 0x80 >> uint(p%8)
+				}
+				off += n
 			case "NSEC": // NSEC/NSEC3
 				// This is the uint16 type bitmap
                                 if val.Field(i).Len() == 0 {
@@ -494,6 +716,19 @@ func packStructValue(val reflect.Value, msg []byte, off int, compression map[str
 			msg[off+3] = byte(i)
 			off += 4
 		case reflect.Uint64:
+			if val.Type().Field(i).Tag == "uint64" {
+				// A full 64 bit value (ILNP)
+				if off+8 > lenmsg {
+					println("dns: overflow packing uint64")
+					return lenmsg, false
+				}
+				i := fv.Uint()
+				for j := 0; j < 8; j++ {
+					msg[off+j] = byte(i >> uint(56-8*j))
+				}
+				off += 8
+				break
+			}
 			// Only used in TSIG, where it stops at 48 bits, so we discard the upper 16
 			if off+6 > lenmsg {
 				println("dns: overflow packing uint64")
@@ -522,6 +757,38 @@ func packStructValue(val reflect.Value, msg []byte, off int, compression map[str
 				}
 				copy(msg[off:off+len(b64)], b64)
 				off += len(b64)
+			case "gateway":
+				// IPSECKEY and AMTRELAY: the format depends on the
+				// gateway type, which comes before it
+				switch gatewayType(val) {
+				case 0:
+					// No gateway
+				case 1:
+					ip := net.ParseIP(s).To4()
+					if ip == nil || off+net.IPv4len > lenmsg {
+						println("dns: failure packing gateway")
+						return lenmsg, false
+					}
+					copy(msg[off:], ip)
+					off += net.IPv4len
+				case 2:
+					ip := net.ParseIP(s)
+					if ip == nil || off+net.IPv6len > lenmsg {
+						println("dns: failure packing gateway")
+						return lenmsg, false
+					}
+					copy(msg[off:], ip.To16())
+					off += net.IPv6len
+				case 3:
+					off, ok = PackDomainName(s, msg, off, compression, false)
+					if !ok {
+						println("dns: overflow packing gateway", off)
+						return lenmsg, false
+					}
+				default:
+					println("dns: unknown gateway type")
+					return lenmsg, false
+				}
 			case "domain-name":
 				fallthrough // No compression
 			case "cdomain-name":
@@ -568,9 +835,11 @@ func packStructValue(val reflect.Value, msg []byte, off int, compression map[str
 				// length of string. String is RAW (not encoded in hex, nor base64)
 				copy(msg[off:off+len(s)], s)
 				off += len(s)
-			case "txt":
-				// Counted string: 1 byte length, but the string may be longer
-				// than 255, in that case it should be multiple strings, for now:
+			case "optional":
+				// Counted string that is left out when empty
+				if s == "" {
+					break
+				}
 				fallthrough
 			case "":
 				// Counted string: 1 byte length.
@@ -607,6 +876,7 @@ func packStructCompress(any interface{}, msg []byte, off int, compression map[st
 // Unpack a reflect.StructValue from msg.
 // Same restrictions as packStructValue.
 func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok bool) {
+	rdend := len(msg) // end of the rdata, set after the header is unpacked
 	for i := 0; i < val.NumField(); i++ {
 		//		f := val.Type().Field(i)
 		lenmsg := len(msg)
@@ -619,6 +889,24 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 			default:
                                 println("dns: unknown tag unpacking struct")
 				return lenmsg, false
+			case "txt":
+				// One or more character-strings, up to the end of the rdata
+				end := rdend
+				if end > lenmsg {
+					println("dns: overflow unpacking txt")
+					return lenmsg, false
+				}
+				var txt []string
+				for off < end {
+					n := int(msg[off])
+					if off+1+n > end {
+						println("dns: failure unpacking txt string")
+						return lenmsg, false
+					}
+					txt = append(txt, string(msg[off+1:off+1+n]))
+					off += 1 + n
+				}
+				fv.Set(reflect.ValueOf(txt))
 			case "A":
 				if off+net.IPv4len > len(msg) {
 					println("dns: overflow unpacking A")
@@ -636,21 +924,41 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 					msg[off+11], msg[off+12], msg[off+13], msg[off+14], msg[off+15]}))
 				off += net.IPv6len
 			case "OPT": // EDNS
-				if off+2 > lenmsg {
-					// This is an ENDNS0 (OPT Record) with no rdata
-					// We can savely return here.
-					break
-				}
-				opt := make([]Option, 1)
-				opt[0].Code, off = unpackUint16(msg, off)
-				optlen, off1 := unpackUint16(msg, off)
-				if off1+int(optlen) > lenmsg {
+				// An OPT RR may have no rdata at all, or several options
+				end := off + int(val.FieldByName("Hdr").FieldByName("Rdlength").Uint())
+				if end > lenmsg {
 					println("dns: overflow unpacking OPT")
 					return lenmsg, false
 				}
-				opt[0].Data = hex.EncodeToString(msg[off1 : off1+int(optlen)])
+				var opt []Option
+				for off+4 <= end {
+					var code, optlen uint16
+					code, off = unpackUint16(msg, off)
+					optlen, off = unpackUint16(msg, off)
+					if off+int(optlen) > end {
+						println("dns: overflow unpacking OPT")
+						return lenmsg, false
+					}
+					opt = append(opt, Option{code, hex.EncodeToString(msg[off : off+int(optlen)])})
+					off += int(optlen)
+				}
 				fv.Set(reflect.ValueOf(opt))
-				off = off1 + int(optlen)
+			case "WKS":
+				// Rest of the rdata is the port bitmap
+				if rdend > lenmsg {
+					println("dns: overflow unpacking WKS")
+					return lenmsg, false
+				}
+				var ports []uint16
+				for j := 0; off+j < rdend; j++ {
+					for bit := 0; bit < 8; bit++ {
+						if msg[off+j]&(0x80>>uint(bit)) != 0 {
+							ports = append(ports, uint16(j*8+bit))
+						}
+					}
+				}
+				off = rdend
+				fv.Set(reflect.ValueOf(ports))
 			case "NSEC": // NSEC/NSEC3
 				// Rest of the Record is the type bitmap
 				rdlength := int(val.FieldByName("Hdr").FieldByName("Rdlength").Uint())
@@ -723,6 +1031,9 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 			}
 		case reflect.Struct:
 			off, ok = unpackStructValue(fv, msg, off)
+			if val.Type().Field(i).Name == "Hdr" {
+				rdend = off + int(fv.FieldByName("Rdlength").Uint())
+			}
 		case reflect.Uint8:
 			if off+1 > lenmsg {
 				println("dns: overflow unpacking uint8")
@@ -746,6 +1057,20 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 			fv.SetUint(uint64(uint32(msg[off])<<24 | uint32(msg[off+1])<<16 | uint32(msg[off+2])<<8 | uint32(msg[off+3])))
 			off += 4
 		case reflect.Uint64:
+			if val.Type().Field(i).Tag == "uint64" {
+				// A full 64 bit value (ILNP)
+				if off+8 > lenmsg {
+					println("dns: overflow unpacking uint64")
+					return lenmsg, false
+				}
+				var i uint64
+				for j := 0; j < 8; j++ {
+					i = i<<8 | uint64(msg[off+j])
+				}
+				fv.SetUint(i)
+				off += 8
+				break
+			}
 			// This is *only* used in TSIG where the last 48 bits are occupied
 			// So for now, assume a uint48 (6 bytes)
 			if off+6 > lenmsg {
@@ -777,7 +1102,7 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 				default:
 					consumed = 0 // return len(msg), false?
 				}
-				if off+rdlength-consumed > lenmsg {
+				if consumed > rdlength || off+rdlength-consumed > rdend {
                                         println("dns: overflow when unpacking hex string")
 					return lenmsg, false
 				}
@@ -789,9 +1114,11 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 				// Need to know how much of rdlength is already consumed, in this packet
 				var consumed int
 				switch val.Type().Name() {
-				case "RR_DNSKEY":
+				case "RR_DNSKEY", "RR_KEY":
 					consumed = 4 // Flags(2) + Protocol(1) + Algorithm(1)
-				case "RR_RRSIG":
+				case "RR_IPSECKEY":
+					consumed = rdlength - (rdend - off) // the gateway has a variable length
+				case "RR_RRSIG", "RR_SIG":
 					consumed = 18 // TypeCovered(2) + Algorithm(1) + Labels(1) +
 					// OrigTTL(4) + SigExpir(4) + SigIncep(4) + KeyTag(2) + len(signername)
 					// Should already be set in the sequence of parsing (comes before)
@@ -800,6 +1127,10 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 				default:
 					consumed = 0 // TODO
 				}
+				if consumed > rdlength || off+rdlength-consumed > rdend {
+					println("dns: overflow when unpacking base64 string")
+					return lenmsg, false
+				}
 				s = unpackBase64(msg[off : off+rdlength-consumed])
 				off += rdlength - consumed
 			case "cdomain-name":
@@ -810,6 +1141,34 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 					println("dns: failure unpacking domain-name")
 					return lenmsg, false
 				}
+			case "gateway":
+				switch gatewayType(val) {
+				case 0:
+					s = "."
+				case 1:
+					if off+net.IPv4len > rdend {
+						println("dns: overflow unpacking gateway")
+						return lenmsg, false
+					}
+					s = net.IP(msg[off : off+net.IPv4len]).String()
+					off += net.IPv4len
+				case 2:
+					if off+net.IPv6len > rdend {
+						println("dns: overflow unpacking gateway")
+						return lenmsg, false
+					}
+					s = net.IP(msg[off : off+net.IPv6len]).String()
+					off += net.IPv6len
+				case 3:
+					s, off, ok = UnpackDomainName(msg, off)
+					if !ok {
+						println("dns: failure unpacking gateway")
+						return lenmsg, false
+					}
+				default:
+					println("dns: unknown gateway type")
+					return lenmsg, false
+				}
 			case "size-base32":
 				var size int
 				switch val.Type().Name() {
@@ -855,24 +1214,12 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 				}
 				s = hex.EncodeToString(msg[off : off+size])
 				off += size
-			case "txt":
-				// 1 or multiple txt pieces
-				rdlength := int(val.FieldByName("Hdr").FieldByName("Rdlength").Uint())
-			Txt:
-				if off >= lenmsg || off+1+int(msg[off]) > lenmsg {
-					println("dns: failure unpacking txt string")
-					return lenmsg, false
-				}
-				n := int(msg[off])
-				off++
-				for i := 0; i < n; i++ {
-					s += string(msg[off+i])
-				}
-				off += n
-				if off < rdlength {
-					// More to come
-					goto Txt
+			case "optional":
+				// Counted string that may be absent at the end of the rdata
+				if off >= rdend {
+					break
 				}
+				fallthrough
 			case "":
 				if off >= lenmsg || off+1+int(msg[off]) > lenmsg {
 					println("dns: failure unpacking string")
@@ -891,6 +1238,16 @@ func unpackStructValue(val reflect.Value, msg []byte, off int) (off1 int, ok boo
 	return off, true
 }
 
+// gatewayType returns the type of the "gateway" field of an IPSECKEY or
+// AMTRELAY RR: 0 none, 1 an IPv4 address, 2 an IPv6 address or 3 a
+// domain name.
+func gatewayType(val reflect.Value) uint8 {
+	if val.Type().Name() == "RR_AMTRELAY" {
+		return uint8(val.FieldByName("RelayType").Uint()) & 0x7f
+	}
+	return uint8(val.FieldByName("GatewayType").Uint())
+}
+
 // Helper function for unpacking
 func unpackUint16(msg []byte, off int) (v uint16, off1 int) {
 	v = uint16(msg[off])<<8 | uint16(msg[off+1])
@@ -949,6 +1306,9 @@ func packRR(rr RR, msg []byte, off int, compression map[string]int, compress boo
 		return len(msg), false
 	}
 
+	if off1, ok, fast := packRRFast(rr, msg, off, compression, compress); fast {
+		return off1, ok
+	}
 	off1, ok = packStructCompress(rr, msg, off, compression, compress)
 	if !ok {
 		return len(msg), false
@@ -957,8 +1317,101 @@ func packRR(rr RR, msg []byte, off int, compression map[string]int, compress boo
 	return off1, true
 }
 
+// packRRFast packs the most common types of answers without reflection.
+// It returns fast == false when rr is not one of those types, or when its
+// rdata is unusual; packRR then uses the reflection based packer, which
+// gives the same result.
+func packRRFast(rr RR, msg []byte, off int, compression map[string]int, compress bool) (off1 int, ok bool, fast bool) {
+	lenmsg := len(msg)
+	var h *RR_Header
+	switch x := rr.(type) {
+	case *RR_A:
+		if len(x.A) != net.IPv4len && len(x.A) != net.IPv6len {
+			return lenmsg, false, false
+		}
+		h = &x.Hdr
+	case *RR_AAAA:
+		if len(x.AAAA) != net.IPv6len {
+			return lenmsg, false, false
+		}
+		h = &x.Hdr
+	case *RR_NS:
+		h = &x.Hdr
+	case *RR_CNAME:
+		h = &x.Hdr
+	case *RR_MX:
+		h = &x.Hdr
+	case *RR_TXT:
+		h = &x.Hdr
+	default:
+		return lenmsg, false, false
+	}
+	if off, ok = PackDomainName(h.Name, msg, off, compression, compress); !ok || off+10 > lenmsg {
+		return lenmsg, false, true
+	}
+	msg[off], msg[off+1] = packUint16(h.Rrtype)
+	msg[off+2], msg[off+3] = packUint16(h.Class)
+	msg[off+4], msg[off+5] = packUint16(uint16(h.Ttl >> 16))
+	msg[off+6], msg[off+7] = packUint16(uint16(h.Ttl))
+	off += 10
+	rdstart := off
+	switch x := rr.(type) {
+	case *RR_A:
+		if off+net.IPv4len > lenmsg {
+			return lenmsg, false, true
+		}
+		copy(msg[off:], x.A[len(x.A)-net.IPv4len:])
+		off += net.IPv4len
+	case *RR_AAAA:
+		if off+net.IPv6len > lenmsg {
+			return lenmsg, false, true
+		}
+		copy(msg[off:], x.AAAA)
+		off += net.IPv6len
+	case *RR_NS:
+		off, ok = PackDomainName(x.Ns, msg, off, compression, compress)
+	case *RR_CNAME:
+		off, ok = PackDomainName(x.Cname, msg, off, compression, compress)
+	case *RR_MX:
+		if off+2 > lenmsg {
+			return lenmsg, false, true
+		}
+		msg[off], msg[off+1] = packUint16(x.Pref)
+		off, ok = PackDomainName(x.Mx, msg, off+2, compression, compress)
+	case *RR_TXT:
+		for _, s := range x.Txt {
+			// Strings longer than 255 octets are split
+			for {
+				n := len(s)
+				if n > 255 {
+					n = 255
+				}
+				if off+1+n > lenmsg {
+					return lenmsg, false, true
+				}
+				msg[off] = byte(n)
+				copy(msg[off+1:], s[:n])
+				off += 1 + n
+				if s = s[n:]; s == "" {
+					break
+				}
+			}
+		}
+	}
+	if !ok {
+		return lenmsg, false, true
+	}
+	msg[rdstart-2], msg[rdstart-1] = packUint16(uint16(off - rdstart))
+	return off, true, true
+}
+
 // Resource record unpacker.
 func unpackRR(msg []byte, off int) (rr RR, off1 int, ok bool) {
+	return unpackRRArena(msg, off, nil)
+}
+
+// unpackRRArena unpacks an RR, allocated from a when it is not nil.
+func unpackRRArena(msg []byte, off int, a *RRArena) (rr RR, off1 int, ok bool) {
 	// unpack just the header, to find the rr type and length
 	var h RR_Header
 	off0 := off
@@ -966,14 +1419,20 @@ func unpackRR(msg []byte, off int) (rr RR, off1 int, ok bool) {
 		return nil, len(msg), false
 	}
 	end := off + int(h.Rdlength)
+	if end > len(msg) {
+		return &h, len(msg), false
+	}
 	// make an rr of that type and re-unpack.
-	mk, known := rr_mk[h.Rrtype]
-	if !known {
-		rr = new(RR_RFC3597)
-	} else {
+	if a != nil {
+		rr = a.New(h.Rrtype)
+	} else if mk, known := rr_mk[h.Rrtype]; known {
 		rr = mk()
+	} else {
+		rr = new(RR_RFC3597)
+	}
+	if off, ok = unpackStruct(rr, msg, off0); !ok {
+		return &h, end, false
 	}
-	off, ok = unpackStruct(rr, msg, off0)
 	if off != end {
 		return &h, end, true
 	}
@@ -989,6 +1448,14 @@ func reverseInt16(m map[uint16]string) map[string]uint16 {
 	return n
 }
 
+func copyInt16(m map[uint16]string) map[uint16]string {
+	n := make(map[uint16]string, len(m))
+	for u, s := range m {
+		n[u] = s
+	}
+	return n
+}
+
 func reverseInt(m map[int]string) map[string]int {
 	n := make(map[string]int)
 	for u, s := range m {
@@ -1007,71 +1474,355 @@ func (h *MsgHdr) String() string {
 		return "<nil> MsgHdr"
 	}
 
-	s := ";; opcode: " + Opcode_str[h.Opcode]
-	s += ", status: " + Rcode_str[h.Rcode]
+	s := ";; opcode: " + OpcodeToString(h.Opcode)
+	s += ", status: " + RcodeToString(h.Rcode)
 	s += ", id: " + strconv.Itoa(int(h.Id)) + "\n"
 
 	s += ";; flags:"
-	if h.Response {
-		s += " qr"
+	if f := h.Flags(); f != "" {
+		s += " " + f
+	}
+	s += ";"
+	return s
+}
+
+// ParseMsgHdr parses a header as printed by MsgHdr.String, which are also
+// the first two lines of Msg.String, back into a MsgHdr:
+//
+//	;; opcode: QUERY, status: NOERROR, id: 48404
+//	;; flags: qr aa rd ra;
+func ParseMsgHdr(s string) (*MsgHdr, error) {
+	h := new(MsgHdr)
+	seen := 0
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, ";"))
+		switch {
+		case strings.HasPrefix(line, "opcode:"):
+			for _, f := range strings.Split(line, ",") {
+				kv := strings.SplitN(f, ":", 2)
+				if len(kv) != 2 {
+					return nil, &Error{Err: "bad header", Name: line}
+				}
+				v, ok := strings.TrimSpace(kv[1]), false
+				switch strings.TrimSpace(kv[0]) {
+				case "opcode":
+					h.Opcode, ok = StringToOpcode(v)
+				case "status":
+					h.Rcode, ok = StringToRcode(v)
+				case "id":
+					id, err := strconv.ParseUint(v, 10, 16)
+					h.Id, ok = uint16(id), err == nil
+				}
+				if !ok {
+					return nil, &Error{Err: "bad header", Name: line}
+				}
+			}
+			seen++
+		case strings.HasPrefix(line, "flags:"):
+			// Msg.String adds the section counts after the flags
+			f := strings.SplitN(line[len("flags:"):], ";", 2)[0]
+			if err := h.SetFlagsFromString(f); err != nil {
+				return nil, err
+			}
+			seen++
+		}
+	}
+	if seen != 2 {
+		return nil, &Error{Err: "bad header", Name: s}
+	}
+	return h, nil
+}
+
+// The flags in the order of the header, with their mnemonics.
+var msgFlags = []struct {
+	name string
+	flag func(h *MsgHdr) *bool
+}{
+	{"qr", func(h *MsgHdr) *bool { return &h.Response }},
+	{"aa", func(h *MsgHdr) *bool { return &h.Authoritative }},
+	{"tc", func(h *MsgHdr) *bool { return &h.Truncated }},
+	{"rd", func(h *MsgHdr) *bool { return &h.RecursionDesired }},
+	{"ra", func(h *MsgHdr) *bool { return &h.RecursionAvailable }},
+	{"z", func(h *MsgHdr) *bool { return &h.Zero }},
+	{"ad", func(h *MsgHdr) *bool { return &h.AuthenticatedData }},
+	{"cd", func(h *MsgHdr) *bool { return &h.CheckingDisabled }},
+}
+
+// Flags returns the flags that are set in h as a list of mnemonics, as
+// dig shows them: "qr aa rd ra".
+func (h *MsgHdr) Flags() string {
+	var f []string
+	for _, x := range msgFlags {
+		if *x.flag(h) {
+			f = append(f, x.name)
+		}
+	}
+	return strings.Join(f, " ")
+}
+
+// SetFlagsFromString sets the flags of h from the list s, as returned by
+// Flags. The mnemonics are case-insensitive and may be separated by spaces
+// or commas. The flags that are not in s are cleared; h is left unchanged
+// when s holds an unknown flag.
+func (h *MsgHdr) SetFlagsFromString(s string) error {
+	set := make(map[string]bool)
+	for _, f := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+		known := false
+		for _, x := range msgFlags {
+			known = known || x.name == f
+		}
+		if !known {
+			return &Error{Err: "unknown flag", Name: f}
+		}
+		set[f] = true
 	}
-	if h.Authoritative {
-		s += " aa"
+	for _, x := range msgFlags {
+		*x.flag(h) = set[x.name]
 	}
-	if h.Truncated {
-		s += " tc"
+	return nil
+}
+
+// Validate checks the message for the most common mistakes before it
+// is packed: names that are not fully qualified or too long, an empty question
+// section, an OPT RR outside of the additional section, a TSIG RR that is
+// not the last RR and character strings that are longer than 255 octets.
+// It returns nil when nothing is wrong, otherwise an *Error describing the
+// problem.
+func (dns *Msg) Validate() error {
+	if len(dns.Question) == 0 {
+		return &Error{Err: "no question section"}
 	}
-	if h.RecursionDesired {
-		s += " rd"
+	for _, q := range dns.Question {
+		if err := validateName(q.Name); err != nil {
+			return err
+		}
+	}
+	sections := [][]RR{dns.Answer, dns.Ns, dns.Extra}
+	for i, section := range sections {
+		for j, r := range section {
+			if r == nil {
+				return &Error{Err: "nil RR in message"}
+			}
+			h := r.Header()
+			switch h.Rrtype {
+			case TypeOPT:
+				if i != 2 {
+					return &Error{Err: "OPT RR not in additional section", Name: h.Name}
+				}
+			case TypeTSIG:
+				if i != 2 || j != len(section)-1 {
+					return &Error{Err: "TSIG RR not last RR in additional section", Name: h.Name}
+				}
+			}
+			if err := validateName(h.Name); err != nil {
+				return err
+			}
+			if err := validateRdata(structValue(r), h.Name); err != nil {
+				return err
+			}
+		}
 	}
-	if h.RecursionAvailable {
-		s += " ra"
+	return nil
+}
+
+// validateName checks if s is fully qualified, if each label is at most
+// 63 octets and the entire name is not longer than 255 octets (in wire format).
+func validateName(s string) error {
+	if !IsFqdn(s) {
+		return &Error{Err: "name is not fully qualified", Name: s}
 	}
-	if h.Zero { // Hmm
-		s += " z"
+	if s == "." {
+		return nil
 	}
-	if h.AuthenticatedData {
-		s += " ad"
+	wirelen := 1 // the root label
+	label := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			// \DDD or \X, an escaped character counts as one
+			if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+				i += 3
+			} else {
+				i++
+			}
+			label++
+		case '.':
+			if label == 0 {
+				return &Error{Err: "empty label in name", Name: s}
+			}
+			if label > 63 {
+				return &Error{Err: "label longer than 63 octets", Name: s}
+			}
+			wirelen += label + 1
+			label = 0
+		default:
+			label++
+		}
 	}
-	if h.CheckingDisabled {
-		s += " cd"
+	if wirelen > 255 {
+		return &Error{Err: "name longer than 255 octets", Name: s}
 	}
+	return nil
+}
 
-	s += ";"
-	return s
+// validateRdata walks the rdata fields of an RR and checks the
+// domain names and the character strings.
+func validateRdata(val reflect.Value, name string) error {
+	for i := 0; i < val.NumField(); i++ {
+		fv := val.Field(i)
+		switch fv.Kind() {
+		case reflect.Struct:
+			if val.Type().Field(i).Name == "Hdr" {
+				continue
+			}
+			if err := validateRdata(fv, name); err != nil {
+				return err
+			}
+		case reflect.String:
+			switch val.Type().Field(i).Tag {
+			case "domain-name", "cdomain-name":
+				if fv.String() == "" {
+					// Empty rdata in dynamic updates
+					continue
+				}
+				if err := validateName(fv.String()); err != nil {
+					return err
+				}
+			case "", "optional":
+				if len(fv.String()) > 255 {
+					return &Error{Err: "character string longer than 255 octets", Name: name}
+				}
+			}
+		case reflect.Slice:
+			if val.Type().Field(i).Tag == "txt" && txtLen(fv.Interface().([]string)) > 0xFFFF {
+				return &Error{Err: "TXT rdata longer than 65535 octets", Name: name}
+			}
+		}
+	}
+	return nil
+}
+
+// fqdnNames checks if all the domain names in the message are fully
+// qualified, ErrFqdn is returned when a name is found that isn't.
+func (dns *Msg) fqdnNames() error {
+	for i := 0; i < len(dns.Question); i++ {
+		if !fqdnName(dns.Question[i].Name) {
+			return ErrFqdn
+		}
+	}
+	for _, section := range [][]RR{dns.Answer, dns.Ns, dns.Extra} {
+		for _, r := range section {
+			if r == nil {
+				continue
+			}
+			if err := fqdnRR(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fqdnRR checks the names of r. Like packRRFast it handles the most
+// common types without reflection.
+func fqdnRR(r RR) error {
+	ok := true
+	switch x := r.(type) {
+	case *RR_A:
+		ok = fqdnName(x.Hdr.Name)
+	case *RR_AAAA:
+		ok = fqdnName(x.Hdr.Name)
+	case *RR_NS:
+		ok = fqdnName(x.Hdr.Name) && fqdnName(x.Ns)
+	case *RR_CNAME:
+		ok = fqdnName(x.Hdr.Name) && fqdnName(x.Cname)
+	case *RR_MX:
+		ok = fqdnName(x.Hdr.Name) && fqdnName(x.Mx)
+	case *RR_TXT:
+		ok = fqdnName(x.Hdr.Name)
+	default:
+		return fqdnValue(structValue(r))
+	}
+	if !ok {
+		return ErrFqdn
+	}
+	return nil
+}
+
+// fqdnName returns true if s is fully qualified, or empty: the empty name
+// is the root.
+func fqdnName(s string) bool {
+	return s == "" || IsFqdn(s)
 }
 
-// Pack a msg: convert it to wire format.
-func (dns *Msg) Pack() (msg []byte, ok bool) {
+func fqdnValue(val reflect.Value) error {
+	for i := 0; i < val.NumField(); i++ {
+		fv := val.Field(i)
+		switch fv.Kind() {
+		case reflect.Struct:
+			if err := fqdnValue(fv); err != nil {
+				return err
+			}
+		case reflect.String:
+			switch val.Type().Field(i).Tag {
+			case "domain-name", "cdomain-name":
+				if !fqdnName(fv.String()) {
+					return ErrFqdn
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Pack a msg: convert it to wire format. If the message contains
+// names that are not fully qualified ErrFqdn is returned, unless
+// AutoFqdn is set, then those names are packed as if they were fully
+// qualified. The message itself is not changed.
+func (dns *Msg) Pack() (msg []byte, err error) {
+	return dns.PackBuffer(nil)
+}
+
+// PackBuffer packs a Msg, using buf as the buffer when it is large
+// enough. This allows the caller to reuse a buffer when packing
+// many messages.
+func (dns *Msg) PackBuffer(buf []byte) (msg []byte, err error) {
 	var dh Header
 	compression := make(map[string]int) // Compression pointer mappings
+	// PackDomainName qualifies the names, so with AutoFqdn there is
+	// nothing to check
+	if !dns.AutoFqdn {
+		if err = dns.fqdnNames(); err != nil {
+			return nil, err
+		}
+	}
 
 	// Convert convenient Msg into wire-like Header.
 	dh.Id = dns.Id
 	dh.Bits = uint16(dns.Opcode)<<11 | uint16(dns.Rcode)
 	if dns.Response {
-		dh.Bits |= _QR
+		dh.Bits |= FlagQR
 	}
 	if dns.Authoritative {
-		dh.Bits |= _AA
+		dh.Bits |= FlagAA
 	}
 	if dns.Truncated {
-		dh.Bits |= _TC
+		dh.Bits |= FlagTC
 	}
 	if dns.RecursionDesired {
-		dh.Bits |= _RD
+		dh.Bits |= FlagRD
 	}
 	if dns.RecursionAvailable {
-		dh.Bits |= _RA
+		dh.Bits |= FlagRA
 	}
 	if dns.Zero {
-		dh.Bits |= _Z
+		dh.Bits |= FlagZ
 	}
 	if dns.AuthenticatedData {
-		dh.Bits |= _AD
+		dh.Bits |= FlagAD
 	}
 	if dns.CheckingDisabled {
-		dh.Bits |= _CD
+		dh.Bits |= FlagCD
 	}
 
 	// Prepare variable sized arrays.
@@ -1086,73 +1837,120 @@ func (dns *Msg) Pack() (msg []byte, ok bool) {
 	dh.Arcount = uint16(len(extra))
 
 	// TODO: still a little too much, but better than 64K...
-	msg = make([]byte, dns.Len()*2)
+	if l := dns.Len() * 2; len(buf) < l {
+		msg = make([]byte, l)
+	} else {
+		// Packing NSEC bitmaps ors bits into the buffer
+		msg = buf
+		for i := range msg[:l] {
+			msg[i] = 0
+		}
+	}
 
 	// Pack it in: header and then the pieces.
-	off := 0
-	off, ok = packStructCompress(&dh, msg, off, compression, dns.Compress)
-	for i := 0; i < len(question); i++ {
-		off, ok = packStructCompress(&question[i], msg, off, compression, dns.Compress)
+	// The header and the questions are packed without reflection, as
+	// packRRFast does for the RRs.
+	if len(msg) < 12 {
+		return nil, ErrPack
 	}
-	for i := 0; i < len(answer); i++ {
-		off, ok = packRR(answer[i], msg, off, compression, dns.Compress)
+	for i, v := range []uint16{dh.Id, dh.Bits, dh.Qdcount, dh.Ancount, dh.Nscount, dh.Arcount} {
+		msg[2*i], msg[2*i+1] = packUint16(v)
 	}
-	for i := 0; i < len(ns); i++ {
-		off, ok = packRR(ns[i], msg, off, compression, dns.Compress)
+	off := 12
+	var ok bool
+	for i := 0; i < len(question); i++ {
+		if off, ok = PackDomainName(question[i].Name, msg, off, compression, dns.Compress); !ok || off+4 > len(msg) {
+			return nil, ErrPack
+		}
+		msg[off], msg[off+1] = packUint16(question[i].Qtype)
+		msg[off+2], msg[off+3] = packUint16(question[i].Qclass)
+		off += 4
 	}
-	for i := 0; i < len(extra); i++ {
-		off, ok = packRR(extra[i], msg, off, compression, dns.Compress)
+	for _, section := range [][]RR{answer, ns, extra} {
+		for i := 0; i < len(section); i++ {
+			if off, ok = packRR(section[i], msg, off, compression, dns.Compress); !ok {
+				return nil, ErrRdata
+			}
+		}
 	}
-	if !ok {
-		return nil, false
+	return msg[:off], nil
+}
+
+// Unpack a binary message to a Msg structure. When msg is too short
+// to hold the header ErrShortRead is returned. A resource record that
+// cannot be unpacked results in ErrRdata, or in ErrTruncated when the
+// message has the TC bit set.
+func (dns *Msg) Unpack(msg []byte) error {
+	off, err := dns.unpack(msg)
+	if err != nil {
+		return err
 	}
-	return msg[:off], true
+	if off != len(msg) {
+		// TODO(mg) remove eventually
+		println("extra bytes in dns packet", off, "<", len(msg))
+	}
+	return nil
 }
 
-// Unpack a binary message to a Msg structure.
-func (dns *Msg) Unpack(msg []byte) bool {
+// unpack unpacks msg and returns the offset of the first byte following
+// the message.
+func (dns *Msg) unpack(msg []byte) (int, error) {
 	// Header.
 	var dh Header
 	off := 0
 	var ok bool
 	if off, ok = unpackStruct(&dh, msg, off); !ok {
-		return false
+		return off, ErrShortRead
 	}
 	dns.Id = dh.Id
-	dns.Response = (dh.Bits & _QR) != 0
+	dns.Response = (dh.Bits & FlagQR) != 0
 	dns.Opcode = int(dh.Bits>>11) & 0xF
-	dns.Authoritative = (dh.Bits & _AA) != 0
-	dns.Truncated = (dh.Bits & _TC) != 0
-	dns.RecursionDesired = (dh.Bits & _RD) != 0
-	dns.RecursionAvailable = (dh.Bits & _RA) != 0
+	dns.Authoritative = (dh.Bits & FlagAA) != 0
+	dns.Truncated = (dh.Bits & FlagTC) != 0
+	dns.RecursionDesired = (dh.Bits & FlagRD) != 0
+	dns.RecursionAvailable = (dh.Bits & FlagRA) != 0
+	dns.Zero = (dh.Bits & FlagZ) != 0
+	dns.AuthenticatedData = (dh.Bits & FlagAD) != 0
+	dns.CheckingDisabled = (dh.Bits & FlagCD) != 0
 	dns.Rcode = int(dh.Bits & 0xF)
 
 	// Arrays.
-	dns.Question = make([]Question, dh.Qdcount)
-	dns.Answer = make([]RR, dh.Ancount)
-	dns.Ns = make([]RR, dh.Nscount)
-	dns.Extra = make([]RR, dh.Arcount)
-
-	for i := 0; i < len(dns.Question); i++ {
-		off, ok = unpackStruct(&dns.Question[i], msg, off)
-	}
-	for i := 0; i < len(dns.Answer); i++ {
-		dns.Answer[i], off, ok = unpackRR(msg, off)
+	if dns.arena != nil && cap(dns.Question) >= int(dh.Qdcount) {
+		// A pooled message, reuse the arrays
+		dns.Question = dns.Question[:dh.Qdcount]
+	} else {
+		dns.Question = make([]Question, dh.Qdcount)
 	}
-	for i := 0; i < len(dns.Ns); i++ {
-		dns.Ns[i], off, ok = unpackRR(msg, off)
+	dns.Answer = dns.rrs(dns.Answer, dh.Ancount)
+	dns.Ns = dns.rrs(dns.Ns, dh.Nscount)
+	dns.Extra = dns.rrs(dns.Extra, dh.Arcount)
+
+	// A failure from here on is likely caused by a truncated message
+	failed := ErrRdata
+	if dns.Truncated {
+		failed = ErrTruncated
 	}
-	for i := 0; i < len(dns.Extra); i++ {
-		dns.Extra[i], off, ok = unpackRR(msg, off)
+	for i := 0; i < len(dns.Question); i++ {
+		if off, ok = unpackStruct(&dns.Question[i], msg, off); !ok {
+			return off, failed
+		}
 	}
-	if !ok {
-		return false
+	for _, section := range [][]RR{dns.Answer, dns.Ns, dns.Extra} {
+		for i := 0; i < len(section); i++ {
+			if section[i], off, ok = unpackRRArena(msg, off, dns.arena); !ok {
+				return off, failed
+			}
+		}
 	}
-	if off != len(msg) {
-		// TODO(mg) remove eventually
-		println("extra bytes in dns packet", off, "<", len(msg))
+	return off, nil
+}
+
+// rrs returns a section of n RRs, reusing s for pooled messages.
+func (dns *Msg) rrs(s []RR, n uint16) []RR {
+	if dns.arena != nil && cap(s) >= int(n) {
+		return s[:n]
 	}
-	return true
+	return make([]RR, n)
 }
 
 // Convert a complete message to a string with dig-like output.
@@ -1165,6 +1963,14 @@ func (dns *Msg) String() string {
 	s += "ANSWER: " + strconv.Itoa(len(dns.Answer)) + ", "
 	s += "AUTHORITY: " + strconv.Itoa(len(dns.Ns)) + ", "
 	s += "ADDITIONAL: " + strconv.Itoa(len(dns.Extra)) + "\n"
+	// As dig, the OPT RR is shown before the question, not in the additional section
+	var opt *RR_OPT
+	for _, r := range dns.Extra {
+		if o, ok := r.(*RR_OPT); ok && opt == nil {
+			opt = o
+			s += "\n" + o.String() + "\n"
+		}
+	}
 	if len(dns.Question) > 0 {
 		s += "\n;; QUESTION SECTION:\n"
 		for i := 0; i < len(dns.Question); i++ {
@@ -1187,10 +1993,10 @@ func (dns *Msg) String() string {
 			}
 		}
 	}
-	if len(dns.Extra) > 0 {
+	if len(dns.Extra) > 0 && (opt == nil || len(dns.Extra) > 1) {
 		s += "\n;; ADDITIONAL SECTION:\n"
 		for i := 0; i < len(dns.Extra); i++ {
-			if dns.Extra[i] != nil {
+			if dns.Extra[i] != nil && dns.Extra[i] != RR(opt) {
 				s += dns.Extra[i].String() + "\n"
 			}
 		}
@@ -1198,7 +2004,8 @@ func (dns *Msg) String() string {
 	return s
 }
 
-// Len return the message length when in uncompressed wire format.
+// Len return the message length when in uncompressed wire format. It is
+// computed from the RRs, the message is not packed.
 func (dns *Msg) Len() int {
 	// Message header is always 12 bytes       
 	l := 12
@@ -1226,10 +2033,16 @@ func (dns *Msg) Len() int {
 }
 
 // CompressedLen returns the length of the message when in 
-// compressed wire format.
+// compressed wire format. Unlike Len it packs the message, with
+// compression, so it is exact; 0 is returned when packing fails.
 func (dns *Msg) CompressedLen() int {
-	// Uhh. TODO
-	return 0
+	c := *dns
+	c.Compress = true
+	buf, err := c.Pack()
+	if err != nil {
+		return 0
+	}
+	return len(buf)
 }
 
 // Id return a 16 bits random number to be used as a
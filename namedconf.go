@@ -0,0 +1,341 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Read the zones from a BIND named.conf file.
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A NamedZone is a zone statement from a named.conf(5) file.
+type NamedZone struct {
+	Name    string   // the name of the zone, fully qualified
+	Class   uint16   // ClassINET when the statement has none
+	View    string   // the view the zone is in, empty if none
+	Type    string   // "master", "slave", "forward", ...; primary and secondary are master and slave
+	File    string   // the file option, as written
+	Masters []string // the addresses (host:port) of the masters, or primaries, option
+}
+
+// NamedConfFromFile parses the named.conf file name, and the files it
+// includes, and returns the zones in it.
+func NamedConfFromFile(name string) ([]*NamedZone, error) {
+	stmts, err := readNamedConf(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	return namedZones(stmts)
+}
+
+// ParseNamedConf parses the named.conf file in r and returns the zones in
+// it. Only a small part of the syntax is understood: the zone statements,
+// also in view statements, with their type, file and masters options, and
+// the masters statements that name a list of masters. Everything else
+// is skipped. Include statements are not followed, see NamedConfFromFile.
+func ParseNamedConf(r io.Reader) ([]*NamedZone, error) {
+	stmts, err := parseNamedConf(r, "")
+	if err != nil {
+		return nil, err
+	}
+	return namedZones(stmts)
+}
+
+// namedStmt is a statement: its words, and the statements in its block.
+type namedStmt struct {
+	args  []string
+	block []*namedStmt
+}
+
+// readNamedConf reads the statements from the file name, the include
+// statements are replaced by the statements from the included files.
+func readNamedConf(name string, depth int) ([]*namedStmt, error) {
+	if depth > 10 {
+		return nil, &Error{Err: "named.conf: include nested too deep", Name: name}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stmts, err := parseNamedConf(f, name)
+	if err != nil {
+		return nil, err
+	}
+	var all []*namedStmt
+	for _, s := range stmts {
+		if s.args[0] != "include" || len(s.args) != 2 {
+			all = append(all, s)
+			continue
+		}
+		inc, err := readNamedConf(s.args[1], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, inc...)
+	}
+	return all, nil
+}
+
+// parseNamedConf parses the statements in r, file is used in the errors.
+func parseNamedConf(r io.Reader, file string) ([]*namedStmt, error) {
+	l := &namedLexer{r: bufio.NewReader(r), line: 1}
+	stmts, err := l.block()
+	if err != nil {
+		return nil, &Error{Err: "named.conf: " + err.Error() + " at line " + strconv.Itoa(l.line), Name: file}
+	}
+	if l.tok != "" {
+		return nil, &Error{Err: "named.conf: unexpected } at line " + strconv.Itoa(l.line), Name: file}
+	}
+	return stmts, nil
+}
+
+// namedLexer splits a named.conf file into words, quoted strings and the
+// characters {, } and ;. Comments (#, // and /* */) are skipped.
+type namedLexer struct {
+	r    *bufio.Reader
+	line int
+	tok  string // the token that ended the last block, "" at the end of the file
+}
+
+var errNamedEOF = &Error{Err: "unexpected end of file"}
+
+// next returns the next token, quoted strings are returned without the
+// quotes and with quoted set. At the end of the file it returns io.EOF.
+func (l *namedLexer) next() (tok string, quoted bool, err error) {
+	var b []byte
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			if len(b) > 0 {
+				return string(b), false, nil
+			}
+			return "", false, io.EOF
+		}
+		switch {
+		case c == '"' && len(b) == 0:
+			s, err := l.r.ReadString('"')
+			if err != nil {
+				return "", false, errNamedEOF
+			}
+			l.line += strings.Count(s, "\n")
+			return s[:len(s)-1], true, nil
+		case c == '#' || c == '/' && l.peek('/'):
+			l.r.ReadString('\n')
+			l.line++
+			if len(b) > 0 {
+				return string(b), false, nil
+			}
+		case c == '/' && l.peek('*'):
+			l.r.ReadByte()
+			for prev := byte(0); ; {
+				c, err := l.r.ReadByte()
+				if err != nil {
+					return "", false, errNamedEOF
+				}
+				if c == '\n' {
+					l.line++
+				}
+				if prev == '*' && c == '/' {
+					break
+				}
+				prev = c
+			}
+			if len(b) > 0 {
+				return string(b), false, nil
+			}
+		case c == '{' || c == '}' || c == ';':
+			if len(b) > 0 {
+				l.r.UnreadByte()
+				return string(b), false, nil
+			}
+			return string(c), false, nil
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if c == '\n' {
+				l.line++
+			}
+			if len(b) > 0 {
+				return string(b), false, nil
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+}
+
+// peek returns true if the next byte is c.
+func (l *namedLexer) peek(c byte) bool {
+	p, err := l.r.Peek(1)
+	return err == nil && p[0] == c
+}
+
+// block reads statements up to the } that ends the block, or up to the
+// end of the file. The token that ended the block is left in l.tok.
+func (l *namedLexer) block() ([]*namedStmt, error) {
+	var (
+		stmts []*namedStmt
+		s     = new(namedStmt)
+	)
+	for {
+		tok, quoted, err := l.next()
+		if err == io.EOF {
+			if len(s.args) > 0 {
+				return nil, errNamedEOF
+			}
+			l.tok = ""
+			return stmts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case quoted:
+			s.args = append(s.args, tok)
+		case tok == "{":
+			if s.block, err = l.block(); err != nil {
+				return nil, err
+			}
+			if l.tok != "}" {
+				return nil, errNamedEOF
+			}
+		case tok == "}":
+			if len(s.args) > 0 {
+				return nil, &Error{Err: "missing ;"}
+			}
+			l.tok = "}"
+			return stmts, nil
+		case tok == ";":
+			if len(s.args) > 0 {
+				stmts = append(stmts, s)
+			}
+			s = new(namedStmt)
+		default:
+			if s.block != nil {
+				return nil, &Error{Err: "missing ;"}
+			}
+			s.args = append(s.args, tok)
+		}
+	}
+}
+
+// namedZones returns the zones in the statements.
+func namedZones(stmts []*namedStmt) ([]*NamedZone, error) {
+	// The named lists of masters
+	lists := make(map[string]*namedStmt)
+	for _, s := range stmts {
+		if len(s.args) >= 2 && s.args[1] != "port" && (s.args[0] == "masters" || s.args[0] == "primaries") {
+			lists[s.args[1]] = s
+		}
+	}
+	var zones []*NamedZone
+	add := func(s *namedStmt, view string) error {
+		z, err := namedZone(s, lists)
+		if err != nil {
+			return err
+		}
+		z.View = view
+		zones = append(zones, z)
+		return nil
+	}
+	for _, s := range stmts {
+		switch {
+		case s.args[0] == "zone":
+			if err := add(s, ""); err != nil {
+				return nil, err
+			}
+		case s.args[0] == "view" && len(s.args) > 1:
+			for _, v := range s.block {
+				if len(v.args) > 0 && v.args[0] == "zone" {
+					if err := add(v, s.args[1]); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return zones, nil
+}
+
+// namedZone returns the zone of the zone statement s.
+func namedZone(s *namedStmt, lists map[string]*namedStmt) (*NamedZone, error) {
+	if len(s.args) < 2 || len(s.args) > 3 {
+		return nil, &Error{Err: "named.conf: bad zone statement", Name: strings.Join(s.args, " ")}
+	}
+	z := &NamedZone{Name: Fqdn(s.args[1]), Class: ClassINET}
+	if len(s.args) == 3 {
+		c, ok := StringToClass(s.args[2])
+		if !ok {
+			return nil, &Error{Err: "named.conf: bad class in zone statement", Name: s.args[2]}
+		}
+		z.Class = c
+	}
+	for _, o := range s.block {
+		if len(o.args) < 1 {
+			continue
+		}
+		switch o.args[0] {
+		case "type":
+			if len(o.args) == 2 {
+				z.Type = strings.ToLower(o.args[1])
+			}
+			switch z.Type {
+			case "primary":
+				z.Type = "master"
+			case "secondary":
+				z.Type = "slave"
+			}
+		case "file":
+			if len(o.args) == 2 {
+				z.File = o.args[1]
+			}
+		case "masters", "primaries":
+			z.Masters = namedMasters(o, lists, 0)
+		}
+	}
+	return z, nil
+}
+
+// namedMasters returns the addresses in the masters option or statement
+// s, with the lists it names expanded.
+func namedMasters(s *namedStmt, lists map[string]*namedStmt, depth int) []string {
+	port := "53"
+	if i := namedIndex(s.args, "port"); i > 0 && i+1 < len(s.args) {
+		port = s.args[i+1]
+	}
+	var addrs []string
+	for _, m := range s.block {
+		if len(m.args) == 0 {
+			continue
+		}
+		if net.ParseIP(m.args[0]) == nil {
+			// A named list
+			if l, ok := lists[m.args[0]]; ok && depth < 10 {
+				addrs = append(addrs, namedMasters(l, lists, depth+1)...)
+			}
+			continue
+		}
+		p := port
+		if i := namedIndex(m.args, "port"); i > 0 && i+1 < len(m.args) {
+			p = m.args[i+1]
+		}
+		addrs = append(addrs, net.JoinHostPort(m.args[0], p))
+	}
+	return addrs
+}
+
+// namedIndex returns the index of word in args, or -1.
+func namedIndex(args []string, word string) int {
+	for i, a := range args {
+		if a == word {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const namedConf = `
+options {
+	directory "/var/named"; // the zone files
+	allow-transfer { none; };
+};
+
+/* The masters
+   of the slave zones */
+masters "upstream" port 5353 { 192.0.2.1; 2001:db8::1 port 53; };
+
+zone "miek.nl" {
+	type primary;
+	file "miek.nl.zone";
+	allow-update { key "update."; };
+};
+
+# Reverse
+zone "2.0.192.in-addr.arpa" IN {
+	type slave;
+	file "slaves/192.0.2";
+	masters { upstream; 198.51.100.1 key "axfr."; };
+};
+
+view "inside" {
+	match-clients { 10/8; };
+	zone "." { type hint; file "root.hints"; };
+};
+`
+
+func TestParseNamedConf(t *testing.T) {
+	zones, err := ParseNamedConf(strings.NewReader(namedConf))
+	if err != nil || len(zones) != 3 {
+		t.Logf("Expected 3 zones, got %d: %v", len(zones), err)
+		t.Fail()
+		return
+	}
+	if z := zones[0]; z.Name != "miek.nl." || z.Type != "master" || z.File != "miek.nl.zone" || z.View != "" || len(z.Masters) != 0 {
+		t.Logf("Wrong first zone: %+v", z)
+		t.Fail()
+	}
+	z := zones[1]
+	if z.Name != "2.0.192.in-addr.arpa." || z.Class != ClassINET || z.Type != "slave" || z.File != "slaves/192.0.2" {
+		t.Logf("Wrong second zone: %+v", z)
+		t.Fail()
+	}
+	if m := strings.Join(z.Masters, " "); m != "192.0.2.1:5353 [2001:db8::1]:53 198.51.100.1:53" {
+		t.Logf("Wrong masters: %s", m)
+		t.Fail()
+	}
+	if z := zones[2]; z.Name != "." || z.Type != "hint" || z.View != "inside" {
+		t.Logf("Wrong zone in the view: %+v", z)
+		t.Fail()
+	}
+	for _, s := range []string{`zone "miek.nl" { type master; }`, `zone "miek.nl" { type master };`, `zone "miek.nl" { file "x`, `};`, `zone "miek.nl" XX { };`} {
+		if _, err := ParseNamedConf(strings.NewReader(s)); err == nil {
+			t.Logf("%q should not parse", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestNamedConfFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "named")
+	if err != nil {
+		t.Logf("Failed to create a file: %s", err)
+		t.Fail()
+		return
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(namedConf)
+	f.Close()
+	conf := strings.NewReader(`include "` + f.Name() + `"; zone "example.org" { type master; file "example.org"; };`)
+	g, _ := ioutil.TempFile("", "named")
+	defer os.Remove(g.Name())
+	conf.WriteTo(g)
+	g.Close()
+	zones, err := NamedConfFromFile(g.Name())
+	if err != nil || len(zones) != 4 || zones[3].Name != "example.org." {
+		t.Logf("Expected 4 zones with the included file, got %d: %v", len(zones), err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Conversion between RRs and the types of the net package.
+
+import (
+	"net"
+)
+
+// NetIP returns the addresses of the A and AAAA records in rrs, the
+// other RRs are skipped.
+func NetIP(rrs []RR) []net.IP {
+	var ips []net.IP
+	for _, rr := range rrs {
+		switch x := rr.(type) {
+		case *RR_A:
+			ips = append(ips, x.A)
+		case *RR_AAAA:
+			ips = append(ips, x.AAAA)
+		}
+	}
+	return ips
+}
+
+// NetMX returns the MX records in rrs as net.MX values. Like the net
+// package, the hosts are fully qualified.
+func NetMX(rrs []RR) []*net.MX {
+	var mx []*net.MX
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_MX); ok {
+			mx = append(mx, &net.MX{Host: x.Mx, Pref: x.Pref})
+		}
+	}
+	return mx
+}
+
+// NetNS returns the NS records in rrs as net.NS values.
+func NetNS(rrs []RR) []*net.NS {
+	var ns []*net.NS
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_NS); ok {
+			ns = append(ns, &net.NS{Host: x.Ns})
+		}
+	}
+	return ns
+}
+
+// NetSRV returns the SRV records in rrs as net.SRV values.
+func NetSRV(rrs []RR) []*net.SRV {
+	var srv []*net.SRV
+	for _, rr := range rrs {
+		if x, ok := rr.(*RR_SRV); ok {
+			srv = append(srv, &net.SRV{Target: x.Target, Port: x.Port, Priority: x.Priority, Weight: x.Weight})
+		}
+	}
+	return srv
+}
+
+// RRsFromIP returns an A record, or an AAAA record for an IPv6 address,
+// for each address in ips. The RRs have owner name name, which is made
+// fully qualified, and TTL ttl.
+func RRsFromIP(name string, ttl uint32, ips []net.IP) []RR {
+	rrs := make([]RR, 0, len(ips))
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			rrs = append(rrs, &RR_A{Hdr: netHdr(name, TypeA, ttl), A: ip4})
+			continue
+		}
+		rrs = append(rrs, &RR_AAAA{Hdr: netHdr(name, TypeAAAA, ttl), AAAA: ip})
+	}
+	return rrs
+}
+
+// RRsFromMX returns the MX records for mx, see RRsFromIP.
+func RRsFromMX(name string, ttl uint32, mx []*net.MX) []RR {
+	rrs := make([]RR, 0, len(mx))
+	for _, m := range mx {
+		rrs = append(rrs, &RR_MX{Hdr: netHdr(name, TypeMX, ttl), Pref: m.Pref, Mx: Fqdn(m.Host)})
+	}
+	return rrs
+}
+
+// RRsFromNS returns the NS records for ns, see RRsFromIP.
+func RRsFromNS(name string, ttl uint32, ns []*net.NS) []RR {
+	rrs := make([]RR, 0, len(ns))
+	for _, n := range ns {
+		rrs = append(rrs, &RR_NS{Hdr: netHdr(name, TypeNS, ttl), Ns: Fqdn(n.Host)})
+	}
+	return rrs
+}
+
+// RRsFromSRV returns the SRV records for srv, see RRsFromIP.
+func RRsFromSRV(name string, ttl uint32, srv []*net.SRV) []RR {
+	rrs := make([]RR, 0, len(srv))
+	for _, s := range srv {
+		rrs = append(rrs, &RR_SRV{Hdr: netHdr(name, TypeSRV, ttl),
+			Priority: s.Priority, Weight: s.Weight, Port: s.Port, Target: Fqdn(s.Target)})
+	}
+	return rrs
+}
+
+// netHdr returns the header for the RRs of RRsFromIP and friends.
+func netHdr(name string, t uint16, ttl uint32) RR_Header {
+	return RR_Header{Name: Fqdn(name), Rrtype: t, Class: ClassINET, Ttl: ttl}
+}
@@ -0,0 +1,36 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetConv(t *testing.T) {
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.ParseIP("2001:db8::1")}
+	rrs := RRsFromIP("miek.nl", 300, ips)
+	if len(rrs) != 2 || rrs[0].Header().Rrtype != TypeA || rrs[1].Header().Rrtype != TypeAAAA || rrs[0].Header().Name != "miek.nl." {
+		t.Logf("Wrong RRs for %v: %v", ips, rrs)
+		t.Fail()
+	}
+	back := NetIP(rrs)
+	if len(back) != 2 || !back[0].Equal(ips[0]) || !back[1].Equal(ips[1]) {
+		t.Logf("Expected %v, got %v", ips, back)
+		t.Fail()
+	}
+
+	mx := NetMX(RRsFromMX("miek.nl.", 300, []*net.MX{{Host: "mx.miek.nl", Pref: 10}}))
+	if len(mx) != 1 || mx[0].Host != "mx.miek.nl." || mx[0].Pref != 10 {
+		t.Logf("Wrong MX round trip: %v", mx)
+		t.Fail()
+	}
+	ns := NetNS(RRsFromNS("miek.nl.", 300, []*net.NS{{Host: "ns.miek.nl."}}))
+	if len(ns) != 1 || ns[0].Host != "ns.miek.nl." {
+		t.Logf("Wrong NS round trip: %v", ns)
+		t.Fail()
+	}
+	srv := NetSRV(RRsFromSRV("_sip._udp.miek.nl.", 300, []*net.SRV{{Target: "sip.miek.nl.", Port: 5060, Priority: 1, Weight: 2}}))
+	if len(srv) != 1 || *srv[0] != (net.SRV{Target: "sip.miek.nl.", Port: 5060, Priority: 1, Weight: 2}) {
+		t.Logf("Wrong SRV round trip: %v", srv)
+		t.Fail()
+	}
+}
@@ -11,8 +11,26 @@ const (
 	_ = iota
 	NSEC3_NXDOMAIN
 	NSEC3_NODATA
+	NSEC3_INSECURE
 )
 
+// NSEC3 records with more iterations or a longer salt (in bytes) than these
+// limits are not used to prove a denial of existence, the answer is treated as
+// insecure instead, see RFC 9276. This prevents a zone from making a validator
+// burn CPU on hashing.
+var (
+	Nsec3MaxIterations uint16 = 100
+	Nsec3MaxSaltLen    int    = 32
+)
+
+// An Nsec3Result is the result of an NSEC3 denial of existence check.
+type Nsec3Result struct {
+	Denial            int    // NSEC3_NXDOMAIN, NSEC3_NODATA, NSEC3_INSECURE or 0
+	ClosestEncloser   string // the closest encloser found
+	NextCloser        string // the next closer name
+	SourceOfSynthesis string // the wildcard at the closest encloser
+}
+
 type saltWireFmt struct {
 	Salt string "size-hex"
 }
@@ -96,15 +114,26 @@ func (m *Msg) NsecVerify(q Question) error {
 }
 
 // Nsec3Verify verifies an denial of existence response with NSEC3s.
-// This function does not validate the NSEC3s.
+// This function does not validate the NSEC3s. It returns NSEC3_NXDOMAIN or
+// NSEC3_NODATA for a correct denial, and NSEC3_INSECURE when the NSEC3s
+// exceed Nsec3MaxIterations or Nsec3MaxSaltLen, see Nsec3Check.
 func (m *Msg) Nsec3Verify(q Question) (int, error) {
+	r, err := m.Nsec3Check(q)
+	if err != nil {
+		return 0, err
+	}
+	return r.Denial, nil
+}
+
+// Nsec3Check is like Nsec3Verify, but returns the names it computed, so
+// the proof can be explained. On error the result holds the names that were
+// found so far.
+func (m *Msg) Nsec3Check(q Question) (*Nsec3Result, error) {
 	var (
 		nsec3    []*RR_NSEC3
 		ncdenied = false // next closer denied
 		sodenied = false // source of synthesis denied
-		ce       = ""    // closest encloser
-		nc       = ""    // next closer
-		so       = ""    // source of synthesis
+		r        = new(Nsec3Result)
 	)
 	if len(m.Answer) > 0 && len(m.Ns) > 0 {
 		// Wildcard expansion
@@ -125,7 +154,14 @@ func (m *Msg) Nsec3Verify(q Question) (int, error) {
 			}
 		}
 		if len(nsec3) == 0 {
-			return 0, ErrDenialNsec3
+			return r, ErrDenialNsec3
+		}
+		// Check the limits before hashing anything
+		for _, nsec := range nsec3 {
+			if nsec.Iterations > Nsec3MaxIterations || len(nsec.Salt)/2 > Nsec3MaxSaltLen {
+				r.Denial = NSEC3_INSECURE
+				return r, nil
+			}
 		}
 
 		lastchopped := ""
@@ -137,19 +173,19 @@ func (m *Msg) Nsec3Verify(q Question) (int, error) {
 			for i := len(labels) - 1; i >= 0; i-- {
 				candidate = labels[i] + "." + candidate
 				if nsec.Match(candidate) {
-					ce = candidate
+					r.ClosestEncloser = candidate
 				}
 				lastchopped = labels[i]
 			}
 		}
-		if ce == "" { // what about root label?
-			return 0, ErrDenialCe
+		if r.ClosestEncloser == "" { // what about root label?
+			return r, ErrDenialCe
 		}
-		nc = lastchopped + "." + ce
-		so = "*." + ce
+		r.NextCloser = lastchopped + "." + r.ClosestEncloser
+		r.SourceOfSynthesis = "*." + r.ClosestEncloser
 		// Check if the next closer is covered and thus denied
 		for _, nsec := range nsec3 {
-			if nsec.Cover(nc) {
+			if nsec.Cover(r.NextCloser) {
 				ncdenied = true
 				break
 			}
@@ -157,7 +193,7 @@ func (m *Msg) Nsec3Verify(q Question) (int, error) {
 		if !ncdenied {
 			if m.MsgHdr.Rcode == RcodeNameError {
 				// For NXDOMAIN this is a problem
-				return 0, ErrDenialNc // add next closer name here
+				return r, ErrDenialNc
 			}
 			// For NODATA we need to to check if the matching nsec3 has to correct type bit map
 			goto NoData
@@ -165,28 +201,30 @@ func (m *Msg) Nsec3Verify(q Question) (int, error) {
 
 		// Check if the source of synthesis is covered and thus denied
 		for _, nsec := range nsec3 {
-			if nsec.Cover(so) {
+			if nsec.Cover(r.SourceOfSynthesis) {
 				sodenied = true
 				break
 			}
 		}
 		if !sodenied {
-			return 0, ErrDenialSo
+			return r, ErrDenialSo
 		}
-		return NSEC3_NXDOMAIN, nil
+		r.Denial = NSEC3_NXDOMAIN
+		return r, nil
 	}
-	return 0, nil
+	return r, nil
 NoData:
 	// The closest encloser MUST be the query name
 	for _, nsec := range nsec3 {
-		if nsec.Match(nc) {
+		if nsec.Match(r.NextCloser) {
 			// This nsec3 must NOT have the type bitmap set of the qtype. If it does have it, return an error
 			for _, t := range nsec.TypeBitMap {
 				if t == q.Qtype {
-					return 0, ErrDenialBit
+					return r, ErrDenialBit
 				}
 			}
 		}
 	}
-	return NSEC3_NODATA, nil
+	r.Denial = NSEC3_NODATA
+	return r, nil
 }
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -17,3 +18,42 @@ func TestPackNsec3(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestNsec3Check(t *testing.T) {
+	apex := new(RR_NSEC3)
+	apex.Hdr = RR_Header{Name: HashName("example.", SHA1, 1, "AB") + ".example.", Rrtype: TypeNSEC3, Class: ClassINET, Ttl: 3600}
+	apex.Hash = SHA1
+	apex.Iterations = 1
+	apex.Salt = "AB"
+	apex.NextDomain = "00000000000000000000000000000001"
+	all := new(RR_NSEC3)
+	*all = *apex
+	all.Hdr.Name = "00000000000000000000000000000000.example."
+	all.NextDomain = "VVVVVVVVVVVVVVVVVVVVVVVVVVVVVVVV"
+
+	m := new(Msg)
+	m.SetQuestion("a.example.", TypeA)
+	m.Rcode = RcodeNameError
+	m.Ns = []RR{apex, all}
+	r, err := m.Nsec3Check(m.Question[0])
+	if err != nil || r.Denial != NSEC3_NXDOMAIN {
+		t.Logf("Expected NXDOMAIN proof: %d %v", r.Denial, err)
+		t.Fail()
+	}
+	if r.ClosestEncloser != "example." || r.NextCloser != "a.example." {
+		t.Logf("Wrong closest encloser or next closer: %s %s", r.ClosestEncloser, r.NextCloser)
+		t.Fail()
+	}
+
+	all.Iterations = Nsec3MaxIterations + 1
+	if w, err := m.Nsec3Verify(m.Question[0]); err != nil || w != NSEC3_INSECURE {
+		t.Logf("Too many iterations should be insecure: %d %v", w, err)
+		t.Fail()
+	}
+	all.Iterations = 1
+	all.Salt = strings.Repeat("AB", Nsec3MaxSaltLen+1)
+	if w, err := m.Nsec3Verify(m.Question[0]); err != nil || w != NSEC3_INSECURE {
+		t.Logf("Long salt should be insecure: %d %v", w, err)
+		t.Fail()
+	}
+}
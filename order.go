@@ -0,0 +1,147 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Ordering the RRs of an RRset, for load distribution.
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// RotateRRset returns a copy of rrs in which each RRset (the RRs with the
+// same owner name, class and type) is rotated n positions to the left.
+// An RRset only takes the positions it had in rrs, so a CNAME in front of
+// the address records stays in front. A server that increments n for each
+// reply hands out the addresses of a name round-robin.
+func RotateRRset(rrs []RR, n int) []RR {
+	out := make([]RR, len(rrs))
+	for _, idx := range rrsetIndices(rrs) {
+		l := len(idx)
+		for i, j := range idx {
+			out[j] = rrs[idx[((i+n)%l+l)%l]]
+		}
+	}
+	return out
+}
+
+// SortByPreference returns a copy of rrs in which the MX, SRV and NAPTR
+// RRsets are put in the order in which they should be tried. MX records
+// are ordered by preference and NAPTR records by order and preference. SRV
+// records are ordered by priority, the records with the same priority are
+// ordered randomly, weighted by their weight as described in RFC 2782.
+// The other RRs are not moved.
+func SortByPreference(rrs []RR) []RR {
+	out := make([]RR, len(rrs))
+	copy(out, rrs)
+	for _, idx := range rrsetIndices(rrs) {
+		switch rrs[idx[0]].Header().Rrtype {
+		case TypeMX, TypeSRV, TypeNAPTR:
+		default:
+			continue
+		}
+		set := make(byPreference, len(idx))
+		for i, j := range idx {
+			set[i] = rrs[j]
+		}
+		sort.Stable(set)
+		if set[0].Header().Rrtype == TypeSRV {
+			weightedShuffle(set)
+		}
+		for i, j := range idx {
+			out[j] = set[i]
+		}
+	}
+	return out
+}
+
+// rrsetIndices returns the indices in rrs of the RRs of each RRset, in
+// the order the RRsets first appear.
+func rrsetIndices(rrs []RR) [][]int {
+	type key struct {
+		name         string
+		class, rtype uint16
+	}
+	seen := make(map[key]int)
+	var sets [][]int
+	for i, r := range rrs {
+		h := r.Header()
+		k := key{strings.ToLower(h.Name), h.Class, h.Rrtype}
+		j, ok := seen[k]
+		if !ok {
+			j = len(sets)
+			seen[k] = j
+			sets = append(sets, nil)
+		}
+		sets[j] = append(sets[j], i)
+	}
+	return sets
+}
+
+// byPreference sorts an MX, SRV or NAPTR RRset.
+type byPreference []RR
+
+func (p byPreference) Len() int      { return len(p) }
+func (p byPreference) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byPreference) Less(i, j int) bool {
+	switch a := p[i].(type) {
+	case *RR_MX:
+		return a.Pref < p[j].(*RR_MX).Pref
+	case *RR_SRV:
+		return a.Priority < p[j].(*RR_SRV).Priority
+	case *RR_NAPTR:
+		b := p[j].(*RR_NAPTR)
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return a.Preference < b.Preference
+	}
+	return false
+}
+
+// weightedShuffle orders the SRV records with the same priority in set,
+// which is sorted by priority, with the selection algorithm of RFC 2782.
+func weightedShuffle(set []RR) {
+	weight := func(i int) int { return int(set[i].(*RR_SRV).Weight) }
+	for start := 0; start < len(set); {
+		end := start
+		for end < len(set) && set[end].(*RR_SRV).Priority == set[start].(*RR_SRV).Priority {
+			end++
+		}
+		// The records with weight 0 go first
+		run := make([]RR, 0, end-start)
+		for i := start; i < end; i++ {
+			if weight(i) == 0 {
+				run = append(run, set[i])
+			}
+		}
+		for i := start; i < end; i++ {
+			if weight(i) != 0 {
+				run = append(run, set[i])
+			}
+		}
+		copy(set[start:end], run)
+		for i := start; i < end-1; i++ {
+			sum := 0
+			for j := i; j < end; j++ {
+				sum += weight(j)
+			}
+			n, running, pick := rand.Intn(sum+1), 0, i
+			for j := i; j < end; j++ {
+				running += weight(j)
+				if running >= n {
+					pick = j
+					break
+				}
+			}
+			// Move the pick to position i, keeping the order of the rest
+			r := set[pick]
+			copy(set[i+1:pick+1], set[i:pick])
+			set[i] = r
+		}
+		start = end
+	}
+}
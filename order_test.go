@@ -0,0 +1,85 @@
+package dns
+
+import (
+	"testing"
+)
+
+func newRRs(s ...string) []RR {
+	rrs := make([]RR, len(s))
+	for i, x := range s {
+		rrs[i], _ = NewRR(x)
+	}
+	return rrs
+}
+
+func TestRotateRRset(t *testing.T) {
+	rrs := newRRs("www.miek.nl. IN CNAME a.miek.nl.",
+		"a.miek.nl. IN A 127.0.0.1", "a.miek.nl. IN A 127.0.0.2", "a.miek.nl. IN A 127.0.0.3",
+		"a.miek.nl. IN AAAA ::1", "a.miek.nl. IN AAAA ::2")
+	tests := []struct {
+		n     int
+		first string
+		aaaa  string
+	}{
+		{0, "127.0.0.1", "::1"},
+		{1, "127.0.0.2", "::2"},
+		{2, "127.0.0.3", "::1"},
+		{3, "127.0.0.1", "::2"},
+		{-1, "127.0.0.3", "::2"},
+	}
+	for _, x := range tests {
+		r := RotateRRset(rrs, x.n)
+		if r[0].Header().Rrtype != TypeCNAME {
+			t.Logf("Rotate %d: CNAME should stay first", x.n)
+			t.Fail()
+		}
+		if r[1].(*RR_A).A.String() != x.first || r[4].(*RR_AAAA).AAAA.String() != x.aaaa {
+			t.Logf("Rotate %d: wrong order %v", x.n, r)
+			t.Fail()
+		}
+	}
+	if rrs[1].(*RR_A).A.String() != "127.0.0.1" {
+		t.Log("RotateRRset should not change its argument")
+		t.Fail()
+	}
+}
+
+func TestSortByPreference(t *testing.T) {
+	rrs := SortByPreference(newRRs("miek.nl. IN MX 20 mx2.miek.nl.", "miek.nl. IN NS ns.miek.nl.",
+		"miek.nl. IN MX 10 mx1.miek.nl.", "miek.nl. IN MX 30 mx3.miek.nl."))
+	if rrs[0].(*RR_MX).Pref != 10 || rrs[2].(*RR_MX).Pref != 20 || rrs[3].(*RR_MX).Pref != 30 {
+		t.Logf("MX records not sorted: %v", rrs)
+		t.Fail()
+	}
+	naptr := func(order, pref uint16) RR {
+		return &RR_NAPTR{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeNAPTR, Class: ClassINET}, Order: order, Preference: pref}
+	}
+	rrs = SortByPreference([]RR{naptr(100, 20), naptr(100, 10), naptr(50, 50)})
+	if rrs[0].(*RR_NAPTR).Order != 50 || rrs[1].(*RR_NAPTR).Preference != 10 {
+		t.Logf("NAPTR records not sorted: %v", rrs)
+		t.Fail()
+	}
+
+	srv := func(prio, weight uint16, target string) RR {
+		return &RR_SRV{Hdr: RR_Header{Name: "_sip._tcp.miek.nl.", Rrtype: TypeSRV, Class: ClassINET},
+			Priority: prio, Weight: weight, Port: 5060, Target: target}
+	}
+	set := []RR{srv(20, 0, "backup.miek.nl."), srv(10, 0, "zero.miek.nl."), srv(10, 100, "heavy.miek.nl.")}
+	zero := 0
+	for i := 0; i < 1000; i++ {
+		rrs := SortByPreference(set)
+		if rrs[2].(*RR_SRV).Target != "backup.miek.nl." {
+			t.Logf("SRV records not sorted by priority: %v", rrs)
+			t.Fail()
+			return
+		}
+		if rrs[0].(*RR_SRV).Target == "zero.miek.nl." {
+			zero++
+		}
+	}
+	// The chance is 1 in 101
+	if zero == 0 || zero > 50 {
+		t.Logf("SRV record with weight 0 picked first %d times out of 1000", zero)
+		t.Fail()
+	}
+}
@@ -2,7 +2,10 @@ package dns
 
 import (
 	"crypto/rsa"
+	"encoding/hex"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -101,7 +104,7 @@ z2.miek.nl.  86400   IN      NSEC    miek.nl. TXT RRSIG NSEC
 $TTL 100
 z3.miek.nl.  IN      NSEC    miek.nl. TXT RRSIG NSEC`
 	// Need to implementen owner substitution in the lexer.
-	to := ParseZone(strings.NewReader(zone), "")
+	to := ParseZone(strings.NewReader(zone), "", "")
 	i := 0
 	for x := range to {
 		if x.Error == nil {
@@ -130,6 +133,88 @@ z3.miek.nl.  IN      NSEC    miek.nl. TXT RRSIG NSEC`
 	}
 }
 
+func TestParseZoneOrigin(t *testing.T) {
+	zone := `www IN A 127.0.0.1
+miek.nl. IN MX 10 mail
+$ORIGIN sub
+a IN A 127.0.0.2
+`
+	want := []string{
+		"www.miek.nl.\t3600\tIN\tA\t127.0.0.1",
+		"miek.nl.\t3600\tIN\tMX\t10 mail.miek.nl.",
+		"a.sub.miek.nl.\t3600\tIN\tA\t127.0.0.2",
+	}
+	i := 0
+	for x := range ParseZone(strings.NewReader(zone), "miek.nl", "") {
+		if x.Error != nil {
+			t.Logf("Failed to parse: %v", x.Error)
+			t.Fail()
+			continue
+		}
+		if i >= len(want) || x.RR.String() != want[i] {
+			t.Logf("Wrong RR %d: %s", i, x.RR.String())
+			t.Fail()
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Logf("Expected %d RRs, got %d", len(want), i)
+		t.Fail()
+	}
+}
+
+func TestParseZoneTtl(t *testing.T) {
+	zone := `a.miek.nl. IN A 127.0.0.1
+b.miek.nl. 100 IN A 127.0.0.2
+c.miek.nl. IN A 127.0.0.3
+$TTL 200
+d.miek.nl. 300 IN A 127.0.0.4
+e.miek.nl. IN A 127.0.0.5
+`
+	ttls := []uint32{DefaultTtl, 100, 100, 300, 200}
+	defttls := []uint32{DefaultTtl, 100, 100, 200, 200}
+	i := 0
+	for x := range ParseZone(strings.NewReader(zone), "", "") {
+		if x.Error != nil {
+			t.Logf("Failed to parse: %v", x.Error)
+			t.Fail()
+			continue
+		}
+		if i < len(ttls) && (x.RR.Header().Ttl != ttls[i] || x.DefaultTtl != defttls[i]) {
+			t.Logf("Wrong TTL %d: %s, default %d", i, x.RR.String(), x.DefaultTtl)
+			t.Fail()
+		}
+		i++
+	}
+}
+
+func TestParseZoneAt(t *testing.T) {
+	zone := `@ IN SOA ns @ 1 2 3 4 5
+@ IN MX 10 @
+`
+	want := []string{
+		"miek.nl.\t3600\tIN\tSOA\tns.miek.nl. miek.nl. 1 2 3 4 5",
+		"miek.nl.\t3600\tIN\tMX\t10 miek.nl.",
+	}
+	i := 0
+	for x := range ParseZone(strings.NewReader(zone), "miek.nl.", "") {
+		if x.Error != nil {
+			t.Logf("Failed to parse: %v", x.Error)
+			t.Fail()
+			continue
+		}
+		if i >= len(want) || x.RR.String() != want[i] {
+			t.Logf("Wrong RR %d: %s", i, x.RR.String())
+			t.Fail()
+		}
+		i++
+	}
+	if r, _ := NewRR("@ IN NS @"); r == nil || r.String() != ".\t3600\tIN\tNS\t." {
+		t.Logf("Failed to parse @ in the root: %v", r)
+		t.Fail()
+	}
+}
+
 func TestDomainName(t *testing.T) {
 	tests := []string{"r\\.gieben.miek.nl.", "www\\.www.miek.nl."}
 	dbuff := make([]byte, 40)
@@ -223,6 +308,106 @@ func TestParseFailure(t *testing.T) {
 	}
 }
 
+func TestParseErrorAccessors(t *testing.T) {
+	_, err := NewRR("miek.nl. IN MX a0 miek.nl.")
+	e, ok := err.(*ParseError)
+	if !ok {
+		t.Logf("Should have returned a *ParseError: %v", err)
+		t.Fail()
+		return
+	}
+	if e.Token() != "a0" || e.Line() != 1 || e.Reason() != "bad MX Pref" {
+		t.Logf("Wrong specifics in error: %s %d %s", e.Token(), e.Line(), e.Reason())
+		t.Fail()
+	}
+	if _, ok := e.Unwrap().(*strconv.NumError); !ok {
+		t.Logf("Should wrap a *strconv.NumError: %v", e.Unwrap())
+		t.Fail()
+	}
+}
+
+func TestParseErrorRecordLine(t *testing.T) {
+	zone := `miek.nl. IN A 127.0.0.1
+miek.nl. IN SOA ns.miek.nl. mail.miek.nl. (
+	2009032802
+	2160x
+	7200 604800 3600 )
+`
+	for x := range ParseZone(strings.NewReader(zone), "", "") {
+		if x.Error == nil {
+			continue
+		}
+		if x.Error.Line() != 4 || x.Error.RecordLine() != 2 || x.Error.RecordColumn() != 1 {
+			t.Logf("Wrong position in error: %v", x.Error)
+			t.Fail()
+		}
+		t.Logf("%v", x.Error)
+		return
+	}
+	t.Log("Expected an error")
+	t.Fail()
+}
+
+func TestParseZoneLimits(t *testing.T) {
+	zone := `a.miek.nl. IN A 127.0.0.1
+b.miek.nl. IN A 127.0.0.2
+c.miek.nl. IN A 127.0.0.3
+`
+	tests := []struct {
+		lim   ZoneLimits
+		limit string
+		n     int // RRs before the error
+	}{
+		{ZoneLimits{}, "", 3},
+		{ZoneLimits{MaxRecords: 3, MaxLineLength: 25, MaxBytes: int64(len(zone))}, "", 3},
+		{ZoneLimits{MaxRecords: 2}, "records", 2},
+		{ZoneLimits{MaxLineLength: 24}, "line length", 0},
+		{ZoneLimits{MaxBytes: int64(len(zone)) - 1}, "bytes", 2},
+	}
+	for _, tc := range tests {
+		n, limit := 0, ""
+		for x := range ParseZoneLimits(strings.NewReader(zone), "", "", tc.lim) {
+			if x.Error == nil {
+				n++
+				continue
+			}
+			if e, ok := x.Error.Unwrap().(*LimitError); ok {
+				limit = e.Limit
+			} else {
+				t.Logf("Failed to parse: %v", x.Error)
+				t.Fail()
+			}
+		}
+		if n != tc.n || limit != tc.limit {
+			t.Logf("%+v: expected %d RRs and limit %q, got %d and %q", tc.lim, tc.n, tc.limit, n, limit)
+			t.Fail()
+		}
+	}
+
+	// A file that includes itself
+	f, err := ioutil.TempFile("", "zone")
+	if err != nil {
+		t.Logf("Failed to create file: %s", err)
+		t.Fail()
+		return
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("a.miek.nl. IN A 127.0.0.1\n$INCLUDE " + f.Name() + "\n")
+	f.Close()
+	n, limit := 0, ""
+	for x := range ParseZoneLimits(strings.NewReader("$INCLUDE "+f.Name()+"\n"), "", "", ZoneLimits{MaxIncludeDepth: 3}) {
+		if x.Error == nil {
+			n++
+		} else if e, ok := x.Error.Unwrap().(*LimitError); ok {
+			limit = e.Limit
+		}
+	}
+	if n != 3 || limit != "include depth" {
+		t.Logf("Expected 3 RRs and the include depth limit, got %d and %q", n, limit)
+		t.Fail()
+	}
+}
+
 // A bit useless, how to use b.N?
 func BenchmarkZoneParsing(b *testing.B) {
 	f, err := os.Open("t/miek.nl.signed_test")
@@ -230,7 +415,7 @@ func BenchmarkZoneParsing(b *testing.B) {
 		return
 	}
 	defer f.Close()
-	to := ParseZone(f, "t/miek.nl.signed_test")
+	to := ParseZone(f, ".", "t/miek.nl.signed_test")
 	for x := range to {
 		x = x
 	}
@@ -243,7 +428,7 @@ func TestZoneParsing(t *testing.T) {
 	}
 	defer f.Close()
 	start := time.Now().UnixNano()
-	to := ParseZone(f, "t/miek.nl.signed_test")
+	to := ParseZone(f, ".", "t/miek.nl.signed_test")
 	var i int
 	for x := range to {
 		t.Logf("%s\n", x.RR)
@@ -291,3 +476,299 @@ func TestZoneParsingBigZone(t *testing.T) {
 	t.Logf("%d RRs parsed in %.2f s (%.2f RR/s)", i, float32(delta)/1e9, float32(i)/(float32(delta)/1e9))
 }
 */
+
+func TestParseArchaic(t *testing.T) {
+	tests := map[string]string{
+		"miek.nl. 3600 IN WKS 127.0.0.1 TCP ( 21 25 )":                             "miek.nl.\t3600\tIN\tWKS\t127.0.0.1 6 21 25",
+		"miek.nl. 3600 IN WKS 127.0.0.1 17 53":                                     "miek.nl.\t3600\tIN\tWKS\t127.0.0.1 17 53",
+		"miek.nl. 3600 IN X25 311061700956":                                        "miek.nl.\t3600\tIN\tX25\t\"311061700956\"",
+		"miek.nl. 3600 IN ISDN \"150862028003217\" 004":                            "miek.nl.\t3600\tIN\tISDN\t\"150862028003217\" \"004\"",
+		"miek.nl. 3600 IN ISDN 150862028003217":                                    "miek.nl.\t3600\tIN\tISDN\t\"150862028003217\"",
+		"miek.nl. 3600 IN RT 10 relay":                                             "miek.nl.\t3600\tIN\tRT\t10 relay.",
+		"miek.nl. 3600 IN NSAP 0x47.0005.80.005a00.0000.0001.e133.ffffff000161.00": "miek.nl.\t3600\tIN\tNSAP\t0x47000580005a0000000001e133ffffff00016100",
+		"miek.nl. 3600 IN PX 10 net2.it. PRMD-net2.ADMD-p400.C-it.":                "miek.nl.\t3600\tIN\tPX\t10 net2.it. PRMD-net2.ADMD-p400.C-it.",
+		"miek.nl. 3600 IN GPOS -32.6882 116.8652 10.0":                             "miek.nl.\t3600\tIN\tGPOS\t-32.6882 116.8652 10.0",
+	}
+	for i, o := range tests {
+		rr, err := NewRR(i)
+		if err != nil || rr.String() != o {
+			t.Logf("%s should parse to %s, got %v %v", i, o, err, rr)
+			t.Fail()
+			continue
+		}
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", rr.Header().Rrtype)
+		m.Answer = []RR{rr}
+		buf, _ := m.Pack()
+		if ok, diag := UnpackThenPack(buf); !ok {
+			t.Logf("%s does not round trip: %s", rr, diag)
+			t.Fail()
+		}
+		// The same RR in the unknown representation
+		rdata, _ := rawRdata(rr)
+		u := &RR_RFC3597{Hdr: *rr.Header(), Rdata: hex.EncodeToString(rdata)}
+		ru, err := NewRR(u.String())
+		if err != nil || !RRsEqual(rr, ru) {
+			t.Logf("%s should parse to %s, got %v %v", u, rr, err, ru)
+			t.Fail()
+		}
+	}
+	for _, s := range []string{"miek.nl. IN WKS 127.0.0.1 6 nosuchservice", "miek.nl. IN RT 10 relay extra",
+		"miek.nl. IN X25 \\# 2 0001", "miek.nl. IN RT \\# 3 000a", "miek.nl. IN NSAP 47.0005", "miek.nl. IN NSAP 0xz7",
+		"miek.nl. IN PX 10 net2.it.", "miek.nl. IN GPOS -32.6882 116.8652 high"} {
+		if _, err := NewRR(s); err == nil {
+			t.Logf("%s should not parse", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseKeySig(t *testing.T) {
+	tests := map[string]string{
+		"miek.nl. 3600 IN KEY 512 3 5 AwEAAcNEU67LJI5GEgF9QLNqLO1SMq1EdoQ6E9f85ha0k0ewQGCblyW2836GiVsm6k8Kr5ECIoMJ6fZWf3CRSQ==":                                                 "miek.nl.\t3600\tIN\tKEY\t512 3 5 AwEAAcNEU67LJI5GEgF9QLNqLO1SMq1EdoQ6E9f85ha0k0ewQGCblyW2836GiVsm6k8Kr5ECIoMJ6fZWf3CRSQ==",
+		"miek.nl. 0 ANY SIG TYPE0 5 0 0 20120201000000 20120101000000 12051 miek.nl. mQ/0eKzLqSgiUUpimSmAgKc+mP2uoaU7rRHk3GoYRqlcvK06UgqA6DmJPAfcS60pumvUeIbyZ4m8ofDU0R+1dw==":  "miek.nl.\t0\tANY\tSIG\tTYPE0 5 0 0 20120201000000 20120101000000 12051 miek.nl. mQ/0eKzLqSgiUUpimSmAgKc+mP2uoaU7rRHk3GoYRqlcvK06UgqA6DmJPAfcS60pumvUeIbyZ4m8ofDU0R+1dw==",
+		"miek.nl. 3600 IN SIG A 5 2 3600 20120201000000 20120101000000 12051 miek.nl. mQ/0eKzLqSgiUUpimSmAgKc+mP2uoaU7rRHk3GoYRqlcvK06UgqA6DmJPAfcS60pumvUeIbyZ4m8ofDU0R+1dw==": "miek.nl.\t3600\tIN\tSIG\tA 5 2 3600 20120201000000 20120101000000 12051 miek.nl. mQ/0eKzLqSgiUUpimSmAgKc+mP2uoaU7rRHk3GoYRqlcvK06UgqA6DmJPAfcS60pumvUeIbyZ4m8ofDU0R+1dw==",
+	}
+	for i, o := range tests {
+		rr, err := NewRR(i)
+		if err != nil || rr.String() != o {
+			t.Logf("%s should parse to %s, got %v %v", i, o, err, rr)
+			t.Fail()
+			continue
+		}
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeA)
+		m.Extra = []RR{rr}
+		buf, _ := m.Pack()
+		m1 := new(Msg)
+		if err := m1.Unpack(buf); err != nil || len(m1.Extra) != 1 || m1.Extra[0].String() != o {
+			t.Logf("%s does not round trip: %v %v", rr, err, m1.Extra)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseGateway(t *testing.T) {
+	key := "AQNRU3mG7TVTO2BkR47usntb102uFJtugbo6BSGvgqt4AQ=="
+	tests := map[string]string{
+		"miek.nl. 3600 IN IPSECKEY 10 0 2 . " + key:                "miek.nl.\t3600\tIN\tIPSECKEY\t10 0 2 . " + key,
+		"miek.nl. 3600 IN IPSECKEY 10 1 2 192.0.2.38 " + key:       "miek.nl.\t3600\tIN\tIPSECKEY\t10 1 2 192.0.2.38 " + key,
+		"miek.nl. 3600 IN IPSECKEY 10 2 2 2001:0DB8:0::1 " + key:   "miek.nl.\t3600\tIN\tIPSECKEY\t10 2 2 2001:db8::1 " + key,
+		"miek.nl. 3600 IN IPSECKEY 10 3 2 gw ( " + key + " )":      "miek.nl.\t3600\tIN\tIPSECKEY\t10 3 2 gw. " + key,
+		"miek.nl. 3600 IN IPSECKEY 10 1 0 192.0.2.3":               "miek.nl.\t3600\tIN\tIPSECKEY\t10 1 0 192.0.2.3 ",
+		"miek.nl. 3600 IN AMTRELAY 10 0 0 .":                       "miek.nl.\t3600\tIN\tAMTRELAY\t10 0 0 .",
+		"miek.nl. 3600 IN AMTRELAY 10 1 1 203.0.113.15":            "miek.nl.\t3600\tIN\tAMTRELAY\t10 1 1 203.0.113.15",
+		"miek.nl. 3600 IN AMTRELAY 10 0 2 2001:db8::15":            "miek.nl.\t3600\tIN\tAMTRELAY\t10 0 2 2001:db8::15",
+		"miek.nl. 3600 IN AMTRELAY 128 1 3 amtrelays.example.com.": "miek.nl.\t3600\tIN\tAMTRELAY\t128 1 3 amtrelays.example.com.",
+	}
+	for i, o := range tests {
+		rr, err := NewRR(i)
+		if err != nil || rr.String() != o {
+			t.Logf("%s should parse to %s, got %v %v", i, o, err, rr)
+			t.Fail()
+			continue
+		}
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", rr.Header().Rrtype)
+		m.Answer = []RR{rr}
+		buf, _ := m.Pack()
+		m1 := new(Msg)
+		if err := m1.Unpack(buf); err != nil || len(m1.Answer) != 1 || m1.Answer[0].String() != o {
+			t.Logf("%s does not round trip: %v %v", rr, err, m1.Answer)
+			t.Fail()
+		}
+		// The same RR in the unknown representation
+		rdata, _ := rawRdata(rr)
+		u := &RR_RFC3597{Hdr: *rr.Header(), Rdata: hex.EncodeToString(rdata)}
+		ru, err := NewRR(u.String())
+		if err != nil || !RRsEqual(rr, ru) {
+			t.Logf("%s should parse to %s, got %v %v", u, rr, err, ru)
+			t.Fail()
+		}
+	}
+	for _, s := range []string{"miek.nl. IN IPSECKEY 10 1 2 gw.miek.nl. " + key, "miek.nl. IN IPSECKEY 10 2 2 192.0.2.1",
+		"miek.nl. IN IPSECKEY 10 0 2 192.0.2.1", "miek.nl. IN AMTRELAY 10 2 1 192.0.2.1", "miek.nl. IN AMTRELAY 10 0 4 .",
+		"miek.nl. IN AMTRELAY 10 0 1 192.0.2.1 extra"} {
+		if _, err := NewRR(s); err == nil {
+			t.Logf("%s should not parse", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseNULL(t *testing.T) {
+	rr, err := NewRR("miek.nl. 3600 IN NULL \\# 5 0061626364")
+	if err != nil || rr.String() != "miek.nl.\t3600\tIN\tNULL\t\\# 5 0061626364" {
+		t.Logf("NULL should parse, got %v %v", err, rr)
+		t.Fail()
+		return
+	}
+	if n, ok := rr.(*RR_NULL); !ok || n.Data != "0061626364" {
+		t.Logf("Expected an RR_NULL, got %T", rr)
+		t.Fail()
+	}
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeNULL)
+	m.Answer = []RR{rr, &RR_NULL{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeNULL, Class: ClassINET}}}
+	buf, _ := m.Pack()
+	m1 := new(Msg)
+	if err := m1.Unpack(buf); err != nil || len(m1.Answer) != 2 || !RRsEqual(m1.Answer[0], rr) || m1.Answer[1].(*RR_NULL).Data != "" {
+		t.Logf("NULL does not round trip: %v %v", err, m1.Answer)
+		t.Fail()
+	}
+	if _, err := NewRR("miek.nl. IN NULL 0061626364"); err == nil {
+		t.Log("NULL should only parse in the unknown representation")
+		t.Fail()
+	}
+}
+
+func TestParseTXT(t *testing.T) {
+	for _, x := range []struct {
+		in  string
+		txt []string
+	}{
+		{`miek.nl. IN TXT ""`, []string{""}},
+		{`miek.nl. IN TXT "x" "" "y"`, []string{"x", "", "y"}},
+		{`miek.nl. IN TXT "say \"hi\"" "back\\slash"`, []string{`say "hi"`, `back\slash`}},
+		{`miek.nl. IN TXT "\009tab"`, []string{"\ttab"}},
+	} {
+		rr, err := NewRR(x.in)
+		if err != nil {
+			t.Logf("Failed to parse %s: %s", x.in, err)
+			t.Fail()
+			continue
+		}
+		if txt := rr.(*RR_TXT).Txt; strings.Join(txt, "|") != strings.Join(x.txt, "|") || len(txt) != len(x.txt) {
+			t.Logf("Wrong character-strings for %s: %q", x.in, txt)
+			t.Fail()
+		}
+		// The presentation format must parse to the same strings
+		if rr1, err := NewRR(rr.String()); err != nil || !RRsEqual(rr, rr1) {
+			t.Logf("TXT does not round trip through %s: %v", rr, err)
+			t.Fail()
+		}
+	}
+	if _, err := NewRR("miek.nl. IN TXT"); err == nil {
+		t.Log("TXT without character-strings should not parse")
+		t.Fail()
+	}
+}
+
+func TestParseILNP(t *testing.T) {
+	tests := map[string]string{
+		"miek.nl. 3600 IN NID 10 14:4fff:ff20:ee64":       "miek.nl.\t3600\tIN\tNID\t10 0014:4fff:ff20:ee64",
+		"miek.nl. 3600 IN L32 10 10.1.2.0":                "miek.nl.\t3600\tIN\tL32\t10 10.1.2.0",
+		"miek.nl. 3600 IN L64 20 2001:0DB8:1140:1000":     "miek.nl.\t3600\tIN\tL64\t20 2001:0db8:1140:1000",
+		"miek.nl. 3600 IN LP 10 l64-subnet1.example.com.": "miek.nl.\t3600\tIN\tLP\t10 l64-subnet1.example.com.",
+	}
+	for i, o := range tests {
+		rr, err := NewRR(i)
+		if err != nil || rr.String() != o {
+			t.Logf("%s should parse to %s, got %v %v", i, o, err, rr)
+			t.Fail()
+			continue
+		}
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", rr.Header().Rrtype)
+		m.Answer = []RR{rr}
+		buf, _ := m.Pack()
+		if ok, diag := UnpackThenPack(buf); !ok {
+			t.Logf("%s does not round trip: %s", rr, diag)
+			t.Fail()
+		}
+	}
+	rr, err := NewRR("miek.nl. IN NID \\# 10 000a 00144fffff20ee64")
+	if nid, ok := rr.(*RR_NID); err != nil || !ok || nid.NodeID != 0x00144fffff20ee64 {
+		t.Logf("Failed to parse NID in the unknown representation: %v %v", err, rr)
+		t.Fail()
+	}
+	for _, s := range []string{"miek.nl. IN NID 10 14:4fff:ff20", "miek.nl. IN L64 10 14:4fff:ff20:fffff",
+		"miek.nl. IN L32 10 ::1"} {
+		if _, err := NewRR(s); err == nil {
+			t.Logf("%s should not parse", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseGeneric(t *testing.T) {
+	tests := map[string]string{
+		"miek.nl. 3600 CLASS1 TYPE1 127.0.0.1":             "miek.nl.\t3600\tIN\tA\t127.0.0.1",
+		"miek.nl. 3600 CLASS32 TYPE1234 \\# 2 abcd":        "miek.nl.\t3600\tCLASS32\tTYPE1234\t\\# 2 abcd",
+		"miek.nl. 3600 IN type33 \\# 9 000100020003016100": "miek.nl.\t3600\tIN\tSRV\t1 2 3 a.",
+	}
+	for i, o := range tests {
+		rr, err := NewRR(i)
+		if err != nil || rr.String() != o {
+			t.Logf("%s should parse to %s, got %v %v", i, o, err, rr)
+			t.Fail()
+		}
+	}
+	if TypeToString(1234) != "TYPE1234" || ClassToString(32) != "CLASS32" || TypeToString(TypeMX) != "MX" {
+		t.Log("Wrong mnemonics")
+		t.Fail()
+	}
+	if tp, ok := StringToType("Type65535"); !ok || tp != 65535 {
+		t.Log("Failed to parse TYPE65535")
+		t.Fail()
+	}
+	for _, s := range []string{"TYPE", "TYPE65536", "TYPE-1", "CLASS1"} {
+		if _, ok := StringToType(s); ok {
+			t.Logf("%s should not be a type", s)
+			t.Fail()
+		}
+	}
+}
+
+func TestTypeMaps(t *testing.T) {
+	for tp, s := range typeStr {
+		if x, ok := StringToType(s); !ok || x != tp {
+			t.Logf("%s does not map back to %d", s, tp)
+			t.Fail()
+		}
+	}
+	// The deprecated maps are copies
+	Rr_str[TypeA] = "XXX"
+	defer func() { Rr_str[TypeA] = "A" }()
+	if TypeToString(TypeA) != "A" {
+		t.Log("Changing Rr_str should not change TypeToString")
+		t.Fail()
+	}
+	if tp, ok := StringToType("mx"); !ok || tp != TypeMX {
+		t.Log("Type mnemonics should be case-insensitive")
+		t.Fail()
+	}
+}
+
+func TestRcodeOpcodeStrings(t *testing.T) {
+	if RcodeToString(RcodeBadTime) != "BADTIME" || RcodeToString(3841) != "RCODE3841" || OpcodeToString(OpcodeNotify) != "NOTIFY" || OpcodeToString(3) != "OPCODE3" {
+		t.Log("Wrong mnemonics")
+		t.Fail()
+	}
+	for s, want := range map[string]int{"nxdomain": RcodeNameError, "NOTIMP": RcodeNotImplemented, "BADSIG": RcodeBadSig, "rcode4095": 4095} {
+		if r, ok := StringToRcode(s); !ok || r != want {
+			t.Logf("%s should parse to rcode %d, got %d", s, want, r)
+			t.Fail()
+		}
+	}
+	for rcode, s := range Rcode_str {
+		if r, ok := StringToRcode(s); !ok || r != rcode {
+			t.Logf("%s does not map back to %d", s, rcode)
+			t.Fail()
+		}
+	}
+	if o, ok := StringToOpcode("update"); !ok || o != OpcodeUpdate {
+		t.Log("Failed to parse UPDATE")
+		t.Fail()
+	}
+	for _, s := range []string{"RCODE4096", "OPCODE16", "QUERY", "TYPE1"} {
+		if _, ok := StringToRcode(s); ok {
+			t.Logf("%s should not be an rcode", s)
+			t.Fail()
+		}
+	}
+	if _, ok := StringToOpcode("OPCODE16"); ok {
+		t.Log("OPCODE16 should not be an opcode")
+		t.Fail()
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// A data source for PowerDNS, speaking its remote backend protocol.
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// A RemoteBackend answers the queries of the PowerDNS remote backend,
+// in its JSON protocol. The lookups are answered by Handler, the list
+// and getDomainMetadata methods by List and Metadata. The methods
+// initialize and lookup, list and getDomainMetadata are understood, the
+// other methods fail, so PowerDNS falls back on its defaults.
+type RemoteBackend struct {
+	Handler  Handler                          // answers the lookups, DefaultServeMux if nil
+	List     func(zone string) ([]RR, bool)   // returns all the RRs of zone, list fails if nil
+	Metadata func(zone, kind string) []string // returns the metadata of kind of zone, none if nil
+}
+
+// pdnsQuery is a query of PowerDNS.
+type pdnsQuery struct {
+	Method     string         `json:"method"`
+	Parameters pdnsParameters `json:"parameters"`
+}
+
+type pdnsParameters struct {
+	Qname    string `json:"qname"`
+	Qtype    string `json:"qtype"`
+	Remote   string `json:"remote"`
+	Zonename string `json:"zonename"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+}
+
+// pdnsRecord is a record in the result of lookup and list.
+type pdnsRecord struct {
+	Qtype   string `json:"qtype"`
+	Qname   string `json:"qname"`
+	Content string `json:"content"`
+	Ttl     uint32 `json:"ttl"`
+	Auth    bool   `json:"auth"`
+}
+
+// pdnsReply is a reply to PowerDNS, Result is false when the method
+// failed.
+type pdnsReply struct {
+	Result interface{} `json:"result"`
+	Log    []string    `json:"log,omitempty"`
+}
+
+// Serve reads the queries from rw, as PowerDNS writes them with the pipe
+// and unix connectors, and writes the replies to rw. It returns nil at
+// the end of rw.
+func (b *RemoteBackend) Serve(rw io.ReadWriter) error {
+	dec := json.NewDecoder(rw)
+	enc := json.NewEncoder(rw)
+	for {
+		var q pdnsQuery
+		if err := dec.Decode(&q); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := enc.Encode(b.reply(&q)); err != nil {
+			return err
+		}
+	}
+}
+
+// ServeHTTP answers a query posted as JSON, as PowerDNS does with the
+// http connector and post_json set.
+func (b *RemoteBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var q pdnsQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b.reply(&q))
+}
+
+// reply returns the reply to q.
+func (b *RemoteBackend) reply(q *pdnsQuery) *pdnsReply {
+	p := &q.Parameters
+	switch strings.ToLower(q.Method) {
+	case "initialize":
+		return &pdnsReply{Result: true}
+	case "lookup":
+		rrs, err := b.lookup(p.Qname, p.Qtype, p.Remote)
+		if err != nil {
+			return &pdnsReply{Result: false, Log: []string{err.Error()}}
+		}
+		return &pdnsReply{Result: pdnsRecords(rrs)}
+	case "list":
+		if b.List == nil {
+			return &pdnsReply{Result: false}
+		}
+		rrs, ok := b.List(Fqdn(strings.ToLower(p.Zonename)))
+		if !ok {
+			return &pdnsReply{Result: false, Log: []string{"no such zone: " + p.Zonename}}
+		}
+		return &pdnsReply{Result: pdnsRecords(rrs)}
+	case "getdomainmetadata":
+		var md []string
+		if b.Metadata != nil {
+			md = b.Metadata(Fqdn(strings.ToLower(p.Name)), p.Kind)
+		}
+		if md == nil {
+			md = []string{}
+		}
+		return &pdnsReply{Result: md}
+	}
+	return &pdnsReply{Result: false, Log: []string{"method not implemented: " + q.Method}}
+}
+
+// lookup asks the handler of b for the RRs of type qtype, which is ANY
+// for all types, of name. The RRs in the answer and the NS records in the
+// authority section, both with name as owner name, are returned.
+func (b *RemoteBackend) lookup(name, qtype, remote string) ([]RR, error) {
+	t, ok := StringToType(qtype)
+	if !ok {
+		return nil, &Error{Err: "unknown qtype", Name: qtype}
+	}
+	name = Fqdn(strings.ToLower(name))
+	m := new(Msg)
+	m.SetQuestion(name, t)
+	w := &pdnsWriter{addr: &net.UDPAddr{IP: net.ParseIP(remote)}}
+	h := b.Handler
+	if h == nil {
+		h = DefaultServeMux
+	}
+	h.ServeDNS(w, m)
+	if w.reply == nil {
+		return nil, &Error{Err: "no reply from the handler", Name: name}
+	}
+	var rrs []RR
+	for _, rr := range w.reply.Answer {
+		if strings.EqualFold(rr.Header().Name, name) {
+			rrs = append(rrs, rr)
+		}
+	}
+	for _, rr := range w.reply.Ns {
+		if rr.Header().Rrtype == TypeNS && strings.EqualFold(rr.Header().Name, name) {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, nil
+}
+
+// pdnsRecords returns rrs in the form of the results of PowerDNS.
+func pdnsRecords(rrs []RR) []*pdnsRecord {
+	recs := make([]*pdnsRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		h := rr.Header()
+		// The content is what follows the header in the presentation
+		// format: name, ttl, class and type, separated by tabs.
+		f := strings.SplitN(rr.String(), "\t", 5)
+		if len(f) != 5 {
+			continue
+		}
+		recs = append(recs, &pdnsRecord{Qtype: TypeToString(h.Rrtype), Qname: h.Name, Content: f[4], Ttl: h.Ttl, Auth: true})
+	}
+	return recs
+}
+
+// pdnsWriter keeps the reply of the handler.
+type pdnsWriter struct {
+	addr  net.Addr
+	reply *Msg
+}
+
+func (w *pdnsWriter) RemoteAddr() net.Addr { return w.addr }
+
+func (w *pdnsWriter) Write(data []byte) (int, error) {
+	m := new(Msg)
+	if err := m.Unpack(data); err != nil {
+		return 0, err
+	}
+	w.reply = m
+	return len(data), nil
+}
@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRemoteBackend(t *testing.T) {
+	hdr := func(name string, t uint16) RR_Header {
+		return RR_Header{Name: name, Rrtype: t, Class: ClassINET, Ttl: 300}
+	}
+	zone := []RR{
+		&RR_SOA{Hdr: hdr("miek.nl.", TypeSOA), Ns: "ns.miek.nl.", Mbox: "hostmaster.miek.nl.", Serial: 1, Refresh: 2, Retry: 3, Expire: 4, Minttl: 5},
+		&RR_A{Hdr: hdr("www.miek.nl.", TypeA), A: net.IPv4(127, 0, 0, 1)},
+		&RR_MX{Hdr: hdr("www.miek.nl.", TypeMX), Pref: 10, Mx: "mx.miek.nl."},
+	}
+	b := &RemoteBackend{
+		Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+			m := new(Msg)
+			m.SetReply(req)
+			q := req.Question[0]
+			for _, rr := range zone {
+				if rr.Header().Name == q.Name && (q.Qtype == TypeANY || q.Qtype == rr.Header().Rrtype) {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			if len(m.Answer) == 0 {
+				m.Ns = append(m.Ns, zone[0])
+			}
+			buf, _ := m.Pack()
+			w.Write(buf)
+		}),
+		List: func(name string) ([]RR, bool) { return zone, name == "miek.nl." },
+		Metadata: func(name, kind string) []string {
+			if kind == "ALLOW-AXFR-FROM" {
+				return []string{"127.0.0.1"}
+			}
+			return nil
+		},
+	}
+	in := `{"method":"initialize","parameters":{"path":"/tmp/socket"}}
+{"method":"lookup","parameters":{"qtype":"ANY","qname":"WWW.miek.nl","remote":"192.0.2.1","zone-id":-1}}
+{"method":"lookup","parameters":{"qtype":"A","qname":"nx.miek.nl.","remote":"192.0.2.1","zone-id":-1}}
+{"method":"lookup","parameters":{"qtype":"BOGUS","qname":"miek.nl.","zone-id":-1}}
+{"method":"list","parameters":{"zonename":"miek.nl","domain_id":-1}}
+{"method":"list","parameters":{"zonename":"example.org.","domain_id":-1}}
+{"method":"getDomainMetadata","parameters":{"name":"miek.nl.","kind":"ALLOW-AXFR-FROM"}}
+{"method":"getDomainMetadata","parameters":{"name":"miek.nl.","kind":"PRESIGNED"}}
+{"method":"getAllDomains","parameters":{}}
+`
+	var out bytes.Buffer
+	if err := b.Serve(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(in), &out}); err != nil {
+		t.Logf("Failed to serve: %s", err)
+		t.Fail()
+		return
+	}
+	want := []string{
+		`{"result":true}`,
+		`{"result":[{"qtype":"A","qname":"www.miek.nl.","content":"127.0.0.1","ttl":300,"auth":true},{"qtype":"MX","qname":"www.miek.nl.","content":"10 mx.miek.nl.","ttl":300,"auth":true}]}`,
+		`{"result":[]}`,
+		`{"result":false,"log":["BOGUS: unknown qtype"]}`,
+		`{"result":[{"qtype":"SOA","qname":"miek.nl.","content":"ns.miek.nl. hostmaster.miek.nl. 1 2 3 4 5","ttl":300,"auth":true},` +
+			`{"qtype":"A","qname":"www.miek.nl.","content":"127.0.0.1","ttl":300,"auth":true},{"qtype":"MX","qname":"www.miek.nl.","content":"10 mx.miek.nl.","ttl":300,"auth":true}]}`,
+		`{"result":false,"log":["no such zone: example.org."]}`,
+		`{"result":["127.0.0.1"]}`,
+		`{"result":[]}`,
+		`{"result":false,"log":["method not implemented: getAllDomains"]}`,
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(got) != len(want) {
+		t.Logf("Expected %d replies, got %d:\n%s", len(want), len(got), out.String())
+		t.Fail()
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Logf("Reply %d: expected\n%s\ngot\n%s", i, want[i], got[i])
+			t.Fail()
+		}
+	}
+
+	s := httptest.NewServer(b)
+	defer s.Close()
+	resp, err := http.Post(s.URL+"/dnsapi/lookup", "application/json",
+		strings.NewReader(`{"method":"lookup","parameters":{"qtype":"A","qname":"www.miek.nl.","remote":"192.0.2.1"}}`))
+	if err != nil {
+		t.Logf("Failed to post: %s", err)
+		t.Fail()
+		return
+	}
+	defer resp.Body.Close()
+	var reply struct{ Result []pdnsRecord }
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil || len(reply.Result) != 1 || reply.Result[0].Content != "127.0.0.1" {
+		t.Logf("Expected the A record of www.miek.nl. over http, got %v: %v", err, reply)
+		t.Fail()
+	}
+}
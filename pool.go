@@ -0,0 +1,124 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Reuse of messages, buffers and RRs, for busy servers.
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Pools holds messages and buffers for reuse. A server that handles many
+// queries can take its request buffers and messages from Pools and give
+// them back when the response is written, so that it hardly allocates
+// once it is running. See the WithPools option of Server.
+//
+// The zero value is ready to use. Pools is safe for concurrent use.
+type Pools struct {
+	msgs sync.Pool // *Msg, with an RRArena
+	bufs sync.Pool // *[]byte
+	ptrs sync.Pool // *[]byte, empty, to hold the next buffer given back
+}
+
+// GetMsg returns an empty message. The RRs that are unpacked into it come
+// from an RRArena and are taken back by PutMsg.
+func (p *Pools) GetMsg() *Msg {
+	if m, ok := p.msgs.Get().(*Msg); ok {
+		return m
+	}
+	return &Msg{arena: new(RRArena)}
+}
+
+// PutMsg gives m back. Neither m nor the RRs that were unpacked into it may
+// be used afterwards.
+func (p *Pools) PutMsg(m *Msg) {
+	if m.arena == nil {
+		// Not from GetMsg
+		return
+	}
+	m.arena.Release()
+	for i := range m.Answer {
+		m.Answer[i] = nil
+	}
+	for i := range m.Ns {
+		m.Ns[i] = nil
+	}
+	for i := range m.Extra {
+		m.Extra[i] = nil
+	}
+	*m = Msg{Question: m.Question[:0], Answer: m.Answer[:0], Ns: m.Ns[:0], Extra: m.Extra[:0], arena: m.arena}
+	p.msgs.Put(m)
+}
+
+// GetBuffer returns a buffer of length size.
+func (p *Pools) GetBuffer(size int) []byte {
+	// The buffers are pooled as pointers, putting a slice in a sync.Pool
+	// allocates. The pointers themselves are reused too.
+	if bp, ok := p.bufs.Get().(*[]byte); ok {
+		b := *bp
+		*bp = nil
+		p.ptrs.Put(bp)
+		if cap(b) >= size {
+			return b[:size]
+		}
+	}
+	return make([]byte, size)
+}
+
+// PutBuffer gives b back. It may not be used afterwards.
+func (p *Pools) PutBuffer(b []byte) {
+	bp, ok := p.ptrs.Get().(*[]byte)
+	if !ok {
+		bp = new([]byte)
+	}
+	*bp = b[:cap(b)]
+	p.bufs.Put(bp)
+}
+
+// An RRArena allocates the RRs of a message when it is unpacked, and takes
+// them back all at once with Release. The RRs are reused for later
+// messages.
+//
+// An RRArena is not safe for concurrent use.
+type RRArena struct {
+	free map[uint16][]RR // released RRs, by type
+	used []arenaRR
+}
+
+type arenaRR struct {
+	t  uint16
+	rr RR
+}
+
+// New returns an empty RR of type t, RR_RFC3597 when t is not known.
+func (a *RRArena) New(t uint16) RR {
+	var rr RR
+	if l := a.free[t]; len(l) > 0 {
+		rr = l[len(l)-1]
+		a.free[t] = l[:len(l)-1]
+	} else if mk, ok := rr_mk[t]; ok {
+		rr = mk()
+	} else {
+		rr = new(RR_RFC3597)
+	}
+	a.used = append(a.used, arenaRR{t, rr})
+	return rr
+}
+
+// Release takes back all RRs returned by New. They are cleared and may not
+// be used afterwards.
+func (a *RRArena) Release() {
+	if a.free == nil {
+		a.free = make(map[uint16][]RR)
+	}
+	for i, u := range a.used {
+		v := reflect.ValueOf(u.rr).Elem()
+		v.Set(reflect.Zero(v.Type()))
+		a.free[u.t] = append(a.free[u.t], u.rr)
+		a.used[i].rr = nil
+	}
+	a.used = a.used[:0]
+}
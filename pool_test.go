@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRRArena(t *testing.T) {
+	a := new(RRArena)
+	rr := a.New(TypeA).(*RR_A)
+	rr.Hdr.Name = "miek.nl."
+	rr.A = net.IPv4(127, 0, 0, 1)
+	if _, ok := a.New(65280).(*RR_RFC3597); !ok {
+		t.Log("Unknown type should be an RR_RFC3597")
+		t.Fail()
+	}
+	a.Release()
+	again := a.New(TypeA).(*RR_A)
+	if again != rr {
+		t.Log("Released RR should be reused")
+		t.Fail()
+	}
+	if again.Hdr.Name != "" || again.A != nil {
+		t.Logf("Released RR should be cleared: %v", again)
+		t.Fail()
+	}
+}
+
+func TestPoolsUnpack(t *testing.T) {
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeMX)
+	mx, _ := NewRR("miek.nl. 3600 IN MX 10 mx.miek.nl.")
+	m.Answer = []RR{mx}
+	buf, _ := m.Pack()
+
+	p := new(Pools)
+	for i := 0; i < 3; i++ {
+		req := p.GetMsg()
+		if err := req.Unpack(buf); err != nil {
+			t.Logf("Failed to unpack: %s", err)
+			t.Fail()
+			return
+		}
+		if len(req.Answer) != 1 || req.Answer[0].String() != mx.String() {
+			t.Logf("Wrong answer: %v", req.Answer)
+			t.Fail()
+		}
+		p.PutMsg(req)
+	}
+}
+
+func TestPoolsBuffer(t *testing.T) {
+	p := new(Pools)
+	p.PutBuffer(p.GetBuffer(512))
+	if n := testing.AllocsPerRun(100, func() { p.PutBuffer(p.GetBuffer(512)) }); n != 0 {
+		t.Logf("Reusing a buffer should not allocate, got %.1f allocations", n)
+		t.Fail()
+	}
+	if b := p.GetBuffer(4096); len(b) != 4096 {
+		t.Logf("Expected a buffer of 4096 bytes, got %d", len(b))
+		t.Fail()
+	}
+}
+
+func TestServingWithPools(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	srv := &Server{Handler: HandlerFunc(HelloServer), WithPools: true}
+	go srv.ServeUDP(l)
+
+	c := NewClient()
+	for i := 0; i < 10; i++ {
+		m := new(Msg)
+		m.SetQuestion("miek.nl.", TypeTXT)
+		r, err := c.Exchange(m, l.LocalAddr().String())
+		if err != nil {
+			t.Logf("Failed to exchange: %s", err)
+			t.Fail()
+			return
+		}
+		if len(r.Extra) != 1 || r.Extra[0].(*RR_TXT).Txt[0] != "Hello world" {
+			t.Logf("Wrong reply: %s", r)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Health probes for (anycast) name servers.
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Probe checks the health of a list of name servers. Each server is
+// sent a CHAOS TXT query for Name with the NSID option (RFC 5001), so the
+// anycast instance that answers can be identified. The NSID is used for
+// the instance when the server returns it, the TXT record otherwise.
+type Probe struct {
+	Client  *Client  // the client for the queries, NewClient() if nil
+	Servers []string // the addresses (host:port) of the servers
+	Name    string   // the name to query, "hostname.bind." if empty
+}
+
+// A ProbeResult holds the result of probing a single server.
+type ProbeResult struct {
+	Server   string        // the address of the server
+	Instance string        // the instance that answered, empty if unknown
+	Nsid     string        // the NSID of the answer, empty if there is none
+	Rtt      time.Duration // the time until the answer came in
+	Rcode    int           // the rcode of the answer
+	Err      error         // non nil when the server did not answer
+}
+
+// Reachable returns true when the server answered, whatever the rcode.
+func (r *ProbeResult) Reachable() bool {
+	return r.Err == nil
+}
+
+// A ProbeReport holds the results of a Probe, in the order of its
+// Servers.
+type ProbeReport struct {
+	Results []*ProbeResult
+}
+
+// Instances returns the servers by the instance that answered them.
+// Servers that answered without identifying the instance are listed under
+// the empty string, unreachable servers are left out.
+func (r *ProbeReport) Instances() map[string][]string {
+	in := make(map[string][]string)
+	for _, res := range r.Results {
+		if res.Reachable() {
+			in[res.Instance] = append(in[res.Instance], res.Server)
+		}
+	}
+	return in
+}
+
+// Unreachable returns the sorted addresses of the servers that did not
+// answer.
+func (r *ProbeReport) Unreachable() []string {
+	var un []string
+	for _, res := range r.Results {
+		if !res.Reachable() {
+			un = append(un, res.Server)
+		}
+	}
+	sort.Strings(un)
+	return un
+}
+
+// Run probes all servers at once and waits for the results.
+func (p *Probe) Run() *ProbeReport {
+	r := &ProbeReport{Results: make([]*ProbeResult, len(p.Servers))}
+	var wg sync.WaitGroup
+	for i, a := range p.Servers {
+		wg.Add(1)
+		go func(i int, a string) {
+			r.Results[i] = p.Probe(a)
+			wg.Done()
+		}(i, a)
+	}
+	wg.Wait()
+	return r
+}
+
+// Probe probes the server at address a.
+func (p *Probe) Probe(a string) *ProbeResult {
+	c := p.Client
+	if c == nil {
+		c = NewClient()
+	}
+	name := p.Name
+	if name == "" {
+		name = "hostname.bind."
+	}
+	m := new(Msg)
+	m.SetQuestion(Fqdn(name), TypeTXT)
+	m.Question[0].Qclass = ClassCHAOS
+	m.RecursionDesired = false
+	m.SetEdns0(DefaultMsgSize, false)
+	m.Extra[len(m.Extra)-1].(*RR_OPT).SetNsid("")
+
+	res := &ProbeResult{Server: a}
+	start := time.Now()
+	in, err := c.Exchange(m, a)
+	res.Rtt = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Rcode = in.Rcode
+	for _, rr := range in.Extra {
+		if o, ok := rr.(*RR_OPT); ok {
+			res.Nsid = optNsid(o)
+		}
+	}
+	res.Instance = res.Nsid
+	if res.Instance == "" {
+		for _, rr := range in.Answer {
+			if t, ok := rr.(*RR_TXT); ok {
+				res.Instance = strings.Join(t.Txt, " ")
+				break
+			}
+		}
+	}
+	return res
+}
+
+// optNsid returns the NSID in o as text, an empty string if there is
+// none.
+func optNsid(o *RR_OPT) string {
+	for _, op := range o.Option {
+		if op.Code != OptionCodeNSID {
+			continue
+		}
+		b, err := hex.DecodeString(op.Data)
+		if err != nil {
+			return op.Data
+		}
+		return string(b)
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package dns
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+// probeHandler answers the CHAOS query with its instance, in the NSID
+// option when nsid is true.
+func probeHandler(instance string, nsid bool) HandlerFunc {
+	return func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		if nsid {
+			m.SetEdns0(DefaultMsgSize, false)
+			m.Extra[0].(*RR_OPT).SetNsid(hex.EncodeToString([]byte(instance)))
+		} else {
+			m.Answer = append(m.Answer, &RR_TXT{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeTXT, Class: ClassCHAOS}, Txt: []string{instance}})
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var servers []string
+	for _, h := range []HandlerFunc{probeHandler("ams1", true), probeHandler("ams1", true), probeHandler("lon2", false)} {
+		l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Logf("Failed to listen: %s", err)
+			t.Fail()
+			return
+		}
+		go (&Server{Handler: h}).ServeUDP(l)
+		servers = append(servers, l.LocalAddr().String())
+	}
+	// Nothing listens here
+	l, _ := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	down := l.LocalAddr().String()
+	l.Close()
+	servers = append(servers, down)
+
+	c := NewClient()
+	c.ReadTimeout = time.Second
+	p := &Probe{Client: c, Servers: servers}
+	r := p.Run()
+	if len(r.Results) != 4 || r.Results[0].Nsid != "ams1" || r.Results[2].Nsid != "" || r.Results[0].Rtt <= 0 {
+		t.Logf("Wrong results: %+v", r.Results)
+		t.Fail()
+		return
+	}
+	in := r.Instances()
+	if len(in) != 2 || len(in["ams1"]) != 2 || len(in["lon2"]) != 1 || in["lon2"][0] != servers[2] {
+		t.Logf("Wrong instances: %v", in)
+		t.Fail()
+	}
+	if un := r.Unreachable(); len(un) != 1 || un[0] != down {
+		t.Logf("Wrong unreachable servers: %v", un)
+		t.Fail()
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Checking that a change has reached all name servers of a zone.
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// A PropagationCheck checks which of the authoritative name servers of a
+// zone serve a record, for instance after an update. The name servers are
+// found with an NS query to a recursive server.
+type PropagationCheck struct {
+	Client  *Client  // the client for the queries, NewClient() if nil
+	Servers []string // the addresses (host:port) of the recursive servers for the NS lookup
+	Port    string   // the port of the name servers of the zone, "53" if empty
+	// LookupIP returns the addresses of a name server, net.LookupIP if
+	// nil.
+	LookupIP func(name string) ([]net.IP, error)
+	Backoff  *Backoff // the wait between the checks of Wait, from 1 s up to 30 s if nil
+}
+
+// defaultPropagationBackoff is the wait between the checks of Wait when
+// the Backoff of a PropagationCheck is nil.
+var defaultPropagationBackoff = &Backoff{Initial: time.Second, Max: 30 * time.Second}
+
+// A PropagationResult holds what a single name server answered.
+type PropagationResult struct {
+	Name   string // the name of the server
+	Addr   string // the address (host:port) that was queried
+	Found  bool   // the server has the record
+	Answer []RR   // the answer of the server
+	Err    error  // non nil when the server did not answer
+}
+
+// A PropagationReport holds the findings of a PropagationCheck.
+type PropagationReport struct {
+	Zone    string
+	Results []*PropagationResult // by server name and address
+}
+
+// Done returns true when all servers have the record.
+func (r *PropagationReport) Done() bool {
+	for _, res := range r.Results {
+		if !res.Found {
+			return false
+		}
+	}
+	return len(r.Results) > 0
+}
+
+// Pending returns the servers that do not have the record yet, as
+// "name (address)".
+func (r *PropagationReport) Pending() []string {
+	var p []string
+	for _, res := range r.Results {
+		if !res.Found {
+			p = append(p, res.Name+" ("+res.Addr+")")
+		}
+	}
+	return p
+}
+
+// Check asks each address of each name server of zone for the name and
+// type of want, and reports which of them have want in their answer.
+// RRs are compared with RRsEqual, so the TTL does not matter. An error is
+// returned when the name servers of the zone can not be found.
+func (p *PropagationCheck) Check(zone string, want RR) (*PropagationReport, error) {
+	zone = strings.ToLower(Fqdn(zone))
+	var (
+		m   *Msg
+		err error
+	)
+	for _, a := range p.Servers {
+		q := new(Msg)
+		q.SetQuestion(zone, TypeNS)
+		if m, err = p.client().Exchange(q, a); err == nil {
+			break
+		}
+	}
+	if m == nil {
+		if err == nil {
+			err = ErrServ
+		}
+		return nil, err
+	}
+	names := nsNames(m.Answer, zone)
+	if len(names) == 0 {
+		return nil, &Error{Err: "no name servers found", Name: zone}
+	}
+
+	r := &PropagationReport{Zone: zone}
+	h := want.Header()
+	for _, ns := range names {
+		ips, err := p.lookupIP(ns)
+		if err == nil && len(ips) == 0 {
+			err = &Error{Err: "no address", Name: ns}
+		}
+		if err != nil {
+			r.Results = append(r.Results, &PropagationResult{Name: ns, Err: err})
+			continue
+		}
+		for _, ip := range ips {
+			res := &PropagationResult{Name: ns, Addr: net.JoinHostPort(ip.String(), p.port())}
+			q := new(Msg)
+			q.SetQuestion(h.Name, h.Rrtype)
+			q.RecursionDesired = false
+			if m, err := p.client().Exchange(q, res.Addr); err != nil {
+				res.Err = err
+			} else {
+				res.Answer = m.Answer
+				for _, rr := range m.Answer {
+					if RRsEqual(rr, want) {
+						res.Found = true
+						break
+					}
+				}
+			}
+			r.Results = append(r.Results, res)
+		}
+	}
+	return r, nil
+}
+
+// Wait checks zone, like Check, until all servers have want, at most
+// attempts times, waiting p.Backoff between the checks. It returns the
+// last report, with an error when the record has not reached all servers.
+func (p *PropagationCheck) Wait(zone string, want RR, attempts int) (r *PropagationReport, err error) {
+	err = p.backoff().Retry(attempts, func() (err error) {
+		if r, err = p.Check(zone, want); err != nil {
+			return err
+		}
+		if !r.Done() {
+			return &Error{Err: "not on all name servers", Name: want.Header().Name}
+		}
+		return nil
+	})
+	return r, err
+}
+
+func (p *PropagationCheck) backoff() *Backoff {
+	if p.Backoff == nil {
+		return defaultPropagationBackoff
+	}
+	return p.Backoff
+}
+
+func (p *PropagationCheck) client() *Client {
+	if p.Client == nil {
+		return NewClient()
+	}
+	return p.Client
+}
+
+func (p *PropagationCheck) lookupIP(name string) ([]net.IP, error) {
+	if p.LookupIP != nil {
+		return p.LookupIP(name)
+	}
+	return net.LookupIP(name)
+}
+
+func (p *PropagationCheck) port() string {
+	if p.Port == "" {
+		return "53"
+	}
+	return p.Port
+}
@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func propagationServer(ip net.IP, port int, h HandlerFunc) (string, bool) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: ip, Port: port})
+	if err != nil {
+		return "", false
+	}
+	go (&Server{Handler: h}).ServeUDP(l)
+	return l.LocalAddr().String(), true
+}
+
+func propagationAuth(a net.IP) HandlerFunc {
+	return func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: req.Question[0].Name, Rrtype: TypeA, Class: ClassINET, Ttl: 60}, A: a})
+		buf, _ := m.Pack()
+		w.Write(buf)
+	}
+}
+
+func TestPropagationCheck(t *testing.T) {
+	resolver, ok := propagationServer(net.IPv4(127, 0, 0, 1), 0, func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		for _, ns := range []string{"ns1.miek.nl.", "ns2.miek.nl."} {
+			m.Answer = append(m.Answer, &RR_NS{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeNS, Class: ClassINET, Ttl: 3600}, Ns: ns})
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})
+	if !ok {
+		t.Log("Failed to start the servers")
+		t.Fail()
+		return
+	}
+	ns1, ok1 := propagationServer(net.IPv4(127, 0, 0, 1), 0, propagationAuth(net.IPv4(192, 0, 2, 1)))
+	_, port, _ := net.SplitHostPort(ns1)
+	p, _ := net.LookupPort("udp", port)
+	ns2, ok2 := propagationServer(net.IPv4(127, 0, 0, 2), p, propagationAuth(net.IPv4(192, 0, 2, 2)))
+	if !ok1 || !ok2 {
+		t.Log("Failed to start the servers")
+		t.Fail()
+		return
+	}
+
+	c := &PropagationCheck{Servers: []string{resolver}, Port: port,
+		Backoff: &Backoff{Initial: time.Millisecond},
+		LookupIP: func(name string) ([]net.IP, error) {
+			if name == "ns1.miek.nl." {
+				return []net.IP{net.IPv4(127, 0, 0, 1)}, nil
+			}
+			return []net.IP{net.IPv4(127, 0, 0, 2)}, nil
+		}}
+	want, _ := NewRR("www.miek.nl. IN A 192.0.2.1")
+	r, err := c.Wait("miek.nl", want, 2)
+	if err == nil || r == nil || r.Done() {
+		t.Logf("The record should not be everywhere: %v", err)
+		t.Fail()
+		return
+	}
+	if len(r.Results) != 2 || !r.Results[0].Found || r.Results[0].Addr != ns1 {
+		t.Logf("ns1 should have the record: %+v", r.Results)
+		t.Fail()
+	}
+	if p := r.Pending(); len(p) != 1 || p[0] != "ns2.miek.nl. ("+ns2+")" {
+		t.Logf("Wrong pending servers: %v", p)
+		t.Fail()
+	}
+	if d := new(PropagationCheck).backoff().Delay(0); d == 0 {
+		t.Log("Wait without a Backoff should wait between the checks")
+		t.Fail()
+	}
+}
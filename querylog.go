@@ -0,0 +1,112 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Query logging in the format of BIND's querylog.
+
+import (
+	"net"
+	"strconv"
+	"time"
+)
+
+// A Logger is used by LogHandler to write the log lines. The
+// *log.Logger from the standard library implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// LogHandler returns a Handler that calls h and then logs the query to l.
+// Each line follows BIND's querylog format:
+//
+//	client 127.0.0.1#53532 (miek.nl.): query: miek.nl. IN MX +E(0)D
+//
+// The flags are: + when recursion was desired (- otherwise), E(version) when
+// the query carried EDNS0, T when TCP was used, D when the DO bit was set, C
+// when checking was disabled and S when the query was signed with TSIG. The
+// line is followed by the rcode, the number of bytes written and the time it
+// took to handle the query:
+//
+//	rcode: NOERROR bytes: 245 duration: 1.105ms
+func LogHandler(h Handler, l Logger) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		lw := &logWriter{ResponseWriter: w, rcode: -1}
+		start := time.Now()
+		h.ServeDNS(lw, r)
+		l.Printf("%s", queryLogLine(w.RemoteAddr(), r, lw.rcode, lw.n, time.Since(start)))
+	})
+}
+
+type logWriter struct {
+	ResponseWriter
+	rcode int // rcode of the last message written
+	n     int // bytes written
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	if len(data) >= 4 {
+		w.rcode = int(data[3] & 0xF)
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.n += n
+	return n, err
+}
+
+// queryLogLine creates the querylog line for the query r from a.
+func queryLogLine(a net.Addr, r *Msg, rcode, n int, d time.Duration) string {
+	s := "client "
+	tcp := false
+	switch a := a.(type) {
+	case *net.UDPAddr:
+		s += a.IP.String() + "#" + strconv.Itoa(a.Port)
+	case *net.TCPAddr:
+		s += a.IP.String() + "#" + strconv.Itoa(a.Port)
+		tcp = true
+	case nil:
+		s += "-"
+	default:
+		s += a.String()
+	}
+	if len(r.Question) == 0 {
+		s += " (.): query: . - -"
+	} else {
+		q := r.Question[0]
+		s += " (" + q.Name + "): query: " + q.Name + " " + ClassToString(q.Qclass) + " " + TypeToString(q.Qtype)
+	}
+	s += " "
+	if r.RecursionDesired {
+		s += "+"
+	} else {
+		s += "-"
+	}
+	var opt *RR_OPT
+	for _, e := range r.Extra {
+		if o, ok := e.(*RR_OPT); ok {
+			opt = o
+		}
+	}
+	if opt != nil {
+		s += "E(" + strconv.Itoa(int(opt.Version())) + ")"
+	}
+	if tcp {
+		s += "T"
+	}
+	if opt != nil && opt.Do() {
+		s += "D"
+	}
+	if r.CheckingDisabled {
+		s += "C"
+	}
+	if r.IsTsig() {
+		s += "S"
+	}
+	if rcode == -1 { // nothing written
+		s += " rcode: -"
+	} else {
+		s += " rcode: " + RcodeToString(rcode)
+	}
+	s += " bytes: " + strconv.Itoa(n) + " duration: " + d.String()
+	return s
+}
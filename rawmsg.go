@@ -22,18 +22,19 @@ func RawSetRdlength(msg []byte, off, end int) bool {
 	// We are at the start of the header, walk the domainname (might be compressed)
 Loop:
 	for {
-		if off > len(msg) {
+		if off >= len(msg) {
 			return false
 		}
 		c := int(msg[off])
 		off++
-		switch c & 0xC00 {
+		switch c & 0xC0 {
 		case 0x00:
 			if c == 0x00 {
 				// End of the domainname
 				break Loop
 			}
-
+			// Skip the label
+			off += c
 		case 0xC0:
 			// pointer, next byte included, ends domainname
 			off++
@@ -51,3 +52,41 @@ Loop:
 	msg[off], msg[off+1] = packUint16(uint16(end - (off + 2)))
 	return true
 }
+
+// FlagSet returns true when flag, one of the Flag constants, is set
+// in bits, the second 16 bits of a message as in Header.Bits.
+func FlagSet(bits, flag uint16) bool {
+	return bits&flag != 0
+}
+
+// SetFlag returns bits with flag set, or cleared when on is false. The
+// opcode and rcode in bits are not changed.
+func SetFlag(bits, flag uint16, on bool) uint16 {
+	if on {
+		return bits | flag
+	}
+	return bits &^ flag
+}
+
+// RawFlags returns the flag bits, with the opcode and rcode, of the
+// message in msg. The offset 'off' must be positioned at the
+// beginning of the message.
+func RawFlags(msg []byte, off int) (uint16, bool) {
+	if off+4 > len(msg) {
+		return 0, false
+	}
+	bits, _ := unpackUint16(msg, off+2)
+	return bits, true
+}
+
+// RawSetFlag sets flag, or clears it when on is false, in the
+// message in msg without unpacking it. The offset 'off' must be
+// positioned at the beginning of the message.
+func RawSetFlag(msg []byte, off int, flag uint16, on bool) bool {
+	bits, ok := RawFlags(msg, off)
+	if !ok {
+		return false
+	}
+	msg[off+2], msg[off+3] = packUint16(SetFlag(bits, flag, on))
+	return true
+}
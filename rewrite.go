@@ -0,0 +1,123 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Rewriting the query name and type before a handler sees the query.
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A RewriteRule rewrites the name and type of a query. The name is
+// matched by Regexp when it is set, otherwise it must equal Name, or with
+// Suffix also be a name below Name.
+type RewriteRule struct {
+	Name    string         // the name to match
+	Suffix  bool           // Name matches the names below it as well
+	Regexp  *regexp.Regexp // if not nil, the names matching Regexp match
+	To      string         // the new name, the new domain with Suffix, or the replacement for Regexp
+	Qtype   uint16         // the type to match, any type if TypeNone
+	ToQtype uint16         // the new type, the type is kept if TypeNone
+}
+
+// rewrite returns the rewritten name of name, which is in lower case.
+func (r *RewriteRule) rewrite(name string, qtype uint16) (string, bool) {
+	if r.Qtype != TypeNone && r.Qtype != qtype {
+		return "", false
+	}
+	if r.Regexp != nil {
+		if !r.Regexp.MatchString(name) {
+			return "", false
+		}
+		return Fqdn(r.Regexp.ReplaceAllString(name, r.To)), true
+	}
+	from := strings.ToLower(Fqdn(r.Name))
+	switch {
+	case name == from:
+		return Fqdn(r.To), true
+	case r.Suffix && strings.HasSuffix(name, "."+from):
+		return name[:len(name)-len(from)] + Fqdn(r.To), true
+	}
+	return "", false
+}
+
+// RewriteHandler returns a handler that rewrites the question of a query
+// with the first rule in rules that matches it, and passes the query on to
+// next. In the response of next the question is restored and the owner
+// names are rewritten back: the new name becomes the query name again and,
+// for a Suffix rule, To and the names below it become Name and the names
+// below Name. Queries
+// that no rule matches are passed on as they are.
+func RewriteHandler(rules []RewriteRule, next Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		if len(r.Question) != 1 {
+			next.ServeDNS(w, r)
+			return
+		}
+		q := r.Question[0]
+		lower := strings.ToLower(q.Name)
+		for i := range rules {
+			name, ok := rules[i].rewrite(lower, q.Qtype)
+			if !ok {
+				continue
+			}
+			rq := *r
+			rq.Question = []Question{q}
+			rq.Question[0].Name = name
+			if rules[i].ToQtype != TypeNone {
+				rq.Question[0].Qtype = rules[i].ToQtype
+			}
+			next.ServeDNS(&rewriteWriter{ResponseWriter: w, rule: &rules[i], q: q, name: strings.ToLower(name)}, &rq)
+			return
+		}
+		next.ServeDNS(w, r)
+	})
+}
+
+type rewriteWriter struct {
+	ResponseWriter
+	rule *RewriteRule
+	q    Question // the original question
+	name string   // the rewritten name
+}
+
+func (w *rewriteWriter) Write(data []byte) (int, error) {
+	m := new(Msg)
+	if m.Unpack(data) != nil || m.IsTsig() {
+		return w.ResponseWriter.Write(data)
+	}
+	if len(m.Question) == 1 {
+		m.Question[0] = w.q
+	}
+	for _, s := range [][]RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range s {
+			if rr.Header().Rrtype != TypeOPT {
+				rr.Header().Name = w.restore(rr.Header().Name)
+			}
+		}
+	}
+	m.Compress = true
+	buf, err := m.Pack()
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// restore rewrites name back.
+func (w *rewriteWriter) restore(name string) string {
+	lower := strings.ToLower(name)
+	if lower == w.name {
+		return w.q.Name
+	}
+	if w.rule.Suffix && w.rule.Regexp == nil {
+		to := strings.ToLower(Fqdn(w.rule.To))
+		if lower == to || strings.HasSuffix(lower, "."+to) {
+			return name[:len(name)-len(to)] + Fqdn(w.rule.Name)
+		}
+	}
+	return name
+}
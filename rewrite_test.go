@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"net"
+	"regexp"
+	"testing"
+)
+
+func TestRewriteHandler(t *testing.T) {
+	rules := []RewriteRule{
+		{Name: "www.miek.nl", To: "internal.miek.nl."},
+		{Name: "corp.example.", Suffix: true, To: "corp.internal."},
+		{Regexp: regexp.MustCompile(`^(.*)\.old\.nl\.$`), To: "$1.new.nl", Qtype: TypeA, ToQtype: TypeAAAA},
+	}
+	var asked Question
+	next := HandlerFunc(func(w ResponseWriter, r *Msg) {
+		asked = r.Question[0]
+		m := new(Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &RR_A{Hdr: RR_Header{Name: r.Question[0].Name, Rrtype: TypeA, Class: ClassINET}, A: net.IPv4(127, 0, 0, 1)})
+		m.Ns = append(m.Ns, &RR_NS{Hdr: RR_Header{Name: "corp.internal.", Rrtype: TypeNS, Class: ClassINET}, Ns: "ns.corp.internal."})
+		buf, _ := m.Pack()
+		w.Write(buf)
+	})
+	h := RewriteHandler(rules, next)
+	tests := []struct {
+		name  string
+		qtype uint16
+		asked Question
+		ns    string // owner name of the NS record in the response
+	}{
+		{"WWW.miek.nl.", TypeA, Question{"internal.miek.nl.", TypeA, ClassINET}, "corp.internal."},
+		{"a.b.Corp.example.", TypeMX, Question{"a.b.corp.internal.", TypeMX, ClassINET}, "corp.example."},
+		{"x.old.nl.", TypeA, Question{"x.new.nl.", TypeAAAA, ClassINET}, "corp.internal."},
+		{"x.old.nl.", TypeMX, Question{"x.old.nl.", TypeMX, ClassINET}, "corp.internal."},
+	}
+	for _, tc := range tests {
+		w := new(bufferWriter)
+		q := new(Msg)
+		q.SetQuestion(tc.name, tc.qtype)
+		h.ServeDNS(w, q)
+		if asked != tc.asked {
+			t.Logf("%s should be asked as %v, not %v", tc.name, tc.asked, asked)
+			t.Fail()
+		}
+		r := new(Msg)
+		if len(w.msgs) != 1 || r.Unpack(w.msgs[0]) != nil {
+			t.Logf("No response for %s", tc.name)
+			t.Fail()
+			continue
+		}
+		if r.Question[0] != q.Question[0] || r.Answer[0].Header().Name != tc.name || r.Ns[0].Header().Name != tc.ns {
+			t.Logf("Wrong response for %s:\n%s", tc.name, r)
+			t.Fail()
+		}
+	}
+}
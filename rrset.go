@@ -0,0 +1,94 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// An RRset that may be shared by the goroutines of a server.
+
+import (
+	"reflect"
+	"sync"
+)
+
+// SafeRRset is an RRset that is safe for concurrent use. It copies the RRs
+// that are put in and the RRs that are taken out, so a handler may change
+// the RRs it gets, for instance to lower the TTL, without changing them for
+// other handlers.
+//
+// The RRs are copied shallowly: the header and the fixed fields are
+// copied, the slices in the rdata, like the strings of a TXT record, are
+// shared and must not be changed.
+//
+// The zero value is an empty set.
+type SafeRRset struct {
+	mu  sync.RWMutex
+	rrs RRset
+}
+
+// NewSafeRRset returns a SafeRRset holding copies of the RRs in s.
+func NewSafeRRset(s RRset) *SafeRRset {
+	return &SafeRRset{rrs: copyRRset(s)}
+}
+
+// Push adds a copy of r, see RRset.Push.
+func (s *SafeRRset) Push(r RR) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rrs.Push(copyRR(r))
+}
+
+// Pop removes the last pushed RR and returns it, nil when the set is
+// empty.
+func (s *SafeRRset) Pop() RR {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rrs.Pop()
+}
+
+// Set replaces the RRs in the set by copies of the RRs in rrset.
+func (s *SafeRRset) Set(rrset RRset) {
+	c := copyRRset(rrset)
+	s.mu.Lock()
+	s.rrs = c
+	s.mu.Unlock()
+}
+
+// RRset returns a copy of the RRs in the set.
+func (s *SafeRRset) RRset() RRset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return copyRRset(s.rrs)
+}
+
+// Len returns the number of RRs in the set.
+func (s *SafeRRset) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.rrs)
+}
+
+func (s *SafeRRset) String() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rrs.String()
+}
+
+// copyRR returns a shallow copy of r.
+func copyRR(r RR) RR {
+	v := reflect.ValueOf(r).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	return c.Interface().(RR)
+}
+
+func copyRRset(s RRset) RRset {
+	if s == nil {
+		return nil
+	}
+	c := make(RRset, len(s))
+	for i, r := range s {
+		c[i] = copyRR(r)
+	}
+	return c
+}
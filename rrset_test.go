@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSafeRRset(t *testing.T) {
+	a, _ := NewRR("miek.nl. 3600 IN A 127.0.0.1")
+	s := NewSafeRRset(RRset{a})
+	a.Header().Ttl = 10
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				for _, r := range s.RRset() {
+					r.Header().Ttl--
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		b, _ := NewRR("miek.nl. 3600 IN A 127.0.0.2")
+		s.Push(b)
+		s.Pop()
+	}
+	wg.Wait()
+	rrs := s.RRset()
+	if len(rrs) != 1 || rrs[0].Header().Ttl != 3600 {
+		t.Logf("RRs in the set have changed: %v", rrs)
+		t.Fail()
+	}
+	if b, _ := NewRR("nl. 3600 IN A 127.0.0.1"); s.Push(b) || s.Len() != 1 {
+		t.Log("Pushed an RR with another owner name")
+		t.Fail()
+	}
+}
+
+func TestRRsetPush(t *testing.T) {
+	var s RRset
+	for _, r := range []string{
+		"miek.nl. 3600 IN A 127.0.0.1",
+		"miek.nl. 3600 IN RRSIG A 8 2 3600 20110823011301 20110724011301 12051 miek.nl. AAAA",
+		"miek.nl. 3600 IN A 127.0.0.2",
+	} {
+		rr, _ := NewRR(r)
+		if err := s.PushStrict(rr); err != nil {
+			t.Logf("Failed to push %s: %s", rr, err)
+			t.Fail()
+		}
+	}
+	tests := map[string]error{
+		"nl. 3600 IN A 127.0.0.3":      ErrRRsetName,
+		"miek.nl. 3600 CH A 127.0.0.3": ErrRRsetClass,
+		"miek.nl. 3600 IN AAAA ::1":    ErrRRsetType,
+		"miek.nl. 3600 IN RRSIG MX 8 2 3600 20110823011301 20110724011301 12051 miek.nl. AAAA": ErrRRsetType,
+		"miek.nl. 1800 IN A 127.0.0.3": ErrRRsetTtl,
+	}
+	for r, err := range tests {
+		rr, _ := NewRR(r)
+		if e := s.PushStrict(rr); e != err {
+			t.Logf("Pushing %s should give %v, not %v", rr, err, e)
+			t.Fail()
+		}
+		if ok := s.Push(rr); ok != (err == ErrRRsetTtl) {
+			t.Logf("Push of %s returned %t", rr, ok)
+			t.Fail()
+		}
+		if err == ErrRRsetTtl && s.Check() != ErrRRsetTtl {
+			t.Logf("Check should find the TTL mismatch: %v", s.Check())
+			t.Fail()
+		}
+	}
+	if (RRset{}).Check() != ErrRRsetEmpty {
+		t.Log("Empty RRset should not be ok")
+		t.Fail()
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// SOA serial numbers and how to increase them.
+
+import (
+	"time"
+)
+
+// Schemes for increasing the serial of a zone, see NextSerial.
+const (
+	SerialIncrement = iota // add one
+	SerialUnixtime         // the current time in seconds since the epoch
+	SerialDate             // the date and a two digit counter: YYYYMMDDnn
+)
+
+// SerialLess returns true if serial a is smaller than serial b, using the
+// serial number arithmetic of RFC 1982. When a and b are exactly 2^31
+// apart the comparison is undefined and false is returned.
+func SerialLess(a, b uint32) bool {
+	return a != b && b-a < 1<<31
+}
+
+// NextSerial returns the serial that follows serial when the zone is
+// changed at time t, using scheme. If the serial of the scheme is not
+// larger than serial, for instance because the zone was changed before in
+// the same second or more than 99 times on the same day, serial is
+// incremented instead. The serial wraps around as described in RFC 1982.
+func NextSerial(serial uint32, scheme int, t time.Time) uint32 {
+	var next uint32
+	switch scheme {
+	case SerialUnixtime:
+		next = uint32(t.Unix())
+	case SerialDate:
+		y, m, d := t.UTC().Date()
+		next = uint32(y*1000000 + int(m)*10000 + d*100)
+	}
+	if scheme != SerialIncrement && SerialLess(serial, next) {
+		return next
+	}
+	return serial + 1
+}
+
+// BumpSerial sets the serial of rr to the serial that follows it at
+// time t, see NextSerial.
+func (rr *RR_SOA) BumpSerial(scheme int, t time.Time) {
+	rr.Serial = NextSerial(rr.Serial, scheme, t)
+}
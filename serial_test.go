@@ -0,0 +1,60 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSerialLess(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		less bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{1, 1, false},
+		{0xFFFFFFFF, 0, true},
+		{0xFFFFFFF0, 10, true},
+		{10, 0xFFFFFFF0, false},
+		{0, 1<<31 - 1, true},
+		{0, 1 << 31, false},
+	}
+	for _, x := range tests {
+		if SerialLess(x.a, x.b) != x.less {
+			t.Logf("SerialLess(%d, %d) should be %v", x.a, x.b, x.less)
+			t.Fail()
+		}
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2012, 4, 23, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		serial uint32
+		scheme int
+		next   uint32
+	}{
+		{1, SerialIncrement, 2},
+		{0xFFFFFFFF, SerialIncrement, 0},
+		{1, SerialUnixtime, uint32(now.Unix())},
+		{uint32(now.Unix()), SerialUnixtime, uint32(now.Unix()) + 1},
+		{1, SerialDate, 2012042300},
+		{2012042300, SerialDate, 2012042301},
+		{2012042299, SerialDate, 2012042300},
+		{2012042200, SerialDate, 2012042300},
+		// The date is "smaller" in serial arithmetic
+		{2012042300 + 1<<31 - 1, SerialDate, 2012042300 + 1<<31},
+	}
+	for _, x := range tests {
+		if n := NextSerial(x.serial, x.scheme, now); n != x.next {
+			t.Logf("NextSerial(%d, %d) should be %d, got %d", x.serial, x.scheme, x.next, n)
+			t.Fail()
+		}
+	}
+	soa := &RR_SOA{Serial: 2012042305}
+	soa.BumpSerial(SerialDate, now)
+	if soa.Serial != 2012042306 {
+		t.Logf("BumpSerial failed: %d", soa.Serial)
+		t.Fail()
+	}
+}
@@ -7,8 +7,8 @@
 package dns
 
 import (
-	"io"
 	"net"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,6 +37,10 @@ type conn struct {
 	_UDP       *net.UDPConn // i/o connection if UDP was used
 	_TCP       *net.TCPConn // i/o connection if TCP was used
 	hijacked   bool         // connection has been hijacked by hander TODO(mg)
+	pools      *Pools       // if not nil, request and buf are given back here
+	stats      *ServerStats // the counters of the server
+	// requests that can not be unpacked are not answered
+	dropMalformed bool
 }
 
 type response struct {
@@ -81,6 +85,35 @@ func Refused(w ResponseWriter, r *Msg) {
 // RefusedHandler returns HandlerFunc with Refused.
 func RefusedHandler() Handler { return HandlerFunc(Refused) }
 
+// MinimalHandler returns a Handler that calls h, but strips the
+// authority and additional sections of the responses h writes
+// of records that are not strictly needed, see Msg.Minimize.
+// Responses that can not be unpacked or that carry a TSIG
+// record are written as is.
+func MinimalHandler(h Handler) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		h.ServeDNS(&minimalWriter{w}, r)
+	})
+}
+
+type minimalWriter struct {
+	ResponseWriter
+}
+
+func (w *minimalWriter) Write(data []byte) (int, error) {
+	m := new(Msg)
+	if m.Unpack(data) != nil || m.IsTsig() {
+		return w.ResponseWriter.Write(data)
+	}
+	m.Minimize()
+	m.Compress = true
+	buf, err := m.Pack()
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
 // ...
 func ListenAndServe(addr string, network string, handler Handler, size int) error {
 	server := &Server{Addr: addr, Net: network, Handler: handler, UDPSize: size}
@@ -118,8 +151,16 @@ func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Ms
 }
 
 // ServeDNS dispatches the request to the handler whose
-// pattern most closely matches the request message.
+// pattern most closely matches the (first) question in the request
+// message. A request without a question gets a format error.
 func (mux *ServeMux) ServeDNS(w ResponseWriter, request *Msg) {
+	if len(request.Question) == 0 {
+		m := new(Msg)
+		m.SetRcodeFormatError(request)
+		buf, _ := m.Pack()
+		w.Write(buf)
+		return
+	}
 	h := mux.match(request.Question[0].Name)
 	if h == nil {
 		h = RefusedHandler()
@@ -139,6 +180,7 @@ func HandleFunc(pattern string, handler func(ResponseWriter, *Msg)) {
 // A Server defines parameters for running an DNS server.
 // Note how much it starts to look like 'Client struct'
 type Server struct {
+	stats        ServerStats       // first, the counters must be 64-bit aligned
 	Addr         string            // address to listen on, ":dns" if empty
 	Net          string            // if "tcp" it will invoke a TCP listener, otherwise an UDP one
 	Handler      Handler           // handler to invoke, dns.DefaultServeMux if nil
@@ -146,6 +188,49 @@ type Server struct {
 	ReadTimeout  time.Duration     // the net.Conn.SetReadTimeout value for new connections
 	WriteTimeout time.Duration     // the net.Conn.SetWriteTimeout value for new connections
 	TsigSecret   map[string]string // secret(s) for Tsig map[<zonename>]<base64 secret>
+	// If true, minimize the responses written by Handler, see MinimalHandler.
+	MinimalResponses bool
+	// If true, the requests are read into pooled buffers and unpacked into
+	// pooled messages, see Pools. Handler must then not keep the request,
+	// or the RRs in it, after ServeDNS returns.
+	WithPools bool
+	// If not zero, requests larger than MaxInboundSize bytes are not
+	// handled: over UDP they get a FORMERR, over TCP the connection is
+	// closed before the request is read. This is independent of the
+	// EDNS0 buffer size the server advertises.
+	MaxInboundSize int
+	// If true, the responses written by Handler are checked and the
+	// invalid ones are dropped, see ValidateHandler.
+	ValidateResponses bool
+	// If not nil, the dropped responses are logged here.
+	ErrorLog Logger
+	// If true, requests that can not be unpacked are dropped. Otherwise
+	// they are answered with a FORMERR that has the id of the request,
+	// when it has a complete header and is not a response. They are
+	// counted in the Malformed counter either way.
+	DropMalformed bool
+}
+
+// ServerStats holds the counters of a Server. The ratio between
+// ResponseBytes and RequestBytes is the amplification factor of the
+// server, which should stay low for a server open to the Internet.
+type ServerStats struct {
+	Requests      uint64 // requests read
+	Responses     uint64 // responses written
+	RequestBytes  uint64 // bytes in the requests, without the TCP length
+	ResponseBytes uint64 // bytes in the responses, without the TCP length
+	Malformed     uint64 // requests that could not be unpacked
+}
+
+// Stats returns the counters of srv.
+func (srv *Server) Stats() ServerStats {
+	return ServerStats{
+		Requests:      atomic.LoadUint64(&srv.stats.Requests),
+		Responses:     atomic.LoadUint64(&srv.stats.Responses),
+		RequestBytes:  atomic.LoadUint64(&srv.stats.RequestBytes),
+		ResponseBytes: atomic.LoadUint64(&srv.stats.ResponseBytes),
+		Malformed:     atomic.LoadUint64(&srv.stats.Malformed),
+	}
 }
 
 // ListenAndServe starts a nameserver on the configured address.
@@ -181,11 +266,8 @@ func (srv *Server) ListenAndServe() error {
 
 func (srv *Server) ServeTCP(l *net.TCPListener) error {
 	defer l.Close()
-	handler := srv.Handler
-	if handler == nil {
-		handler = DefaultServeMux
-	}
-forever:
+	handler := srv.handler()
+	pools := srv.pools()
 	for {
 		rw, e := l.AcceptTCP()
 		if e != nil {
@@ -197,33 +279,22 @@ forever:
 		if srv.WriteTimeout != 0 {
 			rw.SetWriteDeadline(time.Now().Add(srv.WriteTimeout))
 		}
-		l := make([]byte, 2)
-		n, err := rw.Read(l)
-		if err != nil || n != 2 {
-			continue
-		}
-		length, _ := unpackUint16(l, 0)
-		if length == 0 {
-			continue
-		}
-		m := make([]byte, int(length))
-		n, err = rw.Read(m[:int(length)])
+		m, err := readTCP(rw, srv.MaxInboundSize, pools)
 		if err != nil {
+			rw.Close()
 			continue
 		}
-		i := n
-		for i < int(length) {
-			j, err := rw.Read(m[i:int(length)])
-			if err != nil {
-				continue forever
-			}
-			i += j
-		}
-		n = i
 		d, err := newConn(rw, nil, rw.RemoteAddr(), m, handler)
 		if err != nil {
+			if pools != nil {
+				pools.PutBuffer(m)
+			}
+			rw.Close()
 			continue
 		}
+		d.pools = pools
+		d.stats = &srv.stats
+		d.dropMalformed = srv.DropMalformed
 		go d.serve()
 	}
 	panic("not reached")
@@ -231,20 +302,30 @@ forever:
 
 func (srv *Server) ServeUDP(l *net.UDPConn) error {
 	defer l.Close()
-	handler := srv.Handler
-	if handler == nil {
-		handler = DefaultServeMux
-	}
+	handler := srv.handler()
 	if srv.UDPSize == 0 {
 		srv.UDPSize = UDPReceiveMsgSize
 	}
+	pools := srv.pools()
 	for {
-		m := make([]byte, srv.UDPSize)
+		var m []byte
+		if pools != nil {
+			m = pools.GetBuffer(srv.UDPSize)
+		} else {
+			m = make([]byte, srv.UDPSize)
+		}
 		n, a, e := l.ReadFromUDP(m)
 		if e != nil {
 			return e
 		}
 		m = m[:n]
+		if srv.MaxInboundSize > 0 && n > srv.MaxInboundSize {
+			formErr(l, a, m)
+			if pools != nil {
+				pools.PutBuffer(m)
+			}
+			continue
+		}
 
 		if srv.ReadTimeout != 0 {
 			l.SetReadDeadline(time.Now().Add(srv.ReadTimeout))
@@ -254,13 +335,70 @@ func (srv *Server) ServeUDP(l *net.UDPConn) error {
 		}
 		d, err := newConn(nil, l, a, m, handler)
 		if err != nil {
+			if pools != nil {
+				pools.PutBuffer(m)
+			}
 			continue
 		}
+		d.pools = pools
+		d.stats = &srv.stats
+		d.dropMalformed = srv.DropMalformed
 		go d.serve()
 	}
 	panic("not reached")
 }
 
+// formErr writes a FORMERR to a, in reply to the request in buf of which
+// only the header is looked at.
+func formErr(l *net.UDPConn, a *net.UDPAddr, buf []byte) {
+	if out := formErrMsg(buf); out != nil {
+		l.WriteToUDP(out, a)
+	}
+}
+
+// formErrMsg returns a FORMERR in reply to the request in buf, with the id
+// and opcode of the request. It returns nil when buf is too short to hold
+// a header, or holds a response, which must not be answered.
+func formErrMsg(buf []byte) []byte {
+	if len(buf) < 12 { // the size of the header
+		return nil
+	}
+	bits, _ := RawFlags(buf, 0)
+	if FlagSet(bits, FlagQR) {
+		return nil
+	}
+	m := new(Msg)
+	m.Id, _ = unpackUint16(buf, 0)
+	m.Response = true
+	m.Opcode = int(bits>>11) & 0xF
+	m.Rcode = RcodeFormatError
+	out, _ := m.Pack()
+	return out
+}
+
+// handler returns the handler of srv, wrapped as its options require.
+func (srv *Server) handler() Handler {
+	handler := srv.Handler
+	if handler == nil {
+		handler = DefaultServeMux
+	}
+	if srv.MinimalResponses {
+		handler = MinimalHandler(handler)
+	}
+	if srv.ValidateResponses {
+		handler = ValidateHandler(handler, srv.ErrorLog)
+	}
+	return handler
+}
+
+// pools returns the Pools for a listener, nil without WithPools.
+func (srv *Server) pools() *Pools {
+	if srv.WithPools {
+		return new(Pools)
+	}
+	return nil
+}
+
 func newConn(t *net.TCPConn, u *net.UDPConn, a net.Addr, buf []byte, handler Handler) (*conn, error) {
 	c := new(conn)
 	c.handler = handler
@@ -285,17 +423,35 @@ func (c *conn) close() {
 
 // Serve a new connection.
 func (c *conn) serve() {
+	req := new(Msg)
+	if c.pools != nil {
+		req = c.pools.GetMsg()
+	}
+	if c.stats != nil {
+		atomic.AddUint64(&c.stats.Requests, 1)
+		atomic.AddUint64(&c.stats.RequestBytes, uint64(len(c.request)))
+	}
 	for {
 		// Request has been read in ServeUDP or ServeTCP
 		w := new(response)
 		w.conn = c
-		req := new(Msg)
-		if !req.Unpack(c.request) {
+		if req.Unpack(c.request) != nil {
+			if c.stats != nil {
+				atomic.AddUint64(&c.stats.Malformed, 1)
+			}
 			// Send a format error back
-			x := new(Msg)
-			x.SetRcodeFormatError(req)
-			buf, _ := x.Pack()
-			w.Write(buf)
+			if buf := formErrMsg(c.request); buf != nil && !c.dropMalformed {
+				w.Write(buf)
+			}
+			break
+		}
+		if len(req.Question) > 1 {
+			// No one knows how to answer more than one question
+			// (RFC 9619), so such a request is answered with a
+			// format error as well and never reaches the handler
+			if buf := formErrMsg(c.request); buf != nil {
+				w.Write(buf)
+			}
 			break
 		}
 		w.req = req
@@ -305,6 +461,12 @@ func (c *conn) serve() {
 		}
 		break // TODO(mg) Why is this a loop anyway
 	}
+	if c.pools != nil {
+		// The response has been written
+		c.pools.PutMsg(req)
+		c.pools.PutBuffer(c.request)
+		c.request = nil
+	}
 	if c._TCP != nil {
 		c.close() // Listen and Serve is closed then
 	}
@@ -318,29 +480,14 @@ func (w *response) Write(data []byte) (n int, err error) {
 			return 0, err
 		}
 	case w.conn._TCP != nil:
-		// TODO(mg) len(data) > 64K
-		l := make([]byte, 2)
-		l[0], l[1] = packUint16(uint16(len(data)))
-		n, err = w.conn._TCP.Write(l)
-		if err != nil {
-			return n, err
-		}
-		if n != 2 {
-			return n, io.ErrShortWrite
-		}
-		n, err = w.conn._TCP.Write(data)
-		if err != nil {
-			return n, err
-		}
-		i := n
-		if i < len(data) {
-			j, err := w.conn._TCP.Write(data[i:len(data)])
-			if err != nil {
-				return i, err
-			}
-			i += j
+		if err = writeTCP(w.conn._TCP, data); err != nil {
+			return 0, err
 		}
-		n = i
+		n = len(data)
+	}
+	if w.conn.stats != nil {
+		atomic.AddUint64(&w.conn.stats.Responses, 1)
+		atomic.AddUint64(&w.conn.stats.ResponseBytes, uint64(n))
 	}
 	return n, nil
 }
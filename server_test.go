@@ -1,6 +1,11 @@
 package dns
 
 import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -10,7 +15,7 @@ func HelloServer(w ResponseWriter, req *Msg) {
 	m.SetReply(req)
 
 	m.Extra = make([]RR, 1)
-	m.Extra[0] = &RR_TXT{Hdr: RR_Header{Name: m.Question[0].Name, Rrtype: TypeTXT, Class: ClassINET, Ttl: 0}, Txt: "Hello world"}
+	m.Extra[0] = &RR_TXT{Hdr: RR_Header{Name: m.Question[0].Name, Rrtype: TypeTXT, Class: ClassINET, Ttl: 0}, Txt: []string{"Hello world"}}
 	buf, _ := m.Pack()
 	w.Write(buf)
 }
@@ -44,3 +49,288 @@ func BenchmarkServing(b *testing.B) {
 		c.Exchange(m, "127.0.0.1:8053")
 	}
 }
+
+func TestMinimalHandler(t *testing.T) {
+	h := MinimalHandler(HandlerFunc(func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		for _, s := range []string{"miek.nl. IN A 127.0.0.1", "miek.nl. IN NS ns.miek.nl.", "ns.miek.nl. IN A 127.0.0.2"} {
+			rr, _ := NewRR(s)
+			switch rr.Header().Rrtype {
+			case TypeNS:
+				m.Ns = append(m.Ns, rr)
+			default:
+				if len(m.Answer) == 0 {
+					m.Answer = append(m.Answer, rr)
+				} else {
+					m.Extra = append(m.Extra, rr)
+				}
+			}
+		}
+		m.SetEdns0(4096, false)
+		buf, _ := m.Pack()
+		w.Write(buf)
+	}))
+	req := new(Msg)
+	req.SetQuestion("miek.nl.", TypeA)
+	w := new(bufferWriter)
+	h.ServeDNS(w, req)
+	m := new(Msg)
+	if len(w.msgs) != 1 || m.Unpack(w.msgs[0]) != nil {
+		t.Log("Failed to get a response")
+		t.Fail()
+		return
+	}
+	if len(m.Answer) != 1 || len(m.Ns) != 0 || len(m.Extra) != 1 || !m.IsEdns0() {
+		t.Logf("Response is not minimal: %s", m)
+		t.Fail()
+	}
+
+	// Referral, NS and glue should be kept
+	m.Answer = nil
+	m.Authoritative = false
+	ns, _ := NewRR("miek.nl. IN NS ns.miek.nl.")
+	glue, _ := NewRR("ns.miek.nl. IN A 127.0.0.2")
+	other, _ := NewRR("www.miek.nl. IN A 127.0.0.3")
+	m.Ns = []RR{ns}
+	m.Extra = []RR{glue, other}
+	m.Minimize()
+	if len(m.Ns) != 1 || len(m.Extra) != 1 || m.Extra[0] != glue {
+		t.Logf("Referral should keep NS and glue: %s", m)
+		t.Fail()
+	}
+}
+
+type lineLogger struct {
+	lines []string
+}
+
+func (l *lineLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestLogHandler(t *testing.T) {
+	l := new(lineLogger)
+	h := LogHandler(HandlerFunc(HelloServer), l)
+	req := new(Msg)
+	req.SetQuestion("miek.nl.", TypeMX)
+	req.SetEdns0(4096, true)
+	h.ServeDNS(new(bufferWriter), req)
+	if len(l.lines) != 1 {
+		t.Log("Should have logged one line")
+		t.Fail()
+		return
+	}
+	if !strings.HasPrefix(l.lines[0], "client - (miek.nl.): query: miek.nl. IN MX +E(0)D rcode: NOERROR bytes: ") {
+		t.Logf("Wrong log line: %s", l.lines[0])
+		t.Fail()
+	}
+}
+
+func TestServerStats(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	srv := &Server{Handler: HandlerFunc(HelloServer)}
+	go srv.ServeUDP(l)
+
+	c := NewClient()
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	r, info, err := c.ExchangeWithInfo(m, l.LocalAddr().String())
+	if err != nil {
+		t.Logf("Failed to exchange: %s", err)
+		t.Fail()
+		return
+	}
+	if info.RequestSize != m.Len() || info.ResponseSize != r.Len() || info.Rtt <= 0 {
+		t.Logf("Expected a request of %d and a response of %d bytes, got %+v", m.Len(), r.Len(), info)
+		t.Fail()
+	}
+	if r.CompressedLen() >= r.Len() {
+		t.Logf("Expected the compressed length %d to be below %d", r.CompressedLen(), r.Len())
+		t.Fail()
+	}
+	// The response is written before the counters are updated
+	time.Sleep(10 * time.Millisecond)
+	s := srv.Stats()
+	if s.Requests != 1 || s.Responses != 1 || s.RequestBytes != uint64(info.RequestSize) || s.ResponseBytes != uint64(info.ResponseSize) {
+		t.Logf("Wrong server counters %+v for %+v", s, info)
+		t.Fail()
+	}
+}
+
+func TestMaxInboundSize(t *testing.T) {
+	u, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(HelloServer), MaxInboundSize: 64}).ServeUDP(u)
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(HelloServer), MaxInboundSize: 64}).ServeTCP(l)
+
+	small := new(Msg)
+	small.SetQuestion("miek.nl.", TypeTXT)
+	large := new(Msg)
+	large.SetQuestion("a-rather-long-label-to-make-this-query-large.miek.nl.", TypeTXT)
+	large.SetEdns0(4096, false)
+
+	c := NewClient()
+	if r, err := c.Exchange(small, u.LocalAddr().String()); err != nil || r.Rcode != RcodeSuccess {
+		t.Logf("Expected an answer for a small query, got %v: %v", err, r)
+		t.Fail()
+	}
+	if r, err := c.Exchange(large, u.LocalAddr().String()); err != nil || r.Rcode != RcodeFormatError || r.Id != large.Id {
+		t.Logf("Expected FORMERR for a large query, got %v: %v", err, r)
+		t.Fail()
+	}
+	tcp := func(m *Msg) (*Msg, error) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		return c.ExchangeConn(m, conn)
+	}
+	if _, err := tcp(small); err != nil {
+		t.Logf("Expected an answer for a small query over TCP, got %v", err)
+		t.Fail()
+	}
+	if r, err := tcp(large); err == nil {
+		t.Logf("Expected the connection to be closed for a large query, got %v", r)
+		t.Fail()
+	}
+
+	c.MaxInboundSize = 32
+	if _, err := tcp(small); err != ErrInboundSize {
+		t.Logf("Expected ErrInboundSize for a large reply over TCP, got %v", err)
+		t.Fail()
+	}
+	if _, err := c.Exchange(small, u.LocalAddr().String()); err != ErrInboundSize {
+		t.Logf("Expected ErrInboundSize for a large reply, got %v", err)
+		t.Fail()
+	}
+}
+
+func TestServeTCPSplit(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	go (&Server{Handler: HandlerFunc(HelloServer)}).ServeTCP(l)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Logf("Failed to dial: %s", err)
+		t.Fail()
+		return
+	}
+	defer conn.Close()
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeTXT)
+	var b bytes.Buffer
+	WriteMsgTCP(&b, m)
+	// The query arrives a byte at a time
+	for _, c := range b.Bytes() {
+		conn.Write([]byte{c})
+		time.Sleep(time.Millisecond)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if r, err := ReadMsgTCP(conn); err != nil || r.Id != m.Id {
+		t.Logf("Expected an answer for a split query, got %v: %v", err, r)
+		t.Fail()
+	}
+}
+
+func TestServerMalformed(t *testing.T) {
+	for _, drop := range []bool{false, true} {
+		l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Logf("Failed to listen: %s", err)
+			t.Fail()
+			return
+		}
+		srv := &Server{Handler: HandlerFunc(HelloServer), DropMalformed: drop}
+		go srv.ServeUDP(l)
+
+		conn, err := net.Dial("udp", l.LocalAddr().String())
+		if err != nil {
+			t.Logf("Failed to dial: %s", err)
+			t.Fail()
+			return
+		}
+		// A header with an id and a question count, but no question, a
+		// response and a short packet
+		for _, p := range [][]byte{{0x12, 0x34, 0x28, 0, 0, 1, 0, 0, 0, 0, 0, 0}, {0x12, 0x34, 0x80, 0, 0, 1, 0, 0, 0, 0, 0, 0}, {1, 2, 3}} {
+			conn.Write(p)
+		}
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		var replies []*Msg
+		for {
+			buf := make([]byte, 512)
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			m := new(Msg)
+			if m.Unpack(buf[:n]) == nil {
+				replies = append(replies, m)
+			}
+		}
+		conn.Close()
+		switch {
+		case drop && len(replies) != 0:
+			t.Logf("Expected no replies, got %v", replies)
+			t.Fail()
+		case !drop && (len(replies) != 1 || replies[0].Id != 0x1234 || replies[0].Rcode != RcodeFormatError || replies[0].Opcode != OpcodeUpdate):
+			t.Logf("Expected one FORMERR for the update, got %v", replies)
+			t.Fail()
+		}
+		if s := srv.Stats(); s.Malformed != 3 {
+			t.Logf("Expected 3 malformed requests, got %d", s.Malformed)
+			t.Fail()
+		}
+	}
+}
+
+func TestServerQuestions(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	var called int32
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		atomic.AddInt32(&called, 1)
+		HelloServer(w, req)
+	})}).ServeUDP(l)
+
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	m.Question = append(m.Question, Question{"miek.nl.", TypeAAAA, ClassINET})
+	if m.IsAxfr() || m.IsNotify() {
+		t.Log("A message with two questions is not a transfer or notify")
+		t.Fail()
+	}
+	r, err := NewClient().Exchange(m, l.LocalAddr().String())
+	if err != nil || r.Rcode != RcodeFormatError || len(r.Question) != 0 {
+		t.Logf("Expected FORMERR for two questions, got %v: %v", err, r)
+		t.Fail()
+	}
+	if atomic.LoadInt32(&called) != 0 {
+		t.Log("The handler was called for a request with two questions")
+		t.Fail()
+	}
+}
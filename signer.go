@@ -0,0 +1,248 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Online signing: signing the responses of a handler as they are sent.
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An OnlineSigner is a Handler that signs the responses of another
+// Handler, for clients that set the DO bit. This gives DNSSEC for
+// responses that are generated on the fly, without a signed zone.
+//
+// The RRsets in the answer and authority sections that are in Zone are
+// signed with Key; the signatures are cached. The NS RRset of a referral
+// and the additional section are not signed. Denial of existence is done
+// with "black lies": a negative response (with a SOA record in the
+// authority section) is turned into a NODATA response, with an NSEC record
+// for the query name (or the target of the CNAME chain in the answer) that
+// only lists the RRSIG and NSEC types and has the name directly following
+// it as next name. Note that this NSEC record also denies the types that do
+// exist for the name. Responses that hold NSEC or NSEC3 records already
+// are only signed.
+type OnlineSigner struct {
+	Handler  Handler       // the handler whose responses are signed
+	Zone     string        // the zone the responses are for, the signer name
+	Key      *RR_DNSKEY    // the DNSKEY record of the zone signing key
+	PrivKey  PrivateKey    // the private key of Key
+	Validity time.Duration // validity period of the signatures, a day if zero
+	MaxCache int           // maximum number of cached signatures, 10000 if zero
+
+	mu    sync.Mutex
+	cache map[string]*RR_RRSIG
+}
+
+// ServeDNS calls s.Handler and signs the response it writes. Responses
+// that can not be unpacked or that carry a TSIG record are written as is.
+func (s *OnlineSigner) ServeDNS(w ResponseWriter, r *Msg) {
+	opt := requestOpt(r)
+	if opt == nil || !opt.Do() {
+		s.Handler.ServeDNS(w, r)
+		return
+	}
+	size := int(opt.UDPSize())
+	if size < 512 {
+		size = 512
+	}
+	s.Handler.ServeDNS(&signingWriter{ResponseWriter: w, s: s, size: size}, r)
+}
+
+type signingWriter struct {
+	ResponseWriter
+	s    *OnlineSigner
+	size int // the UDP message size of the client
+}
+
+func (w *signingWriter) Write(data []byte) (int, error) {
+	m := new(Msg)
+	if m.Unpack(data) != nil || m.IsTsig() {
+		return w.ResponseWriter.Write(data)
+	}
+	if err := w.s.Sign(m, time.Now()); err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	m.Compress = true
+	buf, err := m.Pack()
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok && len(buf) > w.size {
+		m.Truncated = true
+		m.Answer, m.Ns = nil, nil
+		m.Extra = filterRRs(m.Extra, func(r RR) bool { return r.Header().Rrtype == TypeOPT })
+		if buf, err = m.Pack(); err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseWriter.Write(buf)
+}
+
+// Sign adds the signatures and the denial of existence to the response m,
+// as described for OnlineSigner. Signatures are valid from an hour before
+// now.
+func (s *OnlineSigner) Sign(m *Msg, now time.Time) error {
+	zone := Fqdn(s.Zone)
+	if len(m.Question) == 1 && (m.Rcode == RcodeSuccess || m.Rcode == RcodeNameError) && m.Question[0].Qtype != TypeANY {
+		q := m.Question[0]
+		rrs, target, err := ChaseCNAME(m, q.Name, q.Qtype)
+		soa := findSoa(m.Ns)
+		if err == nil && soa != nil && !hasType(rrs, q.Qtype) && isSubDomain(zone, target) &&
+			!hasType(m.Ns, TypeNSEC) && !hasType(m.Ns, TypeNSEC3) {
+			// Black lie: the name exists, but not with this type
+			m.Rcode = RcodeSuccess
+			m.Ns = append(m.Ns, s.nsec(target, NegativeSoa(soa).Hdr.Ttl))
+		}
+	}
+	referral := len(m.Answer) == 0 && findSoa(m.Ns) == nil
+	var err error
+	if m.Answer, err = s.signSection(m.Answer, zone, false, now); err != nil {
+		return err
+	}
+	m.Ns, err = s.signSection(m.Ns, zone, referral, now)
+	return err
+}
+
+// signSection returns rrs with the RRSIGs for its RRsets added after each
+// RRset. When referral is true, NS RRsets are not signed.
+func (s *OnlineSigner) signSection(rrs []RR, zone string, referral bool, now time.Time) ([]RR, error) {
+	var out []RR
+	for _, idx := range rrsetIndices(rrs) {
+		set := make(RRset, len(idx))
+		for i, j := range idx {
+			set[i] = rrs[j]
+		}
+		out = append(out, set...)
+		h := set[0].Header()
+		switch {
+		case h.Rrtype == TypeRRSIG, h.Rrtype == TypeOPT, h.Rrtype == TypeTSIG:
+			continue
+		case referral && h.Rrtype == TypeNS:
+			continue
+		case !isSubDomain(zone, h.Name):
+			continue
+		}
+		sig, err := s.sign(set, zone, now)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sig)
+	}
+	return out, nil
+}
+
+// sign returns the RRSIG for rrset, from the cache when possible. Cached
+// signatures are used until half of their validity period has passed.
+func (s *OnlineSigner) sign(rrset RRset, zone string, now time.Time) (*RR_RRSIG, error) {
+	k := signerCacheKey(s.Key, rrset)
+	s.mu.Lock()
+	sig, ok := s.cache[k]
+	s.mu.Unlock()
+	if ok && int64(sig.Expiration)-now.Unix() > int64(s.validity()/time.Second)/2 {
+		return sig, nil
+	}
+	sig = new(RR_RRSIG)
+	sig.Hdr.Ttl = rrset[0].Header().Ttl
+	sig.KeyTag = s.Key.KeyTag()
+	sig.Algorithm = s.Key.Algorithm
+	sig.SignerName = strings.ToLower(zone)
+	sig.Inception = uint32(now.Add(-time.Hour).Unix())
+	sig.Expiration = uint32(now.Add(s.validity()).Unix())
+	if err := sig.Sign(s.PrivKey, rrset); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.cache == nil || len(s.cache) >= s.maxCache() {
+		s.cache = make(map[string]*RR_RRSIG)
+	}
+	s.cache[k] = sig
+	s.mu.Unlock()
+	return sig, nil
+}
+
+// nsec returns the black lie NSEC record for name.
+func (s *OnlineSigner) nsec(name string, ttl uint32) *RR_NSEC {
+	return &RR_NSEC{Hdr: RR_Header{Name: name, Rrtype: TypeNSEC, Class: ClassINET, Ttl: ttl},
+		NextDomain: "\x00." + name, TypeBitMap: []uint16{TypeRRSIG, TypeNSEC}}
+}
+
+func (s *OnlineSigner) validity() time.Duration {
+	if s.Validity <= 0 {
+		return 24 * time.Hour
+	}
+	return s.Validity
+}
+
+func (s *OnlineSigner) maxCache() int {
+	if s.MaxCache <= 0 {
+		return 10000
+	}
+	return s.MaxCache
+}
+
+// signerCacheKey returns the key for rrset in the signature cache: the key
+// tag and algorithm of key, the TTL and the RRs in a fixed order. A
+// signature made with a previous key is thus not used after the key
+// changes. Unlike in rrKey the case of the domain names in the rdata is
+// kept, as it is in the signed data.
+func signerCacheKey(key *RR_DNSKEY, rrset RRset) string {
+	keys := make([]string, 0, len(rrset))
+	for _, r := range rrset {
+		h := r.Header()
+		rdata, _ := rawRdata(r)
+		keys = append(keys, strings.ToLower(h.Name)+" "+strconv.Itoa(int(h.Class))+
+			" "+strconv.Itoa(int(h.Rrtype))+" "+string(rdata))
+	}
+	sort.Strings(keys)
+	return strconv.Itoa(int(key.KeyTag())) + "\x00" + strconv.Itoa(int(key.Algorithm)) + "\x00" +
+		strconv.Itoa(int(rrset[0].Header().Ttl)) + "\x00" + strings.Join(keys, "\x00")
+}
+
+// requestOpt returns the OPT record of r, or nil.
+func requestOpt(r *Msg) *RR_OPT {
+	for _, e := range r.Extra {
+		if o, ok := e.(*RR_OPT); ok {
+			return o
+		}
+	}
+	return nil
+}
+
+// hasType returns true if rrs holds an RR of type t.
+func hasType(rrs []RR, t uint16) bool {
+	for _, r := range rrs {
+		if r.Header().Rrtype == t {
+			return true
+		}
+	}
+	return false
+}
+
+// findSoa returns the first SOA record in rrs, or nil.
+func findSoa(rrs []RR) *RR_SOA {
+	for _, r := range rrs {
+		if soa, ok := r.(*RR_SOA); ok {
+			return soa
+		}
+	}
+	return nil
+}
+
+// filterRRs returns the RRs in rrs for which keep returns true.
+func filterRRs(rrs []RR, keep func(RR) bool) []RR {
+	var out []RR
+	for _, r := range rrs {
+		if keep(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
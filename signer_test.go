@@ -0,0 +1,98 @@
+package dns
+
+import (
+	"testing"
+)
+
+func signerHandler(w ResponseWriter, r *Msg) {
+	soa, _ := NewRR("miek.nl. 3600 IN SOA linode.atoom.net. miek.miek.nl. 1282630057 14400 3600 604800 300")
+	m := new(Msg)
+	if r.Question[0].Name == "www.miek.nl." {
+		m.SetReply(r)
+		m.Answer = newRRs("www.miek.nl. 300 IN A 127.0.0.1", "www.miek.nl. 300 IN A 127.0.0.2")
+	} else {
+		m.SetNXDOMAIN(r, soa.(*RR_SOA))
+	}
+	buf, _ := m.Pack()
+	w.Write(buf)
+}
+
+func signerQuery(h Handler, name string, do bool) *Msg {
+	r := new(Msg)
+	r.SetQuestion(name, TypeA)
+	if do {
+		r.SetEdns0(4096, true)
+	}
+	w := new(bufferWriter)
+	h.ServeDNS(w, r)
+	m := new(Msg)
+	if len(w.msgs) != 1 || m.Unpack(w.msgs[0]) != nil {
+		return nil
+	}
+	return m
+}
+
+func TestOnlineSigner(t *testing.T) {
+	key := &RR_DNSKEY{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeDNSKEY, Class: ClassINET, Ttl: 3600},
+		Flags: ZONE, Protocol: 3, Algorithm: ED25519}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Logf("Failed to generate key: %s", err)
+		t.Fail()
+		return
+	}
+	s := &OnlineSigner{Handler: HandlerFunc(signerHandler), Zone: "miek.nl.", Key: key, PrivKey: priv}
+
+	m := signerQuery(s, "www.miek.nl.", true)
+	if m == nil || len(m.Answer) != 3 {
+		t.Logf("Answer should be signed:\n%s", m)
+		t.Fail()
+		return
+	}
+	sig, ok := m.Answer[2].(*RR_RRSIG)
+	if !ok || sig.Verify(key, m.Answer[:2]) != nil {
+		t.Logf("Signature does not verify:\n%s", m)
+		t.Fail()
+	}
+	// The signature comes from the cache the second time
+	if m2 := signerQuery(s, "www.miek.nl.", true); m2 == nil || len(m2.Answer) != 3 || m2.Answer[2].(*RR_RRSIG).Signature != sig.Signature {
+		t.Log("Signature should be cached")
+		t.Fail()
+	}
+	// A new key gets new signatures
+	key2 := &RR_DNSKEY{Hdr: key.Hdr, Flags: ZONE, Protocol: 3, Algorithm: ED25519}
+	priv2, _ := key2.Generate(256)
+	s.Key, s.PrivKey = key2, priv2
+	if m2 := signerQuery(s, "www.miek.nl.", true); m2 == nil || len(m2.Answer) != 3 || m2.Answer[2].(*RR_RRSIG).Verify(key2, m2.Answer[:2]) != nil {
+		t.Logf("Signature should be made with the new key:\n%s", m2)
+		t.Fail()
+	}
+	s.Key, s.PrivKey = key, priv
+
+	// Black lie
+	m = signerQuery(s, "nx.miek.nl.", true)
+	if m == nil || m.Rcode != RcodeSuccess || len(m.Ns) != 4 {
+		t.Logf("Expected a signed NODATA response:\n%s", m)
+		t.Fail()
+		return
+	}
+	nsec, ok := m.Ns[2].(*RR_NSEC)
+	if !ok || nsec.Hdr.Name != "nx.miek.nl." || nsec.Hdr.Ttl != 300 || nsec.NextDomain != "\x00.nx.miek.nl." {
+		t.Logf("Wrong NSEC record:\n%s", m)
+		t.Fail()
+	}
+	if sig, ok := m.Ns[3].(*RR_RRSIG); !ok || sig.Verify(key, m.Ns[2:3]) != nil {
+		t.Logf("NSEC signature does not verify:\n%s", m)
+		t.Fail()
+	}
+	if sig, ok := m.Ns[1].(*RR_RRSIG); !ok || sig.Verify(key, m.Ns[:1]) != nil {
+		t.Logf("SOA signature does not verify:\n%s", m)
+		t.Fail()
+	}
+
+	// No DO bit, no signatures
+	if m = signerQuery(s, "nx.miek.nl.", false); m == nil || m.Rcode != RcodeNameError || len(m.Ns) != 1 {
+		t.Logf("Response without DO should not be signed:\n%s", m)
+		t.Fail()
+	}
+}
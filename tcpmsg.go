@@ -0,0 +1,83 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// The framing of messages over TCP: each message is preceded by its
+// length in two bytes (RFC 1035, section 4.2.2).
+
+import (
+	"io"
+)
+
+// ReadMsgTCP reads a message from r, framed as over TCP, and unpacks it.
+// A zero length is an error, ErrShortRead, as is a message that ends
+// early, io.ErrUnexpectedEOF. At the end of r io.EOF is returned.
+func ReadMsgTCP(r io.Reader) (*Msg, error) {
+	buf, err := readTCP(r, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Msg)
+	if err := m.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteMsgTCP packs m and writes it to w, framed as over TCP. The length
+// and the message are written with a single Write.
+func WriteMsgTCP(w io.Writer, m *Msg) error {
+	buf, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	return writeTCP(w, buf)
+}
+
+// readTCP reads the length and then the message from r. When max is not
+// zero, a message longer than max is not read, ErrInboundSize is returned.
+// The buffer for the message comes from pools, if not nil.
+func readTCP(r io.Reader, max int, pools *Pools) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	n, _ := unpackUint16(l[:], 0)
+	if n == 0 {
+		return nil, ErrShortRead
+	}
+	if max > 0 && int(n) > max {
+		return nil, ErrInboundSize
+	}
+	var buf []byte
+	if pools != nil {
+		buf = pools.GetBuffer(int(n))
+	} else {
+		buf = make([]byte, n)
+	}
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if pools != nil {
+			pools.PutBuffer(buf)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writeTCP writes the length of data and data to w.
+func writeTCP(w io.Writer, data []byte) error {
+	if len(data) > MaxMsgSize-1 {
+		return ErrBuf
+	}
+	a, b := packUint16(uint16(len(data)))
+	n, err := w.Write(append([]byte{a, b}, data...))
+	if err == nil && n != len(data)+2 {
+		err = io.ErrShortWrite
+	}
+	return err
+}
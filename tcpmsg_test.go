@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMsgTCP(t *testing.T) {
+	var b bytes.Buffer
+	for _, name := range []string{"miek.nl.", "www.miek.nl."} {
+		m := new(Msg)
+		m.SetQuestion(name, TypeMX)
+		if err := WriteMsgTCP(&b, m); err != nil {
+			t.Logf("Failed to write %s: %s", name, err)
+			t.Fail()
+			return
+		}
+	}
+	stream := append([]byte{}, b.Bytes()...)
+	for _, name := range []string{"miek.nl.", "www.miek.nl."} {
+		m, err := ReadMsgTCP(&b)
+		if err != nil || m.Question[0].Name != name || m.Question[0].Qtype != TypeMX {
+			t.Logf("Expected the query for %s, got %v: %v", name, err, m)
+			t.Fail()
+		}
+	}
+	if _, err := ReadMsgTCP(&b); err != io.EOF {
+		t.Logf("Expected io.EOF at the end, got %v", err)
+		t.Fail()
+	}
+	if _, err := ReadMsgTCP(bytes.NewReader(stream[:10])); err != io.ErrUnexpectedEOF {
+		t.Logf("Expected io.ErrUnexpectedEOF for a short message, got %v", err)
+		t.Fail()
+	}
+	if _, err := ReadMsgTCP(bytes.NewReader([]byte{0, 0})); err != ErrShortRead {
+		t.Logf("Expected ErrShortRead for a zero length, got %v", err)
+		t.Fail()
+	}
+}
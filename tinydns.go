@@ -0,0 +1,361 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Conversion from and to the data file of djbdns' tinydns.
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// The defaults of tinydns-data.
+const (
+	tinyTtlNS   = 259200
+	tinyTtl     = 86400
+	tinyTtlSOA  = 2560
+	tinyRefresh = 16384
+	tinyRetry   = 2048
+	tinyExpire  = 1048576
+	tinyMinimum = 2560
+)
+
+// ReadTinydns reads the tinydns-data(8) data file in r and returns the RRs
+// it describes, as tinydns-data would create them. The SOA records of the
+// '.' lines get serial as serial number, tinydns-data uses the
+// modification time of the file. The lines for AAAA records ('3' and '6')
+// are understood too. Timestamps and locations are ignored, as are lines
+// starting with '#', '-' and '%'.
+func ReadTinydns(r io.Reader, serial uint32) ([]RR, error) {
+	var rrs []RR
+	b := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := b.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			r, e := tinyLine(line, serial)
+			if e != nil {
+				return nil, &Error{Err: "tinydns: " + e.Error() + " at line " + strconv.Itoa(n), Name: line}
+			}
+			rrs = append(rrs, r...)
+		}
+		if err == io.EOF {
+			return rrs, nil
+		}
+	}
+}
+
+// tinyLine returns the RRs for one line of a data file.
+func tinyLine(line string, serial uint32) ([]RR, error) {
+	switch line[0] {
+	case '#', '-', '%':
+		// Comments, disabled records and locations are not parsed
+		return nil, nil
+	}
+	f := strings.Split(line[1:], ":")
+	field := func(i int) string {
+		if i < len(f) {
+			return f[i]
+		}
+		return ""
+	}
+	name, err := tinyName(field(0))
+	if err != nil {
+		return nil, err
+	}
+	hdr := func(t uint16, i int, ttl uint32) (RR_Header, error) {
+		if s := field(i); s != "" {
+			n, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return RR_Header{}, &Error{Err: "bad ttl", Name: s}
+			}
+			ttl = uint32(n)
+		}
+		return RR_Header{Name: name, Rrtype: t, Class: ClassINET, Ttl: ttl}, nil
+	}
+	// host returns the name in field i, x.label.name when it has no dot.
+	host := func(i int, label string) (string, error) {
+		s := field(i)
+		if s != "" && !strings.Contains(s, ".") {
+			s += "." + label + "." + strings.TrimSuffix(name, ".")
+		}
+		return tinyName(s)
+	}
+	var rrs []RR
+	switch line[0] {
+	case '.', '&':
+		h, err := hdr(TypeNS, 3, tinyTtlNS)
+		if err != nil {
+			return nil, err
+		}
+		ns, err := host(2, "ns")
+		if err != nil {
+			return nil, err
+		}
+		if line[0] == '.' {
+			soa := &RR_SOA{Hdr: h, Ns: ns, Mbox: "hostmaster." + name, Serial: serial,
+				Refresh: tinyRefresh, Retry: tinyRetry, Expire: tinyExpire, Minttl: tinyMinimum}
+			soa.Hdr.Rrtype = TypeSOA
+			soa.Hdr.Ttl = tinyTtlSOA
+			rrs = append(rrs, soa)
+		}
+		rrs = append(rrs, &RR_NS{Hdr: h, Ns: ns})
+		a, err := tinyA(ns, field(1), h.Ttl)
+		if err != nil {
+			return nil, err
+		}
+		if a != nil {
+			rrs = append(rrs, a)
+		}
+	case '=', '+':
+		h, err := hdr(TypeA, 2, tinyTtl)
+		if err != nil {
+			return nil, err
+		}
+		a, err := tinyA(name, field(1), h.Ttl)
+		if err != nil || a == nil {
+			return nil, &Error{Err: "bad address", Name: field(1)}
+		}
+		rrs = append(rrs, a)
+		if line[0] == '=' {
+			rev := reverseAddr(a.(*RR_A).A)
+			rrs = append(rrs, &RR_PTR{Hdr: RR_Header{Name: rev, Rrtype: TypePTR, Class: ClassINET, Ttl: h.Ttl}, Ptr: name})
+		}
+	case '3', '6':
+		h, err := hdr(TypeAAAA, 2, tinyTtl)
+		if err != nil {
+			return nil, err
+		}
+		ip, err := hex.DecodeString(field(1))
+		if err != nil || len(ip) != net.IPv6len {
+			return nil, &Error{Err: "bad address", Name: field(1)}
+		}
+		rrs = append(rrs, &RR_AAAA{Hdr: h, AAAA: net.IP(ip)})
+		if line[0] == '6' {
+			rev := reverseAddr(net.IP(ip))
+			rrs = append(rrs, &RR_PTR{Hdr: RR_Header{Name: rev, Rrtype: TypePTR, Class: ClassINET, Ttl: h.Ttl}, Ptr: name})
+		}
+	case '@':
+		h, err := hdr(TypeMX, 4, tinyTtl)
+		if err != nil {
+			return nil, err
+		}
+		mx, err := host(2, "mx")
+		if err != nil {
+			return nil, err
+		}
+		pref := uint64(0)
+		if s := field(3); s != "" {
+			if pref, err = strconv.ParseUint(s, 10, 16); err != nil {
+				return nil, &Error{Err: "bad distance", Name: s}
+			}
+		}
+		rrs = append(rrs, &RR_MX{Hdr: h, Pref: uint16(pref), Mx: mx})
+		a, err := tinyA(mx, field(1), h.Ttl)
+		if err != nil {
+			return nil, err
+		}
+		if a != nil {
+			rrs = append(rrs, a)
+		}
+	case '\'':
+		h, err := hdr(TypeTXT, 2, tinyTtl)
+		if err != nil {
+			return nil, err
+		}
+		s, err := tinyUnescape(field(1))
+		if err != nil {
+			return nil, err
+		}
+		// tinydns-data splits the text in strings of 127 bytes
+		txt := &RR_TXT{Hdr: h}
+		for len(s) > 127 {
+			txt.Txt, s = append(txt.Txt, s[:127]), s[127:]
+		}
+		txt.Txt = append(txt.Txt, s)
+		rrs = append(rrs, txt)
+	case '^', 'C':
+		t := TypePTR
+		if line[0] == 'C' {
+			t = TypeCNAME
+		}
+		h, err := hdr(t, 2, tinyTtl)
+		if err != nil {
+			return nil, err
+		}
+		p, err := tinyName(field(1))
+		if err != nil {
+			return nil, err
+		}
+		if t == TypePTR {
+			rrs = append(rrs, &RR_PTR{Hdr: h, Ptr: p})
+		} else {
+			rrs = append(rrs, &RR_CNAME{Hdr: h, Cname: p})
+		}
+	case 'Z':
+		h, err := hdr(TypeSOA, 8, tinyTtlSOA)
+		if err != nil {
+			return nil, err
+		}
+		soa := &RR_SOA{Hdr: h, Serial: serial, Refresh: tinyRefresh, Retry: tinyRetry, Expire: tinyExpire, Minttl: tinyMinimum}
+		if soa.Ns, err = tinyName(field(1)); err != nil {
+			return nil, err
+		}
+		if soa.Mbox, err = tinyName(field(2)); err != nil {
+			return nil, err
+		}
+		for i, v := range []*uint32{&soa.Serial, &soa.Refresh, &soa.Retry, &soa.Expire, &soa.Minttl} {
+			if s := field(3 + i); s != "" {
+				n, err := strconv.ParseUint(s, 10, 32)
+				if err != nil {
+					return nil, &Error{Err: "bad SOA field", Name: s}
+				}
+				*v = uint32(n)
+			}
+		}
+		rrs = append(rrs, soa)
+	case ':':
+		t, err := strconv.ParseUint(field(1), 10, 16)
+		if err != nil {
+			return nil, &Error{Err: "bad type", Name: field(1)}
+		}
+		h, err := hdr(uint16(t), 3, tinyTtl)
+		if err != nil {
+			return nil, err
+		}
+		rdata, err := tinyUnescape(field(2))
+		if err != nil {
+			return nil, err
+		}
+		rr, err := NewRR(h.Name + " " + strconv.Itoa(int(h.Ttl)) + " IN TYPE" + field(1) + " \\# " +
+			strconv.Itoa(len(rdata)) + " " + hex.EncodeToString([]byte(rdata)))
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, rr)
+	default:
+		return nil, &Error{Err: "unknown line type", Name: line[:1]}
+	}
+	return rrs, nil
+}
+
+// tinyA returns the A record for name with address ip, nil if ip is empty.
+func tinyA(name, ip string, ttl uint32) (RR, error) {
+	if ip == "" {
+		return nil, nil
+	}
+	a := net.ParseIP(ip).To4()
+	if a == nil {
+		return nil, &Error{Err: "bad address", Name: ip}
+	}
+	return &RR_A{Hdr: RR_Header{Name: name, Rrtype: TypeA, Class: ClassINET, Ttl: ttl}, A: a}, nil
+}
+
+// tinyName returns the fully qualified, lowercased, name for the name s
+// from a data file.
+func tinyName(s string) (string, error) {
+	s, err := tinyUnescape(s)
+	if err != nil {
+		return "", err
+	}
+	return Fqdn(strings.ToLower(s)), nil
+}
+
+// tinyUnescape replaces the \ooo octal escapes in s.
+func tinyUnescape(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+3 >= len(s) {
+			return "", &Error{Err: "bad escape", Name: s}
+		}
+		n, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", &Error{Err: "bad escape", Name: s}
+		}
+		b = append(b, byte(n))
+		i += 3
+	}
+	return string(b), nil
+}
+
+// tinyEscape escapes the bytes in s that can not be in a data file
+// as \ooo.
+func tinyEscape(s string) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == ':' || c == '\\' {
+			o := strconv.FormatUint(uint64(c), 8)
+			b = append(b, '\\')
+			b = append(b, strings.Repeat("0", 3-len(o))+o...)
+			continue
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// WriteTinydns writes rrs to w as lines of a tinydns-data(8) data file.
+// A, AAAA, NS, MX, PTR, CNAME and SOA records, and TXT records with one
+// string of at most 127 bytes, get their own kind of line, the other RRs
+// are written as generic ':' lines. The class of the RRs is not written,
+// tinydns only serves class IN.
+func WriteTinydns(w io.Writer, rrs []RR) error {
+	b := bufio.NewWriter(w)
+	for _, rr := range rrs {
+		h := rr.Header()
+		name := tinyEscape(strings.TrimSuffix(h.Name, "."))
+		ttl := strconv.FormatUint(uint64(h.Ttl), 10)
+		var line string
+		switch x := rr.(type) {
+		case *RR_A:
+			line = "+" + name + ":" + x.A.String() + ":" + ttl
+		case *RR_AAAA:
+			line = "3" + name + ":" + hex.EncodeToString(x.AAAA.To16()) + ":" + ttl
+		case *RR_NS:
+			line = "&" + name + "::" + tinyEscape(x.Ns) + ":" + ttl
+		case *RR_MX:
+			line = "@" + name + "::" + tinyEscape(x.Mx) + ":" + strconv.Itoa(int(x.Pref)) + ":" + ttl
+		case *RR_PTR:
+			line = "^" + name + ":" + tinyEscape(x.Ptr) + ":" + ttl
+		case *RR_CNAME:
+			line = "C" + name + ":" + tinyEscape(x.Cname) + ":" + ttl
+		case *RR_SOA:
+			line = "Z" + name + ":" + tinyEscape(x.Ns) + ":" + tinyEscape(x.Mbox)
+			for _, v := range []uint32{x.Serial, x.Refresh, x.Retry, x.Expire, x.Minttl} {
+				line += ":" + strconv.FormatUint(uint64(v), 10)
+			}
+			line += ":" + ttl
+		case *RR_TXT:
+			if len(x.Txt) == 1 && len(x.Txt[0]) <= 127 {
+				line = "'" + name + ":" + tinyEscape(x.Txt[0]) + ":" + ttl
+			}
+		}
+		if line == "" {
+			rdata, ok := rawRdata(rr)
+			if !ok {
+				return &Error{Err: "tinydns: can not pack rdata", Name: h.Name}
+			}
+			line = ":" + name + ":" + strconv.Itoa(int(h.Rrtype)) + ":" + tinyEscape(string(rdata)) + ":" + ttl
+		}
+		if _, err := b.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
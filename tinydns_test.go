@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testTinydns = `# A tinydns data file
+# in /service/tinydns/root\data
+%in:192.168
+.miek.nl:192.168.1.1:a
+@miek.nl:192.168.1.2:mx1:10
+=www.miek.nl:192.168.1.3:3600
++Ftp.Miek.NL:192.168.1.4
+Calias.miek.nl:www.miek.nl
+'txt.miek.nl:v=spf1\072-all
+6six.miek.nl:20010db8000000000000000000000001
+:gen.miek.nl:65280:\001\002\072
+-disabled.miek.nl:192.168.1.5
+`
+
+func TestReadTinydns(t *testing.T) {
+	rrs, err := ReadTinydns(strings.NewReader(testTinydns), 2012)
+	if err != nil {
+		t.Logf("Failed to read data file: %s", err)
+		t.Fail()
+		return
+	}
+	want := []string{
+		"miek.nl.\t2560\tIN\tSOA\ta.ns.miek.nl. hostmaster.miek.nl. 2012 16384 2048 1048576 2560",
+		"miek.nl.\t259200\tIN\tNS\ta.ns.miek.nl.",
+		"a.ns.miek.nl.\t259200\tIN\tA\t192.168.1.1",
+		"miek.nl.\t86400\tIN\tMX\t10 mx1.mx.miek.nl.",
+		"mx1.mx.miek.nl.\t86400\tIN\tA\t192.168.1.2",
+		"www.miek.nl.\t3600\tIN\tA\t192.168.1.3",
+		"3.1.168.192.in-addr.arpa.\t3600\tIN\tPTR\twww.miek.nl.",
+		"ftp.miek.nl.\t86400\tIN\tA\t192.168.1.4",
+		"alias.miek.nl.\t86400\tIN\tCNAME\twww.miek.nl.",
+		"txt.miek.nl.\t86400\tIN\tTXT\t\"v=spf1:-all\"",
+		"six.miek.nl.\t86400\tIN\tAAAA\t2001:db8::1",
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.\t86400\tIN\tPTR\tsix.miek.nl.",
+	}
+	if len(rrs) != len(want)+1 {
+		t.Logf("Expected %d RRs, got %d: %v", len(want)+1, len(rrs), rrs)
+		t.Fail()
+		return
+	}
+	for i, w := range want {
+		if rrs[i].String() != w {
+			t.Logf("RR %d: expected %q, got %q", i, w, rrs[i].String())
+			t.Fail()
+		}
+	}
+	gen := rrs[len(want)]
+	if gen.Header().Rrtype != 65280 {
+		t.Logf("Expected a generic RR of type 65280, got %s", gen)
+		t.Fail()
+	}
+	if rdata, _ := rawRdata(gen); !bytes.Equal(rdata, []byte{1, 2, ':'}) {
+		t.Logf("Wrong rdata of the generic RR: %v", rdata)
+		t.Fail()
+	}
+
+	for _, bad := range []string{"+miek.nl:300.1.1.1", "@miek.nl::mx:dist", "Xmiek.nl", "'miek.nl:\\07"} {
+		if _, err := ReadTinydns(strings.NewReader(bad), 0); err == nil {
+			t.Logf("Expected an error for %q", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestWriteTinydns(t *testing.T) {
+	rrs, err := ReadTinydns(strings.NewReader(testTinydns), 2012)
+	if err != nil {
+		t.Logf("Failed to read data file: %s", err)
+		t.Fail()
+		return
+	}
+	srv := &RR_SRV{Hdr: RR_Header{Name: "_sip._udp.miek.nl.", Rrtype: TypeSRV, Class: ClassINET, Ttl: 300},
+		Priority: 1, Weight: 2, Port: 5060, Target: "sip.miek.nl."}
+	rrs = append(rrs, srv)
+	var b bytes.Buffer
+	if err := WriteTinydns(&b, rrs); err != nil {
+		t.Logf("Failed to write data file: %s", err)
+		t.Fail()
+		return
+	}
+	t.Logf("%s", b.String())
+	if !strings.Contains(b.String(), "'txt.miek.nl:v=spf1\\072-all:86400\n") {
+		t.Log("TXT record not escaped")
+		t.Fail()
+	}
+	back, err := ReadTinydns(&b, 0)
+	if err != nil {
+		t.Logf("Failed to read written data file: %s", err)
+		t.Fail()
+		return
+	}
+	if len(back) != len(rrs) {
+		t.Logf("Expected %d RRs, got %d", len(rrs), len(back))
+		t.Fail()
+		return
+	}
+	for i := range rrs {
+		if rrs[i].String() != back[i].String() {
+			t.Logf("RR %d: expected %q, got %q", i, rrs[i].String(), back[i].String())
+			t.Fail()
+		}
+	}
+}
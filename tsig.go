@@ -35,8 +35,10 @@ package dns
 import (
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
-	"io"
+	"hash"
 	"strings"
 	"time"
 )
@@ -48,6 +50,27 @@ const (
 	HmacSHA256 = "hmac-sha256."
 )
 
+// A TsigKey is a TSIG key, as used by TransferZone.
+type TsigKey struct {
+	Name      string // the name of the key, fully qualified
+	Algorithm string // HmacMD5 if empty
+	Secret    string // the secret in base64
+}
+
+// tsigHash returns the hash function for the TSIG algorithm, or ErrKeyAlg
+// when the algorithm is not known.
+func tsigHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case HmacMD5:
+		return md5.New, nil
+	case HmacSHA1:
+		return sha1.New, nil
+	case HmacSHA256:
+		return sha256.New, nil
+	}
+	return nil, ErrKeyAlg
+}
+
 // The following values must be put in wireformat, so that the MAC can be calculated.
 // RFC 2845, section 3.4.2. TSIG Variables.
 type tsigWireFmt struct {
@@ -84,8 +107,7 @@ type timerWireFmt struct {
 // If something goes wrong an error is returned, otherwise it is nil.
 func TsigGenerate(m *Msg, secret, requestMAC string, timersOnly bool) error {
 	if !m.IsTsig() {
-		// panic? panic?
-		panic("TSIG not last RR in additional")
+		return ErrNoSig
 	}
 	// If we barf here, the caller is to blame
 	rawsecret, err := packBase64([]byte(secret))
@@ -94,15 +116,23 @@ func TsigGenerate(m *Msg, secret, requestMAC string, timersOnly bool) error {
 	}
 
 	rr := m.Extra[len(m.Extra)-1].(*RR_TSIG)
+	f, err := tsigHash(rr.Algorithm)
+	if err != nil {
+		return err
+	}
 	m.Extra = m.Extra[0 : len(m.Extra)-1] // kill the TSIG from the msg
-	mbuf, _ := m.Pack()
+	mbuf, err := m.Pack()
+	if err != nil {
+		m.Extra = append(m.Extra, rr)
+		return err
+	}
 	buf := tsigBuffer(mbuf, rr, requestMAC, timersOnly)
 
 	t := new(RR_TSIG)
 
-	h := hmac.New(md5.New, []byte(rawsecret))
-
-	t.MAC = hex.EncodeToString(h.Sum(buf))
+	h := hmac.New(f, []byte(rawsecret))
+	h.Write(buf)
+	t.MAC = hex.EncodeToString(h.Sum(nil))
 	t.MACSize = uint16(len(t.MAC) / 2) // Size is half!
 
 	t.Hdr = RR_Header{Name: rr.Hdr.Name, Rrtype: TypeTSIG, Class: ClassANY, Ttl: 0}
@@ -117,7 +147,9 @@ func TsigGenerate(m *Msg, secret, requestMAC string, timersOnly bool) error {
 
 // TsigVerify verifies the TSIG on a message. 
 // If the signature does not validate err contains the
-// error, otherwise it is nil.
+// error, otherwise it is nil. The MAC is compared in constant time.
+// The message is hashed with the algorithm named in the TSIG RR, an
+// unknown algorithm results in ErrKeyAlg.
 func TsigVerify(msg []byte, secret, requestMAC string, timersOnly bool) error {
 	rawsecret, err := packBase64([]byte(secret))
 	if err != nil {
@@ -129,16 +161,30 @@ func TsigVerify(msg []byte, secret, requestMAC string, timersOnly bool) error {
 		return err
 	}
 
+	f, err := tsigHash(tsig.Algorithm)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(tsig.MAC)
+	if err != nil {
+		return ErrSig
+	}
+
 	buf := tsigBuffer(stripped, tsig, requestMAC, timersOnly)
 
-	ti := uint64(time.Now().Unix()) - tsig.TimeSigned
+	// The time may be off in both directions
+	now := uint64(time.Now().Unix())
+	ti := now - tsig.TimeSigned
+	if now < tsig.TimeSigned {
+		ti = tsig.TimeSigned - now
+	}
 	if uint64(tsig.Fudge) < ti {
 		return ErrTime
 	}
 
-	h := hmac.New(md5.New, []byte(rawsecret))
-	io.WriteString(h, string(buf))
-	if strings.ToUpper(hex.EncodeToString(h.Sum(nil))) != strings.ToUpper(tsig.MAC) {
+	h := hmac.New(f, []byte(rawsecret))
+	h.Write(buf)
+	if !hmac.Equal(h.Sum(nil), mac) {
 		return ErrSig
 	}
 	return nil
@@ -187,7 +233,7 @@ func tsigBuffer(msgbuf []byte, rr *RR_TSIG, requestMAC string, timersOnly bool)
 		n, _ := packStruct(tsig, tsigvar, 0)
 		tsigvar = tsigvar[:n]
 	}
-	if rr.MAC != "" {
+	if requestMAC != "" {
 		x := append(macbuf, msgbuf...)
 		buf = append(x, tsigvar...)
 	} else {
@@ -196,13 +242,38 @@ func tsigBuffer(msgbuf []byte, rr *RR_TSIG, requestMAC string, timersOnly bool)
 	return buf
 }
 
-// Strip the TSIG from the raw message
+// TsigStrip returns a copy of the raw message msg without its TSIG RR,
+// and that TSIG RR. The ID in the copy is the original ID from the TSIG,
+// as the MAC was calculated with it: a forwarder may have changed the ID
+// of the message since (RFC 2845, section 4.5).
+func TsigStrip(msg []byte) ([]byte, *RR_TSIG, error) {
+	return stripTsig(msg)
+}
+
+// TsigResign replaces the TSIG RR of m, a message that is forwarded, with
+// a new one for the key name with the given algorithm and secret. The
+// original ID is the current ID of m. For a response requestMAC is the
+// MAC of the request as it was forwarded, for a request it is empty.
+// A message without a TSIG RR is signed too.
+func TsigResign(m *Msg, name, algorithm, secret, requestMAC string) error {
+	m.StripTsig()
+	m.SetTsig(name, algorithm, 300, uint64(time.Now().Unix()))
+	if err := TsigGenerate(m, secret, requestMAC, false); err != nil {
+		m.StripTsig()
+		return err
+	}
+	return nil
+}
+
+// Strip the TSIG from the raw message, see TsigStrip.
 func stripTsig(msg []byte) ([]byte, *RR_TSIG, error) {
+	// Don't change the message of the caller
+	msg = append([]byte(nil), msg...)
 	// Copied from msg.go's Unpack()
 	// Header.
 	var dh Header
 	dns := new(Msg)
-	rr := new(RR_TSIG)
+	var rr *RR_TSIG
 	off := 0
 	tsigoff := 0
 	var ok bool
@@ -235,7 +306,14 @@ func stripTsig(msg []byte) ([]byte, *RR_TSIG, error) {
 	for i := 0; i < len(dns.Extra); i++ {
 		tsigoff = off
 		dns.Extra[i], off, ok = unpackRR(msg, off)
+		if !ok || dns.Extra[i] == nil {
+			return nil, nil, ErrUnpack
+		}
 		if dns.Extra[i].Header().Rrtype == TypeTSIG {
+			// The TSIG must be the last RR, RFC 2845 section 3.2
+			if i != len(dns.Extra)-1 {
+				return nil, nil, ErrSig
+			}
 			rr = dns.Extra[i].(*RR_TSIG)
 			// Adjust Arcount.
 			arcount, _ := unpackUint16(msg, 10)
@@ -249,5 +327,6 @@ func stripTsig(msg []byte) ([]byte, *RR_TSIG, error) {
 	if rr == nil {
 		return nil, nil, ErrNoSig
 	}
+	msg[0], msg[1] = packUint16(rr.OrigId)
 	return msg[:tsigoff], rr, nil
 }
@@ -6,6 +6,7 @@
 package dns
 
 import (
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
@@ -17,6 +18,7 @@ import (
 // Wire constants and supported types.
 const (
 	// valid RR_Header.Rrtype and Question.qtype
+	TypeNone  uint16 = 0 // reserved, not a type
 	TypeA     uint16 = 1
 	TypeNS    uint16 = 2
 	TypeMD    uint16 = 3
@@ -33,6 +35,13 @@ const (
 	TypeMINFO uint16 = 14
 	TypeMX    uint16 = 15
 	TypeTXT   uint16 = 16
+	TypeAFSDB uint16 = 18
+	TypeX25   uint16 = 19
+	TypeISDN  uint16 = 20
+	TypeRT    uint16 = 21
+	TypeNSAP  uint16 = 22
+	TypePX    uint16 = 26
+	TypeGPOS  uint16 = 27
 	TypeAAAA  uint16 = 28
 	TypeLOC   uint16 = 29
 	TypeSRV   uint16 = 33
@@ -49,7 +58,7 @@ const (
 	TypeNXT        uint16 = 30
 	TypeDS         uint16 = 43
 	TypeSSHFP      uint16 = 44
-	TypeIPSECKEY   uint16 = 45 // No type implemented
+	TypeIPSECKEY   uint16 = 45
 	TypeRRSIG      uint16 = 46
 	TypeNSEC       uint16 = 47
 	TypeDNSKEY     uint16 = 48
@@ -57,7 +66,14 @@ const (
 	TypeNSEC3      uint16 = 50
 	TypeNSEC3PARAM uint16 = 51
 	TypeTALINK     uint16 = 58
+	TypeCDS        uint16 = 59
+	TypeCDNSKEY    uint16 = 60
 	TypeSPF        uint16 = 99
+	TypeNID        uint16 = 104
+	TypeL32        uint16 = 105
+	TypeL64        uint16 = 106
+	TypeLP         uint16 = 107
+	TypeAMTRELAY   uint16 = 260
 
 	TypeTKEY uint16 = 249
 	TypeTSIG uint16 = 250
@@ -93,12 +109,14 @@ const (
 	RcodeNotAuth        = 9
 	RcodeNotZone        = 10
 	RcodeBadSig         = 16 // TSIG
+	RcodeBadVers        = 16 // EDNS0
 	RcodeBadKey         = 17
 	RcodeBadTime        = 18
 	RcodeBadMode        = 19 // TKEY
 	RcodeBadName        = 20
 	RcodeBadAlg         = 21
 	RcodeBadTrunc       = 22 // TSIG
+	RcodeBadCookie      = 23 // DNS Cookies
 
 	// Opcode
 	OpcodeQuery  = 0
@@ -116,16 +134,16 @@ type Header struct {
 	Qdcount, Ancount, Nscount, Arcount uint16
 }
 
+// The flags in Header.Bits, see FlagSet and SetFlag.
 const (
-	// Header.Bits
-	_QR = 1 << 15 // query/response (response=1)
-	_AA = 1 << 10 // authoritative
-	_TC = 1 << 9  // truncated
-	_RD = 1 << 8  // recursion desired
-	_RA = 1 << 7  // recursion available
-	_Z  = 1 << 6  // Z
-	_AD = 1 << 5  // authticated data
-	_CD = 1 << 4  // checking disabled
+	FlagQR = 1 << 15 // query/response (response=1)
+	FlagAA = 1 << 10 // authoritative
+	FlagTC = 1 << 9  // truncated
+	FlagRD = 1 << 8  // recursion desired
+	FlagRA = 1 << 7  // recursion available
+	FlagZ  = 1 << 6  // Z
+	FlagAD = 1 << 5  // authticated data
+	FlagCD = 1 << 4  // checking disabled
 )
 
 // DNS queries.
@@ -135,19 +153,15 @@ type Question struct {
 	Qclass uint16
 }
 
-func (q *Question) String() (s string) {
+func (q Question) String() (s string) {
 	// prefix with ; (as in dig)
 	if len(q.Name) == 0 {
 		s = ";.\t" // root label
 	} else {
 		s = ";" + q.Name + "\t"
 	}
-	s = s + Class_str[q.Qclass] + "\t"
-	if _, ok := Rr_str[q.Qtype]; ok {
-		s += " " + Rr_str[q.Qtype]
-	} else {
-		s += " " + "TYPE" + strconv.Itoa(int(q.Qtype))
-	}
+	s += ClassToString(q.Qclass) + "\t"
+	s += " " + TypeToString(q.Qtype)
 	return s
 }
 
@@ -368,9 +382,39 @@ func (rr *RR_SOA) Len() int {
 	return rr.Hdr.Len() + l + n + 20
 }
 
+// NegativeTTL returns how long a negative answer with rr in the authority
+// section may be cached: the minimum of the TTL and the MINIMUM field of
+// rr (RFC 2308, section 5).
+func (rr *RR_SOA) NegativeTTL() uint32 {
+	if rr.Minttl < rr.Hdr.Ttl {
+		return rr.Minttl
+	}
+	return rr.Hdr.Ttl
+}
+
+// RefreshIn returns the REFRESH field of rr as a duration: the time
+// between two checks of a secondary for a new version of the zone.
+func (rr *RR_SOA) RefreshIn() time.Duration {
+	return time.Duration(rr.Refresh) * time.Second
+}
+
+// RetryIn returns the RETRY field of rr as a duration: the time a
+// secondary waits before it checks again after a failed check.
+func (rr *RR_SOA) RetryIn() time.Duration {
+	return time.Duration(rr.Retry) * time.Second
+}
+
+// ExpireAt returns the time at which a secondary that last refreshed the
+// zone at t must stop answering for it: t plus the EXPIRE field of rr.
+func (rr *RR_SOA) ExpireAt(t time.Time) time.Time {
+	return t.Add(time.Duration(rr.Expire) * time.Second)
+}
+
+// The character-strings of a TXT record may be longer than 255 octets,
+// they are split in several character-strings when packed.
 type RR_TXT struct {
 	Hdr RR_Header
-	Txt string "txt"
+	Txt []string "txt"
 }
 
 func (rr *RR_TXT) Header() *RR_Header {
@@ -378,11 +422,183 @@ func (rr *RR_TXT) Header() *RR_Header {
 }
 
 func (rr *RR_TXT) String() string {
-	return rr.Hdr.String() + "\"" + rr.Txt + "\""
+	return rr.Hdr.String() + txtString(rr.Txt)
 }
 
 func (rr *RR_TXT) Len() int {
-	return rr.Hdr.Len() + len(rr.Txt) // TODO: always works?
+	return rr.Hdr.Len() + txtLen(rr.Txt)
+}
+
+// See RFC 1035. The services are the port numbers in the bit map.
+type RR_WKS struct {
+	Hdr      RR_Header
+	Address  net.IP "A"
+	Protocol uint8
+	BitMap   []uint16 "WKS"
+}
+
+func (rr *RR_WKS) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_WKS) String() string {
+	s := rr.Hdr.String() + rr.Address.String() + " " + strconv.Itoa(int(rr.Protocol))
+	for _, p := range rr.BitMap {
+		s += " " + strconv.Itoa(int(p))
+	}
+	return s
+}
+
+func (rr *RR_WKS) Len() int {
+	max := -1
+	for _, p := range rr.BitMap {
+		if int(p) > max {
+			max = int(p)
+		}
+	}
+	return rr.Hdr.Len() + net.IPv4len + 1 + (max+8)/8
+}
+
+// See RFC 1183.
+type RR_X25 struct {
+	Hdr         RR_Header
+	PSDNAddress string
+}
+
+func (rr *RR_X25) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_X25) String() string {
+	return rr.Hdr.String() + "\"" + rr.PSDNAddress + "\""
+}
+
+func (rr *RR_X25) Len() int {
+	return rr.Hdr.Len() + len(rr.PSDNAddress) + 1
+}
+
+// See RFC 1183. The hostname is not compressed, see RFC 3597.
+type RR_AFSDB struct {
+	Hdr      RR_Header
+	Subtype  uint16
+	Hostname string "domain-name"
+}
+
+func (rr *RR_AFSDB) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_AFSDB) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Subtype)) + " " + rr.Hostname
+}
+
+func (rr *RR_AFSDB) Len() int {
+	return rr.Hdr.Len() + 2 + len(rr.Hostname) + 1
+}
+
+// See RFC 1183. The subaddress is optional.
+type RR_ISDN struct {
+	Hdr        RR_Header
+	Address    string
+	SubAddress string "optional"
+}
+
+func (rr *RR_ISDN) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_ISDN) String() string {
+	s := rr.Hdr.String() + "\"" + rr.Address + "\""
+	if rr.SubAddress != "" {
+		s += " \"" + rr.SubAddress + "\""
+	}
+	return s
+}
+
+func (rr *RR_ISDN) Len() int {
+	l := rr.Hdr.Len() + len(rr.Address) + 1
+	if rr.SubAddress != "" {
+		l += len(rr.SubAddress) + 1
+	}
+	return l
+}
+
+// See RFC 1183.
+type RR_RT struct {
+	Hdr        RR_Header
+	Preference uint16
+	Host       string "domain-name"
+}
+
+func (rr *RR_RT) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_RT) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Preference)) + " " + rr.Host
+}
+
+func (rr *RR_RT) Len() int {
+	return rr.Hdr.Len() + 2 + len(rr.Host) + 1
+}
+
+// See RFC 1706. The address is kept in hex, without the "0x" it has in
+// the zone file.
+type RR_NSAP struct {
+	Hdr     RR_Header
+	Address string "hex"
+}
+
+func (rr *RR_NSAP) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_NSAP) String() string {
+	return rr.Hdr.String() + "0x" + rr.Address
+}
+
+func (rr *RR_NSAP) Len() int {
+	return rr.Hdr.Len() + len(rr.Address)/2
+}
+
+// See RFC 2163.
+type RR_PX struct {
+	Hdr        RR_Header
+	Preference uint16
+	Map822     string "domain-name"
+	Mapx400    string "domain-name"
+}
+
+func (rr *RR_PX) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_PX) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Preference)) + " " + rr.Map822 + " " + rr.Mapx400
+}
+
+func (rr *RR_PX) Len() int {
+	return rr.Hdr.Len() + 2 + len(rr.Map822) + 1 + len(rr.Mapx400) + 1
+}
+
+// See RFC 1712. The coordinates are decimal numbers in character-strings.
+type RR_GPOS struct {
+	Hdr       RR_Header
+	Longitude string
+	Latitude  string
+	Altitude  string
+}
+
+func (rr *RR_GPOS) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_GPOS) String() string {
+	return rr.Hdr.String() + rr.Longitude + " " + rr.Latitude + " " + rr.Altitude
+}
+
+func (rr *RR_GPOS) Len() int {
+	return rr.Hdr.Len() + len(rr.Longitude) + len(rr.Latitude) + len(rr.Altitude) + 3
 }
 
 type RR_SRV struct {
@@ -557,12 +773,12 @@ func (rr *RR_RRSIG) Header() *RR_Header {
 }
 
 func (rr *RR_RRSIG) String() string {
-	return rr.Hdr.String() + Rr_str[rr.TypeCovered] +
+	return rr.Hdr.String() + TypeToString(rr.TypeCovered) +
 		" " + strconv.Itoa(int(rr.Algorithm)) +
 		" " + strconv.Itoa(int(rr.Labels)) +
 		" " + strconv.Itoa(int(rr.OrigTtl)) +
-		" " + timeToDate(rr.Expiration) +
-		" " + timeToDate(rr.Inception) +
+		" " + TimeToDate(rr.Expiration) +
+		" " + TimeToDate(rr.Inception) +
 		" " + strconv.Itoa(int(rr.KeyTag)) +
 		" " + rr.SignerName +
 		" " + rr.Signature
@@ -573,6 +789,42 @@ func (rr *RR_RRSIG) Len() int {
 	// TODO base64 string, should be less
 }
 
+// RR_SIG is the SIG record of RFC 2535, the predecessor of RRSIG. It is
+// still used for SIG(0) transaction signatures (RFC 2931): then
+// TypeCovered is zero and the RR is the last of the additional section.
+type RR_SIG struct {
+	Hdr         RR_Header
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OrigTtl     uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string "domain-name"
+	Signature   string "base64"
+}
+
+func (rr *RR_SIG) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_SIG) String() string {
+	return rr.Hdr.String() + TypeToString(rr.TypeCovered) +
+		" " + strconv.Itoa(int(rr.Algorithm)) +
+		" " + strconv.Itoa(int(rr.Labels)) +
+		" " + strconv.Itoa(int(rr.OrigTtl)) +
+		" " + TimeToDate(rr.Expiration) +
+		" " + TimeToDate(rr.Inception) +
+		" " + strconv.Itoa(int(rr.KeyTag)) +
+		" " + rr.SignerName +
+		" " + rr.Signature
+}
+
+func (rr *RR_SIG) Len() int {
+	return rr.Hdr.Len() + len(rr.SignerName) + 1 + len(rr.Signature) + 18
+}
+
 type RR_NSEC struct {
 	Hdr        RR_Header
 	NextDomain string   "domain-name"
@@ -586,11 +838,7 @@ func (rr *RR_NSEC) Header() *RR_Header {
 func (rr *RR_NSEC) String() string {
 	s := rr.Hdr.String() + rr.NextDomain
 	for i := 0; i < len(rr.TypeBitMap); i++ {
-		if _, ok := Rr_str[rr.TypeBitMap[i]]; ok {
-			s += " " + Rr_str[rr.TypeBitMap[i]]
-		} else {
-			s += " " + "TYPE" + strconv.Itoa(int(rr.TypeBitMap[i]))
-		}
+		s += " " + TypeToString(rr.TypeBitMap[i])
 	}
 	return s
 }
@@ -624,6 +872,29 @@ func (rr *RR_DS) Len() int {
 	return rr.Hdr.Len() + 4 + len(rr.Digest)/2
 }
 
+type RR_CDS struct {
+	Hdr        RR_Header
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     string "hex"
+}
+
+func (rr *RR_CDS) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_CDS) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.KeyTag)) +
+		" " + strconv.Itoa(int(rr.Algorithm)) +
+		" " + strconv.Itoa(int(rr.DigestType)) +
+		" " + strings.ToUpper(rr.Digest)
+}
+
+func (rr *RR_CDS) Len() int {
+	return rr.Hdr.Len() + 4 + len(rr.Digest)/2
+}
+
 type RR_DLV struct {
 	Hdr        RR_Header
 	KeyTag     uint16
@@ -752,6 +1023,120 @@ func (rr *RR_DNSKEY) Len() int {
 	return rr.Hdr.Len() + 4 + len(rr.PublicKey) // todo: base64
 }
 
+type RR_CDNSKEY struct {
+	Hdr       RR_Header
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey string "base64"
+}
+
+func (rr *RR_CDNSKEY) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_CDNSKEY) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Flags)) +
+		" " + strconv.Itoa(int(rr.Protocol)) +
+		" " + strconv.Itoa(int(rr.Algorithm)) +
+		" " + rr.PublicKey
+}
+
+func (rr *RR_CDNSKEY) Len() int {
+	return rr.Hdr.Len() + 4 + len(rr.PublicKey) // todo: base64
+}
+
+// RR_KEY is the KEY record of RFC 2535, the predecessor of DNSKEY. It is
+// still used for the keys of SIG(0) (RFC 2931) and TKEY (RFC 2930).
+type RR_KEY struct {
+	Hdr       RR_Header
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey string "base64"
+}
+
+func (rr *RR_KEY) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_KEY) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Flags)) +
+		" " + strconv.Itoa(int(rr.Protocol)) +
+		" " + strconv.Itoa(int(rr.Algorithm)) +
+		" " + rr.PublicKey
+}
+
+func (rr *RR_KEY) Len() int {
+	return rr.Hdr.Len() + 4 + len(rr.PublicKey) // todo: base64
+}
+
+// RR_IPSECKEY is the IPSECKEY record of RFC 4025. The format of Gateway
+// depends on GatewayType: 0 no gateway, written as ".", 1 an IPv4
+// address, 2 an IPv6 address or 3 a domain name.
+type RR_IPSECKEY struct {
+	Hdr         RR_Header
+	Precedence  uint8
+	GatewayType uint8
+	Algorithm   uint8
+	Gateway     string "gateway"
+	PublicKey   string "base64"
+}
+
+func (rr *RR_IPSECKEY) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_IPSECKEY) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Precedence)) +
+		" " + strconv.Itoa(int(rr.GatewayType)) +
+		" " + strconv.Itoa(int(rr.Algorithm)) +
+		" " + rr.Gateway +
+		" " + rr.PublicKey
+}
+
+func (rr *RR_IPSECKEY) Len() int {
+	return rr.Hdr.Len() + 3 + gatewayLen(rr.GatewayType, rr.Gateway) + len(rr.PublicKey) // todo: base64
+}
+
+// RR_AMTRELAY is the AMTRELAY record of RFC 8777. The high bit of
+// RelayType is the D (discovery optional) bit, the other bits give the
+// format of Relay as the GatewayType of an IPSECKEY does.
+type RR_AMTRELAY struct {
+	Hdr        RR_Header
+	Precedence uint8
+	RelayType  uint8
+	Relay      string "gateway"
+}
+
+func (rr *RR_AMTRELAY) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_AMTRELAY) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Precedence)) +
+		" " + strconv.Itoa(int(rr.RelayType>>7)) +
+		" " + strconv.Itoa(int(rr.RelayType&0x7f)) +
+		" " + rr.Relay
+}
+
+func (rr *RR_AMTRELAY) Len() int {
+	return rr.Hdr.Len() + 2 + gatewayLen(rr.RelayType&0x7f, rr.Relay)
+}
+
+// gatewayLen returns the length in the rdata of a gateway g of type t.
+func gatewayLen(t uint8, g string) int {
+	switch t {
+	case 1:
+		return net.IPv4len
+	case 2:
+		return net.IPv6len
+	case 3:
+		return len(g) + 1
+	}
+	return 0
+}
+
 type RR_NSEC3 struct {
 	Hdr        RR_Header
 	Hash       uint8
@@ -776,11 +1161,7 @@ func (rr *RR_NSEC3) String() string {
 		" " + strings.ToUpper(rr.Salt) +
 		" " + rr.NextDomain
 	for i := 0; i < len(rr.TypeBitMap); i++ {
-		if _, ok := Rr_str[rr.TypeBitMap[i]]; ok {
-			s += " " + Rr_str[rr.TypeBitMap[i]]
-		} else {
-			s += " " + "TYPE" + strconv.Itoa(int(rr.TypeBitMap[i]))
-		}
+		s += " " + TypeToString(rr.TypeBitMap[i])
 	}
 	return s
 }
@@ -819,7 +1200,7 @@ func (rr *RR_NSEC3PARAM) Len() int {
 // See RFC 4408.
 type RR_SPF struct {
 	Hdr RR_Header
-	Txt string
+	Txt []string "txt"
 }
 
 func (rr *RR_SPF) Header() *RR_Header {
@@ -827,11 +1208,87 @@ func (rr *RR_SPF) Header() *RR_Header {
 }
 
 func (rr *RR_SPF) String() string {
-	return rr.Hdr.String() + "\"" + rr.Txt + "\""
+	return rr.Hdr.String() + txtString(rr.Txt)
 }
 
 func (rr *RR_SPF) Len() int {
-	return rr.Hdr.Len() + len(rr.Txt)
+	return rr.Hdr.Len() + txtLen(rr.Txt)
+}
+
+// See RFC 6742.
+type RR_NID struct {
+	Hdr        RR_Header
+	Preference uint16
+	NodeID     uint64 "uint64"
+}
+
+func (rr *RR_NID) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_NID) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Preference)) + " " + ilnpString(rr.NodeID)
+}
+
+func (rr *RR_NID) Len() int {
+	return rr.Hdr.Len() + 2 + 8
+}
+
+// See RFC 6742.
+type RR_L32 struct {
+	Hdr        RR_Header
+	Preference uint16
+	Locator32  net.IP "A"
+}
+
+func (rr *RR_L32) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_L32) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Preference)) + " " + rr.Locator32.String()
+}
+
+func (rr *RR_L32) Len() int {
+	return rr.Hdr.Len() + 2 + net.IPv4len
+}
+
+// See RFC 6742.
+type RR_L64 struct {
+	Hdr        RR_Header
+	Preference uint16
+	Locator64  uint64 "uint64"
+}
+
+func (rr *RR_L64) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_L64) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Preference)) + " " + ilnpString(rr.Locator64)
+}
+
+func (rr *RR_L64) Len() int {
+	return rr.Hdr.Len() + 2 + 8
+}
+
+// See RFC 6742.
+type RR_LP struct {
+	Hdr        RR_Header
+	Preference uint16
+	Fqdn       string "domain-name"
+}
+
+func (rr *RR_LP) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_LP) String() string {
+	return rr.Hdr.String() + strconv.Itoa(int(rr.Preference)) + " " + rr.Fqdn
+}
+
+func (rr *RR_LP) Len() int {
+	return rr.Hdr.Len() + 2 + len(rr.Fqdn) + 1
 }
 
 type RR_TKEY struct {
@@ -861,6 +1318,25 @@ func (rr *RR_TKEY) Len() int {
 		len(rr.Key) + 2 + len(rr.OtherData)
 }
 
+// See RFC 1035. The rdata of a NULL RR can be anything, it is kept in hex
+// and written in the unknown RR representation of RFC 3597.
+type RR_NULL struct {
+	Hdr  RR_Header
+	Data string "hex"
+}
+
+func (rr *RR_NULL) Header() *RR_Header {
+	return &rr.Hdr
+}
+
+func (rr *RR_NULL) String() string {
+	return rr.Hdr.String() + "\\# " + strconv.Itoa(len(rr.Data)/2) + " " + rr.Data
+}
+
+func (rr *RR_NULL) Len() int {
+	return rr.Hdr.Len() + len(rr.Data)/2
+}
+
 // Unknown RR representation
 type RR_RFC3597 struct {
 	Hdr   RR_Header
@@ -981,19 +1457,20 @@ func (rr *RR_TLSA) Len() int {
 	return rr.Hdr.Len() + 3 + len(rr.Certificate)/2
 }
 
-// Translate the RRSIG's incep. and expir. time to the correct date.
+// TimeToDate translates the RRSIG's inception and expiration time to
+// the presentation format: YYYYMMDDHHmmSS.
 // Taking into account serial arithmetic (RFC 1982) [TODO]
-func timeToDate(t uint32) string {
+func TimeToDate(t uint32) string {
 	//	utc := time.Now().UTC().Unix()
 	//	mod := (int64(t) - utc) / Year68
 	ti := time.Unix(int64(t), 0).UTC()
 	return ti.Format("20060102150405")
 }
 
-// Translate the RRSIG's incep. and expir. times from 
-// string values ("20110403154150") to an integer.
+// DateToTime translates the RRSIG's inception and expiration times
+// from the presentation format ("20110403154150") to the wire format.
 // Taking into account serial arithmetic (RFC 1982)
-func dateToTime(s string) (uint32, error) {
+func DateToTime(s string) (uint32, error) {
 	t, e := time.Parse("20060102150405", s)
 	if e != nil {
 		return 0, e
@@ -1023,9 +1500,53 @@ func saltString(s string) string {
 	return strings.ToUpper(s)
 }
 
+// txtString returns the character-strings of a TXT or SPF record, each
+// between quotes. Quotes and backslashes are escaped with a backslash,
+// other octets that are not printable as \DDD.
+func txtString(txt []string) string {
+	s := make([]string, len(txt))
+	for i, t := range txt {
+		b := make([]byte, 0, len(t)+2)
+		b = append(b, '"')
+		for j := 0; j < len(t); j++ {
+			switch c := t[j]; {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c < ' ' || c > '~':
+				b = append(b, '\\', '0'+c/100, '0'+c/10%10, '0'+c%10)
+			default:
+				b = append(b, c)
+			}
+		}
+		s[i] = string(append(b, '"'))
+	}
+	return strings.Join(s, " ")
+}
+
+// txtLen returns the length of the character-strings in wire format,
+// after splitting them in pieces of at most 255 octets.
+func txtLen(txt []string) int {
+	l := 0
+	for _, t := range txt {
+		l += len(t) + 1 + (len(t)-1)/255
+	}
+	return l
+}
+
+// ilnpString returns the presentation format of an ILNP node identifier
+// or locator: four 16 bit hexadecimal values, separated by colons.
+func ilnpString(i uint64) string {
+	s := make([]string, 4)
+	for j := range s {
+		s[j] = fmt.Sprintf("%04x", uint16(i>>uint(48-16*j)))
+	}
+	return strings.Join(s, ":")
+}
+
 // Map of constructors for each RR wire type.
 var rr_mk = map[uint16]func() RR{
 	TypeCNAME:      func() RR { return new(RR_CNAME) },
+	TypeWKS:        func() RR { return new(RR_WKS) },
 	TypeHINFO:      func() RR { return new(RR_HINFO) },
 	TypeMB:         func() RR { return new(RR_MB) },
 	TypeMG:         func() RR { return new(RR_MG) },
@@ -1036,6 +1557,14 @@ var rr_mk = map[uint16]func() RR{
 	TypePTR:        func() RR { return new(RR_PTR) },
 	TypeSOA:        func() RR { return new(RR_SOA) },
 	TypeTXT:        func() RR { return new(RR_TXT) },
+	TypeNULL:       func() RR { return new(RR_NULL) },
+	TypeAFSDB:      func() RR { return new(RR_AFSDB) },
+	TypeX25:        func() RR { return new(RR_X25) },
+	TypeISDN:       func() RR { return new(RR_ISDN) },
+	TypeRT:         func() RR { return new(RR_RT) },
+	TypeNSAP:       func() RR { return new(RR_NSAP) },
+	TypePX:         func() RR { return new(RR_PX) },
+	TypeGPOS:       func() RR { return new(RR_GPOS) },
 	TypeSRV:        func() RR { return new(RR_SRV) },
 	TypeNAPTR:      func() RR { return new(RR_NAPTR) },
 	TypeDNAME:      func() RR { return new(RR_DNAME) },
@@ -1047,17 +1576,27 @@ var rr_mk = map[uint16]func() RR{
 	TypeCERT:       func() RR { return new(RR_CERT) },
 	TypeKX:         func() RR { return new(RR_KX) },
 	TypeSPF:        func() RR { return new(RR_SPF) },
+	TypeNID:        func() RR { return new(RR_NID) },
+	TypeL32:        func() RR { return new(RR_L32) },
+	TypeL64:        func() RR { return new(RR_L64) },
+	TypeLP:         func() RR { return new(RR_LP) },
 	TypeTALINK:     func() RR { return new(RR_TALINK) },
+	TypeCDS:        func() RR { return new(RR_CDS) },
+	TypeCDNSKEY:    func() RR { return new(RR_CDNSKEY) },
 	TypeSSHFP:      func() RR { return new(RR_SSHFP) },
 	TypeRRSIG:      func() RR { return new(RR_RRSIG) },
+	TypeSIG:        func() RR { return new(RR_SIG) },
 	TypeNSEC:       func() RR { return new(RR_NSEC) },
 	TypeDNSKEY:     func() RR { return new(RR_DNSKEY) },
+	TypeKEY:        func() RR { return new(RR_KEY) },
+	TypeIPSECKEY:   func() RR { return new(RR_IPSECKEY) },
 	TypeNSEC3:      func() RR { return new(RR_NSEC3) },
 	TypeDHCID:      func() RR { return new(RR_DHCID) },
 	TypeNSEC3PARAM: func() RR { return new(RR_NSEC3PARAM) },
 	TypeTKEY:       func() RR { return new(RR_TKEY) },
 	TypeTSIG:       func() RR { return new(RR_TSIG) },
 	TypeURI:        func() RR { return new(RR_URI) },
+	TypeAMTRELAY:   func() RR { return new(RR_AMTRELAY) },
 	TypeTA:         func() RR { return new(RR_TA) },
 	TypeDLV:        func() RR { return new(RR_DLV) },
 
@@ -87,6 +87,7 @@ func (u *Msg) RRsetUsedRdata(rr []RR) {
 	for i, r := range rr {
 		u.Answer[i] = r
 		u.Answer[i].Header().Class = u.Question[0].Qclass
+		u.Answer[i].Header().Ttl = 0
 	}
 }
 
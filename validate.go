@@ -0,0 +1,131 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Validating the responses of a handler before they are sent.
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ValidateResponse checks the response resp that a handler writes in
+// reply to req, received over TCP when tcp is set. It returns an error
+// for the first problem found:
+//
+//	the response can not be unpacked, or the count fields in the header
+//	do not match the sections
+//	the QR bit is not set, or the id or opcode differ from the request
+//	the question of the request is not echoed, only a FORMERR may lack it
+//	the TC bit is set over TCP, or a UDP response is larger than the
+//	request allows without the TC bit set
+//	an OPT RR is not in the additional section, there is more than one,
+//	or the request had none
+//	a TSIG RR is not the last RR of the additional section
+func ValidateResponse(req *Msg, resp []byte, tcp bool) error {
+	m := new(Msg)
+	off, err := m.unpack(resp)
+	if err != nil {
+		return validateError("can not be unpacked: " + err.Error())
+	}
+	if off != len(resp) {
+		return validateError(strconv.Itoa(len(resp)-off) + " bytes after the counted RRs")
+	}
+	if !m.Response {
+		return validateError("QR bit not set")
+	}
+	if m.Id != req.Id {
+		return validateError("id differs from the request")
+	}
+	if m.Opcode != req.Opcode {
+		return validateError("opcode differs from the request")
+	}
+	if len(req.Question) > 0 && !(len(m.Question) == 0 && m.Rcode == RcodeFormatError) {
+		if len(m.Question) != len(req.Question) {
+			return validateError("question not echoed")
+		}
+		for i, q := range req.Question {
+			r := m.Question[i]
+			if !strings.EqualFold(q.Name, r.Name) || q.Qtype != r.Qtype || q.Qclass != r.Qclass {
+				return validateError("question differs from the request")
+			}
+		}
+	}
+	if tcp && m.Truncated {
+		return validateError("TC bit set over TCP")
+	}
+	if !tcp && !m.Truncated {
+		size := 512
+		if o := requestOpt(req); o != nil && int(o.UDPSize()) > size {
+			size = int(o.UDPSize())
+		}
+		if len(resp) > size {
+			return validateError(strconv.Itoa(len(resp)) + " bytes without TC bit, the request allows " + strconv.Itoa(size))
+		}
+	}
+	for _, s := range [][]RR{m.Answer, m.Ns} {
+		for _, rr := range s {
+			switch rr.Header().Rrtype {
+			case TypeOPT:
+				return validateError("OPT RR outside the additional section")
+			case TypeTSIG:
+				return validateError("TSIG RR outside the additional section")
+			}
+		}
+	}
+	opt := 0
+	for i, rr := range m.Extra {
+		switch rr.Header().Rrtype {
+		case TypeOPT:
+			opt++
+		case TypeTSIG:
+			if i != len(m.Extra)-1 {
+				return validateError("TSIG RR is not the last RR")
+			}
+		}
+	}
+	switch {
+	case opt > 1:
+		return validateError("more than one OPT RR")
+	case opt == 1 && requestOpt(req) == nil:
+		return validateError("OPT RR in the response to a request without one")
+	}
+	return nil
+}
+
+func validateError(s string) error {
+	return &Error{Err: "invalid response: " + s}
+}
+
+// ValidateHandler returns a Handler that calls h and checks the responses
+// it writes with ValidateResponse. An invalid response is not sent: it is
+// logged to l, when l is not nil, and Write returns the error.
+func ValidateHandler(h Handler, l Logger) Handler {
+	return HandlerFunc(func(w ResponseWriter, r *Msg) {
+		h.ServeDNS(&validateWriter{ResponseWriter: w, req: r, log: l}, r)
+	})
+}
+
+type validateWriter struct {
+	ResponseWriter
+	req *Msg
+	log Logger
+}
+
+func (w *validateWriter) Write(data []byte) (int, error) {
+	_, tcp := w.RemoteAddr().(*net.TCPAddr)
+	if err := ValidateResponse(w.req, data, tcp); err != nil {
+		if w.log != nil {
+			name := ""
+			if len(w.req.Question) > 0 {
+				name = w.req.Question[0].Name
+			}
+			w.log.Printf("dropped response to %s (%s): %s", w.RemoteAddr(), name, err)
+		}
+		return 0, err
+	}
+	return w.ResponseWriter.Write(data)
+}
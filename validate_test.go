@@ -0,0 +1,124 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+)
+
+type testLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestValidateResponse(t *testing.T) {
+	req := new(Msg)
+	req.SetQuestion("miek.nl.", TypeMX)
+	tsig := &RR_TSIG{Hdr: RR_Header{Name: "axfr.", Rrtype: TypeTSIG, Class: ClassANY}, Algorithm: HmacMD5}
+	opt := &RR_OPT{Hdr: RR_Header{Name: ".", Rrtype: TypeOPT}}
+	large := make([]RR, 40)
+	for i := range large {
+		large[i] = &RR_MX{Hdr: RR_Header{Name: "miek.nl.", Rrtype: TypeMX, Class: ClassINET}, Pref: uint16(i), Mx: "mx.miek.nl."}
+	}
+	tests := []struct {
+		change func(m *Msg)
+		tcp    bool
+		valid  bool
+	}{
+		{func(m *Msg) {}, false, true},
+		{func(m *Msg) { m.Response = false }, false, false},
+		{func(m *Msg) { m.Id++ }, false, false},
+		{func(m *Msg) { m.Opcode = OpcodeNotify }, false, false},
+		{func(m *Msg) { m.Question = nil }, false, false},
+		{func(m *Msg) { m.Question = nil; m.Rcode = RcodeFormatError }, false, true},
+		{func(m *Msg) { m.Question[0].Qtype = TypeA }, false, false},
+		{func(m *Msg) { m.Question[0].Name = "MIEK.nl." }, false, true},
+		{func(m *Msg) { m.Truncated = true }, true, false},
+		{func(m *Msg) { m.Answer = large }, false, false},
+		{func(m *Msg) { m.Answer = large; m.Truncated = true }, false, true},
+		{func(m *Msg) { m.Answer = large }, true, true},
+		{func(m *Msg) { m.Extra = []RR{opt} }, false, false},
+		{func(m *Msg) { m.Extra = []RR{tsig} }, false, true},
+		{func(m *Msg) { m.Extra = []RR{tsig, large[0]} }, false, false},
+		{func(m *Msg) { m.Answer = []RR{tsig} }, false, false},
+	}
+	for i, x := range tests {
+		m := new(Msg)
+		m.SetReply(req)
+		x.change(m)
+		buf, _ := m.Pack()
+		if err := ValidateResponse(req, buf, x.tcp); (err == nil) != x.valid {
+			t.Logf("Test %d: expected valid to be %t, got %v", i, x.valid, err)
+			t.Fail()
+		}
+	}
+
+	// OPT RRs are fine in the response to a request with one
+	req.SetEdns0(4096, false)
+	m := new(Msg)
+	m.SetReply(req)
+	m.Answer = large
+	m.Extra = []RR{opt}
+	buf, _ := m.Pack()
+	if err := ValidateResponse(req, buf, false); err != nil {
+		t.Logf("Expected a valid response, got %s", err)
+		t.Fail()
+	}
+	m.Extra = []RR{opt, opt}
+	buf, _ = m.Pack()
+	if err := ValidateResponse(req, buf, false); err == nil {
+		t.Log("Expected an error for two OPT RRs")
+		t.Fail()
+	}
+	// Trailing bytes mean the counts are off
+	if err := ValidateResponse(req, append(buf, 0), false); err == nil {
+		t.Log("Expected an error for trailing bytes")
+		t.Fail()
+	}
+}
+
+func TestServerValidateResponses(t *testing.T) {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Logf("Failed to listen: %s", err)
+		t.Fail()
+		return
+	}
+	var log testLogger
+	go (&Server{Handler: HandlerFunc(func(w ResponseWriter, req *Msg) {
+		m := new(Msg)
+		m.SetReply(req)
+		if req.Question[0].Name == "bad.miek.nl." {
+			m.Id++
+		}
+		buf, _ := m.Pack()
+		w.Write(buf)
+	}), ValidateResponses: true, ErrorLog: &log}).ServeUDP(l)
+
+	c := NewClient()
+	c.ReadTimeout = 2e8
+	m := new(Msg)
+	m.SetQuestion("miek.nl.", TypeA)
+	if _, err := c.Exchange(m, l.LocalAddr().String()); err != nil {
+		t.Logf("Expected a reply, got %s", err)
+		t.Fail()
+	}
+	m.SetQuestion("bad.miek.nl.", TypeA)
+	if r, err := c.Exchange(m, l.LocalAddr().String()); err == nil {
+		t.Logf("Expected the invalid reply to be dropped, got %v", r)
+		t.Fail()
+	}
+	log.Lock()
+	defer log.Unlock()
+	if len(log.lines) != 1 {
+		t.Logf("Expected one logged response, got %v", log.lines)
+		t.Fail()
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+// Zone walking, to audit how much of a zone can be enumerated
+// from its NSEC or NSEC3 records, see RFC 5155 section 12.1.
+
+import (
+	"strings"
+)
+
+// Cover returns true if name lies between the owner name and the next domain
+// name of the NSEC record in canonical order, i.e. the NSEC proves that name
+// does not exist. The last NSEC of a zone, which points back to the apex,
+// covers all names that sort after its owner name.
+func (nsec *RR_NSEC) Cover(name string) bool {
+	if CompareDomainName(nsec.Hdr.Name, name) >= 0 {
+		return false
+	}
+	if CompareDomainName(nsec.Hdr.Name, nsec.NextDomain) >= 0 {
+		// Last NSEC in the chain
+		return true
+	}
+	return CompareDomainName(name, nsec.NextDomain) < 0
+}
+
+// NsecWalk walks the NSEC chain of zone. Starting at the apex, query is
+// called with each owner name in the chain and should return the response
+// to a query for that name, i.e. an NSEC query sent to an authoritative
+// server of the zone. For each NSEC record found f is called. The walk
+// stops when the chain returns to the apex, when f returns false or when
+// query returns an error. ErrWalk is returned when a response does not
+// contain the NSEC record of the name or when the chain does not move
+// forward.
+func NsecWalk(zone string, query func(name string) (*Msg, error), f func(*RR_NSEC) bool) error {
+	zone = Fqdn(zone)
+	name := zone
+	for {
+		m, err := query(name)
+		if err != nil {
+			return err
+		}
+		var nsec *RR_NSEC
+		for _, r := range append(m.Answer, m.Ns...) {
+			if n, ok := r.(*RR_NSEC); ok && CompareDomainName(n.Hdr.Name, name) == 0 {
+				nsec = n
+				break
+			}
+		}
+		if nsec == nil {
+			return ErrWalk
+		}
+		if !f(nsec) {
+			return nil
+		}
+		next := nsec.NextDomain
+		if CompareDomainName(next, zone) == 0 {
+			return nil
+		}
+		if CompareDomainName(next, name) <= 0 || !isSubDomain(strings.ToLower(zone), strings.ToLower(next)) {
+			return ErrWalk
+		}
+		name = next
+	}
+}
+
+// Nsec3Crack tries to find the names that belong to the hashed owner
+// names of the NSEC3 records of zone. The names tried are the apex and
+// the labels returned by next, prepended to zone; next is called until it
+// returns false. The NSEC3 parameters of each record are used for hashing.
+// The result maps the hashed owner names (in upper case, without the zone)
+// to the names found.
+func Nsec3Crack(nsec3 []*RR_NSEC3, zone string, next func() (label string, ok bool)) map[string]string {
+	type params struct {
+		hash uint8
+		iter uint16
+		salt string
+	}
+	zone = Fqdn(zone)
+	hashes := make(map[string]bool)
+	var ps []params
+	seen := make(map[params]bool)
+	for _, n := range nsec3 {
+		hashes[strings.ToUpper(SplitLabels(n.Hdr.Name)[0])] = true
+		p := params{n.Hash, n.Iterations, strings.ToUpper(n.Salt)}
+		if !seen[p] {
+			seen[p] = true
+			ps = append(ps, p)
+		}
+	}
+	found := make(map[string]string)
+	try := func(name string) {
+		for _, p := range ps {
+			h := HashName(name, p.hash, p.iter, p.salt)
+			if hashes[h] {
+				found[h] = name
+			}
+		}
+	}
+	try(zone)
+	for len(found) < len(hashes) {
+		label, ok := next()
+		if !ok {
+			break
+		}
+		try(label + "." + zone)
+	}
+	return found
+}
@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCompareDomainName(t *testing.T) {
+	// RFC 4034 section 6.1
+	names := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.",
+		"zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example."}
+	for i := 1; i < len(names); i++ {
+		if CompareDomainName(names[i-1], names[i]) != -1 || CompareDomainName(names[i], names[i-1]) != 1 {
+			t.Logf("%s should sort before %s", names[i-1], names[i])
+			t.Fail()
+		}
+	}
+	if CompareDomainName("A.example.", "a.Example") != 0 {
+		t.Log("Names should be equal")
+		t.Fail()
+	}
+	if CompareDomainName(".", "example.") != -1 {
+		t.Log("The root should sort first")
+		t.Fail()
+	}
+}
+
+func TestNsecWalk(t *testing.T) {
+	chain := []string{"miek.nl.", "a.miek.nl.", "www.miek.nl.", "z.miek.nl."}
+	nsecs := make(map[string]*RR_NSEC)
+	for i, n := range chain {
+		nsec := new(RR_NSEC)
+		nsec.Hdr = RR_Header{Name: n, Rrtype: TypeNSEC, Class: ClassINET, Ttl: 3600}
+		nsec.NextDomain = chain[(i+1)%len(chain)]
+		nsecs[n] = nsec
+	}
+	query := func(name string) (*Msg, error) {
+		m := new(Msg)
+		m.SetQuestion(name, TypeNSEC)
+		if n, ok := nsecs[name]; ok {
+			m.Answer = append(m.Answer, n)
+		}
+		return m, nil
+	}
+	var walked []string
+	err := NsecWalk("miek.nl", query, func(n *RR_NSEC) bool {
+		walked = append(walked, n.Hdr.Name)
+		return true
+	})
+	if err != nil || len(walked) != len(chain) {
+		t.Logf("Failed to walk the chain: %v %v", walked, err)
+		t.Fail()
+	}
+	if !nsecs["a.miek.nl."].Cover("b.miek.nl.") || nsecs["a.miek.nl."].Cover("z.miek.nl.") {
+		t.Log("Wrong cover of a.miek.nl. NSEC")
+		t.Fail()
+	}
+	if !nsecs["z.miek.nl."].Cover("zz.miek.nl.") {
+		t.Log("Last NSEC should cover names after it")
+		t.Fail()
+	}
+	// Break the chain
+	nsecs["www.miek.nl."].NextDomain = "a.miek.nl."
+	if err := NsecWalk("miek.nl.", query, func(*RR_NSEC) bool { return true }); err != ErrWalk {
+		t.Logf("Broken chain should fail: %v", err)
+		t.Fail()
+	}
+}
+
+func TestNsec3Crack(t *testing.T) {
+	var nsec3 []*RR_NSEC3
+	for _, n := range []string{"miek.nl.", "www.miek.nl.", "secret.miek.nl."} {
+		r := new(RR_NSEC3)
+		r.Hdr = RR_Header{Name: HashName(n, SHA1, 1, "AABB") + ".miek.nl.", Rrtype: TypeNSEC3, Class: ClassINET, Ttl: 3600}
+		r.Hash = SHA1
+		r.Iterations = 1
+		r.Salt = "AABB"
+		nsec3 = append(nsec3, r)
+	}
+	dict := []string{"mail", "www", "ns1"}
+	for i := 0; i < 10; i++ {
+		dict = append(dict, "host"+strconv.Itoa(i))
+	}
+	i := 0
+	found := Nsec3Crack(nsec3, "miek.nl.", func() (string, bool) {
+		if i == len(dict) {
+			return "", false
+		}
+		i++
+		return dict[i-1], true
+	})
+	if len(found) != 2 || found[HashName("www.miek.nl.", SHA1, 1, "AABB")] != "www.miek.nl." {
+		t.Logf("Failed to crack NSEC3 names: %v", found)
+		t.Fail()
+	}
+}
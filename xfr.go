@@ -6,6 +6,9 @@ package dns
 // The last message send has Exchange.Error set to ErrXfrLast
 // to signal there is nothing more to come.
 func (c *Client) XfrReceive(q *Msg, a string) error {
+	if len(q.Question) == 0 {
+		return ErrXfrType
+	}
 	w := new(reply)
 	w.client = c
 	w.addr = a
@@ -33,16 +36,16 @@ func (w *reply) axfrReceive() {
 	for {
 		in, err := w.Receive()
 		if err != nil {
-			w.Client().ReplyChan <- &Exchange{w.req, in, err}
+			w.replies() <- &Exchange{w.req, in, err}
 			return
 		}
 		if w.req.Id != in.Id {
-			w.Client().ReplyChan <- &Exchange{w.req, in, ErrId}
+			w.replies() <- &Exchange{w.req, in, ErrId}
 			return
 		}
 		if first {
 			if !checkXfrSOA(in, true) {
-				w.Client().ReplyChan <- &Exchange{w.req, in, ErrXfrSoa}
+				w.replies() <- &Exchange{w.req, in, ErrXfrSoa}
 				return
 			}
 			first = !first
@@ -51,10 +54,10 @@ func (w *reply) axfrReceive() {
 		if !first {
 			w.tsigTimersOnly = true // Subsequent envelopes use this.
 			if checkXfrSOA(in, false) {
-				w.Client().ReplyChan <- &Exchange{w.req, in, ErrXfrLast}
+				w.replies() <- &Exchange{w.req, in, ErrXfrLast}
 				return
 			}
-			w.Client().ReplyChan <- &Exchange{Request: w.req, Reply: in}
+			w.replies() <- &Exchange{Request: w.req, Reply: in}
 		}
 	}
 	panic("not reached")
@@ -68,24 +71,24 @@ func (w *reply) ixfrReceive() {
 	for {
 		in, err := w.Receive()
 		if err != nil {
-			w.Client().ReplyChan <- &Exchange{w.req, in, err}
+			w.replies() <- &Exchange{w.req, in, err}
 			return
 		}
 		if w.req.Id != in.Id {
-			w.Client().ReplyChan <- &Exchange{w.req, in, ErrId}
+			w.replies() <- &Exchange{w.req, in, ErrId}
 			return
 		}
 
 		if first {
 			// A single SOA RR signals "no changes"
 			if len(in.Answer) == 1 && checkXfrSOA(in, true) {
-				w.Client().ReplyChan <- &Exchange{w.req, in, ErrXfrLast}
+				w.replies() <- &Exchange{w.req, in, ErrXfrLast}
 				return
 			}
 
 			// Check if the returned answer is ok
 			if !checkXfrSOA(in, true) {
-				w.Client().ReplyChan <- &Exchange{w.req, in, ErrXfrSoa}
+				w.replies() <- &Exchange{w.req, in, ErrXfrSoa}
 				return
 			}
 			// This serial is important
@@ -99,20 +102,102 @@ func (w *reply) ixfrReceive() {
 			// If the last record in the IXFR contains the servers' SOA,  we should quit
 			if v, ok := in.Answer[len(in.Answer)-1].(*RR_SOA); ok {
 				if v.Serial == serial {
-					w.Client().ReplyChan <- &Exchange{w.req, in, ErrXfrLast}
+					w.replies() <- &Exchange{w.req, in, ErrXfrLast}
 					return
 				}
 			}
-			w.Client().ReplyChan <- &Exchange{Request: w.req, Reply: in}
+			w.replies() <- &Exchange{Request: w.req, Reply: in}
 		}
 	}
 	panic("not reached")
 	return
 }
 
+// TransferZone transfers zone from the master server at address master
+// (host:port). It first asks master for the SOA of the zone and then
+// requests an AXFR, both over TCP. When tsig is not nil the queries are
+// signed with it, and the answers must be too; for the AXFR only the first
+// message must be signed. It returns the records of
+// the zone, starting with the SOA record, and the serial of the zone.
+func TransferZone(zone, master string, tsig *TsigKey) ([]RR, uint32, error) {
+	zone = Fqdn(zone)
+	c := NewClient()
+	c.Net = "tcp"
+	if tsig != nil {
+		c.TsigSecret = map[string]string{tsig.Name: tsig.Secret}
+		c.TsigName, c.TsigAlgorithm = tsig.Name, tsig.Algorithm
+	}
+
+	w := &reply{client: c, addr: master}
+	q := new(Msg)
+	q.SetQuestion(zone, TypeSOA)
+	q.RecursionDesired = false
+	if err := w.Send(q); err != nil {
+		return nil, 0, err
+	}
+	in, err := w.Receive()
+	w.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	if tsig != nil && !in.IsTsig() {
+		return nil, 0, ErrNoSig
+	}
+	if in.Rcode != RcodeSuccess {
+		return nil, 0, &Error{Err: "SOA query failed: " + RcodeToString(in.Rcode), Name: zone}
+	}
+	if len(in.Answer) == 0 || in.Answer[0].Header().Rrtype != TypeSOA {
+		return nil, 0, &Error{Err: "no SOA for zone", Name: zone}
+	}
+
+	q = new(Msg)
+	q.SetAxfr(zone)
+	w = &reply{client: c, addr: master, req: q, replyChan: make(chan *Exchange)}
+	if err := w.Send(q); err != nil {
+		return nil, 0, err
+	}
+	go w.axfrReceive()
+	var rrs []RR
+	for ex := range w.replyChan {
+		if ex.Error != nil && ex.Error != ErrXfrLast {
+			if ex.Reply != nil && ex.Reply.Rcode != RcodeSuccess {
+				return nil, 0, &Error{Err: "AXFR failed: " + RcodeToString(ex.Reply.Rcode), Name: zone}
+			}
+			return nil, 0, ex.Error
+		}
+		if tsig != nil && len(rrs) == 0 && !ex.Reply.IsTsig() {
+			if ex.Error == nil {
+				// Stop axfrReceive, it ends with an error
+				w.conn.Close()
+				go func() {
+					for ex := range w.replyChan {
+						if ex.Error != nil {
+							return
+						}
+					}
+				}()
+			}
+			return nil, 0, ErrNoSig
+		}
+		rrs = append(rrs, ex.Reply.Answer...)
+		if ex.Error == ErrXfrLast {
+			break
+		}
+	}
+	if len(rrs) < 2 {
+		return nil, 0, ErrXfrSoa
+	}
+	// Leave out the SOA that ends the transfer
+	rrs = rrs[:len(rrs)-1]
+	return rrs, rrs[0].(*RR_SOA).Serial, nil
+}
+
 // XfrSend performs an outgoing Ixfr or Axfr. The function is xfr agnostic, it is
 // up to the caller to correctly send the sequence of messages.
 func XfrSend(w ResponseWriter, q *Msg, a string) error {
+	if len(q.Question) == 0 {
+		return ErrXfrType
+	}
 	switch q.Question[0].Qtype {
 	case TypeAXFR, TypeIXFR:
 		//		go d.xfrWrite(q, m, e)
@@ -0,0 +1,244 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zoned
+
+// A journal of the changes made to a zone, so they survive a restart.
+
+import (
+	"bufio"
+	"bytes"
+	"dns"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// A Journal persists the changes made to a zone. Each change is written
+// in the difference sequence format of IXFR (RFC 1995): the old SOA, the
+// removed RRs, the new SOA and the added RRs, followed by the new SOA again
+// to mark the end of the change. The records are in zone file format. A
+// change that was not completely written, for instance because of a crash,
+// is ignored and cut off when the journal is replayed.
+type Journal struct {
+	mu   sync.Mutex // serializes the access to f
+	name string
+	f    *os.File
+}
+
+// OpenJournal opens the journal in the file name, the file is created when
+// it does not exist.
+func OpenJournal(name string) (*Journal, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{name: name, f: f}, nil
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	return j.f.Close()
+}
+
+// Append writes a change to the journal and syncs it to disk.
+func (j *Journal) Append(from, to *dns.RR_SOA, removed, added []dns.RR) error {
+	var b bytes.Buffer
+	b.WriteString(from.String() + "\n")
+	for _, r := range removed {
+		b.WriteString(r.String() + "\n")
+	}
+	b.WriteString(to.String() + "\n")
+	for _, r := range added {
+		b.WriteString(r.String() + "\n")
+	}
+	b.WriteString(to.String() + "\n")
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.f.WriteString(b.String()); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Replay applies the changes in the journal that follow the current
+// version of z, in order. The changes are not written to the journal of z
+// again. It is an error when the journal holds changes for z, but not the
+// one following the current version.
+func (j *Journal) Replay(z *Zone) error {
+	j.mu.Lock()
+	changes, err := j.read()
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, c := range changes {
+		d := z.data()
+		if !dns.SerialLess(d.soa.Serial, c.to.Serial) {
+			// Already in the zone
+			continue
+		}
+		if c.from.Serial != d.soa.Serial {
+			return errors.New("zoned: journal " + j.name + " does not follow the zone")
+		}
+		if err := z.apply(d, c.removed, c.added, c.to, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the journal without the changes up to and including
+// the version with the given serial, i.e. after the zone with that serial
+// has been written to its zone file, see Zone.WriteTo. The new journal
+// replaces the old one atomically.
+func (j *Journal) Compact(serial uint32) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changes, err := j.read()
+	if err != nil {
+		return err
+	}
+	tmp, err := OpenJournal(j.name + ".tmp")
+	if err != nil {
+		return err
+	}
+	if err := tmp.f.Truncate(0); err != nil {
+		tmp.Close()
+		return err
+	}
+	for _, c := range changes {
+		if !dns.SerialLess(serial, c.to.Serial) {
+			continue
+		}
+		if err := tmp.Append(c.from, c.to, c.removed, c.added); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := os.Rename(tmp.name, j.name); err != nil {
+		tmp.Close()
+		return err
+	}
+	j.f.Close()
+	j.f = tmp.f
+	return nil
+}
+
+// read reads the changes from the journal. An incomplete last change is
+// cut off the file, so that the next change is appended right after the
+// last complete one. j.mu must be held.
+func (j *Journal) read() ([]*delta, error) {
+	if _, err := j.f.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	changes, size, err := readJournal(bufio.NewReader(j.f), j.name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := j.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > size {
+		if err := j.f.Truncate(size); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// readJournal reads the changes from a journal, an incomplete last
+// change is left out. It also returns the length of the complete
+// changes. Any other error in the journal is returned.
+func readJournal(r io.Reader, file string) ([]*delta, int64, error) {
+	const (
+		expectFrom = iota
+		inRemoved
+		inAdded
+	)
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A change that was cut off while it was written leaves a last line
+	// without a newline
+	lines := bytes.Count(buf, []byte{'\n'}) + 1
+	cut := len(buf) > 0 && buf[len(buf)-1] != '\n'
+	var (
+		changes []*delta
+		c       *delta
+		state   = expectFrom
+		partial bool
+	)
+	// Always drain the channel, so the parser finishes
+	for t := range dns.ParseZone(bytes.NewReader(buf), ".", file) {
+		if err != nil || partial {
+			continue
+		}
+		if t.Error != nil {
+			if cut && t.Error.Line() >= lines {
+				partial = true
+				continue
+			}
+			err = t.Error
+			continue
+		}
+		soa, isSoa := t.RR.(*dns.RR_SOA)
+		switch state {
+		case expectFrom:
+			if !isSoa {
+				err = errors.New("zoned: journal " + file + " is corrupt")
+				continue
+			}
+			c = &delta{from: soa}
+			state = inRemoved
+		case inRemoved:
+			if isSoa {
+				c.to = soa
+				state = inAdded
+				continue
+			}
+			c.removed = append(c.removed, t.RR)
+		case inAdded:
+			if isSoa {
+				// The end of the change
+				changes = append(changes, c)
+				state = expectFrom
+				continue
+			}
+			c.added = append(c.added, t.RR)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	// Each record of a change is on a line of its own, see Append
+	n := 0
+	for _, c := range changes {
+		n += 3 + len(c.removed) + len(c.added)
+	}
+	var size int64
+	for ; n > 0; n-- {
+		size += int64(bytes.IndexByte(buf[size:], '\n')) + 1
+	}
+	return changes, size, nil
+}
+
+// WriteTo writes the current version of the zone to w in zone file format.
+func (z *Zone) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, r := range z.data().rrs {
+		m, err := io.WriteString(w, r.String()+"\n")
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
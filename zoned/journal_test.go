@@ -0,0 +1,165 @@
+package zoned
+
+import (
+	"bytes"
+	"dns"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zoned")
+	if err != nil {
+		t.Logf("Failed to create directory: %s", err)
+		t.Fail()
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "miek.nl.jnl")
+
+	z, _ := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	serial := z.Serial()
+	if z.Journal, err = OpenJournal(file); err != nil {
+		t.Logf("Failed to open journal: %s", err)
+		t.Fail()
+		return
+	}
+	z.Apply([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.1")}, []dns.RR{newRR("a.miek.nl. IN A 127.0.0.10")})
+	z.Apply(nil, []dns.RR{newRR("new.miek.nl. IN A 127.0.0.11")})
+	z.Journal.Close()
+	// A partly written change, as after a crash
+	f, _ := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(z.Soa().String() + "\nnew.miek.nl. IN A 127.0.0.11\nnew.miek.nl. IN A 127.0")
+	f.Close()
+
+	// Replay on the zone as it is in the zone file
+	z1, _ := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	j, err := OpenJournal(file)
+	if err != nil {
+		t.Logf("Failed to open journal: %s", err)
+		t.Fail()
+		return
+	}
+	defer j.Close()
+	if err := j.Replay(z1); err != nil {
+		t.Logf("Failed to replay: %s", err)
+		t.Fail()
+	}
+	if z1.Serial() != serial+2 {
+		t.Logf("Replay should bring the zone to serial %d: %d", serial+2, z1.Serial())
+		t.Fail()
+	}
+	if len(z1.data().rrs) != len(z.data().rrs) {
+		t.Logf("Replayed zone differs: %d != %d RRs", len(z1.data().rrs), len(z.data().rrs))
+		t.Fail()
+	}
+	// Replaying again changes nothing
+	if err := j.Replay(z1); err != nil || z1.Serial() != serial+2 {
+		t.Log("Second replay should be a no-op")
+		t.Fail()
+	}
+	// The cut off change is gone, a new change follows the last complete one
+	z1.Journal = j
+	if err := z1.Apply(nil, []dns.RR{newRR("newer.miek.nl. IN A 127.0.0.12")}); err != nil {
+		t.Logf("Failed to apply: %s", err)
+		t.Fail()
+	}
+	z1.Journal = nil
+	z2, _ := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err := j.Replay(z2); err != nil || z2.Serial() != serial+3 {
+		t.Logf("Replay after a change appended to a cut off journal failed: %v", err)
+		t.Fail()
+	}
+
+	// Compact the journal, as if the zone with the first change was written
+	if err := j.Compact(serial + 1); err != nil {
+		t.Logf("Failed to compact: %s", err)
+		t.Fail()
+	}
+	z3, _ := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err := j.Replay(z3); err == nil {
+		t.Log("Replay of a compacted journal on an old zone should fail")
+		t.Fail()
+	}
+	var buf bytes.Buffer
+	z4, _ := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	z4.Apply([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.1")}, []dns.RR{newRR("a.miek.nl. IN A 127.0.0.10")})
+	z4.WriteTo(&buf)
+	z5, err := ReadZone(&buf, "miek.nl.", "")
+	if err != nil {
+		t.Logf("Failed to read written zone: %s", err)
+		t.Fail()
+		return
+	}
+	if err := j.Replay(z5); err != nil || z5.Serial() != serial+3 {
+		t.Logf("Replay on the written zone failed: %v", err)
+		t.Fail()
+	}
+	if m := query(z5, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}, "new.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 {
+		t.Logf("Replayed change not served:\n%s", m[0])
+		t.Fail()
+	}
+}
+
+func TestReadJournal(t *testing.T) {
+	from := "miek.nl. IN SOA linode.atoom.net. miek.miek.nl. 1 14400 3600 604800 14400\n"
+	to := "miek.nl. IN SOA linode.atoom.net. miek.miek.nl. 2 14400 3600 604800 14400\n"
+	change := from + "a.miek.nl. IN A 127.0.0.1\n" + to + "a.miek.nl. IN A 127.0.0.10\n" + to
+	if c, size, err := readJournal(strings.NewReader(change+from+"a.miek.nl. IN A 127."), "jnl"); err != nil || len(c) != 1 || size != int64(len(change)) {
+		t.Logf("A cut off last change should be left out: %v %v %d", err, c, size)
+		t.Fail()
+	}
+	if c, size, err := readJournal(strings.NewReader(change+from+"a.miek.nl. IN A 127.0.0.1\n"), "jnl"); err != nil || len(c) != 1 || size != int64(len(change)) {
+		t.Logf("A change without its end should be left out: %v %v %d", err, c, size)
+		t.Fail()
+	}
+	if _, _, err := readJournal(strings.NewReader(from+"a.miek.nl. IN A 127.\n"+to+to+change), "jnl"); err == nil {
+		t.Log("A bad change before the end should be an error")
+		t.Fail()
+	}
+	if _, _, err := readJournal(strings.NewReader(change+"a.miek.nl. IN A 127.0.0.1\n"+change), "jnl"); err == nil {
+		t.Log("A change that does not start with a SOA should be an error")
+		t.Fail()
+	}
+}
+
+func TestServerJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zoned")
+	if err != nil {
+		t.Logf("Failed to create directory: %s", err)
+		t.Fail()
+		return
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "miek.nl")
+	ioutil.WriteFile(file, []byte(testZone), 0644)
+
+	s := &Server{Zones: map[string]string{"miek.nl.": file}, Journals: true}
+	if err := s.Load(); err != nil {
+		t.Logf("Failed to load: %s", err)
+		t.Fail()
+		return
+	}
+	z := s.Zone("miek.nl.")
+	serial := z.Serial()
+	z.Apply(nil, []dns.RR{newRR("new.miek.nl. IN A 127.0.0.11")})
+	// The reloaded zone takes over the journal, the old one is done
+	if err := s.Load(); err != nil || s.Zone("miek.nl.").Serial() != serial+1 {
+		t.Logf("Reload should replay the journal: %v", err)
+		t.Fail()
+		return
+	}
+	if err := z.Apply(nil, []dns.RR{newRR("old.miek.nl. IN A 127.0.0.12")}); err == nil {
+		t.Log("A change to the replaced zone should fail")
+		t.Fail()
+	}
+	s.Zone("miek.nl.").Apply(nil, []dns.RR{newRR("newer.miek.nl. IN A 127.0.0.13")})
+	if err := s.Load(); err != nil || s.Zone("miek.nl.").Serial() != serial+2 {
+		t.Logf("Second reload should replay both changes: %v", err)
+		t.Fail()
+	}
+}
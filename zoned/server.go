@@ -0,0 +1,211 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zoned
+
+import (
+	"dns"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+)
+
+// A Server serves a set of zones. It implements dns.Handler, so it can be
+// given to dns.ListenAndServe or used in a dns.Server.
+type Server struct {
+	Zones    map[string]string // zone files by origin
+	XfrPeers []string          // IP addresses or CIDR prefixes that may transfer the zones
+	ErrorLog dns.Logger        // if not nil, reload errors are logged here
+	Journals bool              // keep a journal of the changes to each zone, in the zone file + ".jnl"
+
+	loading sync.Mutex // serializes Load
+	mu      sync.RWMutex
+	mux     *dns.ServeMux
+	zones   map[string]*Zone
+	peers   []*net.IPNet
+}
+
+// Load (re)loads all zones. When a zone can not be loaded an error is
+// returned and the zones that were loaded before are kept, the server never
+// serves a partially loaded set of zones. A reloaded zone takes over the
+// journal of the zone it replaces, the old zone refuses changes afterwards.
+func (s *Server) Load() error {
+	peers, err := parsePeers(s.XfrPeers)
+	if err != nil {
+		return err
+	}
+	s.loading.Lock()
+	defer s.loading.Unlock()
+	s.mu.RLock()
+	old := s.zones
+	s.mu.RUnlock()
+	// The old zones are locked from the replay of their journal until the
+	// new zones are served, so that no change to them gets lost
+	locked := make(map[*Zone]bool)
+	zones := make(map[string]*Zone)
+	mux := dns.NewServeMux()
+	for origin, file := range s.Zones {
+		z, err := LoadZone(file, origin)
+		if err == nil && s.Journals {
+			o := old[z.Origin]
+			if o != nil && !locked[o] {
+				o.mu.Lock()
+				locked[o] = true
+			}
+			if o != nil && o.Journal != nil && o.Journal.name == file+".jnl" {
+				if err = o.Journal.Replay(z); err == nil {
+					z.Journal = o.Journal
+				}
+			} else {
+				err = openJournal(z, file+".jnl")
+			}
+		}
+		if err != nil {
+			for _, z := range zones {
+				if z.Journal != nil && (old[z.Origin] == nil || old[z.Origin].Journal != z.Journal) {
+					z.Journal.Close()
+				}
+			}
+			for o := range locked {
+				o.mu.Unlock()
+			}
+			return err
+		}
+		zones[z.Origin] = z
+		mux.Handle(z.Origin, s.handler(z))
+	}
+	s.mu.Lock()
+	s.mux, s.zones, s.peers = mux, zones, peers
+	s.mu.Unlock()
+	for _, o := range old {
+		if !locked[o] {
+			o.mu.Lock()
+		}
+		if o.Journal != nil && (zones[o.Origin] == nil || zones[o.Origin].Journal != o.Journal) {
+			o.Journal.Close()
+		}
+		o.Journal = nil
+		o.retired = true
+		o.mu.Unlock()
+	}
+	return nil
+}
+
+// openJournal opens the journal in file for z and replays it.
+func openJournal(z *Zone, file string) error {
+	j, err := OpenJournal(file)
+	if err != nil {
+		return err
+	}
+	if err := j.Replay(z); err != nil {
+		j.Close()
+		return err
+	}
+	z.Journal = j
+	return nil
+}
+
+// Zone returns the currently loaded zone with apex origin, or nil.
+func (s *Server) Zone(origin string) *Zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.zones[strings.ToLower(dns.Fqdn(origin))]
+}
+
+// ReloadOnSignal reloads the zones each time one of the signals, typically
+// syscall.SIGHUP, is received.
+func (s *Server) ReloadOnSignal(sig ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		for _ = range c {
+			if err := s.Load(); err != nil && s.ErrorLog != nil {
+				s.ErrorLog.Printf("zoned: reload failed: %s", err)
+			}
+		}
+	}()
+}
+
+// ServeDNS answers r from the zone that most closely matches the question.
+// Queries for names not in one of the zones are refused.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	s.mu.RLock()
+	mux := s.mux
+	s.mu.RUnlock()
+	if mux == nil {
+		dns.Refused(w, r)
+		return
+	}
+	mux.ServeDNS(w, r)
+}
+
+// handler returns the handler for the zone z, this adds zone transfers
+// (AXFR and IXFR) for the allowed peers.
+func (s *Server) handler(z *Zone) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if len(r.Question) == 0 {
+			z.ServeDNS(w, r)
+			return
+		}
+		switch r.Question[0].Qtype {
+		case dns.TypeAXFR, dns.TypeIXFR:
+			if !s.xfrAllowed(w.RemoteAddr()) {
+				z.ServeDNS(w, r) // refuses
+				return
+			}
+			if r.Question[0].Qtype == dns.TypeIXFR {
+				z.TransferIncremental(w, r)
+				return
+			}
+			z.Transfer(w, r)
+		default:
+			z.ServeDNS(w, r)
+		}
+	})
+}
+
+// xfrAllowed returns true if a may transfer the zones. Transfers
+// are only done over TCP.
+func (s *Server) xfrAllowed(a net.Addr) bool {
+	t, ok := a.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.peers {
+		if p.Contains(t.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePeers parses the IP addresses and CIDR prefixes in peers.
+func parsePeers(peers []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, p := range peers {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, errors.New("zoned: bad peer address " + p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
@@ -0,0 +1,373 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zoned
+
+// Dynamic updates, RFC 2136, with an update policy as in BIND.
+
+import (
+	"dns"
+	"strings"
+)
+
+// How the name in an UpdateRule is matched.
+const (
+	MatchName      = iota // the owner name equals the name of the rule
+	MatchSubdomain        // the owner name is equal to or below the name of the rule
+	MatchWildcard         // the owner name matches the wildcard name of the rule, e.g. *.dyn.miek.nl.
+	MatchSelf             // the owner name equals the name of the TSIG key, the name of the rule is ignored
+	MatchZonesub          // any owner name in the zone, the name of the rule is ignored
+)
+
+// An UpdateRule grants or denies the changes to the RRs of an owner name
+// and type, when the update is signed with a TSIG key.
+type UpdateRule struct {
+	Grant bool     // grant or deny
+	Key   string   // name of the TSIG key, "*" for any key, "" for unsigned updates
+	Match int      // how Name is matched
+	Name  string   // the name to match
+	Types []uint16 // the types the rule applies to, all but NSEC and NSEC3 when empty
+}
+
+// An UpdatePolicy is a list of rules, the first rule that matches a change
+// decides if it is allowed. When no rule matches, the change is denied.
+type UpdatePolicy []UpdateRule
+
+// Allowed returns true if the update signed with key may change the RRs of
+// type t of name.
+func (p UpdatePolicy) Allowed(key, name string, t uint16) bool {
+	key = strings.ToLower(key)
+	name = strings.ToLower(name)
+	for _, r := range p {
+		if r.matches(key, name, t) {
+			return r.Grant
+		}
+	}
+	return false
+}
+
+func (r *UpdateRule) matches(key, name string, t uint16) bool {
+	switch r.Key {
+	case "*":
+		if key == "" {
+			return false
+		}
+	default:
+		if strings.ToLower(dns.Fqdn(r.Key)) != dns.Fqdn(key) {
+			return false
+		}
+	}
+	rn := strings.ToLower(dns.Fqdn(r.Name))
+	switch r.Match {
+	case MatchName:
+		if name != rn {
+			return false
+		}
+	case MatchSubdomain:
+		if !inZone(rn, name) {
+			return false
+		}
+	case MatchWildcard:
+		if !strings.HasPrefix(rn, "*.") || !strings.HasSuffix(name, rn[1:]) {
+			return false
+		}
+	case MatchSelf:
+		if key == "" || name != dns.Fqdn(key) {
+			return false
+		}
+	case MatchZonesub:
+	default:
+		return false
+	}
+	if len(r.Types) == 0 {
+		return t != dns.TypeNSEC && t != dns.TypeNSEC3
+	}
+	for _, x := range r.Types {
+		if x == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeUpdate handles the dynamic update u and writes the reply to w. See
+// Update.
+func (z *Zone) ServeUpdate(w dns.ResponseWriter, u *dns.Msg, key string, p UpdatePolicy) {
+	m := new(dns.Msg)
+	m.SetRcode(u, z.Update(u, key, p))
+	m.Opcode = dns.OpcodeUpdate
+	write(w, u, m)
+}
+
+// Update handles the dynamic update u as described in RFC 2136 and returns
+// the rcode for the reply. The prerequisites in u are checked against the
+// current version of the zone, and every change must be allowed by the
+// policy p. The name of the TSIG key u is signed with is given in key, the
+// caller must have verified the signature; for unsigned updates key is "".
+// The changes are applied as a whole in a new version of the zone with an
+// increased serial (see Apply), or not at all.
+func (z *Zone) Update(u *dns.Msg, key string, p UpdatePolicy) int {
+	if len(u.Question) != 1 || u.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	if strings.ToLower(dns.Fqdn(u.Question[0].Name)) != z.Origin {
+		return dns.RcodeNotAuth
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	up := &update{d: z.data(), class: u.Question[0].Qclass}
+	if up.class != up.d.soa.Hdr.Class {
+		return dns.RcodeNotAuth
+	}
+	if rcode := up.prerequisites(u.Answer); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+	for _, r := range u.Ns {
+		if rcode := up.prescan(r); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+		if !p.Allowed(key, r.Header().Name, r.Header().Rrtype) {
+			return dns.RcodeRefused
+		}
+	}
+	for _, r := range u.Ns {
+		up.update(r)
+	}
+	if len(up.removed) == 0 && len(up.added) == 0 && up.soa == nil {
+		return dns.RcodeSuccess
+	}
+	if err := z.apply(up.d, up.removed, up.added, up.soa, true); err != nil {
+		return dns.RcodeServerFailure
+	}
+	return dns.RcodeSuccess
+}
+
+// An update holds the changes of a dynamic update to a version of a zone.
+type update struct {
+	d       *zoneData
+	class   uint16
+	soa     *dns.RR_SOA // the new SOA record, if any
+	removed []dns.RR    // RRs of d that are removed
+	added   []dns.RR    // RRs that are not in d and are added
+}
+
+// prerequisites checks the prerequisite section, RFC 2136 section 3.2.
+func (u *update) prerequisites(prereqs []dns.RR) int {
+	type key struct {
+		name string
+		t    uint16
+	}
+	values := make(map[key][]dns.RR) // the value dependent RRsets
+	for _, r := range prereqs {
+		h := r.Header()
+		name := strings.ToLower(h.Name)
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !inZone(u.d.origin, name) {
+			return dns.RcodeNotZone
+		}
+		n, used := u.d.names[name]
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if !used {
+					return dns.RcodeNameError
+				}
+			} else if !used || len(n.rrset(h.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if used {
+					return dns.RcodeYXDomain
+				}
+			} else if used && len(n.rrset(h.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case u.class:
+			k := key{name, h.Rrtype}
+			values[k] = append(values[k], r)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	for k, set := range values {
+		var rrs []dns.RR
+		if n, ok := u.d.names[k.name]; ok {
+			rrs = n.rrset(k.t)
+		}
+		added, removed := dns.DiffRRsets(rrs, set)
+		if len(added) > 0 || len(removed) > 0 {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// prescan checks an RR from the update section, RFC 2136 section 3.4.1.
+func (u *update) prescan(r dns.RR) int {
+	h := r.Header()
+	if !inZone(u.d.origin, strings.ToLower(h.Name)) {
+		return dns.RcodeNotZone
+	}
+	switch h.Class {
+	case u.class:
+		if metaType(h.Rrtype) {
+			return dns.RcodeFormatError
+		}
+	case dns.ClassANY:
+		if h.Ttl != 0 || h.Rdlength != 0 || (metaType(h.Rrtype) && h.Rrtype != dns.TypeANY) {
+			return dns.RcodeFormatError
+		}
+	case dns.ClassNONE:
+		if h.Ttl != 0 || metaType(h.Rrtype) {
+			return dns.RcodeFormatError
+		}
+	default:
+		return dns.RcodeFormatError
+	}
+	return dns.RcodeSuccess
+}
+
+// update processes an RR from the update section, RFC 2136 section 3.4.2.
+// Changes that are not possible are silently ignored.
+func (u *update) update(r dns.RR) {
+	h := r.Header()
+	name := strings.ToLower(h.Name)
+	apex := name == u.d.origin
+	switch h.Class {
+	case u.class:
+		switch h.Rrtype {
+		case dns.TypeSOA:
+			soa := u.d.soa
+			if u.soa != nil {
+				soa = u.soa
+			}
+			if apex && dns.SerialLess(soa.Serial, r.(*dns.RR_SOA).Serial) {
+				u.soa = r.(*dns.RR_SOA)
+			}
+			return
+		case dns.TypeCNAME:
+			for _, x := range u.rrset(name, dns.TypeANY) {
+				if t := x.Header().Rrtype; t != dns.TypeCNAME && !dnssecType(t) {
+					return
+				}
+			}
+			// A CNAME replaces the existing one
+			for _, x := range u.rrset(name, dns.TypeCNAME) {
+				u.remove(x)
+			}
+		default:
+			if !dnssecType(h.Rrtype) && len(u.rrset(name, dns.TypeCNAME)) > 0 {
+				return
+			}
+		}
+		u.add(r)
+	case dns.ClassANY:
+		for _, x := range u.rrset(name, h.Rrtype) {
+			if t := x.Header().Rrtype; !apex || (t != dns.TypeSOA && t != dns.TypeNS) {
+				u.remove(x)
+			}
+		}
+	case dns.ClassNONE:
+		if h.Rrtype == dns.TypeSOA {
+			return
+		}
+		if apex && h.Rrtype == dns.TypeNS && len(u.rrset(name, dns.TypeNS)) <= 1 {
+			// Never remove the last NS record
+			return
+		}
+		c := copyRR(r)
+		c.Header().Class = u.class
+		for _, x := range u.rrset(name, h.Rrtype) {
+			if dns.RRsEqual(x, c) {
+				u.remove(x)
+			}
+		}
+	}
+}
+
+// rrset returns the RRs of type t of name, with the changes so far. For
+// TypeANY all RRs of name are returned.
+func (u *update) rrset(name string, t uint16) []dns.RR {
+	var set []dns.RR
+	if n, ok := u.d.names[name]; ok {
+		for _, r := range n.rrset(t) {
+			if index(u.removed, r) < 0 {
+				set = append(set, r)
+			}
+		}
+	}
+	for _, r := range u.added {
+		if strings.ToLower(r.Header().Name) == name && (t == dns.TypeANY || r.Header().Rrtype == t) {
+			set = append(set, r)
+		}
+	}
+	return set
+}
+
+// remove removes r, which is in the zone or added before.
+func (u *update) remove(r dns.RR) {
+	if i := index(u.added, r); i >= 0 {
+		u.added = append(u.added[:i], u.added[i+1:]...)
+		return
+	}
+	u.removed = append(u.removed, r)
+}
+
+// add adds r, unless it is already there.
+func (u *update) add(r dns.RR) {
+	if i := index(u.removed, r); i >= 0 {
+		// Removed before, it stays
+		u.removed = append(u.removed[:i], u.removed[i+1:]...)
+		return
+	}
+	if index(u.rrset(strings.ToLower(r.Header().Name), r.Header().Rrtype), r) < 0 {
+		u.added = append(u.added, r)
+	}
+}
+
+// rrset returns the RRs of type t in n, for TypeANY all RRs.
+func (n *node) rrset(t uint16) []dns.RR {
+	var set []dns.RR
+	for x, rrs := range n.rrs {
+		if t == dns.TypeANY || t == x {
+			set = append(set, rrs...)
+		}
+	}
+	if t == dns.TypeANY || t == dns.TypeRRSIG {
+		for _, rrs := range n.sigs {
+			set = append(set, rrs...)
+		}
+	}
+	return set
+}
+
+// index returns the index of r in rrs, or -1. Equality is as in
+// dns.RRsEqual.
+func index(rrs []dns.RR, r dns.RR) int {
+	for i, x := range rrs {
+		if dns.RRsEqual(x, r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// metaType returns true for the types that can only appear in queries.
+func metaType(t uint16) bool {
+	return t == dns.TypeOPT || (t >= dns.TypeTKEY && t <= dns.TypeANY)
+}
+
+// dnssecType returns true for the types that may exist next to a CNAME.
+func dnssecType(t uint16) bool {
+	return t == dns.TypeRRSIG || t == dns.TypeNSEC || t == dns.TypeNSEC3
+}
@@ -0,0 +1,157 @@
+package zoned
+
+import (
+	"dns"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestUpdatePolicy(t *testing.T) {
+	p := UpdatePolicy{
+		{Grant: false, Key: "*", Match: MatchName, Name: "deny.dyn.miek.nl."},
+		{Grant: true, Key: "dyn.key.", Match: MatchSubdomain, Name: "dyn.miek.nl.", Types: []uint16{dns.TypeA, dns.TypeTXT}},
+		{Grant: true, Key: "*", Match: MatchSelf},
+		{Grant: true, Key: "*", Match: MatchWildcard, Name: "*.wild.miek.nl.", Types: []uint16{dns.TypeTXT}},
+		{Grant: true, Key: "admin.key.", Match: MatchZonesub},
+	}
+	tests := []struct {
+		key, name string
+		t         uint16
+		ok        bool
+	}{
+		{"dyn.key.", "host.dyn.miek.nl.", dns.TypeA, true},
+		{"DYN.KEY.", "dyn.miek.nl.", dns.TypeTXT, true},
+		{"dyn.key.", "host.dyn.miek.nl.", dns.TypeMX, false},
+		{"dyn.key.", "deny.dyn.miek.nl.", dns.TypeA, false},
+		{"", "host.dyn.miek.nl.", dns.TypeA, false},
+		{"host.miek.nl.", "host.miek.nl.", dns.TypeAAAA, true},
+		{"host.miek.nl.", "other.miek.nl.", dns.TypeAAAA, false},
+		{"some.key.", "x.wild.miek.nl.", dns.TypeTXT, true},
+		{"some.key.", "wild.miek.nl.", dns.TypeTXT, false},
+		{"admin.key.", "miek.nl.", dns.TypeMX, true},
+		{"admin.key.", "a.miek.nl.", dns.TypeNSEC, false},
+	}
+	for _, x := range tests {
+		if p.Allowed(x.key, x.name, x.t) != x.ok {
+			t.Logf("Allowed(%q, %q, %s) should be %v", x.key, x.name, dns.TypeToString(x.t), x.ok)
+			t.Fail()
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	z, err := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err != nil {
+		t.Logf("Failed to read zone: %s", err)
+		t.Fail()
+		return
+	}
+	p := UpdatePolicy{
+		{Grant: true, Key: "dyn.key.", Match: MatchSubdomain, Name: "dyn.miek.nl."},
+		{Grant: true, Key: "admin.key.", Match: MatchZonesub},
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+	serial := z.Serial()
+
+	// Unsigned updates are refused
+	u := dns.NewUpdate("miek.nl.", dns.ClassINET)
+	u.RRsetAddRdata([]dns.RR{newRR("host.dyn.miek.nl. 300 IN A 127.0.0.5")})
+	w := &testWriter{addr: udp}
+	z.ServeUpdate(w, u, "", p)
+	if len(w.msgs) != 1 || w.msgs[0].Rcode != dns.RcodeRefused || w.msgs[0].Opcode != dns.OpcodeUpdate {
+		t.Logf("Unsigned update should be refused: %v", w.msgs)
+		t.Fail()
+	}
+	w = &testWriter{addr: udp}
+	z.ServeUpdate(w, u, "dyn.key.", p)
+	if len(w.msgs) != 1 || w.msgs[0].Rcode != dns.RcodeSuccess {
+		t.Logf("Update should succeed: %v", w.msgs)
+		t.Fail()
+	}
+	if z.Serial() != serial+1 {
+		t.Logf("Serial should be incremented: %d", z.Serial())
+		t.Fail()
+	}
+	if m := query(z, udp, "host.dyn.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 {
+		t.Logf("Update not served:\n%s", m[0])
+		t.Fail()
+	}
+
+	tests := []struct {
+		prereq  func(u *dns.Msg)
+		update  func(u *dns.Msg)
+		rcode   int
+		changed bool
+	}{
+		// Name is not in use
+		{func(u *dns.Msg) { u.NameNotUsed([]dns.RR{newRR("host.dyn.miek.nl. IN A 127.0.0.9")}) },
+			func(u *dns.Msg) { u.RRsetAddRdata([]dns.RR{newRR("host.dyn.miek.nl. 300 IN A 127.0.0.6")}) },
+			dns.RcodeYXDomain, false},
+		// Name is in use
+		{func(u *dns.Msg) { u.NameUsed([]dns.RR{newRR("nohost.miek.nl. IN A 127.0.0.9")}) },
+			func(u *dns.Msg) { u.RRsetAddRdata([]dns.RR{newRR("a.miek.nl. 300 IN A 127.0.0.6")}) },
+			dns.RcodeNameError, false},
+		// RRset does not exist
+		{func(u *dns.Msg) { u.RRsetNotUsed([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.1")}) },
+			func(u *dns.Msg) { u.RRsetAddRdata([]dns.RR{newRR("a.miek.nl. 300 IN A 127.0.0.6")}) },
+			dns.RcodeYXRrset, false},
+		// RRset exists, value dependent
+		{func(u *dns.Msg) { u.RRsetUsedRdata([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.2")}) },
+			func(u *dns.Msg) { u.RRsetAddRdata([]dns.RR{newRR("a.miek.nl. 300 IN A 127.0.0.6")}) },
+			dns.RcodeNXRrset, false},
+		// Replace an RRset
+		{func(u *dns.Msg) { u.RRsetUsedRdata([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.1")}) },
+			func(u *dns.Msg) {
+				u.RRsetDelete([]dns.RR{&dns.RR_A{Hdr: dns.RR_Header{Name: "a.miek.nl.", Rrtype: dns.TypeA}}})
+				u.Ns = append(u.Ns, newRR("a.miek.nl. 300 IN A 127.0.0.6"))
+			},
+			dns.RcodeSuccess, true},
+		// A CNAME and other data
+		{nil, func(u *dns.Msg) { u.RRsetAddRdata([]dns.RR{newRR("www.miek.nl. 300 IN A 127.0.0.6")}) },
+			dns.RcodeSuccess, false},
+		// The last NS record is not removed
+		{nil, func(u *dns.Msg) { u.RRsetDeleteRR([]dns.RR{newRR("miek.nl. IN NS linode.atoom.net.")}) },
+			dns.RcodeSuccess, false},
+		// Not in the zone
+		{nil, func(u *dns.Msg) { u.RRsetAddRdata([]dns.RR{newRR("a.example.org. 300 IN A 127.0.0.6")}) },
+			dns.RcodeNotZone, false},
+		// Meta types can not be added
+		{nil, func(u *dns.Msg) {
+			u.RRsetAddRdata([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.6")})
+			u.Ns[0].Header().Rrtype = dns.TypeANY
+		},
+			dns.RcodeFormatError, false},
+		// Delete a name
+		{nil, func(u *dns.Msg) { u.NameDelete([]dns.RR{newRR("host.dyn.miek.nl. IN A 127.0.0.9")}) },
+			dns.RcodeSuccess, true},
+	}
+	for i, x := range tests {
+		serial := z.Serial()
+		u := dns.NewUpdate("miek.nl.", dns.ClassINET)
+		if x.prereq != nil {
+			x.prereq(u)
+		}
+		x.update(u)
+		if rcode := z.Update(u, "admin.key.", p); rcode != x.rcode {
+			t.Logf("Update %d: expected %s, got %s", i, dns.Rcode_str[x.rcode], dns.Rcode_str[rcode])
+			t.Fail()
+		}
+		if changed := z.Serial() != serial; changed != x.changed {
+			t.Logf("Update %d: zone changed should be %v", i, x.changed)
+			t.Fail()
+		}
+	}
+	if m := query(z, udp, "a.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 || m[0].Answer[0].(*dns.RR_A).A.String() != "127.0.0.6" {
+		t.Logf("RRset not replaced:\n%s", m[0])
+		t.Fail()
+	}
+	if m := query(z, udp, "host.dyn.miek.nl.", dns.TypeA); m[0].Rcode != dns.RcodeNameError {
+		t.Logf("Name not deleted:\n%s", m[0])
+		t.Fail()
+	}
+	if rcode := z.Update(dns.NewUpdate("example.org.", dns.ClassINET), "admin.key.", p); rcode != dns.RcodeNotAuth {
+		t.Log("Update of another zone should be NOTAUTH")
+		t.Fail()
+	}
+}
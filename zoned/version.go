@@ -0,0 +1,289 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zoned
+
+// Versions of a zone, for updates, IXFR (RFC 1995) and rollbacks.
+
+import (
+	"dns"
+	"errors"
+	"strings"
+	"time"
+)
+
+// A delta holds the changes between two versions of a zone.
+type delta struct {
+	from, to       *dns.RR_SOA
+	removed, added []dns.RR
+}
+
+// Serial returns the serial of the current version of the zone.
+func (z *Zone) Serial() uint32 {
+	return z.data().soa.Serial
+}
+
+// Versions returns the serials of the versions that are kept, oldest first.
+// The zone can be rolled back to each of these.
+func (z *Zone) Versions() []uint32 {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	s := make([]uint32, len(z.versions))
+	for i, d := range z.versions {
+		s[i] = d.soa.Serial
+	}
+	return s
+}
+
+// Apply creates a new version of the zone: the RRs in removed are deleted
+// and the RRs in added are added. RRs that are not in the zone are not
+// removed, RRs that already exist are not added again. When added holds a
+// SOA record for the apex it becomes the SOA of the new version, its serial
+// must be larger than the current one; otherwise the serial is increased
+// according to SerialScheme. The new version shares the unchanged names
+// with the old one. If an error is returned nothing has changed.
+func (z *Zone) Apply(removed, added []dns.RR) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.apply(z.data(), removed, added, nil, true)
+}
+
+// Rollback creates a new version of the zone with the contents of the
+// earlier version with the given serial. The new version gets a serial
+// that is larger than the current one, so secondaries pick up the change.
+func (z *Zone) Rollback(serial uint32) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var old *zoneData
+	for _, d := range z.versions {
+		if d.soa.Serial == serial {
+			old = d
+		}
+	}
+	if old == nil {
+		return errors.New("zoned: no version with that serial")
+	}
+	cur := z.data()
+	added, removed := dns.DiffRRsets(cur.rrs, old.rrs)
+	soa := copyRR(old.soa).(*dns.RR_SOA)
+	soa.Serial = dns.NextSerial(cur.soa.Serial, z.SerialScheme, time.Now())
+	return z.apply(cur, withoutSoa(removed), withoutSoa(added), soa, true)
+}
+
+// Ixfr returns the RRs for an IXFR reply to a secondary that has the
+// version with the given serial. When the changes since that version are
+// no longer known, false is returned and an AXFR should be sent instead.
+func (z *Zone) Ixfr(serial uint32) ([]dns.RR, bool) {
+	d := z.data()
+	if !dns.SerialLess(serial, d.soa.Serial) {
+		// Up to date
+		return []dns.RR{d.soa}, true
+	}
+	for i, c := range d.deltas {
+		if c.from.Serial != serial {
+			continue
+		}
+		rrs := []dns.RR{d.soa}
+		for _, c := range d.deltas[i:] {
+			rrs = append(rrs, c.from)
+			rrs = append(rrs, c.removed...)
+			rrs = append(rrs, c.to)
+			rrs = append(rrs, c.added...)
+		}
+		return append(rrs, d.soa), true
+	}
+	return nil, false
+}
+
+// TransferIncremental sends an IXFR reply to r to w. The serial of the
+// secondary is taken from the SOA record in the authority section of r.
+// When the changes since that serial are not known, the whole zone is sent
+// as with Transfer.
+func (z *Zone) TransferIncremental(w dns.ResponseWriter, r *dns.Msg) error {
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.RR_SOA); ok {
+			if rrs, ok := z.Ixfr(soa.Serial); ok {
+				e := dns.NewEnvelope(w, r, dns.MaxMsgSize-1)
+				if err := e.Add(rrs...); err != nil {
+					return err
+				}
+				return e.Flush()
+			}
+		}
+	}
+	return z.Transfer(w, r)
+}
+
+// apply creates and publishes a new version from d. When soa is not nil
+// it is used as the new SOA record. When journal is true and the zone has a
+// journal, the change is written to it first. z.mu must be held.
+func (z *Zone) apply(d *zoneData, removed, added []dns.RR, soa *dns.RR_SOA, journal bool) error {
+	if z.retired {
+		return errors.New("zoned: zone " + z.Origin + " has been reloaded")
+	}
+	n := &zoneData{origin: d.origin, soa: d.soa, names: make(map[string]*node, len(d.names)), below: make(map[string]int, len(d.below))}
+	for k, v := range d.names {
+		n.names[k] = v
+	}
+	for k, v := range d.below {
+		n.below[k] = v
+	}
+	cloned := make(map[string]bool)
+	// clone returns the node for name that may be changed.
+	clone := func(name string) *node {
+		old, ok := n.names[name]
+		if ok && cloned[name] {
+			return old
+		}
+		c := &node{rrs: make(map[uint16][]dns.RR), sigs: make(map[uint16][]dns.RR)}
+		if ok {
+			for t, v := range old.rrs {
+				c.rrs[t] = v
+			}
+			for t, v := range old.sigs {
+				c.sigs[t] = v
+			}
+		} else {
+			n.ancestors(name, 1)
+		}
+		n.names[name] = c
+		cloned[name] = true
+		return c
+	}
+
+	gone := make(map[dns.RR]bool) // the removed RRs, as found in d
+	var reallyRemoved, reallyAdded []dns.RR
+	for _, r := range removed {
+		name := strings.ToLower(r.Header().Name)
+		if r.Header().Rrtype == dns.TypeSOA {
+			continue
+		}
+		if _, ok := n.names[name]; !ok {
+			continue
+		}
+		nd := clone(name)
+		set, t := nd.set(r)
+		for i, x := range set[t] {
+			if dns.RRsEqual(x, r) {
+				// Never change the slice in place, it is shared
+				set[t] = append(set[t][:i:i], set[t][i+1:]...)
+				if len(set[t]) == 0 {
+					delete(set, t)
+				}
+				gone[x] = true
+				reallyRemoved = append(reallyRemoved, x)
+				break
+			}
+		}
+		if len(nd.rrs) == 0 && len(nd.sigs) == 0 {
+			delete(n.names, name)
+			n.ancestors(name, -1)
+		}
+	}
+	for _, r := range added {
+		name := strings.ToLower(r.Header().Name)
+		if !inZone(n.origin, name) {
+			return errors.New("zoned: " + r.Header().Name + " is not in zone " + n.origin)
+		}
+		if s, ok := r.(*dns.RR_SOA); ok {
+			if name != n.origin {
+				return errors.New("zoned: SOA record not at the apex of " + n.origin)
+			}
+			soa = s
+			continue
+		}
+		nd := clone(name)
+		set, t := nd.set(r)
+		dup := false
+		for _, x := range set[t] {
+			if dns.RRsEqual(x, r) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			set[t] = append(set[t][:len(set[t]):len(set[t])], r)
+			reallyAdded = append(reallyAdded, r)
+		}
+	}
+
+	if soa == nil {
+		soa = copyRR(d.soa).(*dns.RR_SOA)
+		soa.BumpSerial(z.SerialScheme, time.Now())
+	} else if !dns.SerialLess(d.soa.Serial, soa.Serial) {
+		return errors.New("zoned: serial of the new SOA record is not larger")
+	}
+	n.soa = soa
+	n.names[n.origin] = clone(n.origin)
+	n.names[n.origin].rrs[dns.TypeSOA] = []dns.RR{soa}
+
+	// The RRs in order, and the NSECs
+	n.rrs = make([]dns.RR, 0, len(d.rrs)+len(reallyAdded))
+	for _, r := range d.rrs {
+		if !gone[r] && r != dns.RR(d.soa) {
+			n.rrs = append(n.rrs, r)
+		}
+	}
+	n.rrs = append([]dns.RR{soa}, append(n.rrs, reallyAdded...)...)
+	for _, r := range n.rrs {
+		if nsec, ok := r.(*dns.RR_NSEC); ok {
+			n.nsecs = append(n.nsecs, nsec)
+		}
+	}
+
+	c := &delta{from: d.soa, to: soa, removed: reallyRemoved, added: reallyAdded}
+	if journal && z.Journal != nil {
+		if err := z.Journal.Append(c.from, c.to, c.removed, c.added); err != nil {
+			return err
+		}
+	}
+	n.deltas = z.deltas(d, c)
+	z.publish(n)
+	return nil
+}
+
+// set returns the map that holds the RRs of the type of r in n, and the
+// key for r: RRSIGs are kept by the type they cover.
+func (n *node) set(r dns.RR) (map[uint16][]dns.RR, uint16) {
+	if s, ok := r.(*dns.RR_RRSIG); ok {
+		return n.sigs, s.TypeCovered
+	}
+	return n.rrs, r.Header().Rrtype
+}
+
+// deltas returns the deltas for the version that follows d with change c.
+func (z *Zone) deltas(d *zoneData, c *delta) []*delta {
+	ds := d.deltas
+	if l := len(ds) - z.history() + 1; l > 0 {
+		ds = ds[l:]
+	}
+	return append(ds[:len(ds):len(ds)], c)
+}
+
+// publish makes d the current version. z.mu must be held.
+func (z *Zone) publish(d *zoneData) {
+	z.cur.Store(d)
+	z.versions = append(z.versions, d)
+	if l := len(z.versions) - z.history(); l > 0 {
+		z.versions = z.versions[l:]
+	}
+}
+
+func (z *Zone) history() int {
+	if z.History <= 0 {
+		return 10
+	}
+	return z.History
+}
+
+// withoutSoa returns rrs without the SOA records.
+func withoutSoa(rrs []dns.RR) []dns.RR {
+	var r []dns.RR
+	for _, x := range rrs {
+		if x.Header().Rrtype != dns.TypeSOA {
+			r = append(r, x)
+		}
+	}
+	return r
+}
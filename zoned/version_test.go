@@ -0,0 +1,159 @@
+package zoned
+
+import (
+	"dns"
+	"net"
+	"strings"
+	"testing"
+)
+
+func newRR(s string) dns.RR {
+	r, _ := dns.NewRR(s)
+	return r
+}
+
+func TestApply(t *testing.T) {
+	z, err := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err != nil {
+		t.Logf("Failed to read zone: %s", err)
+		t.Fail()
+		return
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+	v1 := z.data()
+	serial := z.Serial()
+	err = z.Apply([]dns.RR{newRR("a.miek.nl. IN A 127.0.0.1")},
+		[]dns.RR{newRR("a.miek.nl. IN A 127.0.0.10"), newRR("new.miek.nl. IN A 127.0.0.11")})
+	if err != nil {
+		t.Logf("Failed to apply: %s", err)
+		t.Fail()
+		return
+	}
+	if z.Serial() != serial+1 {
+		t.Logf("Serial should be incremented: %d", z.Serial())
+		t.Fail()
+	}
+	if m := query(z, udp, "a.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 || m[0].Answer[0].(*dns.RR_A).A.String() != "127.0.0.10" {
+		t.Logf("Update not served:\n%s", m[0])
+		t.Fail()
+	}
+	// The old version is not changed and shares the unchanged names
+	if len(v1.names["a.miek.nl."].rrs[dns.TypeA]) != 1 || v1.names["a.miek.nl."].rrs[dns.TypeA][0].(*dns.RR_A).A.String() != "127.0.0.1" {
+		t.Log("Old version was changed")
+		t.Fail()
+	}
+	if v1.names["www.miek.nl."] != z.data().names["www.miek.nl."] {
+		t.Log("Unchanged names should be shared")
+		t.Fail()
+	}
+
+	// IXFR from the first version
+	rrs, ok := z.Ixfr(serial)
+	if !ok || len(rrs) != 7 {
+		t.Logf("Wrong IXFR: %v", rrs)
+		t.Fail()
+	}
+	if _, ok := z.Ixfr(serial - 1); ok {
+		t.Log("IXFR from an unknown serial should not be possible")
+		t.Fail()
+	}
+	if rrs, ok := z.Ixfr(z.Serial()); !ok || len(rrs) != 1 {
+		t.Log("IXFR of an up to date secondary is only the SOA")
+		t.Fail()
+	}
+
+	// A failing update changes nothing
+	if err := z.Apply(nil, []dns.RR{newRR("a.example.org. IN A 127.0.0.1")}); err == nil {
+		t.Log("Update outside the zone should fail")
+		t.Fail()
+	}
+	if z.Serial() != serial+1 {
+		t.Log("Failed update should not change the zone")
+		t.Fail()
+	}
+
+	// Rollback
+	if err := z.Rollback(serial); err != nil {
+		t.Logf("Failed to roll back: %s", err)
+		t.Fail()
+	}
+	if z.Serial() != serial+2 {
+		t.Logf("Rollback should increment the serial: %d", z.Serial())
+		t.Fail()
+	}
+	if m := query(z, udp, "new.miek.nl.", dns.TypeA); m[0].Rcode != dns.RcodeNameError {
+		t.Log("Rollback should remove new.miek.nl.")
+		t.Fail()
+	}
+	if m := query(z, udp, "a.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 || m[0].Answer[0].(*dns.RR_A).A.String() != "127.0.0.1" {
+		t.Log("Rollback should restore a.miek.nl.")
+		t.Fail()
+	}
+	if len(z.data().rrs) != len(v1.rrs) {
+		t.Logf("Rollback should restore all RRs: %d != %d", len(z.data().rrs), len(v1.rrs))
+		t.Fail()
+	}
+
+	// Empty non-terminals come and go with the names below them
+	x := newRR("x.b.ent.miek.nl. IN A 127.0.0.12")
+	if err := z.Apply(nil, []dns.RR{x}); err != nil {
+		t.Logf("Failed to apply: %s", err)
+		t.Fail()
+		return
+	}
+	for _, name := range []string{"ent.miek.nl.", "b.ent.miek.nl."} {
+		if m := query(z, udp, name, dns.TypeA); m[0].Rcode != dns.RcodeSuccess {
+			t.Logf("%s should be an empty non-terminal:\n%s", name, m[0])
+			t.Fail()
+		}
+	}
+	if err := z.Apply([]dns.RR{x}, nil); err != nil {
+		t.Logf("Failed to apply: %s", err)
+		t.Fail()
+		return
+	}
+	if m := query(z, udp, "ent.miek.nl.", dns.TypeA); m[0].Rcode != dns.RcodeNameError {
+		t.Logf("ent.miek.nl. should be gone:\n%s", m[0])
+		t.Fail()
+	}
+	if len(z.data().below) != len(v1.below) {
+		t.Logf("Expected the empty non-terminals of the first version: %v", z.data().below)
+		t.Fail()
+	}
+}
+
+func TestServerIxfr(t *testing.T) {
+	z, err := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err != nil {
+		t.Logf("Failed to read zone: %s", err)
+		t.Fail()
+		return
+	}
+	serial := z.Serial()
+	z.Apply(nil, []dns.RR{newRR("new.miek.nl. IN A 127.0.0.11")})
+
+	s := &Server{XfrPeers: []string{"127.0.0.1"}}
+	s.peers, _ = parsePeers(s.XfrPeers)
+	s.mux = dns.NewServeMux()
+	s.mux.Handle(z.Origin, s.handler(z))
+
+	r := new(dns.Msg)
+	r.SetQuestion("miek.nl.", dns.TypeIXFR)
+	soa := copyRR(z.Soa()).(*dns.RR_SOA)
+	soa.Serial = serial
+	r.Ns = []dns.RR{soa}
+	w := &testWriter{addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}}
+	s.ServeDNS(w, r)
+	if len(w.msgs) != 1 || len(w.msgs[0].Answer) != 5 {
+		t.Logf("Wrong IXFR reply: %v", w.msgs)
+		t.Fail()
+	}
+	// Unknown serial gets an AXFR
+	soa.Serial = serial - 10
+	w = &testWriter{addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}}
+	s.ServeDNS(w, r)
+	if len(w.msgs) != 1 || len(w.msgs[0].Answer) != len(z.data().rrs)+1 {
+		t.Logf("Expected AXFR reply: %v", w.msgs)
+		t.Fail()
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2012 Miek Gieben. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zoned implements a small authoritative name server. It loads
+// zone files, answers queries for them (with DNSSEC records when the
+// zones are signed and the DO bit is set), sends zone transfers to
+// allowed peers and reloads the zones when asked to.
+//
+// Basic use pattern:
+//
+//	s := &zoned.Server{Zones: map[string]string{"miek.nl.": "/etc/zones/miek.nl.signed"}}
+//	if err := s.Load(); err != nil {
+//		// handle error
+//	}
+//	s.ReloadOnSignal(syscall.SIGHUP)
+//	go dns.ListenAndServe(":53", "tcp", s, 0)
+//	dns.ListenAndServe(":53", "udp", s, 0)
+package zoned
+
+import (
+	"dns"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Zone holds the data of a single zone. The data is versioned: each
+// reload or update creates a new version, that shares the unchanged
+// parts with the previous one, see Apply. Queries are answered from the
+// current version without locking.
+type Zone struct {
+	Origin       string   // the apex of the zone
+	History      int      // number of versions kept for IXFR and Rollback, 10 if zero
+	Journal      *Journal // if not nil, changes made with Apply and Rollback are written here
+	SerialScheme int      // how the serial is increased on changes, see dns.NextSerial
+
+	mu       sync.Mutex   // serializes the writers
+	cur      atomic.Value // the current *zoneData
+	versions []*zoneData  // the recent versions, oldest first
+	retired  bool         // replaced by Server.Load, changes are refused
+}
+
+// zoneData is a version of the content of a zone, it is not changed
+// after it is published.
+type zoneData struct {
+	origin string
+	soa    *dns.RR_SOA
+	rrs    []dns.RR // all RRs, in the order they were read
+	names  map[string]*node
+	below  map[string]int // the number of names below a name, for the empty non-terminals
+	nsecs  []*dns.RR_NSEC
+	deltas []*delta // the changes that lead to this version, oldest first
+}
+
+// A node holds the RRs of a single owner name, by type.
+type node struct {
+	rrs  map[uint16][]dns.RR
+	sigs map[uint16][]dns.RR // RRSIGs by type covered
+}
+
+// ReadZone reads the zone with apex origin from r, file is used in error
+// messages. All RRs must be in the zone and there must be a SOA record at
+// the apex. The owner names in r must be fully qualified.
+func ReadZone(r io.Reader, origin, file string) (*Zone, error) {
+	z := &Zone{Origin: strings.ToLower(dns.Fqdn(origin))}
+	if err := z.reload(r, file); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// LoadZone reads the zone with apex origin from the file name.
+func LoadZone(name, origin string) (*Zone, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadZone(f, origin, name)
+}
+
+// ReloadFrom reads the zone again from r. The new data is only used when
+// it is read without errors, until then and on error the old data is
+// served. Queries are answered during the reload.
+func (z *Zone) ReloadFrom(r io.Reader) error {
+	return z.reload(r, "")
+}
+
+func (z *Zone) reload(r io.Reader, file string) error {
+	d := &zoneData{origin: z.Origin, names: make(map[string]*node), below: make(map[string]int)}
+	var err error
+	// Always drain the channel, so the parser finishes
+	for t := range dns.ParseZone(r, z.Origin, file) {
+		if err != nil {
+			continue
+		}
+		if t.Error != nil {
+			err = t.Error
+			continue
+		}
+		err = d.insert(t.RR)
+	}
+	if err != nil {
+		return err
+	}
+	if d.soa == nil {
+		return errors.New("zoned: no SOA record at the apex of " + z.Origin)
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if old := z.data(); old != nil && dns.SerialLess(old.soa.Serial, d.soa.Serial) {
+		// Keep IXFR working over the reload
+		added, removed := dns.DiffRRsets(old.rrs, d.rrs)
+		d.deltas = z.deltas(old, &delta{from: old.soa, to: d.soa, removed: withoutSoa(removed), added: withoutSoa(added)})
+	}
+	z.publish(d)
+	return nil
+}
+
+// data returns the current version of the zone.
+func (z *Zone) data() *zoneData {
+	d, _ := z.cur.Load().(*zoneData)
+	return d
+}
+
+// Soa returns the SOA record of the zone.
+func (z *Zone) Soa() *dns.RR_SOA {
+	return z.data().soa
+}
+
+// RRs returns all the RRs of the current version of the zone, in the
+// order they were read. The RRs must not be changed.
+func (z *Zone) RRs() []dns.RR {
+	return z.data().rrs
+}
+
+func (z *zoneData) insert(rr dns.RR) error {
+	h := rr.Header()
+	name := strings.ToLower(h.Name)
+	if !inZone(z.origin, name) {
+		return errors.New("zoned: " + h.Name + " is not in zone " + z.origin)
+	}
+	n, ok := z.names[name]
+	if !ok {
+		n = &node{rrs: make(map[uint16][]dns.RR), sigs: make(map[uint16][]dns.RR)}
+		z.names[name] = n
+		z.ancestors(name, 1)
+	}
+	switch x := rr.(type) {
+	case *dns.RR_SOA:
+		if name == z.origin {
+			z.soa = x
+		}
+	case *dns.RR_RRSIG:
+		n.sigs[x.TypeCovered] = append(n.sigs[x.TypeCovered], rr)
+		z.rrs = append(z.rrs, rr)
+		return nil
+	case *dns.RR_NSEC:
+		z.nsecs = append(z.nsecs, x)
+	}
+	n.rrs[h.Rrtype] = append(n.rrs[h.Rrtype], rr)
+	z.rrs = append(z.rrs, rr)
+	return nil
+}
+
+// Signed returns true if the zone holds RRSIG records.
+func (z *Zone) Signed() bool {
+	d := z.data()
+	if n, ok := d.names[d.origin]; ok {
+		return len(n.sigs[dns.TypeSOA]) > 0
+	}
+	return false
+}
+
+// ServeDNS answers the query r with the data from the zone. Zone
+// transfers are refused, see Transfer.
+func (z *Zone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	if len(r.Question) == 0 {
+		m.SetRcodeFormatError(r)
+		write(w, r, m)
+		return
+	}
+	q := r.Question[0]
+	switch q.Qtype {
+	case dns.TypeAXFR, dns.TypeIXFR:
+		m.SetRcode(r, dns.RcodeRefused)
+		write(w, r, m)
+		return
+	}
+	m.SetReply(r)
+	z.Answer(m, q, dnssecOk(r))
+	write(w, r, m)
+}
+
+// Answer fills in the sections of m with the answer to q. When do is true
+// and the zone is signed, the RRSIG and NSEC records are added.
+func (z *Zone) Answer(m *dns.Msg, q dns.Question, do bool) {
+	z.data().answer(m, q, do)
+}
+
+func (z *zoneData) answer(m *dns.Msg, q dns.Question, do bool) {
+	m.Authoritative = true
+	name := strings.ToLower(q.Name)
+	if !inZone(z.origin, name) {
+		m.Rcode = dns.RcodeRefused
+		m.Authoritative = false
+		return
+	}
+	// Look for a delegation between the apex and the name
+	labels := dns.SplitLabels(name)
+	for i := len(labels) - len(dns.SplitLabels(z.origin)) - 1; i >= 0; i-- {
+		cut := strings.Join(labels[i:], ".") + "."
+		if n, ok := z.names[cut]; ok && n.rrs[dns.TypeNS] != nil {
+			if cut == name && q.Qtype == dns.TypeDS {
+				// The DS lives at the parent side of the cut
+				break
+			}
+			z.referral(m, n, do)
+			return
+		}
+	}
+
+	n, ok := z.names[name]
+	if !ok && z.nonTerminal(name) {
+		// An empty non-terminal exists, but has no RRs (RFC 8020)
+		z.addSoa(m, do)
+		if do {
+			z.addNsec(m, name, true)
+		}
+		return
+	}
+	if !ok {
+		// Wildcard
+		ce := z.closestEncloser(name)
+		if w, ok := z.names["*."+ce]; ok {
+			if z.answerNode(m, w, q, do, q.Name) {
+				// Prove that the name itself does not exist
+				if do {
+					z.addNsec(m, name, true)
+				}
+			}
+			return
+		}
+		m.Rcode = dns.RcodeNameError
+		z.addSoa(m, do)
+		if do {
+			z.addNsec(m, name, true)
+			z.addNsec(m, "*."+ce, true)
+		}
+		return
+	}
+	z.answerNode(m, n, q, do, "")
+}
+
+// answerNode answers q from the node n. If owner is not empty the RRs are
+// synthesized from a wildcard and get owner as their owner name. It returns
+// true when there is an answer.
+func (z *zoneData) answerNode(m *dns.Msg, n *node, q dns.Question, do bool, owner string) bool {
+	typ := q.Qtype
+	if _, ok := n.rrs[typ]; !ok && q.Qtype != dns.TypeCNAME {
+		if _, ok := n.rrs[dns.TypeCNAME]; ok {
+			typ = dns.TypeCNAME
+		}
+	}
+	var rrs []dns.RR
+	if q.Qtype == dns.TypeANY {
+		for t, set := range n.rrs {
+			rrs = append(rrs, set...)
+			if do {
+				rrs = append(rrs, n.sigs[t]...)
+			}
+		}
+	} else if set, ok := n.rrs[typ]; ok {
+		rrs = append(rrs, set...)
+		if do {
+			rrs = append(rrs, n.sigs[typ]...)
+		}
+	}
+	if len(rrs) == 0 {
+		// NODATA
+		z.addSoa(m, do)
+		if do {
+			name := q.Name
+			if owner != "" {
+				name = "*." + z.closestEncloser(strings.ToLower(q.Name))
+			}
+			z.addNsec(m, name, false)
+		}
+		return false
+	}
+	if owner != "" {
+		for i, r := range rrs {
+			rrs[i] = copyRR(r)
+			rrs[i].Header().Name = owner
+		}
+	}
+	m.Answer = append(m.Answer, rrs...)
+	return true
+}
+
+// referral adds the NS records of the delegation n to the authority
+// section, together with the glue and, if do is set, the DS records.
+func (z *zoneData) referral(m *dns.Msg, n *node, do bool) {
+	m.Authoritative = false
+	m.Ns = append(m.Ns, n.rrs[dns.TypeNS]...)
+	if do {
+		if ds, ok := n.rrs[dns.TypeDS]; ok {
+			m.Ns = append(m.Ns, ds...)
+			m.Ns = append(m.Ns, n.sigs[dns.TypeDS]...)
+		} else if nsec, ok := n.rrs[dns.TypeNSEC]; ok {
+			// Insecure delegation
+			m.Ns = append(m.Ns, nsec...)
+			m.Ns = append(m.Ns, n.sigs[dns.TypeNSEC]...)
+		}
+	}
+	for _, r := range n.rrs[dns.TypeNS] {
+		ns := strings.ToLower(r.(*dns.RR_NS).Ns)
+		if g, ok := z.names[ns]; ok {
+			m.Extra = append(m.Extra, g.rrs[dns.TypeA]...)
+			m.Extra = append(m.Extra, g.rrs[dns.TypeAAAA]...)
+		}
+	}
+}
+
+func (z *zoneData) addSoa(m *dns.Msg, do bool) {
+	m.Ns = append(m.Ns, dns.NegativeSoa(z.soa))
+	if do {
+		m.Ns = append(m.Ns, z.names[z.origin].sigs[dns.TypeSOA]...)
+	}
+}
+
+// addNsec adds the NSEC record that covers name (when cover is true) or
+// that has name as its owner to the authority section.
+func (z *zoneData) addNsec(m *dns.Msg, name string, cover bool) {
+	for _, nsec := range z.nsecs {
+		if (cover && nsec.Cover(name)) || (!cover && dns.CompareDomainName(nsec.Hdr.Name, name) == 0) {
+			for _, r := range m.Ns {
+				if r == dns.RR(nsec) {
+					return
+				}
+			}
+			m.Ns = append(m.Ns, nsec)
+			m.Ns = append(m.Ns, z.names[strings.ToLower(nsec.Hdr.Name)].sigs[dns.TypeNSEC]...)
+			return
+		}
+	}
+}
+
+// closestEncloser returns the longest existing name in the zone that is
+// an ancestor of name.
+func (z *zoneData) closestEncloser(name string) string {
+	labels := dns.SplitLabels(name)
+	for i := 1; i < len(labels); i++ {
+		ce := strings.Join(labels[i:], ".") + "."
+		if _, ok := z.names[ce]; ok {
+			return ce
+		}
+		// Empty non-terminals exist too
+		if z.nonTerminal(ce) {
+			return ce
+		}
+	}
+	return z.origin
+}
+
+// nonTerminal returns true when there are names in the zone below name.
+func (z *zoneData) nonTerminal(name string) bool {
+	return z.below[name] > 0
+}
+
+// ancestors adds i to the number of names below each ancestor of name in
+// the zone, the apex included. It is called when name is added to or
+// removed from z.names.
+func (z *zoneData) ancestors(name string, i int) {
+	for name != z.origin {
+		j := strings.Index(name, ".")
+		if j < 0 || j == len(name)-1 {
+			return
+		}
+		name = name[j+1:]
+		if z.below[name] += i; z.below[name] == 0 {
+			delete(z.below, name)
+		}
+	}
+}
+
+// Transfer sends the zone to w as an AXFR reply to r.
+func (z *Zone) Transfer(w dns.ResponseWriter, r *dns.Msg) error {
+	return z.data().transfer(w, r)
+}
+
+func (z *zoneData) transfer(w dns.ResponseWriter, r *dns.Msg) error {
+	e := dns.NewEnvelope(w, r, dns.MaxMsgSize-1)
+	if err := e.Add(z.soa); err != nil {
+		return err
+	}
+	for _, rr := range z.rrs {
+		if rr == dns.RR(z.soa) {
+			continue
+		}
+		if err := e.Add(rr); err != nil {
+			return err
+		}
+	}
+	if err := e.Add(z.soa); err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// inZone returns true if name is equal to or below origin. Both must be in
+// lower case and fully qualified.
+func inZone(origin, name string) bool {
+	return origin == "." || name == origin || strings.HasSuffix(name, "."+origin)
+}
+
+// dnssecOk returns true if the DO bit is set in r.
+func dnssecOk(r *dns.Msg) bool {
+	for _, e := range r.Extra {
+		if o, ok := e.(*dns.RR_OPT); ok {
+			return o.Do()
+		}
+	}
+	return false
+}
+
+// copyRR returns a shallow copy of r.
+func copyRR(r dns.RR) dns.RR {
+	v := reflect.ValueOf(r).Elem()
+	c := reflect.New(v.Type())
+	c.Elem().Set(v)
+	return c.Interface().(dns.RR)
+}
+
+// write writes m to w. When the request came in over UDP and the reply is
+// larger than the client can handle, the reply is truncated.
+func write(w dns.ResponseWriter, r, m *dns.Msg) {
+	size := 512
+	var opt *dns.RR_OPT
+	for _, e := range r.Extra {
+		if o, ok := e.(*dns.RR_OPT); ok {
+			opt = o
+			if int(o.UDPSize()) > size {
+				size = int(o.UDPSize())
+			}
+			m.SetEdns0(dns.DefaultMsgSize, o.Do())
+		}
+	}
+	m.Compress = true
+	buf, err := m.Pack()
+	if err != nil {
+		return
+	}
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); !ok && len(buf) > size {
+		m.Truncated = true
+		m.Answer, m.Ns, m.Extra = nil, nil, nil
+		if opt != nil {
+			m.SetEdns0(dns.DefaultMsgSize, opt.Do())
+		}
+		if buf, err = m.Pack(); err != nil {
+			return
+		}
+	}
+	w.Write(buf)
+}
@@ -0,0 +1,187 @@
+package zoned
+
+import (
+	"dns"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testZone = `miek.nl. 3600 IN SOA linode.atoom.net. miek.miek.nl. 1282630057 14400 3600 604800 14400
+miek.nl. 3600 IN NS linode.atoom.net.
+miek.nl. 3600 IN MX 10 mail.miek.nl.
+a.miek.nl. 3600 IN A 127.0.0.1
+www.miek.nl. 3600 IN CNAME a.miek.nl.
+*.wild.miek.nl. 3600 IN TXT "wildcard"
+sub.miek.nl. 3600 IN NS ns.sub.miek.nl.
+ns.sub.miek.nl. 3600 IN A 127.0.0.2
+`
+
+type testWriter struct {
+	addr net.Addr
+	msgs []*dns.Msg
+}
+
+func (w *testWriter) RemoteAddr() net.Addr { return w.addr }
+
+func (w *testWriter) Write(buf []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(buf); err != nil {
+		return 0, err
+	}
+	w.msgs = append(w.msgs, m)
+	return len(buf), nil
+}
+
+func query(h dns.Handler, addr net.Addr, name string, t uint16) []*dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(name, t)
+	w := &testWriter{addr: addr}
+	h.ServeDNS(w, r)
+	return w.msgs
+}
+
+func TestZone(t *testing.T) {
+	z, err := ReadZone(strings.NewReader(testZone), "miek.nl", "")
+	if err != nil {
+		t.Logf("Failed to read zone: %s", err)
+		t.Fail()
+		return
+	}
+	if rrs := z.RRs(); len(rrs) != 8 || rrs[0] != dns.RR(z.Soa()) {
+		t.Logf("Expected the 8 RRs of the zone, starting with the SOA, got %v", rrs)
+		t.Fail()
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+	tests := []struct {
+		name   string
+		qtype  uint16
+		rcode  int
+		answer int
+		ns     int
+		extra  int
+	}{
+		{"a.miek.nl.", dns.TypeA, dns.RcodeSuccess, 1, 0, 0},
+		{"A.MIEK.NL.", dns.TypeA, dns.RcodeSuccess, 1, 0, 0},
+		{"a.miek.nl.", dns.TypeMX, dns.RcodeSuccess, 0, 1, 0},  // NODATA
+		{"www.miek.nl.", dns.TypeA, dns.RcodeSuccess, 1, 0, 0}, // CNAME
+		{"x.wild.miek.nl.", dns.TypeTXT, dns.RcodeSuccess, 1, 0, 0},
+		{"b.miek.nl.", dns.TypeA, dns.RcodeNameError, 0, 1, 0},
+		{"wild.miek.nl.", dns.TypeA, dns.RcodeSuccess, 0, 1, 0},    // empty non-terminal
+		{"www.sub.miek.nl.", dns.TypeA, dns.RcodeSuccess, 0, 1, 1}, // referral with glue
+		{"example.org.", dns.TypeA, dns.RcodeRefused, 0, 0, 0},
+	}
+	for _, tc := range tests {
+		msgs := query(z, udp, tc.name, tc.qtype)
+		if len(msgs) != 1 {
+			t.Logf("%s: expected one reply, got %d", tc.name, len(msgs))
+			t.Fail()
+			continue
+		}
+		m := msgs[0]
+		if m.Rcode != tc.rcode || len(m.Answer) != tc.answer || len(m.Ns) != tc.ns || len(m.Extra) != tc.extra {
+			t.Logf("%s: unexpected reply\n%s", tc.name, m)
+			t.Fail()
+		}
+	}
+	m := query(z, udp, "x.wild.miek.nl.", dns.TypeTXT)[0]
+	if m.Answer[0].Header().Name != "x.wild.miek.nl." {
+		t.Logf("Wildcard answer should have the query name: %s", m.Answer[0])
+		t.Fail()
+	}
+}
+
+func TestServerTransfer(t *testing.T) {
+	z, err := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err != nil {
+		t.Logf("Failed to read zone: %s", err)
+		t.Fail()
+		return
+	}
+	s := new(Server)
+	s.XfrPeers = []string{"127.0.0.1", "10.0.0.0/8"}
+	if s.peers, err = parsePeers(s.XfrPeers); err != nil {
+		t.Logf("Failed to parse peers: %s", err)
+		t.Fail()
+		return
+	}
+	s.mux = dns.NewServeMux()
+	s.mux.Handle(z.Origin, s.handler(z))
+
+	for _, a := range []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53},
+		&net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 53},
+	} {
+		msgs := query(s, a, "miek.nl.", dns.TypeAXFR)
+		n := 0
+		for _, m := range msgs {
+			n += len(m.Answer)
+		}
+		if n != len(z.data().rrs)+1 {
+			t.Logf("Transfer to %s should contain %d RRs, got %d", a, len(z.data().rrs)+1, n)
+			t.Fail()
+		}
+	}
+	for _, a := range []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53},
+		&net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53},
+	} {
+		msgs := query(s, a, "miek.nl.", dns.TypeAXFR)
+		if len(msgs) != 1 || msgs[0].Rcode != dns.RcodeRefused {
+			t.Logf("Transfer to %s should be refused", a)
+			t.Fail()
+		}
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+	if m := query(s, udp, "org.", dns.TypeA); len(m) != 1 || m[0].Rcode != dns.RcodeRefused {
+		t.Log("Query outside of the zones should be refused")
+		t.Fail()
+	}
+}
+
+func TestReloadFrom(t *testing.T) {
+	z, err := ReadZone(strings.NewReader(testZone), "miek.nl.", "")
+	if err != nil {
+		t.Logf("Failed to read zone: %s", err)
+		t.Fail()
+		return
+	}
+	udp := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+	done := make(chan bool)
+	go func() {
+		// Keep on querying during the reloads
+		for i := 0; i < 100; i++ {
+			if m := query(z, udp, "a.miek.nl.", dns.TypeA); len(m) != 1 || len(m[0].Answer) != 1 {
+				t.Log("Query during reload failed")
+				t.Fail()
+			}
+		}
+		done <- true
+	}()
+	// A broken zone is not used
+	if err := z.ReloadFrom(strings.NewReader(testZone + "b.miek.nl. IN A 300.0.0.1\n")); err == nil {
+		t.Log("Reload of a broken zone should fail")
+		t.Fail()
+	}
+	if m := query(z, udp, "a.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 {
+		t.Log("Old zone should still be served")
+		t.Fail()
+	}
+	if err := z.ReloadFrom(strings.NewReader(strings.Replace(testZone, "1282630057", "1282630058", 1) + "b.miek.nl. IN A 127.0.0.3\n")); err != nil {
+		t.Logf("Failed to reload: %s", err)
+		t.Fail()
+	}
+	<-done
+	if z.Soa().Serial != 1282630058 {
+		t.Log("New zone should be served")
+		t.Fail()
+	}
+	if rrs, ok := z.Ixfr(1282630057); !ok || len(rrs) != 5 {
+		t.Logf("IXFR over a reload should be possible: %v", rrs)
+		t.Fail()
+	}
+	if m := query(z, udp, "b.miek.nl.", dns.TypeA); len(m[0].Answer) != 1 {
+		t.Log("New name should be served")
+		t.Fail()
+	}
+}
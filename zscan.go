@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"text/scanner"
 )
 
@@ -54,13 +55,42 @@ const (
 )
 
 // ParseError contains the parse error and the location in the io.Reader
-// where the error occured.
+// where the error occured. Use the accessor methods to get at the
+// specifics of the error.
 type ParseError struct {
-	file string
-	err  string
-	lex  lex
+	file  string
+	err   string
+	lex   lex
+	cause error // underlying error, if any
 }
 
+// File returns the name of the file in which the error occured.
+func (e *ParseError) File() string { return e.file }
+
+// Line returns the line number of the offending token.
+func (e *ParseError) Line() int { return e.lex.line }
+
+// Column returns the column of the offending token.
+func (e *ParseError) Column() int { return e.lex.column }
+
+// RecordLine returns the line where the RR with the offending token
+// starts. This differs from Line for RRs that span lines with braces.
+func (e *ParseError) RecordLine() int { return e.lex.rrline }
+
+// RecordColumn returns the column where the RR with the offending token
+// starts.
+func (e *ParseError) RecordColumn() int { return e.lex.rrcol }
+
+// Token returns the text of the offending token.
+func (e *ParseError) Token() string { return e.lex.token }
+
+// Reason returns the description of the error without the location.
+func (e *ParseError) Reason() string { return e.err }
+
+// Unwrap returns the underlying error that caused the parse error, for
+// instance a *strconv.NumError. It returns nil if there is none.
+func (e *ParseError) Unwrap() error { return e.cause }
+
 func (e *ParseError) Error() (s string) {
 	//	va := strconv.Itoa(e.lex.value)
 	if e.file != "" {
@@ -68,6 +98,9 @@ func (e *ParseError) Error() (s string) {
 	}
 	s += e.err + ": `" + e.lex.token + "' at line: " +
 		strconv.Itoa(e.lex.line) + ":" + strconv.Itoa(e.lex.column)
+	if e.lex.rrline != 0 && e.lex.rrline != e.lex.line {
+		s += " (RR at line: " + strconv.Itoa(e.lex.rrline) + ":" + strconv.Itoa(e.lex.rrcol) + ")"
+	}
 	return
 }
 
@@ -77,11 +110,15 @@ type lex struct {
 	value  int    // Value: _STRING, _BLANK, etc.
 	line   int    // Line in the file
 	column int    // Column in the fil
+	rrline int    // Line where the RR of this token starts
+	rrcol  int    // Column where the RR of this token starts
+	cause  error  // underlying error of err, if any
 }
 
 type Token struct {
-	RR                // the scanned resource record
-	Error *ParseError // when an error occured, this is the specifics
+	RR                     // the scanned resource record
+	Error      *ParseError // when an error occured, this is the specifics
+	DefaultTtl uint32      // the TTL used for RRs without one, when RR was scanned
 }
 
 // NewRR reads the RR contained in the string s. Only the first RR is returned.
@@ -98,7 +135,7 @@ func NewRR(s string) (RR, error) {
 // ReadRR reads the RR contained in q. Only the first RR is returned.
 // The class defaults to IN and TTL defaults to DefaultTtl
 func ReadRR(q io.Reader, filename string) (RR, error) {
-        r := <-ParseZone(q, filename)
+        r := <-ParseZone(q, ".", filename)
         if r.Error != nil {
                 return nil, r.Error
         }
@@ -107,13 +144,114 @@ func ReadRR(q io.Reader, filename string) (RR, error) {
 
 // ParseZone reads a RFC 1035 zone from r. It returns each parsed RR or on error
 // on the returned channel. The channel t is closed by ParseZone when the end of r is reached.
-func ParseZone(r io.Reader, file string) chan Token {
+// Relative names are qualified with origin until a $ORIGIN directive is seen,
+// like named does with the zone name. An empty origin is the root.
+func ParseZone(r io.Reader, origin, file string) chan Token {
+	return ParseZoneLimits(r, origin, file, ZoneLimits{})
+}
+
+// ZoneLimits limits the resources ParseZoneLimits may use, for reading zones
+// from untrusted sources. A zero value means no limit, except for the
+// include depth which defaults to 7.
+type ZoneLimits struct {
+	MaxRecords      int   // number of RRs
+	MaxLineLength   int   // length of a line, in characters
+	MaxIncludeDepth int   // nesting of $INCLUDE directives
+	MaxBytes        int64 // number of bytes read, $INCLUDEd files included
+}
+
+// A LimitError is the cause of the ParseError returned when a zone exceeds
+// one of its ZoneLimits.
+type LimitError struct {
+	Limit string // "records", "line length", "include depth" or "bytes"
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return "zone exceeds " + e.Limit + " limit of " + strconv.FormatInt(e.Max, 10)
+}
+
+// zoneLimits is the state of the limits, it is shared by a zone and its
+// $INCLUDEd files.
+type zoneLimits struct {
+	ZoneLimits
+	records int
+	bytes   int64 // read so far, updated atomically
+	big     int32 // set atomically when there is more than MaxBytes
+	over    bool  // a limit error has been returned
+}
+
+func (z *zoneLimits) maxInclude() int {
+	if z.MaxIncludeDepth <= 0 {
+		return 7
+	}
+	return z.MaxIncludeDepth
+}
+
+// limitReader counts the bytes read and stops at MaxBytes. It also holds
+// the error of the lexer reading from it, as the parser does not see
+// every token itself.
+type limitReader struct {
+	r   io.Reader
+	lim *zoneLimits
+	err atomic.Value // lex
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.lim.MaxBytes <= 0 {
+		return l.r.Read(p)
+	}
+	left := l.lim.MaxBytes - atomic.LoadInt64(&l.lim.bytes)
+	if left <= 0 {
+		// See if there is more
+		var b [1]byte
+		if n, _ := l.r.Read(b[:]); n > 0 {
+			atomic.StoreInt32(&l.lim.big, 1)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := l.r.Read(p)
+	atomic.AddInt64(&l.lim.bytes, int64(n))
+	return n, err
+}
+
+func (l *limitReader) exceeded() bool {
+	return atomic.LoadInt32(&l.lim.big) == 1
+}
+
+// lexErr returns the error the lexer gave up with, if any.
+func (l *limitReader) lexErr() (lex, bool) {
+	e, ok := l.err.Load().(lex)
+	return e, ok
+}
+
+// ParseZoneLimits is like ParseZone, but stops with an error when the zone
+// exceeds one of the limits in lim. The cause of that error is a
+// *LimitError.
+func ParseZoneLimits(r io.Reader, origin, file string, lim ZoneLimits) chan Token {
+	if origin == "" {
+		origin = "."
+	}
 	t := make(chan Token)
-	go parseZone(r, file, t, 0)
+	if origin = Fqdn(origin); origin != "." {
+		// Relative names are qualified by appending origin
+		origin = "." + origin
+	}
+	go parseZone(r, origin, file, t, 0, &zoneLimits{ZoneLimits: lim})
 	return t
 }
 
-func parseZone(r io.Reader, f string, t chan Token, include int) {
+// ParseZoneFile reads a zone from r with the root as the origin.
+//
+// Deprecated: use ParseZone with an origin.
+func ParseZoneFile(r io.Reader, file string) chan Token {
+	return ParseZone(r, ".", file)
+}
+
+func parseZone(r io.Reader, origin, f string, t chan Token, include int, lim *zoneLimits) {
 	defer func() {
 		if include == 0 {
 			close(t)
@@ -121,11 +259,12 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 	}()
 	var s scanner.Scanner
 	c := make(chan lex)
-	s.Init(r)
+	lr := &limitReader{r: r, lim: lim}
+	s.Init(lr)
 	s.Mode = 0
 	s.Whitespace = 0
 	// Start the lexer
-	go zlexer(s, c)
+	go zlexer(s, c, lr)
 	// 5 possible beginnings of a line, _ is a space
 	// 1. _OWNER _ _RRTYPE                     -> class/ttl omitted
 	// 2. _OWNER _ _STRING _ _RRTYPE           -> class omitted
@@ -137,17 +276,17 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 	st := _EXPECT_OWNER_DIR
 	var h RR_Header
 	var ok bool
+	// Without $TTL the last stated TTL is the default (RFC 2308, section 4)
 	var defttl uint32 = DefaultTtl
-	var origin string = "."
+	var dirttl bool // seen $TTL
 	for l := range c {
 		if _DEBUG {
 			fmt.Printf("[%v]\n", l)
 		}
 		// Lexer spotted an error already
 		if l.err != "" {
-			t <- Token{Error: &ParseError{f, l.err, l}}
+			lexError(l, f, t, lim)
 			return
-
 		}
 		switch st {
 		case _EXPECT_OWNER_DIR:
@@ -159,13 +298,11 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 				st = _EXPECT_OWNER_DIR
 			case _OWNER:
 				h.Name = l.token
-				if _, ok := IsDomainName(l.token); !ok {
-					t <- Token{Error: &ParseError{f, "bad owner name", l}}
+				if !isZoneName(l.token) {
+					t <- Token{Error: &ParseError{f, "bad owner name", l, nil}}
 					return
 				}
-				if !IsFqdn(h.Name) {
-					h.Name += origin
-				}
+				h.Name = appendOrigin(h.Name, origin)
 				st = _EXPECT_OWNER_BL
 			case _DIRTTL:
 				st = _EXPECT_DIRTTL_BL
@@ -174,80 +311,90 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 			case _DIRINCLUDE:
 				st = _EXPECT_DIRINCLUDE_BL
 			default:
-				t <- Token{Error: &ParseError{f, "Error at the start", l}}
+				t <- Token{Error: &ParseError{f, "Error at the start", l, nil}}
 				return
 			}
 		case _EXPECT_DIRINCLUDE_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank after $INCLUDE-directive", l}}
+				t <- Token{Error: &ParseError{f, "No blank after $INCLUDE-directive", l, nil}}
 				return
 			}
 			st = _EXPECT_DIRINCLUDE
 		case _EXPECT_DIRINCLUDE:
 			if l.value != _STRING {
-				t <- Token{Error: &ParseError{f, "Expecting $INCLUDE value, not this...", l}}
+				t <- Token{Error: &ParseError{f, "Expecting $INCLUDE value, not this...", l, nil}}
 				return
 			}
 			// Start with the new file
 			r1, e1 := os.Open(l.token)
 			if e1 != nil {
-				t <- Token{Error: &ParseError{f, "Failed to open `" + l.token + "'", l}}
+				t <- Token{Error: &ParseError{f, "Failed to open `" + l.token + "'", l, nil}}
+				return
+			}
+			if include+1 > lim.maxInclude() {
+				r1.Close()
+				lim.over = true
+				t <- Token{Error: &ParseError{f, "Too deeply nested $INCLUDE", l, &LimitError{"include depth", int64(lim.maxInclude())}}}
+				return
+			}
+			parseZone(r1, origin, l.token, t, include+1, lim)
+			r1.Close()
+			if lim.over {
 				return
 			}
-                        if include + 1 > 7 {
-		                t <- Token{Error: &ParseError{f, "Too deeply nested $INCLUDE", l}}
-                                return
-                        }
-			parseZone(r1, l.token, t, include+1)
 			st = _EXPECT_OWNER_DIR
 		case _EXPECT_DIRTTL_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank after $TTL-directive", l}}
+				t <- Token{Error: &ParseError{f, "No blank after $TTL-directive", l, nil}}
 				return
 			}
 			st = _EXPECT_DIRTTL
 		case _EXPECT_DIRTTL:
 			if l.value != _STRING {
-				t <- Token{Error: &ParseError{f, "Expecting $TTL value, not this...", l}}
+				t <- Token{Error: &ParseError{f, "Expecting $TTL value, not this...", l, nil}}
 				return
 			}
 			if ttl, ok := stringToTtl(l, f, t); !ok {
 				return
 			} else {
 				defttl = ttl
+				dirttl = true
 			}
 			st = _EXPECT_OWNER_DIR
 		case _EXPECT_DIRORIGIN_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank after $ORIGIN-directive", l}}
+				t <- Token{Error: &ParseError{f, "No blank after $ORIGIN-directive", l, nil}}
 				return
 			}
 			st = _EXPECT_DIRORIGIN
 		case _EXPECT_DIRORIGIN:
 			if l.value != _STRING {
-				t <- Token{Error: &ParseError{f, "Expecting $ORIGIN value, not this...", l}}
+				t <- Token{Error: &ParseError{f, "Expecting $ORIGIN value, not this...", l, nil}}
 				return
 			}
 			if !IsFqdn(l.token) {
-				origin = l.token + origin // Append old origin if the new one isn't a fqdn
+				origin = "." + l.token + origin // Append old origin if the new one isn't a fqdn
+			} else if l.token == "." {
+				origin = "."
 			} else {
-				origin = l.token
+				origin = "." + l.token
 			}
+			st = _EXPECT_OWNER_DIR
 		case _EXPECT_OWNER_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank after owner", l}}
+				t <- Token{Error: &ParseError{f, "No blank after owner", l, nil}}
 				return
 			}
 			st = _EXPECT_ANY
 		case _EXPECT_ANY:
 			switch l.value {
 			case _RRTYPE:
-				h.Rrtype, _ = Str_rr[strings.ToUpper(l.token)]
+				h.Rrtype, _ = StringToType(l.token)
 				st = _EXPECT_RDATA
 			case _CLASS:
-				h.Class, ok = Str_class[strings.ToUpper(l.token)]
+				h.Class, ok = StringToClass(l.token)
 				if !ok {
-					t <- Token{Error: &ParseError{f, "Unknown class", l}}
+					t <- Token{Error: &ParseError{f, "Unknown class", l, nil}}
 					return
 				}
 				st = _EXPECT_ANY_NOCLASS_BL
@@ -256,35 +403,38 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 					return
 				} else {
 					h.Ttl = ttl
+					if !dirttl {
+						defttl = ttl
+					}
 				}
 				st = _EXPECT_ANY_NOTTL_BL
 			default:
-				t <- Token{Error: &ParseError{f, "Expecting RR type, TTL or class, not this...", l}}
+				t <- Token{Error: &ParseError{f, "Expecting RR type, TTL or class, not this...", l, nil}}
 				return
 			}
 		case _EXPECT_ANY_NOCLASS_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank before NOCLASS", l}}
+				t <- Token{Error: &ParseError{f, "No blank before NOCLASS", l, nil}}
 				return
 			}
 			st = _EXPECT_ANY_NOCLASS
 		case _EXPECT_ANY_NOTTL_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank before NOTTL", l}}
+				t <- Token{Error: &ParseError{f, "No blank before NOTTL", l, nil}}
 				return
 			}
 			st = _EXPECT_ANY_NOTTL
 		case _EXPECT_ANY_NOTTL:
 			switch l.value {
 			case _CLASS:
-				h.Class, ok = Str_class[strings.ToUpper(l.token)]
+				h.Class, ok = StringToClass(l.token)
 				if !ok {
-					t <- Token{Error: &ParseError{f, "Unknown class", l}}
+					t <- Token{Error: &ParseError{f, "Unknown class", l, nil}}
 					return
 				}
 				st = _EXPECT_RRTYPE_BL
 			case _RRTYPE:
-				h.Rrtype, _ = Str_rr[strings.ToUpper(l.token)]
+				h.Rrtype, _ = StringToType(l.token)
 				st = _EXPECT_RDATA
 			}
 		case _EXPECT_ANY_NOCLASS:
@@ -294,31 +444,39 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 					return
 				} else {
 					h.Ttl = ttl
+					if !dirttl {
+						defttl = ttl
+					}
 				}
 				st = _EXPECT_RRTYPE_BL
 			case _RRTYPE:
-				h.Rrtype, _ = Str_rr[strings.ToUpper(l.token)]
+				h.Rrtype, _ = StringToType(l.token)
 				st = _EXPECT_RDATA
 			default:
-				t <- Token{Error: &ParseError{f, "Expecting RR type or TTL, not this...", l}}
+				t <- Token{Error: &ParseError{f, "Expecting RR type or TTL, not this...", l, nil}}
 				return
 			}
 		case _EXPECT_RRTYPE_BL:
 			if l.value != _BLANK {
-				t <- Token{Error: &ParseError{f, "No blank after", l}}
+				t <- Token{Error: &ParseError{f, "No blank after", l, nil}}
 				return
 			}
 			st = _EXPECT_RRTYPE
 		case _EXPECT_RRTYPE:
 			if l.value != _RRTYPE {
-				t <- Token{Error: &ParseError{f, "Unknown RR type", l}}
+				t <- Token{Error: &ParseError{f, "Unknown RR type", l, nil}}
 				return
 			}
-			h.Rrtype, _ = Str_rr[strings.ToUpper(l.token)]
+			h.Rrtype, _ = StringToType(l.token)
 			st = _EXPECT_RDATA
 		case _EXPECT_RDATA:
 			// I could save my token here...? l
 			r, e := setRR(h, c, origin, f)
+			if l, ok := lr.lexErr(); ok {
+				// The rdata was cut short
+				lexError(l, f, t, lim)
+				return
+			}
 			if e != nil {
 				// If e.lex is nil than we have encounter a unknown RR type
 				// in that case we substitute our current lex token
@@ -328,12 +486,49 @@ func parseZone(r io.Reader, f string, t chan Token, include int) {
 				t <- Token{Error: e}
 				return
 			}
-			t <- Token{RR: r}
+			if lim.records++; lim.MaxRecords > 0 && lim.records > lim.MaxRecords {
+				lim.over = true
+				t <- Token{Error: &ParseError{f, "Too many RRs", l, &LimitError{"records", int64(lim.MaxRecords)}}}
+				return
+			}
+			t <- Token{RR: r, DefaultTtl: defttl}
 			st = _EXPECT_OWNER_DIR
 		}
 	}
 }
 
+// isZoneName checks if s is a domain name, or "@".
+func isZoneName(s string) bool {
+	if s == "@" {
+		return true
+	}
+	_, ok := IsDomainName(s)
+	return ok
+}
+
+// appendOrigin qualifies the relative name s with origin, "@" is origin
+// itself. The origin starts with a dot, unless it is the root.
+func appendOrigin(s, origin string) string {
+	if s == "@" {
+		if origin == "." {
+			return origin
+		}
+		return origin[1:]
+	}
+	if IsFqdn(s) {
+		return s
+	}
+	return s + origin
+}
+
+// lexError returns the error the lexer gave up with on t.
+func lexError(l lex, f string, t chan Token, lim *zoneLimits) {
+	if _, ok := l.cause.(*LimitError); ok {
+		lim.over = true
+	}
+	t <- Token{Error: &ParseError{f, l.err, l, l.cause}}
+}
+
 func (l lex) String() string {
 	switch l.value {
 	case _STRING:
@@ -355,28 +550,45 @@ func (l lex) String() string {
 }
 
 // zlexer scans the sourcefile and returns tokens on the channel c.
-func zlexer(s scanner.Scanner, c chan lex) {
+func zlexer(s scanner.Scanner, c chan lex, lr *limitReader) {
 	var l lex
 	str := "" // Hold the current read text
 	quote := false
+	quoted := false // str is quoted text, it is sent even when empty
 	escape := false
 	space := false
 	commt := false
 	rrtype := false
 	owner := true
 	brace := 0
+	start := true // the next text starts a new RR
 	tok := s.Scan()
 	defer close(c)
 	for tok != scanner.EOF {
 		l.column = s.Position.Column
 		l.line = s.Position.Line
+		if start {
+			l.rrline, l.rrcol = l.line, l.column
+		}
+		if max := lr.lim.MaxLineLength; max > 0 && l.column > max && tok != '\n' {
+			l.err = "Line too long"
+			l.cause = &LimitError{"line length", int64(max)}
+			lr.err.Store(l)
+			c <- l
+			return
+		}
 		switch x := s.TokenText(); x {
 		case " ", "\t":
 			escape = false
 			if commt {
 				break
 			}
-			if str == "" {
+			if quote {
+				// Inside quoted text a blank is part of the string
+				str += x
+				break
+			}
+			if str == "" && !quoted {
 				//l.value = _BLANK
 				//l.token = " "
 			} else if owner {
@@ -398,17 +610,21 @@ func zlexer(s scanner.Scanner, c chan lex) {
 				l.token = str
 
 				if !rrtype {
-					if _, ok := Str_rr[strings.ToUpper(l.token)]; ok {
+					if _, ok := StringToType(l.token); ok {
 						l.value = _RRTYPE
 						rrtype = true
 					}
-					if _, ok := Str_class[strings.ToUpper(l.token)]; ok {
+					// ANY is a class as well as a type, the type
+					// may still follow
+					if _, ok := StringToClass(l.token); ok {
 						l.value = _CLASS
+						rrtype = false
 					}
 				}
 				c <- l
 			}
 			str = ""
+			quoted = false
 			if !space && !commt {
 				l.value = _BLANK
 				l.token = " "
@@ -436,20 +652,22 @@ func zlexer(s scanner.Scanner, c chan lex) {
 				commt = false
 				rrtype = false
 				str = ""
+				quoted = false
 				// If not in a brace this ends the comment AND the RR
 				if brace == 0 {
 					owner = true
+					start = true
 					l.value = _NEWLINE
 					l.token = "\n"
 					c <- l
 				}
 				break
 			}
-			if str != "" {
+			if str != "" || quoted {
 				l.value = _STRING
 				l.token = str
 				if !rrtype {
-					if _, ok := Str_rr[strings.ToUpper(l.token)]; ok {
+					if _, ok := StringToType(l.token); ok {
 						l.value = _RRTYPE
 						rrtype = true
 					}
@@ -463,6 +681,7 @@ func zlexer(s scanner.Scanner, c chan lex) {
 					c <- l
 				}
 			} else {
+				start = true
 				l.value = _NEWLINE
 				l.token = "\n"
 				c <- l
@@ -472,6 +691,7 @@ func zlexer(s scanner.Scanner, c chan lex) {
 			}
 
 			str = ""
+			quoted = false
 			commt = false
 			rrtype = false
 			owner = true
@@ -497,6 +717,8 @@ func zlexer(s scanner.Scanner, c chan lex) {
 			}
 			// str += "\"" don't add quoted quotes
 			quote = !quote
+			quoted = true
+			space = false
 		case "(":
 			if commt {
 				break
@@ -507,6 +729,7 @@ func zlexer(s scanner.Scanner, c chan lex) {
 				break
 			}
 			brace++
+			start = false
 		case ")":
 			if commt {
 				break
@@ -519,6 +742,7 @@ func zlexer(s scanner.Scanner, c chan lex) {
 			brace--
 			if brace < 0 {
 				l.err = "Extra closing brace"
+				lr.err.Store(l)
 				c <- l
 				return
 			}
@@ -529,11 +753,19 @@ func zlexer(s scanner.Scanner, c chan lex) {
 			escape = false
 			str += x
 			space = false
+			start = false
 		}
 		tok = s.Scan()
 	}
+	if lr.exceeded() {
+		l.err = "Zone too large"
+		l.cause = &LimitError{"bytes", lr.lim.MaxBytes}
+		lr.err.Store(l)
+		c <- l
+		return
+	}
 	// Hmm.
-	if len(str) > 0 {
+	if len(str) > 0 || quoted {
 		// Send remainder
 		l.token = str
 		l.value = _STRING
@@ -543,7 +775,7 @@ func zlexer(s scanner.Scanner, c chan lex) {
 
 func stringToTtl(l lex, f string, t chan Token) (uint32, bool) {
 	if ttl, ok := strconv.Atoi(l.token); ok != nil {
-		t <- Token{Error: &ParseError{f, "Not a TTL", l}}
+		t <- Token{Error: &ParseError{f, "Not a TTL", l, ok}}
 		return 0, false
 	} else {
 		return uint32(ttl), true
@@ -1,6 +1,7 @@
 package dns
 
 import (
+	"encoding/hex"
 	"fmt"
 	"net"
 	"strconv"
@@ -51,12 +52,53 @@ func setRR(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 		return setNSEC3(h, c, o, f)
 	case TypeDS:
 		return setDS(h, c, f)
+	case TypeCDS:
+		return setCDS(h, c, f)
+	case TypeCDNSKEY:
+		return setCDNSKEY(h, c, f)
+	case TypeKEY:
+		return setKEY(h, c, f)
+	case TypeSIG:
+		return setSIG(h, c, o, f)
+	case TypeIPSECKEY:
+		return setIPSECKEY(h, c, o, f)
+	case TypeAMTRELAY:
+		return setAMTRELAY(h, c, o, f)
 	case TypeTXT:
 		return setTXT(h, c, f)
+	case TypeWKS:
+		return setWKS(h, c, f)
+	case TypeAFSDB:
+		return setAFSDB(h, c, o, f)
+	case TypeX25:
+		return setX25(h, c, f)
+	case TypeISDN:
+		return setISDN(h, c, f)
+	case TypeRT:
+		return setRT(h, c, o, f)
+	case TypeNSAP:
+		return setNSAP(h, c, f)
+	case TypePX:
+		return setPX(h, c, o, f)
+	case TypeGPOS:
+		return setGPOS(h, c, f)
+	case TypeNID:
+		return setNID(h, c, f)
+	case TypeL32:
+		return setL32(h, c, f)
+	case TypeL64:
+		return setL64(h, c, f)
+	case TypeLP:
+		return setLP(h, c, o, f)
 	default:
+		// Types without a parser can still be given in the RFC 3597
+		// representation
+		if l := <-c; l.token == "\\#" {
+			return setRFC3597(h, c, f)
+		}
 		// Don't the have the token the holds the RRtype, but we substitute that in the
 		// calling function when lex is empty.
-		return nil, &ParseError{f, "Unknown RR type", lex{}}
+		return nil, &ParseError{f, "Unknown RR type", lex{}, nil}
 	}
 Slurp:
 	if e != nil {
@@ -80,7 +122,7 @@ func slurpRemainder(c chan lex, f string) *ParseError {
 			fmt.Printf("%v\n", l)
 		}
 		if l.value != _NEWLINE && l.value != _EOF {
-			return &ParseError{f, "garbage after rdata", l}
+			return &ParseError{f, "garbage after rdata", l, nil}
 		}
 		// Ok
 	case _NEWLINE:
@@ -88,7 +130,7 @@ func slurpRemainder(c chan lex, f string) *ParseError {
 	case _EOF:
 		// Ok
 	default:
-		return &ParseError{f, "garbage after directly rdata", l}
+		return &ParseError{f, "garbage after directly rdata", l, nil}
 	}
 	return nil
 }
@@ -100,7 +142,7 @@ func setA(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 	l := <-c
 	rr.A = net.ParseIP(l.token)
 	if rr.A == nil {
-		return nil, &ParseError{f, "bad A", l}
+		return nil, &ParseError{f, "bad A", l, nil}
 	}
 	return rr, nil
 }
@@ -112,7 +154,7 @@ func setAAAA(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 	l := <-c
 	rr.AAAA = net.ParseIP(l.token)
 	if rr.AAAA == nil {
-		return nil, &ParseError{f, "bad AAAA", l}
+		return nil, &ParseError{f, "bad AAAA", l, nil}
 	}
 	return rr, nil
 }
@@ -123,12 +165,10 @@ func setNS(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 
 	l := <-c
 	rr.Ns = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad NS Ns", l}
-	}
-	if !IsFqdn(rr.Ns) {
-		rr.Ns += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad NS Ns", l, nil}
 	}
+	rr.Ns = appendOrigin(rr.Ns, o)
 	return rr, nil
 }
 
@@ -138,19 +178,17 @@ func setMX(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 
 	l := <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad MX Pref", l}
+		return nil, &ParseError{f, "bad MX Pref", l, e}
 	} else {
 		rr.Pref = uint16(i)
 	}
 	<-c     // _BLANK
 	l = <-c // _STRING
 	rr.Mx = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad MX Mx", l}
-	}
-	if !IsFqdn(rr.Mx) {
-		rr.Mx += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad MX Mx", l, nil}
 	}
+	rr.Mx = appendOrigin(rr.Mx, o)
 	return rr, nil
 }
 
@@ -160,12 +198,10 @@ func setCNAME(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 
 	l := <-c
 	rr.Cname = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad CNAME", l}
-	}
-	if !IsFqdn(rr.Cname) {
-		rr.Cname += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad CNAME", l, nil}
 	}
+	rr.Cname = appendOrigin(rr.Cname, o)
 	return rr, nil
 }
 
@@ -176,21 +212,17 @@ func setSOA(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 	l := <-c
 	rr.Ns = l.token
 	<-c // _BLANK
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad SOA mname", l}
-	}
-	if !IsFqdn(rr.Ns) {
-		rr.Ns += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad SOA mname", l, nil}
 	}
+	rr.Ns = appendOrigin(rr.Ns, o)
 
 	l = <-c
 	rr.Mbox = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad SOA rname", l}
-	}
-	if !IsFqdn(rr.Mbox) {
-		rr.Mbox += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad SOA rname", l, nil}
 	}
+	rr.Mbox = appendOrigin(rr.Mbox, o)
 	<-c // _BLANK
 
 	var j int
@@ -198,7 +230,7 @@ func setSOA(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 	for i := 0; i < 5; i++ {
 		l = <-c
 		if j, e = strconv.Atoi(l.token); e != nil {
-			return nil, &ParseError{f, "bad SOA zone parameter", l}
+			return nil, &ParseError{f, "bad SOA zone parameter", l, e}
 		}
 		switch i {
 		case 0:
@@ -224,62 +256,60 @@ func setRRSIG(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 	rr := new(RR_RRSIG)
 	rr.Hdr = h
 	l := <-c
-	if t, ok := Str_rr[strings.ToUpper(l.token)]; !ok {
-		return nil, &ParseError{f, "bad RRSIG", l}
+	if t, ok := StringToType(l.token); !ok {
+		return nil, &ParseError{f, "bad RRSIG", l, nil}
 	} else {
 		rr.TypeCovered = t
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, err := strconv.Atoi(l.token); err != nil {
-		return nil, &ParseError{f, "bad RRSIG", l}
+		return nil, &ParseError{f, "bad RRSIG", l, err}
 	} else {
 		rr.Algorithm = uint8(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, err := strconv.Atoi(l.token); err != nil {
-		return nil, &ParseError{f, "bad RRSIG", l}
+		return nil, &ParseError{f, "bad RRSIG", l, err}
 	} else {
 		rr.Labels = uint8(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, err := strconv.Atoi(l.token); err != nil {
-		return nil, &ParseError{f, "bad RRSIG", l}
+		return nil, &ParseError{f, "bad RRSIG", l, err}
 	} else {
 		rr.OrigTtl = uint32(i)
 	}
 	<-c // _BLANK
 	l = <-c
-	if i, err := dateToTime(l.token); err != nil {
-		return nil, &ParseError{f, "bad RRSIG expiration", l}
+	if i, err := DateToTime(l.token); err != nil {
+		return nil, &ParseError{f, "bad RRSIG expiration", l, err}
 	} else {
 		rr.Expiration = i
 	}
 	<-c // _BLANK
 	l = <-c
-	if i, err := dateToTime(l.token); err != nil {
-		return nil, &ParseError{f, "bad RRSIG inception", l}
+	if i, err := DateToTime(l.token); err != nil {
+		return nil, &ParseError{f, "bad RRSIG inception", l, err}
 	} else {
 		rr.Inception = i
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, err := strconv.Atoi(l.token); err != nil {
-		return nil, &ParseError{f, "bad RRSIG keytag", l}
+		return nil, &ParseError{f, "bad RRSIG keytag", l, err}
 	} else {
 		rr.KeyTag = uint16(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	rr.SignerName = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad RRSIG signername", l}
-	}
-	if !IsFqdn(rr.SignerName) {
-		rr.SignerName += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad RRSIG signername", l, nil}
 	}
+	rr.SignerName = appendOrigin(rr.SignerName, o)
 	// Get the remaining data until we see a NEWLINE
 	l = <-c
 	s := ""
@@ -290,7 +320,7 @@ func setRRSIG(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 		case _BLANK:
 			// Ok
 		default:
-			return nil, &ParseError{f, "bad RRSIG signature", l}
+			return nil, &ParseError{f, "bad RRSIG signature", l, nil}
 		}
 		l = <-c
 	}
@@ -304,12 +334,10 @@ func setNSEC(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 
 	l := <-c
 	rr.NextDomain = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad NSEC nextdomain", l}
-	}
-	if !IsFqdn(rr.NextDomain) {
-		rr.NextDomain += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad NSEC nextdomain", l, nil}
 	}
+	rr.NextDomain = appendOrigin(rr.NextDomain, o)
 
 	rr.TypeBitMap = make([]uint16, 0)
 	l = <-c
@@ -318,13 +346,13 @@ func setNSEC(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 		case _BLANK:
 			// Ok
 		case _STRING:
-			if k, ok := Str_rr[strings.ToUpper(l.token)]; !ok {
-				return nil, &ParseError{f, "bad NSEC non RR in type bitmap", l}
+			if k, ok := StringToType(l.token); !ok {
+				return nil, &ParseError{f, "bad NSEC non RR in type bitmap", l, nil}
 			} else {
 				rr.TypeBitMap = append(rr.TypeBitMap, k)
 			}
 		default:
-			return nil, &ParseError{f, "bad NSEC garbage in type bitmap", l}
+			return nil, &ParseError{f, "bad NSEC garbage in type bitmap", l, nil}
 		}
 		l = <-c
 	}
@@ -337,21 +365,21 @@ func setNSEC3(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 
 	l := <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad NSEC3", l}
+		return nil, &ParseError{f, "bad NSEC3", l, e}
 	} else {
 		rr.Hash = uint8(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad NSEC3", l}
+		return nil, &ParseError{f, "bad NSEC3", l, e}
 	} else {
 		rr.Flags = uint8(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad NSEC3", l}
+		return nil, &ParseError{f, "bad NSEC3", l, e}
 	} else {
 		rr.Iterations = uint16(i)
 	}
@@ -364,12 +392,10 @@ func setNSEC3(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 	l = <-c
 	rr.HashLength = uint8(len(l.token))
 	rr.NextDomain = l.token
-	if _, ok := IsDomainName(l.token); !ok {
-		return nil, &ParseError{f, "bad NSEC nextdomain", l}
-	}
-	if !IsFqdn(rr.NextDomain) {
-		rr.NextDomain += o
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad NSEC nextdomain", l, nil}
 	}
+	rr.NextDomain = appendOrigin(rr.NextDomain, o)
 
 	rr.TypeBitMap = make([]uint16, 0)
 	l = <-c
@@ -378,13 +404,13 @@ func setNSEC3(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
 		case _BLANK:
 			// Ok
 		case _STRING:
-			if k, ok := Str_rr[strings.ToUpper(l.token)]; !ok {
-				return nil, &ParseError{f, "bad NSEC3", l}
+			if k, ok := StringToType(l.token); !ok {
+				return nil, &ParseError{f, "bad NSEC3", l, nil}
 			} else {
 				rr.TypeBitMap = append(rr.TypeBitMap, k)
 			}
 		default:
-			return nil, &ParseError{f, "bad NSEC3", l}
+			return nil, &ParseError{f, "bad NSEC3", l, nil}
 		}
 		l = <-c
 	}
@@ -423,14 +449,14 @@ func setSSHFP(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 
 	l := <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad SSHFP", l}
+		return nil, &ParseError{f, "bad SSHFP", l, e}
 	} else {
 		rr.Algorithm = uint8(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad SSHFP", l}
+		return nil, &ParseError{f, "bad SSHFP", l, e}
 	} else {
 		rr.Type = uint8(i)
 	}
@@ -446,21 +472,21 @@ func setDNSKEY(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 
 	l := <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad DNSKEY", l}
+		return nil, &ParseError{f, "bad DNSKEY", l, e}
 	} else {
 		rr.Flags = uint16(i)
 	}
 	<-c     // _BLANK
 	l = <-c // _STRING
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad DNSKEY", l}
+		return nil, &ParseError{f, "bad DNSKEY", l, e}
 	} else {
 		rr.Protocol = uint8(i)
 	}
 	<-c     // _BLANK
 	l = <-c // _STRING
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad DNSKEY", l}
+		return nil, &ParseError{f, "bad DNSKEY", l, e}
 	} else {
 		rr.Algorithm = uint8(i)
 	}
@@ -473,7 +499,7 @@ func setDNSKEY(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 		case _BLANK:
 			// Ok
 		default:
-			return nil, &ParseError{f, "bad DNSKEY", l}
+			return nil, &ParseError{f, "bad DNSKEY", l, nil}
 		}
 		l = <-c
 	}
@@ -487,21 +513,21 @@ func setDS(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 	rr.Hdr = h
 	l := <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad DS", l}
+		return nil, &ParseError{f, "bad DS", l, e}
 	} else {
 		rr.KeyTag = uint16(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad DS", l}
+		return nil, &ParseError{f, "bad DS", l, e}
 	} else {
 		rr.Algorithm = uint8(i)
 	}
 	<-c // _BLANK
 	l = <-c
 	if i, e := strconv.Atoi(l.token); e != nil {
-		return nil, &ParseError{f, "bad DS", l}
+		return nil, &ParseError{f, "bad DS", l, e}
 	} else {
 		rr.DigestType = uint8(i)
 	}
@@ -515,7 +541,7 @@ func setDS(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 		case _BLANK:
 			// Ok
 		default:
-			return nil, &ParseError{f, "bad DS", l}
+			return nil, &ParseError{f, "bad DS", l, nil}
 		}
 		l = <-c
 	}
@@ -523,24 +549,566 @@ func setDS(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 	return rr, nil
 }
 
+func setCDS(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	r, e := setDS(h, c, f)
+	if e != nil {
+		return nil, e
+	}
+	ds := r.(*RR_DS)
+	return &RR_CDS{ds.Hdr, ds.KeyTag, ds.Algorithm, ds.DigestType, ds.Digest}, nil
+}
+
+func setCDNSKEY(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	r, e := setDNSKEY(h, c, f)
+	if e != nil {
+		return nil, e
+	}
+	k := r.(*RR_DNSKEY)
+	return &RR_CDNSKEY{k.Hdr, k.Flags, k.Protocol, k.Algorithm, k.PublicKey}, nil
+}
+
+func setKEY(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	r, e := setDNSKEY(h, c, f)
+	if e != nil {
+		return nil, e
+	}
+	k := r.(*RR_DNSKEY)
+	return &RR_KEY{k.Hdr, k.Flags, k.Protocol, k.Algorithm, k.PublicKey}, nil
+}
+
+func setSIG(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	r, e := setRRSIG(h, c, o, f)
+	if e != nil {
+		return nil, e
+	}
+	s := r.(*RR_RRSIG)
+	return &RR_SIG{s.Hdr, s.TypeCovered, s.Algorithm, s.Labels, s.OrigTtl,
+		s.Expiration, s.Inception, s.KeyTag, s.SignerName, s.Signature}, nil
+}
+
+func setIPSECKEY(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_IPSECKEY)
+	rr.Hdr = h
+	if i, e := strconv.Atoi(l.token); e != nil || i > 255 || i < 0 {
+		return nil, &ParseError{f, "bad IPSECKEY Precedence", l, e}
+	} else {
+		rr.Precedence = uint8(i)
+	}
+	<-c // _BLANK
+	l = <-c
+	if i, e := strconv.Atoi(l.token); e != nil || i > 3 || i < 0 {
+		return nil, &ParseError{f, "bad IPSECKEY GatewayType", l, e}
+	} else {
+		rr.GatewayType = uint8(i)
+	}
+	<-c // _BLANK
+	l = <-c
+	if i, e := strconv.Atoi(l.token); e != nil || i > 255 || i < 0 {
+		return nil, &ParseError{f, "bad IPSECKEY Algorithm", l, e}
+	} else {
+		rr.Algorithm = uint8(i)
+	}
+	<-c // _BLANK
+	l = <-c
+	g, ok := gateway(l.token, rr.GatewayType, o)
+	if !ok {
+		return nil, &ParseError{f, "bad IPSECKEY Gateway", l, nil}
+	}
+	rr.Gateway = g
+	// The public key is optional, get the remaining data until we
+	// see a NEWLINE
+	l = <-c
+	var k string
+	for l.value != _NEWLINE && l.value != _EOF {
+		switch l.value {
+		case _STRING:
+			k += l.token
+		case _BLANK:
+			// Ok
+		default:
+			return nil, &ParseError{f, "bad IPSECKEY PublicKey", l, nil}
+		}
+		l = <-c
+	}
+	rr.PublicKey = k
+	return rr, nil
+}
+
+func setAMTRELAY(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_AMTRELAY)
+	rr.Hdr = h
+	if i, e := strconv.Atoi(l.token); e != nil || i > 255 || i < 0 {
+		return nil, &ParseError{f, "bad AMTRELAY Precedence", l, e}
+	} else {
+		rr.Precedence = uint8(i)
+	}
+	<-c // _BLANK
+	l = <-c
+	switch l.token {
+	case "0":
+	case "1":
+		rr.RelayType = 0x80
+	default:
+		return nil, &ParseError{f, "bad AMTRELAY D bit", l, nil}
+	}
+	<-c // _BLANK
+	l = <-c
+	if i, e := strconv.Atoi(l.token); e != nil || i > 3 || i < 0 {
+		return nil, &ParseError{f, "bad AMTRELAY RelayType", l, e}
+	} else {
+		rr.RelayType |= uint8(i)
+	}
+	<-c // _BLANK
+	l = <-c
+	g, ok := gateway(l.token, rr.RelayType&0x7f, o)
+	if !ok {
+		return nil, &ParseError{f, "bad AMTRELAY Relay", l, nil}
+	}
+	rr.Relay = g
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+// gateway checks the gateway s of an IPSECKEY or AMTRELAY RR against its
+// type t and returns it in the form String uses.
+func gateway(s string, t uint8, o string) (string, bool) {
+	switch t {
+	case 0:
+		return s, s == "."
+	case 1:
+		if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+			return ip.String(), true
+		}
+	case 2:
+		if ip := net.ParseIP(s); ip != nil && ip.To4() == nil {
+			return ip.String(), true
+		}
+	case 3:
+		if isZoneName(s) {
+			return appendOrigin(s, o), true
+		}
+	}
+	return "", false
+}
+
 func setTXT(h RR_Header, c chan lex, f string) (RR, *ParseError) {
 	rr := new(RR_TXT)
 	rr.Hdr = h
 
-	// Get the remaining data until we see a NEWLINE
+	// Get the remaining data until we see a NEWLINE, each (quoted)
+	// string is a character-string, "" is an empty one
 	l := <-c
+	for l.value != _NEWLINE && l.value != _EOF {
+		switch l.value {
+		case _STRING:
+			rr.Txt = append(rr.Txt, unescapeLabel(l.token))
+		case _BLANK:
+		default:
+			return nil, &ParseError{f, "bad TXT", l, nil}
+		}
+		l = <-c
+	}
+	if len(rr.Txt) == 0 {
+		return nil, &ParseError{f, "bad TXT", l, nil}
+	}
+	return rr, nil
+}
+
+// The types below also accept the rdata in the unknown RR representation
+// of RFC 3597: \# <length> <hex data>.
+
+func setWKS(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_WKS)
+	rr.Hdr = h
+	if rr.Address = net.ParseIP(l.token).To4(); rr.Address == nil {
+		return nil, &ParseError{f, "bad WKS Address", l, nil}
+	}
+	<-c // _BLANK
+	l = <-c
+	proto := strings.ToLower(l.token)
+	switch proto {
+	case "tcp":
+		rr.Protocol = 6
+	case "udp":
+		rr.Protocol = 17
+	default:
+		i, e := strconv.Atoi(l.token)
+		if e != nil || i > 255 || i < 0 {
+			return nil, &ParseError{f, "bad WKS Protocol", l, e}
+		}
+		rr.Protocol = uint8(i)
+	}
+	// The services, by port number or by name
+	l = <-c
+	for l.value != _NEWLINE && l.value != _EOF {
+		switch l.value {
+		case _BLANK:
+		case _STRING:
+			p, e := strconv.Atoi(l.token)
+			if e != nil {
+				if p, e = net.LookupPort(proto, l.token); e != nil {
+					return nil, &ParseError{f, "bad WKS service", l, e}
+				}
+			}
+			if p < 0 || p > 65535 {
+				return nil, &ParseError{f, "bad WKS service", l, nil}
+			}
+			rr.BitMap = append(rr.BitMap, uint16(p))
+		default:
+			return nil, &ParseError{f, "bad WKS", l, nil}
+		}
+		l = <-c
+	}
+	return rr, nil
+}
+
+func setAFSDB(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_AFSDB)
+	rr.Hdr = h
+	if i, e := strconv.Atoi(l.token); e != nil || i > 65535 || i < 0 {
+		return nil, &ParseError{f, "bad AFSDB Subtype", l, e}
+	} else {
+		rr.Subtype = uint16(i)
+	}
+	<-c     // _BLANK
+	l = <-c // _STRING
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad AFSDB Hostname", l, nil}
+	}
+	rr.Hostname = appendOrigin(l.token, o)
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setX25(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_X25)
+	rr.Hdr = h
+	rr.PSDNAddress = l.token
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setISDN(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_ISDN)
+	rr.Hdr = h
+	rr.Address = l.token
+	l = <-c
+	if l.value == _BLANK {
+		l = <-c
+	}
+	if l.value == _STRING {
+		rr.SubAddress = l.token
+		if se := slurpRemainder(c, f); se != nil {
+			return nil, se
+		}
+		return rr, nil
+	}
+	if l.value != _NEWLINE && l.value != _EOF {
+		return nil, &ParseError{f, "garbage after rdata", l, nil}
+	}
+	return rr, nil
+}
+
+func setRT(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_RT)
+	rr.Hdr = h
+	if i, e := strconv.Atoi(l.token); e != nil || i > 65535 || i < 0 {
+		return nil, &ParseError{f, "bad RT Preference", l, e}
+	} else {
+		rr.Preference = uint16(i)
+	}
+	<-c     // _BLANK
+	l = <-c // _STRING
+	rr.Host = l.token
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad RT Host", l, nil}
+	}
+	rr.Host = appendOrigin(rr.Host, o)
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setNSAP(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_NSAP)
+	rr.Hdr = h
+	// The dots are only there for readability
+	a := strings.ToLower(strings.Replace(l.token, ".", "", -1))
+	if !strings.HasPrefix(a, "0x") || len(a) == 2 {
+		return nil, &ParseError{f, "bad NSAP Address", l, nil}
+	}
+	if _, e := hex.DecodeString(a[2:]); e != nil {
+		return nil, &ParseError{f, "bad NSAP Address", l, e}
+	}
+	rr.Address = a[2:]
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setPX(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_PX)
+	rr.Hdr = h
+	if i, e := strconv.Atoi(l.token); e != nil || i > 65535 || i < 0 {
+		return nil, &ParseError{f, "bad PX Preference", l, e}
+	} else {
+		rr.Preference = uint16(i)
+	}
+	<-c     // _BLANK
+	l = <-c // _STRING
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad PX Map822", l, nil}
+	}
+	rr.Map822 = appendOrigin(l.token, o)
+	<-c     // _BLANK
+	l = <-c // _STRING
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad PX Mapx400", l, nil}
+	}
+	rr.Mapx400 = appendOrigin(l.token, o)
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setGPOS(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_GPOS)
+	rr.Hdr = h
+	for i, p := range []*string{&rr.Longitude, &rr.Latitude, &rr.Altitude} {
+		if i > 0 {
+			<-c     // _BLANK
+			l = <-c // _STRING
+		}
+		if _, e := strconv.ParseFloat(l.token, 64); e != nil {
+			return nil, &ParseError{f, "bad GPOS", l, e}
+		}
+		*p = l.token
+	}
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setNID(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_NID)
+	rr.Hdr = h
+	pref, e := setILNPPreference(l, c, f)
+	if e != nil {
+		return nil, e
+	}
+	rr.Preference = pref
+	l = <-c
+	id, ok := ilnpValue(l.token)
+	if !ok {
+		return nil, &ParseError{f, "bad NID NodeID", l, nil}
+	}
+	rr.NodeID = id
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setL32(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_L32)
+	rr.Hdr = h
+	pref, e := setILNPPreference(l, c, f)
+	if e != nil {
+		return nil, e
+	}
+	rr.Preference = pref
+	l = <-c
+	if rr.Locator32 = net.ParseIP(l.token).To4(); rr.Locator32 == nil {
+		return nil, &ParseError{f, "bad L32 Locator", l, nil}
+	}
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setL64(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_L64)
+	rr.Hdr = h
+	pref, e := setILNPPreference(l, c, f)
+	if e != nil {
+		return nil, e
+	}
+	rr.Preference = pref
+	l = <-c
+	loc, ok := ilnpValue(l.token)
+	if !ok {
+		return nil, &ParseError{f, "bad L64 Locator", l, nil}
+	}
+	rr.Locator64 = loc
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+func setLP(h RR_Header, c chan lex, o, f string) (RR, *ParseError) {
+	l := <-c
+	if l.token == "\\#" {
+		return setRFC3597(h, c, f)
+	}
+	rr := new(RR_LP)
+	rr.Hdr = h
+	pref, e := setILNPPreference(l, c, f)
+	if e != nil {
+		return nil, e
+	}
+	rr.Preference = pref
+	l = <-c
+	rr.Fqdn = l.token
+	if !isZoneName(l.token) {
+		return nil, &ParseError{f, "bad LP Fqdn", l, nil}
+	}
+	rr.Fqdn = appendOrigin(rr.Fqdn, o)
+	if se := slurpRemainder(c, f); se != nil {
+		return nil, se
+	}
+	return rr, nil
+}
+
+// setILNPPreference parses the preference in l and reads the blank
+// following it.
+func setILNPPreference(l lex, c chan lex, f string) (uint16, *ParseError) {
+	i, e := strconv.Atoi(l.token)
+	if e != nil || i < 0 || i > 65535 {
+		return 0, &ParseError{f, "bad ILNP Preference", l, e}
+	}
+	<-c // _BLANK
+	return uint16(i), nil
+}
+
+// ilnpValue parses a node identifier or locator: four 16 bit hexadecimal
+// values separated by colons.
+func ilnpValue(s string) (uint64, bool) {
+	groups := strings.Split(s, ":")
+	if len(groups) != 4 {
+		return 0, false
+	}
+	var v uint64
+	for _, g := range groups {
+		if len(g) == 0 || len(g) > 4 {
+			return 0, false
+		}
+		i, e := strconv.ParseUint(g, 16, 16)
+		if e != nil {
+			return 0, false
+		}
+		v = v<<16 | i
+	}
+	return v, true
+}
+
+// setRFC3597 parses the rdata in the unknown RR representation, after the
+// \# token, and returns the RR of type h.Rrtype it holds.
+func setRFC3597(h RR_Header, c chan lex, f string) (RR, *ParseError) {
+	<-c // _BLANK
+	l := <-c
+	rdlength, e := strconv.Atoi(l.token)
+	if e != nil || rdlength < 0 || rdlength > 65535 {
+		return nil, &ParseError{f, "bad RFC 3597 rdata length", l, e}
+	}
 	var s string
+	l = <-c
 	for l.value != _NEWLINE && l.value != _EOF {
 		switch l.value {
 		case _STRING:
 			s += l.token
 		case _BLANK:
-			s += l.token
 		default:
-			return nil, &ParseError{f, "bad TXT", l}
+			return nil, &ParseError{f, "bad RFC 3597 rdata", l, nil}
 		}
 		l = <-c
 	}
-	rr.Txt = s
+	if len(s) != 2*rdlength {
+		return nil, &ParseError{f, "bad RFC 3597 rdata length", l, nil}
+	}
+	rr, ok := unknownToRR(&RR_RFC3597{Hdr: h, Rdata: s})
+	if !ok {
+		return nil, &ParseError{f, "bad RFC 3597 rdata", l, nil}
+	}
 	return rr, nil
 }
+
+// unknownToRR converts u to an RR of type u.Hdr.Rrtype, by packing and
+// unpacking it.
+func unknownToRR(u *RR_RFC3597) (RR, bool) {
+	buf := make([]byte, u.Len()*2+DefaultMsgSize)
+	off, ok := packRR(u, buf, 0, nil, false)
+	if !ok {
+		return nil, false
+	}
+	rr, end, ok := unpackRR(buf[:off], 0)
+	if _, hdr := rr.(*RR_Header); !ok || hdr || end != off {
+		// A header only means the rdata did not match the type
+		return nil, false
+	}
+	rr.Header().Rdlength = 0
+	return rr, true
+}